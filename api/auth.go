@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// publicRoutes are answered without an API key so probes and scrapers need no credentials
+var publicRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/version": true,
+	"/metrics": true,
+}
+
+// routeRoles is the role a route needs when it is not the role its method
+// needs, such as a POST that only reads or one that deletes
+var routeRoles = map[string]models.Role{
+	http.MethodPost + " /api/v1/pricing/quote":                        models.RoleReader,
+	http.MethodPost + " /api/v1/produce:batchDelete":                  models.RoleAdmin,
+	http.MethodPost + " /api/v1/produce/import":                       models.RoleAdmin,
+	http.MethodDelete + " /api/v1/carts/{cartID}/items/{productCode}": models.RoleEditor,
+}
+
+// WithKeyStore requires every request other than health checks, the version
+// and metrics to be sent with an API key of the key store whose role allows it
+func WithKeyStore(keyStore KeyStore) func(*Server) {
+	return func(s *Server) {
+		s.keyStore = keyStore
+	}
+}
+
+// requiredRole returns the role a request needs, or false when it needs no API key.
+// Reads need a reader, deletes need an admin and any other change needs an editor.
+func requiredRole(r *http.Request) (models.Role, bool) {
+	template := routeTemplate(r)
+	if publicRoutes[template] {
+		return "", false
+	}
+	if role, ok := routeRoles[r.Method+" "+template]; ok {
+		return role, true
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.RoleReader, true
+	case http.MethodDelete:
+		return models.RoleAdmin, true
+	default:
+		return models.RoleEditor, true
+	}
+}
+
+// authenticatedKey returns the API key a request was authenticated with, or
+// false when the server has no key store or the request needs no API key
+func authenticatedKey(r *http.Request) (models.APIKey, bool) {
+	apiKey, ok := r.Context().Value(apiKeyContextKey).(models.APIKey)
+	return apiKey, ok
+}
+
+// apiKeyFromRequest returns the API key sent as a bearer token or in X-API-Key
+func apiKeyFromRequest(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, ok := strings.Cut(authorization, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return r.Header.Get(apiKeyHeader)
+}
+
+// writeUnauthorized writes the problem of a request without a valid API key
+func writeUnauthorized(w http.ResponseWriter, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="supermarket"`)
+	writeProblem(w, http.StatusUnauthorized, models.ProblemUnauthorized, detail)
+}
+
+// authenticate is middleware that refuses a request with a 401 unless it is
+// sent with an API key that has not been revoked, and with a 403 unless the
+// role of the key allows the request. Every request is allowed when the server
+// has no key store.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required, ok := requiredRole(r)
+		if s.keyStore == nil || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := apiKeyFromRequest(r)
+		if key == "" {
+			writeUnauthorized(w, "an API key is required, sent as a bearer token in the Authorization header or in the "+apiKeyHeader+" header")
+			return
+		}
+
+		id, secret, ok := parseAPIKey(key)
+		if !ok {
+			writeUnauthorized(w, "invalid API key")
+			return
+		}
+		apiKey, err := s.keyStore.GetAPIKey(id)
+		switch {
+		case err == ErrAPIKeyNotFound || (err == nil && !verifyAPIKey(apiKey, secret)):
+			writeUnauthorized(w, "invalid API key")
+			return
+		case err != nil:
+			writeInternalError(w, err)
+			return
+		case apiKey.Revoked():
+			writeUnauthorized(w, "API key has been revoked")
+			return
+		}
+
+		if !apiKey.Role.Allows(required) {
+			writeProblem(w, http.StatusForbidden, models.ProblemForbidden, fmt.Sprintf("the %s role of API key %s cannot %s %s, it needs the %s role", apiKey.Role, apiKey.ID, r.Method, routeTemplate(r), required))
+			return
+		}
+
+		addLogFields(r, log.Fields{"apiKeyId": apiKey.ID})
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, apiKey)))
+	})
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keyFile := newTestKeyFile(t)
+	keys := map[models.Role]string{}
+	for _, role := range []models.Role{models.RoleReader, models.RoleEditor, models.RoleAdmin} {
+		_, key, err := keyFile.CreateAPIKey(string(role), role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[role] = key
+	}
+	revoked, revokedKey, err := keyFile.CreateAPIKey("revoked", models.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyFile.RevokeAPIKey(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	produce := `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header http.Header
+		want   int
+	}{
+		{name: "health without a key", method: http.MethodGet, path: "/healthz", want: http.StatusOK},
+		{name: "metrics without a key", method: http.MethodGet, path: "/metrics", want: http.StatusOK},
+		{name: "list without a key", method: http.MethodGet, path: "/api/v1/produce", want: http.StatusUnauthorized},
+		{name: "list with an invalid key", method: http.MethodGet, path: "/api/v1/produce", header: http.Header{"Authorization": {"Bearer not-a-key"}}, want: http.StatusUnauthorized},
+		{name: "list with a wrong secret", method: http.MethodGet, path: "/api/v1/produce", header: http.Header{"Authorization": {"Bearer " + keys[models.RoleAdmin] + "0"}}, want: http.StatusUnauthorized},
+		{name: "list with another scheme", method: http.MethodGet, path: "/api/v1/produce", header: http.Header{"Authorization": {"Basic " + keys[models.RoleAdmin]}}, want: http.StatusUnauthorized},
+		{name: "list with a revoked key", method: http.MethodGet, path: "/api/v1/produce", header: http.Header{"Authorization": {"Bearer " + revokedKey}}, want: http.StatusUnauthorized},
+		{name: "list as reader", method: http.MethodGet, path: "/api/v1/produce", header: http.Header{"Authorization": {"Bearer " + keys[models.RoleReader]}}, want: http.StatusOK},
+		{name: "list as reader in X-API-Key", method: http.MethodGet, path: "/api/v1/produce", header: http.Header{apiKeyHeader: {keys[models.RoleReader]}}, want: http.StatusOK},
+		{name: "quote as reader", method: http.MethodPost, path: "/api/v1/pricing/quote", body: `{"items":[]}`, header: http.Header{apiKeyHeader: {keys[models.RoleReader]}}, want: http.StatusOK},
+		{name: "create as reader", method: http.MethodPost, path: "/api/v1/produce", body: produce, header: http.Header{apiKeyHeader: {keys[models.RoleReader]}}, want: http.StatusForbidden},
+		{name: "create as editor", method: http.MethodPost, path: "/api/v1/produce", body: produce, header: http.Header{apiKeyHeader: {keys[models.RoleEditor]}}, want: http.StatusCreated},
+		{name: "import as editor", method: http.MethodPost, path: "/api/v1/produce/import", header: http.Header{apiKeyHeader: {keys[models.RoleEditor]}}, want: http.StatusForbidden},
+		{name: "delete as editor", method: http.MethodDelete, path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M", header: http.Header{apiKeyHeader: {keys[models.RoleEditor]}}, want: http.StatusForbidden},
+		{name: "batch delete as editor", method: http.MethodPost, path: "/api/v1/produce:batchDelete", body: `{"produceCodes":["A12T-4GH7-QPL9-3N4M"]}`, header: http.Header{apiKeyHeader: {keys[models.RoleEditor]}}, want: http.StatusForbidden},
+		{name: "delete as admin", method: http.MethodDelete, path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M", header: http.Header{apiKeyHeader: {keys[models.RoleAdmin]}}, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for name, values := range tt.header {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+
+			rr := httptest.NewRecorder()
+			NewServer(WithKeyStore(keyFile)).Handler().ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.want, rr.Body)
+			}
+
+			var wantType string
+			switch rr.Code {
+			case http.StatusUnauthorized:
+				wantType = models.ProblemUnauthorized
+				if rr.Header().Get("WWW-Authenticate") == "" {
+					t.Error("401 without a WWW-Authenticate header")
+				}
+			case http.StatusForbidden:
+				wantType = models.ProblemForbidden
+			default:
+				return
+			}
+			problem := models.Problem{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Type != wantType {
+				t.Errorf("wrong problem type: got %q want %q", problem.Type, wantType)
+			}
+		})
+	}
+}
+
+func TestAuthenticateWithoutKeyStore(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewServer().Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/produce/A12T-4GH7-QPL9-3N4M", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+}
+
+func TestAuthenticateLogsAPIKey(t *testing.T) {
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+
+	keyFile := newTestKeyFile(t)
+	apiKey, key, err := keyFile.CreateAPIKey("kiosk", models.RoleReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/produce", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	rr := httptest.NewRecorder()
+	NewServer(WithKeyStore(keyFile)).Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "handled request" {
+		t.Fatalf("request was not logged: %+v", hook.AllEntries())
+	}
+	if entry.Data["apiKeyId"] != apiKey.ID {
+		t.Errorf("wrong apiKeyId: got %v want %v", entry.Data["apiKeyId"], apiKey.ID)
+	}
+}
+
+func TestAuthenticatedActor(t *testing.T) {
+	keyFile := newTestKeyFile(t)
+	apiKey, key, err := keyFile.CreateAPIKey("kiosk", models.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewServer(WithKeyStore(keyFile)).Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/produce", strings.NewReader(`[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`))
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set(actorHeader, "mallory")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/produce/BEET-4GH7-QPL9-3N4M/prices", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var history []models.PriceChange
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	want := "kiosk (API key " + apiKey.ID + ")"
+	if len(history) != 1 || history[0].Actor != want {
+		t.Errorf("wrong actor in price history: got %+v want %q", history, want)
+	}
+}
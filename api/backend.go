@@ -0,0 +1,460 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// ErrProduceAlreadyExists is returned by a ProduceManager when a produce code is already in use
+var ErrProduceAlreadyExists = errors.New("produce already exists")
+
+// ErrProduceNotFound is returned by a ProduceManager when no produce has the requested produce code
+var ErrProduceNotFound = errors.New("produce not found")
+
+// ErrProduceVersionMismatch is returned by a ProduceManager when a produce is
+// changed or deleted on the condition of a version it no longer has
+var ErrProduceVersionMismatch = errors.New("produce has changed since the version given")
+
+// ErrPromotionAlreadyExists is returned by a PromotionManager when a promotion id is already in use
+var ErrPromotionAlreadyExists = errors.New("promotion already exists")
+
+// ErrPromotionNotFound is returned by a PromotionManager when no promotion has the requested id
+var ErrPromotionNotFound = errors.New("promotion not found")
+
+// BatchError is returned by CreateAllProduce when some produce of a batch
+// cannot be created. It maps the position of each such produce in the batch to
+// the reason it cannot be created. Nothing of the batch is stored.
+type BatchError map[int]error
+
+// Error lists the reason of every produce that cannot be created in batch order
+func (e BatchError) Error() string {
+	positions := make([]int, 0, len(e))
+	for i := range e {
+		positions = append(positions, i)
+	}
+	sort.Ints(positions)
+
+	reasons := make([]string, len(positions))
+	for i, position := range positions {
+		reasons[i] = fmt.Sprintf("produce %d: %s", position, e[position])
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// systemActor is the actor recorded for produce that was seeded or stored before its history was kept
+const systemActor = "system"
+
+// backend is the in memory implementation of ProduceManager and PromotionManager
+type backend struct {
+	data       map[string]models.Produce
+	history    map[string][]models.ProduceRevision
+	promotions map[string]models.Promotion
+	mutex      sync.RWMutex
+}
+
+func newBackend(data map[string]models.Produce) *backend {
+	b := &backend{
+		data:       data,
+		history:    map[string][]models.ProduceRevision{},
+		promotions: map[string]models.Promotion{},
+	}
+	b.backfillHistory(time.Now().UTC())
+	b.backfillVersions(time.Now().UTC())
+	return b
+}
+
+// ListProduce returns all produce in the backend matching the filter of the
+// query parameters in no particular order. When the query is as of a moment in time the catalog is rebuilt
+// from the history of every produce.
+func (b *backend) ListProduce(queryParams queryParameters) ([]models.Produce, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var produce []models.Produce
+	if queryParams.asOf != nil {
+		for _, revisions := range b.history {
+			if revision, ok := models.RevisionAt(revisions, *queryParams.asOf); ok && !revision.Deleted {
+				produce = append(produce, revision.Produce)
+			}
+		}
+	} else {
+		for _, val := range b.data {
+			produce = append(produce, val)
+		}
+	}
+
+	return filterProduce(produce, queryParams.filter), nil
+}
+
+// GetProduce returns the produce with the given produce code
+func (b *backend) GetProduce(produceCode models.ProduceCode) (models.Produce, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	produce, exists := b.data[string(produceCode)]
+	if !exists {
+		return models.Produce{}, ErrProduceNotFound
+	}
+
+	return produce, nil
+}
+
+// PriceHistory returns every unit price a produce has had, oldest first. The
+// history of a deleted produce is kept.
+func (b *backend) PriceHistory(produceCode models.ProduceCode) ([]models.PriceChange, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	revisions, exists := b.history[string(produceCode)]
+	if !exists {
+		return nil, ErrProduceNotFound
+	}
+
+	return models.PriceHistory(revisions), nil
+}
+
+// CreateProduce stores a new produce. The produce code is upper cased and the
+// unit price is rounded to the minor unit of its currency before it is stored.
+func (b *backend) CreateProduce(produce models.Produce, actor string) (models.Produce, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	newProduce, err := normalizeProduce(produce)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	if _, exists := b.data[newProduce.ProduceCode]; exists {
+		return models.Produce{}, ErrProduceAlreadyExists
+	}
+
+	// nothing can be reserved before the produce exists
+	newProduce.Reserved = 0
+	newProduce.Version = 1
+	newProduce.UpdatedAt = time.Now().UTC()
+
+	b.data[newProduce.ProduceCode] = newProduce
+	b.record(models.NewRevision(newProduce, false, actor, newProduce.UpdatedAt))
+
+	return newProduce, nil
+}
+
+// CreateAllProduce stores every new produce of a batch, or none of them when
+// any cannot be created, such as when its produce code is already in use or
+// appears earlier in the batch. Produce is stored the same way as CreateProduce.
+func (b *backend) CreateAllProduce(produce []models.Produce, actor string) ([]models.Produce, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	newProduce := make([]models.Produce, len(produce))
+	failed := BatchError{}
+	batch := map[string]bool{}
+	for i, val := range produce {
+		p, err := normalizeProduce(val)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+
+		if _, exists := b.data[p.ProduceCode]; exists || batch[p.ProduceCode] {
+			failed[i] = ErrProduceAlreadyExists
+			continue
+		}
+		batch[p.ProduceCode] = true
+
+		// nothing can be reserved before the produce exists
+		p.Reserved = 0
+		newProduce[i] = p
+	}
+
+	if len(failed) > 0 {
+		return nil, failed
+	}
+
+	changedAt := time.Now().UTC()
+	for i := range newProduce {
+		newProduce[i].Version = 1
+		newProduce[i].UpdatedAt = changedAt
+	}
+	for _, p := range newProduce {
+		b.data[p.ProduceCode] = p
+		b.record(models.NewRevision(p, false, actor, changedAt))
+	}
+
+	return newProduce, nil
+}
+
+// UpdateProduce replaces an existing produce. The unit price is rounded the
+// same way as CreateProduce and the stock on hand and reserved are kept. When
+// the produce has a version it is only replaced if the stored produce still
+// has that version.
+func (b *backend) UpdateProduce(produce models.Produce, actor string) (models.Produce, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	updatedProduce, err := normalizeProduce(produce)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	old, exists := b.data[updatedProduce.ProduceCode]
+	if !exists {
+		return models.Produce{}, ErrProduceNotFound
+	}
+
+	if updatedProduce.Version != 0 && updatedProduce.Version != old.Version {
+		return models.Produce{}, ErrProduceVersionMismatch
+	}
+
+	// stock counts only change through ChangeStock
+	updatedProduce.OnHand = old.OnHand
+	updatedProduce.Reserved = old.Reserved
+	updatedProduce.Version = old.Version + 1
+	updatedProduce.UpdatedAt = time.Now().UTC()
+
+	b.data[updatedProduce.ProduceCode] = updatedProduce
+	b.record(models.NewRevision(updatedProduce, false, actor, updatedProduce.UpdatedAt))
+
+	return updatedProduce, nil
+}
+
+// ChangeStock atomically applies a stock change to a produce
+func (b *backend) ChangeStock(produceCode models.ProduceCode, change models.StockChange) (models.Produce, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	produce, exists := b.data[string(produceCode)]
+	if !exists {
+		return models.Produce{}, ErrProduceNotFound
+	}
+
+	updatedProduce, err := produce.ApplyStockChange(change)
+	if err != nil {
+		return models.Produce{}, err
+	}
+	updatedProduce.Version++
+	updatedProduce.UpdatedAt = time.Now().UTC()
+
+	b.data[string(produceCode)] = updatedProduce
+
+	return updatedProduce, nil
+}
+
+// DeleteProduce removes a produce from the backend. When a version is given
+// the produce is only deleted if it still has that version.
+func (b *backend) DeleteProduce(produceCode models.ProduceCode, version int64, actor string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	produce, exists := b.data[string(produceCode)]
+	if !exists {
+		return ErrProduceNotFound
+	}
+
+	if version != 0 && version != produce.Version {
+		return ErrProduceVersionMismatch
+	}
+
+	delete(b.data, string(produceCode))
+	b.record(models.NewRevision(produce, true, actor, time.Now().UTC()))
+
+	return nil
+}
+
+// record appends a revision to the history of its produce. The caller must hold the mutex.
+func (b *backend) record(revision models.ProduceRevision) {
+	code := revision.Produce.ProduceCode
+	b.history[code] = append(b.history[code], revision)
+}
+
+// revert puts back the value a produce had before its last catalog change and
+// drops the revision the change recorded. A nil old value removes the produce.
+func (b *backend) revert(produceCode string, old *models.Produce) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if old == nil {
+		delete(b.data, string(produceCode))
+	} else {
+		b.data[string(produceCode)] = *old
+	}
+
+	if revisions := b.history[string(produceCode)]; len(revisions) > 1 {
+		b.history[string(produceCode)] = revisions[:len(revisions)-1]
+	} else {
+		delete(b.history, produceCode)
+	}
+}
+
+// backfillHistory records a revision by the system actor for every produce
+// without any history, such as the seeded inventory or produce stored before
+// history was kept
+func (b *backend) backfillHistory(at time.Time) {
+	for code, produce := range b.data {
+		if _, exists := b.history[code]; !exists {
+			b.record(models.NewRevision(produce, false, systemActor, at))
+		}
+	}
+}
+
+// backfillVersions gives every produce without a version, such as the seeded
+// inventory or produce stored before versions were kept, its first version
+func (b *backend) backfillVersions(at time.Time) {
+	for code, produce := range b.data {
+		if produce.Version == 0 {
+			produce.Version = 1
+			produce.UpdatedAt = at
+			b.data[code] = produce
+		}
+	}
+}
+
+// ListPromotions returns every promotion ordered by id
+func (b *backend) ListPromotions() ([]models.Promotion, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	promotions := make([]models.Promotion, 0, len(b.promotions))
+	for _, val := range b.promotions {
+		promotions = append(promotions, val)
+	}
+	sort.Slice(promotions, func(i, j int) bool { return promotions[i].ID < promotions[j].ID })
+
+	return promotions, nil
+}
+
+// GetPromotion returns the promotion with the given id
+func (b *backend) GetPromotion(id string) (models.Promotion, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	promotion, exists := b.promotions[id]
+	if !exists {
+		return models.Promotion{}, ErrPromotionNotFound
+	}
+
+	return promotion, nil
+}
+
+// CreatePromotion stores a new promotion
+func (b *backend) CreatePromotion(promotion models.Promotion) (models.Promotion, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.promotions[promotion.ID]; exists {
+		return models.Promotion{}, ErrPromotionAlreadyExists
+	}
+
+	b.promotions[promotion.ID] = promotion
+
+	return promotion, nil
+}
+
+// UpdatePromotion replaces an existing promotion
+func (b *backend) UpdatePromotion(promotion models.Promotion) (models.Promotion, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.promotions[promotion.ID]; !exists {
+		return models.Promotion{}, ErrPromotionNotFound
+	}
+
+	b.promotions[promotion.ID] = promotion
+
+	return promotion, nil
+}
+
+// DeletePromotion removes a promotion
+func (b *backend) DeletePromotion(id string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.promotions[id]; !exists {
+		return ErrPromotionNotFound
+	}
+
+	delete(b.promotions, id)
+
+	return nil
+}
+
+// historySnapshot returns a copy of the history of every produce
+func (b *backend) historySnapshot() []models.ProduceRevision {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var revisions []models.ProduceRevision
+	for _, val := range b.history {
+		revisions = append(revisions, val...)
+	}
+	return revisions
+}
+
+// snapshot returns a copy of every produce currently held by the backend
+func (b *backend) snapshot() []models.Produce {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	produce := make([]models.Produce, 0, len(b.data))
+	for _, val := range b.data {
+		produce = append(produce, val)
+	}
+	return produce
+}
+
+// normalizeProduce puts the produce code in its canonical form and rounds the
+// unit price to the minor unit of its currency. Prices sent without a currency
+// are in the default currency. An invalid produce code is an error.
+func normalizeProduce(produce models.Produce) (models.Produce, error) {
+	produceCode, err := models.ParseProduceCode(produce.ProduceCode)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	unitPrice := produce.UnitPrice
+	if unitPrice == (models.Money{}) {
+		unitPrice = models.NewMoney(0, models.DefaultCurrency)
+	}
+
+	unitPrice, err = unitPrice.Round(models.RoundHalfEven)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	produce.ProduceCode = produceCode.String()
+	produce.UnitPrice = unitPrice
+
+	return produce, nil
+}
+
+func initializeData() map[string]models.Produce {
+	data := map[string]models.Produce{
+		"A12T-4GH7-QPL9-3N4M": models.Produce{
+			Name:        "Lettuce",
+			ProduceCode: "A12T-4GH7-QPL9-3N4M",
+			UnitPrice:   models.NewMoney(346, models.USD),
+		},
+		"E5T6-9UI3-TH15-QR88": models.Produce{
+			Name:        "Peach",
+			ProduceCode: "E5T6-9UI3-TH15-QR88",
+			UnitPrice:   models.NewMoney(299, models.USD),
+		},
+		"YRT6-72AS-K736-L4AR": models.Produce{
+			Name:        "Green Pepper",
+			ProduceCode: "YRT6-72AS-K736-L4AR",
+			UnitPrice:   models.NewMoney(79, models.USD),
+		},
+		"TQ4C-VV6T-75ZX-1RMR": models.Produce{
+			Name:        "Gala Apple",
+			ProduceCode: "TQ4C-VV6T-75ZX-1RMR",
+			UnitPrice:   models.NewMoney(359, models.USD),
+		},
+	}
+	return data
+}
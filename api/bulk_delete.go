@@ -0,0 +1,180 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// batchDeleteRequest is the body of a bulk delete of produce by produce code
+type batchDeleteRequest struct {
+	ProduceCodes []string `json:"produceCodes"`
+}
+
+// errFilterRequired is returned for a delete by filter without any filter so the whole catalog is never deleted by mistake
+var errFilterRequired = errors.New("at least one of name_contains, name_prefix, produce_code, code_prefix, min_price or max_price is required")
+
+// BatchDeleteProduce is an API handlerFunc for deleting every produce listed by produce code
+func (s *Server) BatchDeleteProduce(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := parseBoolQueryParam(w, r, DRY_RUN)
+	if !ok {
+		return
+	}
+
+	request := batchDeleteRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+
+	if len(request.ProduceCodes) == 0 {
+		writeInvalidField(w, "produceCodes", models.ReasonRequired, "produceCodes must list at least one produce code")
+		return
+	}
+
+	produce := []models.Produce{}
+	failedProduce := []models.FailedProduce{}
+	requested := map[models.ProduceCode]bool{}
+	for _, code := range request.ProduceCodes {
+		produceCode, err := models.ParseProduceCode(code)
+		if err != nil {
+			failedProduce = append(failedProduce, models.NewFailedProduce(models.Produce{ProduceCode: code}, models.ReasonInvalidCodeFormat, err))
+			continue
+		}
+		if requested[produceCode] {
+			failedProduce = append(failedProduce, models.NewFailedProduce(models.Produce{ProduceCode: produceCode.String()}, models.ReasonDuplicateCode, fmt.Errorf("produce code %s appears more than once in the request", produceCode)))
+			continue
+		}
+		requested[produceCode] = true
+
+		current, err := s.produceManager.GetProduce(produceCode)
+		switch {
+		case err == ErrProduceNotFound:
+			failedProduce = append(failedProduce, models.NewFailedProduce(models.Produce{ProduceCode: produceCode.String()}, models.ReasonNotFound, err))
+		case err != nil:
+			writeInternalError(w, err)
+			return
+		default:
+			produce = append(produce, current)
+		}
+	}
+
+	writeDeleteProduceResponse(w, r, s.deleteAllProduce(produce, failedProduce, dryRun, actorFromRequest(r)))
+}
+
+// DeleteMatchingProduce is an API handlerFunc for deleting every produce
+// matching the filter query parameters. A dry run lists the produce along with
+// a confirm token and the produce is only deleted when the token is sent back,
+// so what is deleted is exactly what the dry run listed.
+func (s *Server) DeleteMatchingProduce(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := parseBoolQueryParam(w, r, DRY_RUN)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter, invalid := parseProduceFilter(query)
+	if len(invalid) > 0 {
+		writeInvalidRequest(w, invalid)
+		return
+	}
+	if filter == (produceFilter{}) {
+		writeInvalidRequest(w, errFilterRequired)
+		return
+	}
+
+	produce, err := s.produceManager.ListProduce(queryParameters{filter: filter})
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	produce = sortProduce(produce, queryParameters{sortBy: QUERY_PARAM_PRODUCE_CODE})
+	token := deleteConfirmToken(produce)
+
+	if dryRun {
+		response := s.deleteAllProduce(produce, []models.FailedProduce{}, true, actorFromRequest(r))
+		response.Confirm = token
+		writeDeleteProduceResponse(w, r, response)
+		return
+	}
+
+	switch confirm := query.Get(CONFIRM); {
+	case confirm == "":
+		writeInvalidField(w, CONFIRM, models.ReasonRequired, "confirm must be the token returned by a dry_run of the same delete")
+		return
+	case confirm != token:
+		writeProblem(w, http.StatusPreconditionFailed, models.ProblemPreconditionFailed, "produce matching the filter has changed since the dry_run that returned the confirm token")
+		return
+	}
+
+	writeDeleteProduceResponse(w, r, s.deleteAllProduce(produce, []models.FailedProduce{}, false, actorFromRequest(r)))
+}
+
+// deleteAllProduce deletes each produce as it was read, leaving produce that
+// has changed since in place and reporting it. Nothing is deleted in a dry run.
+func (s *Server) deleteAllProduce(produce []models.Produce, failedProduce []models.FailedProduce, dryRun bool, actor string) models.DeleteProduceResponse {
+	response := models.DeleteProduceResponse{
+		Deleted: []models.Produce{},
+		Invalid: failedProduce,
+		DryRun:  dryRun,
+	}
+
+	if dryRun {
+		response.Deleted = append(response.Deleted, produce...)
+		return response
+	}
+
+	for _, val := range produce {
+		// the produce was read from the backend so its produce code is canonical
+		if err := s.produceManager.DeleteProduce(models.ProduceCode(val.ProduceCode), val.Version, actor); err != nil {
+			response.Invalid = append(response.Invalid, models.NewFailedProduce(val, deleteFailureReason(err), err))
+			continue
+		}
+		response.Deleted = append(response.Deleted, val)
+	}
+
+	return response
+}
+
+// deleteFailureReason returns the machine readable reason a backend could not delete a produce
+func deleteFailureReason(err error) string {
+	switch err {
+	case ErrProduceNotFound:
+		return models.ReasonNotFound
+	case ErrProduceVersionMismatch:
+		return models.ReasonChanged
+	default:
+		return models.ReasonInternal
+	}
+}
+
+// deleteConfirmToken identifies the produce a delete by filter removes, including
+// the version of each produce, so the token changes when any of it changes
+func deleteConfirmToken(produce []models.Produce) string {
+	h := sha256.New()
+	for _, val := range produce {
+		fmt.Fprintf(h, "%s@%d\n", val.ProduceCode, val.Version)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// writeDeleteProduceResponse writes the response to a bulk delete with the
+// same statuses as a bulk create
+func writeDeleteProduceResponse(w http.ResponseWriter, r *http.Request, response models.DeleteProduceResponse) {
+	status := http.StatusOK
+	switch {
+	case len(response.Invalid) > 0 && len(response.Deleted) > 0:
+		status = http.StatusMultiStatus
+	case len(response.Invalid) > 0 && len(response.Deleted) == 0:
+		status = http.StatusBadRequest
+	}
+
+	writeVersioned(w, r, status, response, func() interface{} {
+		return response.V2()
+	})
+}
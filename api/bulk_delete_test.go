@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func decodeDeleteProduceResponse(t *testing.T, body []byte) models.DeleteProduceResponse {
+	response := models.DeleteProduceResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("failed to decode delete response %s: %v", body, err)
+	}
+	return response
+}
+
+func TestBatchDeleteProduce(t *testing.T) {
+	body := `{"produceCodes":["a12t-4gh7-qpl9-3n4m","E5T6-9UI3-TH15-QR88","ZZZZ-ZZZZ-ZZZZ-ZZZZ","bad","A12T-4GH7-QPL9-3N4M"]}`
+
+	for name, newManager := range historyTestBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			manager, closeManager := newManager()
+			defer closeManager()
+			s := NewServer(WithProduceManager(manager))
+
+			rr := serveRequest(s, http.MethodPost, "/api/v1/produce:batchDelete?dry_run=true", actorHeader, "alice", body)
+			if rr.Code != http.StatusMultiStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMultiStatus)
+			}
+			if response := decodeDeleteProduceResponse(t, rr.Body.Bytes()); !response.DryRun || len(response.Deleted) != 2 {
+				t.Errorf("unexpected dry run response %s", rr.Body.String())
+			}
+			if _, err := manager.GetProduce("A12T-4GH7-QPL9-3N4M"); err != nil {
+				t.Errorf("dry run deleted produce: %v", err)
+			}
+
+			rr = serveRequest(s, http.MethodPost, "/api/v1/produce:batchDelete", actorHeader, "alice", body)
+			if rr.Code != http.StatusMultiStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMultiStatus)
+			}
+
+			response := decodeDeleteProduceResponse(t, rr.Body.Bytes())
+			if response.DryRun {
+				t.Error("delete response is marked as a dry run")
+			}
+
+			deleted := map[string]bool{}
+			for _, val := range response.Deleted {
+				deleted[val.ProduceCode] = true
+			}
+			for _, code := range []models.ProduceCode{"A12T-4GH7-QPL9-3N4M", "E5T6-9UI3-TH15-QR88"} {
+				if !deleted[code.String()] {
+					t.Errorf("produce %s is not listed as deleted in %s", code, rr.Body.String())
+				}
+				if _, err := manager.GetProduce(code); err != ErrProduceNotFound {
+					t.Errorf("unexpected error getting deleted produce %s got %v want %v", code, err, ErrProduceNotFound)
+				}
+			}
+
+			wantReasons := []string{models.ReasonNotFound, models.ReasonInvalidCodeFormat, models.ReasonDuplicateCode}
+			if len(response.Invalid) != len(wantReasons) {
+				t.Fatalf("unexpected failed produce got %v want reasons %v", response.Invalid, wantReasons)
+			}
+			for i, reason := range wantReasons {
+				if response.Invalid[i].Reason != reason {
+					t.Errorf("unexpected reason of failed produce %d got %v want %v", i, response.Invalid[i].Reason, reason)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchDeleteProduceInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{name: "malformed body", path: "/api/v1/produce:batchDelete", body: `["A12T-4GH7-QPL9-3N4M"]`, want: http.StatusBadRequest},
+		{name: "no produce codes", path: "/api/v1/produce:batchDelete", body: `{"produceCodes":[]}`, want: http.StatusBadRequest},
+		{name: "invalid dry run", path: "/api/v1/produce:batchDelete?dry_run=maybe", body: `{"produceCodes":["A12T-4GH7-QPL9-3N4M"]}`, want: http.StatusBadRequest},
+		{name: "nothing deleted", path: "/api/v1/produce:batchDelete", body: `{"produceCodes":["ZZZZ-ZZZZ-ZZZZ-ZZZZ"]}`, want: http.StatusBadRequest},
+		{name: "everything deleted", path: "/api/v1/produce:batchDelete", body: `{"produceCodes":["A12T-4GH7-QPL9-3N4M"]}`, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveRequest(NewServer(), http.MethodPost, tt.path, "", "", tt.body)
+			if rr.Code != tt.want {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteMatchingProduce(t *testing.T) {
+	s := NewServer()
+
+	rr := serveRequest(s, http.MethodDelete, "/api/v1/produce", "", "", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code without a filter: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = serveRequest(s, http.MethodDelete, "/api/v1/produce?max_price=3.00", "", "", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code without confirm: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = serveRequest(s, http.MethodDelete, "/api/v1/produce?max_price=3.00&dry_run=true", "", "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code for dry run: got %v want %v", rr.Code, http.StatusOK)
+	}
+	dryRun := decodeDeleteProduceResponse(t, rr.Body.Bytes())
+	if !dryRun.DryRun || dryRun.Confirm == "" || len(dryRun.Deleted) != 2 {
+		t.Fatalf("unexpected dry run response %s", rr.Body.String())
+	}
+
+	rr = serveRequest(s, http.MethodDelete, "/api/v1/produce?max_price=3.00&confirm=wrong", "", "", "")
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("handler returned wrong status code for wrong confirm: got %v want %v", rr.Code, http.StatusPreconditionFailed)
+	}
+
+	// a change to produce the dry run listed makes its token stale
+	rr = serveRequest(s, http.MethodPatch, "/api/v1/produce/E5T6-9UI3-TH15-QR88", "", "", `{"name":"White Peach"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = serveRequest(s, http.MethodDelete, "/api/v1/produce?max_price=3.00&confirm="+dryRun.Confirm, "", "", "")
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("handler returned wrong status code for stale confirm: got %v want %v", rr.Code, http.StatusPreconditionFailed)
+	}
+
+	rr = serveRequest(s, http.MethodDelete, "/api/v1/produce?max_price=3.00&dry_run=true", "", "", "")
+	dryRun = decodeDeleteProduceResponse(t, rr.Body.Bytes())
+
+	rr = serveRequest(s, http.MethodDelete, "/api/v1/produce?max_price=3.00&confirm="+dryRun.Confirm, "", "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if response := decodeDeleteProduceResponse(t, rr.Body.Bytes()); len(response.Deleted) != 2 || response.DryRun {
+		t.Errorf("unexpected delete response %s", rr.Body.String())
+	}
+
+	produce, err := s.produceManager.ListProduce(queryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(produce) != len(initializeData())-2 {
+		t.Errorf("unexpected produce count after delete got %d want %d", len(produce), len(initializeData())-2)
+	}
+}
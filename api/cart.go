@@ -0,0 +1,259 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// ErrCartProduceNotFound is returned when a produce in a cart has been removed from the catalog
+var ErrCartProduceNotFound = errors.New("produce in the cart is no longer in the catalog")
+
+// ErrCartEmpty is returned when a cart without any items is checked out
+var ErrCartEmpty = errors.New("cannot check out an empty cart")
+
+// CreateCart is an API handlerFunc for starting a new empty cart
+func (s *Server) CreateCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := s.cartManager.CreateCart()
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	s.writePricedCart(w, http.StatusCreated, cart)
+}
+
+// GetCart is an API handlerFunc for fetching a cart priced at the current unit prices
+func (s *Server) GetCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := s.cartManager.GetCart(mux.Vars(r)["cartID"])
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	s.writePricedCart(w, http.StatusOK, cart)
+}
+
+// AddCartItem is an API handlerFunc for adding a quantity of produce to a cart,
+// e.g. {"produceCode": "A12T-4GH7-QPL9-3N4M", "quantity": 2}
+func (s *Server) AddCartItem(w http.ResponseWriter, r *http.Request) {
+	item := models.CartItem{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+
+	if _, ok := s.checkCartItem(w, &item); !ok {
+		return
+	}
+
+	// the item is only added when the cart can still be priced and checked
+	// out with it, so a quantity too large to price never gets stuck in the cart
+	cart, err := s.cartManager.AddCartItem(mux.Vars(r)["cartID"], item, func(cart models.Cart) error {
+		_, err := s.receipt(cart, time.Now().UTC())
+		return err
+	})
+	switch err {
+	case nil:
+	case ErrCartQuantityOutOfRange, models.ErrAmountOutOfRange:
+		writeInvalidField(w, "quantity", models.ReasonInvalidValue, err.Error())
+		return
+	default:
+		writeCartError(w, err)
+		return
+	}
+
+	s.writePricedCart(w, http.StatusOK, cart)
+}
+
+// checkCartItem upper cases the produce code of an item and checks the produce
+// exists and can be sold in the quantity. If the item is invalid an error is
+// written and false is returned.
+func (s *Server) checkCartItem(w http.ResponseWriter, item *models.CartItem) (models.Produce, bool) {
+	produceCode, err := models.ParseProduceCode(item.ProduceCode)
+	if err != nil {
+		writeInvalidField(w, "produceCode", models.ReasonInvalidCodeFormat, err.Error())
+		return models.Produce{}, false
+	}
+	item.ProduceCode = produceCode.String()
+
+	if item.Quantity <= 0 {
+		writeInvalidField(w, "quantity", models.ReasonInvalidValue, "quantity must be greater than zero")
+		return models.Produce{}, false
+	}
+
+	produce, err := s.produceManager.GetProduce(produceCode)
+	if err != nil {
+		writeProduceManagerError(w, err)
+		return models.Produce{}, false
+	}
+
+	if produce.UnitOfMeasure.OrDefault() == models.Each && !item.Quantity.IsWhole() {
+		writeInvalidField(w, "quantity", models.ReasonInvalidValue, models.ErrFractionalQuantity.Error())
+		return models.Produce{}, false
+	}
+
+	return produce, true
+}
+
+// RemoveCartItem is an API handlerFunc for removing produce from a cart. The
+// optional quantity query parameter removes only part of the item.
+func (s *Server) RemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	produceCode, ok := produceCodeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	item := models.CartItem{ProduceCode: produceCode.String()}
+	if quantity := r.URL.Query().Get("quantity"); quantity != "" {
+		q, err := models.ParseQuantity(quantity)
+		if err != nil {
+			writeInvalidField(w, "quantity", models.ReasonInvalidValue, err.Error())
+			return
+		}
+		if q <= 0 {
+			writeInvalidField(w, "quantity", models.ReasonInvalidValue, "quantity must be greater than zero")
+			return
+		}
+		item.Quantity = q
+	}
+
+	cart, err := s.cartManager.RemoveCartItem(mux.Vars(r)["cartID"], item)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	s.writePricedCart(w, http.StatusOK, cart)
+}
+
+// CheckoutCart is an API handlerFunc for checking out a cart. The prices of the
+// items are frozen, sales tax is charged and the itemized receipt is returned.
+func (s *Server) CheckoutCart(w http.ResponseWriter, r *http.Request) {
+	receipt, err := s.cartManager.CheckoutCart(mux.Vars(r)["cartID"], func(cart models.Cart) (models.Receipt, error) {
+		if len(cart.Items) == 0 {
+			return models.Receipt{}, ErrCartEmpty
+		}
+
+		return s.receipt(cart, time.Now().UTC())
+	})
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, receipt)
+}
+
+// receipt prices the items of a cart at the current unit prices and applies
+// the promotions valid and the sales tax charged at a moment in time
+func (s *Server) receipt(cart models.Cart, at time.Time) (models.Receipt, error) {
+	lines, err := s.priceCartItems(cart.Items)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	quote, err := s.quote(lines, at)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	return models.NewReceipt(cart.ID, quote, s.salesTaxRate, at)
+}
+
+// GetReceipt is an API handlerFunc for fetching the receipt of a checked out cart
+func (s *Server) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	cart, err := s.cartManager.GetCart(mux.Vars(r)["cartID"])
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	if cart.Receipt == nil {
+		writeProblem(w, http.StatusNotFound, models.ProblemNotFound, "cart has not been checked out")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cart.Receipt)
+}
+
+// writePricedCart writes a cart with its items priced at the current unit
+// prices. A checked out cart is priced from its receipt instead.
+func (s *Server) writePricedCart(w http.ResponseWriter, status int, cart models.Cart) {
+	lines := []models.LineItem{}
+	if cart.Receipt != nil {
+		lines = cart.Receipt.LineItems()
+	} else {
+		var err error
+		if lines, err = s.priceCartItems(cart.Items); err != nil {
+			writeCartError(w, err)
+			return
+		}
+	}
+
+	subtotal, err := models.Subtotal(lines)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeJSON(w, status, models.PricedCart{
+		ID:        cart.ID,
+		Status:    cart.Status,
+		Items:     lines,
+		Subtotal:  subtotal,
+		Currency:  subtotal.Currency(),
+		CreatedAt: cart.CreatedAt,
+	})
+}
+
+// priceCartItems prices every item at the current unit price of its produce
+func (s *Server) priceCartItems(items []models.CartItem) ([]models.LineItem, error) {
+	lines := make([]models.LineItem, 0, len(items))
+	for _, item := range items {
+		// items are only added with a canonical produce code
+		produce, err := s.produceManager.GetProduce(models.ProduceCode(item.ProduceCode))
+		if err == ErrProduceNotFound {
+			return nil, ErrCartProduceNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, err := models.NewLineItem(produce, item.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func writeCartError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrCartNotFound, ErrCartItemNotFound:
+		writeProblem(w, http.StatusNotFound, models.ProblemNotFound, err.Error())
+	case ErrCartEmpty:
+		writeProblem(w, http.StatusBadRequest, models.ProblemInvalidRequest, err.Error())
+	case ErrCartCheckedOut, ErrCartProduceNotFound, models.ErrCurrencyMismatch:
+		writeProblem(w, http.StatusConflict, models.ProblemConflict, err.Error())
+	default:
+		writeInternalError(w, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// ErrCartNotFound is returned by a CartManager when no cart has the requested id
+var ErrCartNotFound = errors.New("cart not found")
+
+// ErrCartCheckedOut is returned by a CartManager when a cart that has been checked out is changed
+var ErrCartCheckedOut = errors.New("cart has already been checked out")
+
+// ErrCartQuantityOutOfRange is returned by a CartManager when adding to an item would take its quantity beyond the largest that can be held
+var ErrCartQuantityOutOfRange = errors.New("quantity in the cart would be beyond the largest quantity that can be held")
+
+// ErrCartItemNotFound is returned by a CartManager when a produce is removed from a cart that does not hold it
+var ErrCartItemNotFound = errors.New("produce is not in the cart")
+
+// CartManager is the interface between the API and the storage of carts
+type CartManager interface {
+	CreateCart() (models.Cart, error)
+	GetCart(string) (models.Cart, error)
+	// AddCartItem stores the cart with the item added only when check accepts it
+	AddCartItem(string, models.CartItem, func(models.Cart) error) (models.Cart, error)
+	RemoveCartItem(string, models.CartItem) (models.Cart, error)
+	CheckoutCart(string, func(models.Cart) (models.Receipt, error)) (models.Receipt, error)
+}
+
+// cartBackend is the in memory implementation of CartManager
+type cartBackend struct {
+	carts map[string]models.Cart
+	mutex sync.RWMutex
+}
+
+func newCartBackend() *cartBackend {
+	return &cartBackend{
+		carts: map[string]models.Cart{},
+	}
+}
+
+// CreateCart stores a new empty cart with a random id
+func (c *cartBackend) CreateCart() (models.Cart, error) {
+	id, err := newID()
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	cart := models.Cart{
+		ID:        id,
+		Status:    models.CartOpen,
+		Items:     []models.CartItem{},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.carts[id] = cart
+
+	return cart, nil
+}
+
+// GetCart returns the cart with the given id
+func (c *cartBackend) GetCart(id string) (models.Cart, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	cart, exists := c.carts[id]
+	if !exists {
+		return models.Cart{}, ErrCartNotFound
+	}
+
+	return cart, nil
+}
+
+// AddCartItem adds a quantity of produce to an open cart. Adding a produce
+// already in the cart increases its quantity. The cart with the item added is
+// only stored when check returns no error, which is then returned instead.
+func (c *cartBackend) AddCartItem(id string, item models.CartItem, check func(models.Cart) error) (models.Cart, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cart, err := c.openCart(id)
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	items := make([]models.CartItem, 0, len(cart.Items)+1)
+	added := false
+	for _, existing := range cart.Items {
+		if existing.ProduceCode == item.ProduceCode {
+			quantity, ok := existing.Quantity.Add(item.Quantity)
+			if !ok {
+				return models.Cart{}, ErrCartQuantityOutOfRange
+			}
+			existing.Quantity = quantity
+			added = true
+		}
+		items = append(items, existing)
+	}
+	if !added {
+		items = append(items, item)
+	}
+
+	cart.Items = items
+	if err := check(cart); err != nil {
+		return models.Cart{}, err
+	}
+	c.carts[id] = cart
+
+	return cart, nil
+}
+
+// RemoveCartItem removes a quantity of produce from an open cart. The item is
+// removed entirely when the quantity is zero or at least the quantity in the cart.
+func (c *cartBackend) RemoveCartItem(id string, item models.CartItem) (models.Cart, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cart, err := c.openCart(id)
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	items := make([]models.CartItem, 0, len(cart.Items))
+	removed := false
+	for _, existing := range cart.Items {
+		if existing.ProduceCode == item.ProduceCode {
+			removed = true
+			if item.Quantity == 0 || item.Quantity >= existing.Quantity {
+				continue
+			}
+			existing.Quantity -= item.Quantity
+		}
+		items = append(items, existing)
+	}
+	if !removed {
+		return models.Cart{}, ErrCartItemNotFound
+	}
+
+	cart.Items = items
+	c.carts[id] = cart
+
+	return cart, nil
+}
+
+// CheckoutCart closes an open cart with the receipt built by checkout. The cart
+// is locked while the receipt is built so no item can change underneath it.
+func (c *cartBackend) CheckoutCart(id string, checkout func(models.Cart) (models.Receipt, error)) (models.Receipt, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cart, err := c.openCart(id)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	receipt, err := checkout(cart)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	cart.Status = models.CartCheckedOut
+	cart.Receipt = &receipt
+	c.carts[id] = cart
+
+	return receipt, nil
+}
+
+// openCart returns a cart that can still be changed. The caller must hold the mutex.
+func (c *cartBackend) openCart(id string) (models.Cart, error) {
+	cart, exists := c.carts[id]
+	if !exists {
+		return models.Cart{}, ErrCartNotFound
+	}
+
+	if cart.Status != models.CartOpen {
+		return models.Cart{}, ErrCartCheckedOut
+	}
+
+	return cart, nil
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func newTestCart(t *testing.T, s *Server) string {
+	rr := serveRequest(s, http.MethodPost, "/api/v1/carts", "", "", "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create cart returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	cart := models.PricedCart{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &cart); err != nil {
+		t.Fatal(err)
+	}
+	return cart.ID
+}
+
+func TestCartCheckout(t *testing.T) {
+	rate, err := models.ParseTaxRate("0.0825")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(WithSalesTaxRate(rate))
+	cartID := newTestCart(t, s)
+	cartPath := "/api/v1/carts/" + cartID
+
+	for _, body := range []string{
+		`{"produceCode":"a12t-4gh7-qpl9-3n4m","quantity":2}`,
+		`{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":1}`,
+		`{"produceCode":"TQ4C-VV6T-75ZX-1RMR","quantity":4}`,
+	} {
+		if rr := serveRequest(s, http.MethodPost, cartPath+"/items", "", "", body); rr.Code != http.StatusOK {
+			t.Fatalf("add %s returned wrong status code: got %v want %v: %s", body, rr.Code, http.StatusOK, rr.Body)
+		}
+	}
+
+	if rr := serveRequest(s, http.MethodDelete, cartPath+"/items/TQ4C-VV6T-75ZX-1RMR?quantity=2", "", "", ""); rr.Code != http.StatusOK {
+		t.Fatalf("remove returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// the subtotal follows the catalog until checkout
+	if rr := serveRequest(s, http.MethodPatch, "/api/v1/produce/A12T-4GH7-QPL9-3N4M", "", "", `{"unitPrice":3}`); rr.Code != http.StatusOK {
+		t.Fatalf("patch returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr := serveRequest(s, http.MethodGet, cartPath, "", "", "")
+	cart := models.PricedCart{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &cart); err != nil {
+		t.Fatal(err)
+	}
+	// 3 x 3.00 + 2 x 3.59
+	if want := models.NewMoney(1618, models.USD); cart.Subtotal.Cmp(want) != 0 {
+		t.Errorf("unexpected subtotal got %v want %v", cart.Subtotal, want)
+	}
+
+	rr = serveRequest(s, http.MethodPost, cartPath+"/checkout", "", "", "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("checkout returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	receipt := models.Receipt{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &receipt); err != nil {
+		t.Fatal(err)
+	}
+	// 16.18 * 0.0825 = 1.33485 which rounds to 1.33
+	if want := models.NewMoney(133, models.USD); receipt.Tax.Cmp(want) != 0 {
+		t.Errorf("unexpected tax got %v want %v", receipt.Tax, want)
+	}
+	if want := models.NewMoney(1751, models.USD); receipt.Total.Cmp(want) != 0 {
+		t.Errorf("unexpected total got %v want %v", receipt.Total, want)
+	}
+
+	// prices are frozen at checkout
+	serveRequest(s, http.MethodPatch, "/api/v1/produce/A12T-4GH7-QPL9-3N4M", "", "", `{"unitPrice":10}`)
+	rr = serveRequest(s, http.MethodGet, cartPath+"/receipt", "", "", "")
+	frozen := models.Receipt{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &frozen); err != nil {
+		t.Fatal(err)
+	}
+	if frozen.Total.Cmp(receipt.Total) != 0 {
+		t.Errorf("receipt total changed after checkout got %v want %v", frozen.Total, receipt.Total)
+	}
+
+	if rr := serveRequest(s, http.MethodPost, cartPath+"/checkout", "", "", ""); rr.Code != http.StatusConflict {
+		t.Errorf("second checkout returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if rr := serveRequest(s, http.MethodPost, cartPath+"/items", "", "", `{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":1}`); rr.Code != http.StatusConflict {
+		t.Errorf("add after checkout returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestCartErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "unknown cart", method: http.MethodGet, path: "/api/v1/carts/missing", wantStatus: http.StatusNotFound},
+		{name: "add unknown produce", method: http.MethodPost, path: "/items", body: `{"produceCode":"XX1X-4GH7-QPL9-3N4M","quantity":1}`, wantStatus: http.StatusNotFound},
+		{name: "add invalid produce code", method: http.MethodPost, path: "/items", body: `{"produceCode":"invalid","quantity":1}`, wantStatus: http.StatusBadRequest},
+		{name: "add zero quantity", method: http.MethodPost, path: "/items", body: `{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":0}`, wantStatus: http.StatusBadRequest},
+		{name: "add fraction of produce sold each", method: http.MethodPost, path: "/items", body: `{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":0.5}`, wantStatus: http.StatusBadRequest},
+		{name: "remove produce not in cart", method: http.MethodDelete, path: "/items/A12T-4GH7-QPL9-3N4M", wantStatus: http.StatusNotFound},
+		{name: "checkout empty cart", method: http.MethodPost, path: "/checkout", wantStatus: http.StatusBadRequest},
+		{name: "receipt before checkout", method: http.MethodGet, path: "/receipt", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			// paths that are not absolute are relative to a new cart
+			path := tt.path
+			if !strings.HasPrefix(path, "/api/") {
+				path = "/api/v1/carts/" + newTestCart(t, s) + path
+			}
+
+			rr := serveRequest(s, tt.method, path, "", "", tt.body)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCartItemOutOfRange(t *testing.T) {
+	s := NewServer()
+	cartPath := "/api/v1/carts/" + newTestCart(t, s)
+
+	// the quantity fits but its line total does not, as in a quote
+	rr := serveRequest(s, http.MethodPost, cartPath+"/items", "", "", `{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":9000000000000000}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusBadRequest, rr.Body)
+	}
+	problem := models.Problem{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "quantity" || problem.Errors[0].Reason != models.ReasonInvalidValue {
+		t.Errorf("wrong problem: %+v", problem)
+	}
+
+	// the cart is left as it was and can still be priced and checked out
+	if rr := serveRequest(s, http.MethodPost, cartPath+"/items", "", "", `{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":1}`); rr.Code != http.StatusOK {
+		t.Fatalf("add returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	rr = serveRequest(s, http.MethodGet, cartPath, "", "", "")
+	cart := models.PricedCart{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &cart); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || len(cart.Items) != 1 || cart.Items[0].Quantity != models.NewQuantity(1) {
+		t.Errorf("wrong cart after a refused item: %v %+v", rr.Code, cart)
+	}
+	if rr := serveRequest(s, http.MethodPost, cartPath+"/checkout", "", "", ""); rr.Code != http.StatusCreated {
+		t.Errorf("checkout returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+}
+
+func TestCartBackendAddCartItem(t *testing.T) {
+	c := newCartBackend()
+	cart, err := c.CreateCart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accept := func(models.Cart) error { return nil }
+
+	item := models.CartItem{ProduceCode: "A12T-4GH7-QPL9-3N4M", Quantity: models.Quantity(math.MaxInt64 - 7)}
+	if _, err := c.AddCartItem(cart.ID, item, accept); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddCartItem(cart.ID, models.CartItem{ProduceCode: item.ProduceCode, Quantity: 8}, accept); err != ErrCartQuantityOutOfRange {
+		t.Errorf("wrong error adding beyond the largest quantity: got %v want %v", err, ErrCartQuantityOutOfRange)
+	}
+
+	refused := errors.New("refused")
+	if _, err := c.AddCartItem(cart.ID, models.CartItem{ProduceCode: "E5T6-9UI3-TH15-QR88", Quantity: 1}, func(models.Cart) error { return refused }); err != refused {
+		t.Errorf("wrong error of a refused item: got %v want %v", err, refused)
+	}
+
+	got, err := c.GetCart(cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Items) != 1 || got.Items[0] != item {
+		t.Errorf("refused items were stored: %+v", got.Items)
+	}
+}
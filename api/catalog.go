@@ -0,0 +1,428 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+const (
+	// mediaTypeCSV is the media type of a catalog exported or imported as comma separated values
+	mediaTypeCSV = "text/csv"
+	// mediaTypeNDJSON is the media type of a catalog exported or imported as one JSON produce per line
+	mediaTypeNDJSON = "application/x-ndjson"
+
+	// maxImportLineLength is the longest line of a newline delimited JSON import
+	maxImportLineLength = 1 << 20
+)
+
+// How an import handles a row with a produce code already in the catalog
+const (
+	duplicateSkip      = "skip"
+	duplicateOverwrite = "overwrite"
+	duplicateFail      = "fail"
+)
+
+// The columns of a CSV catalog in the order they are exported. An import may
+// give them in any order and matches their names case insensitively.
+const (
+	columnProduceCode      = "produceCode"
+	columnName             = "name"
+	columnUnitPrice        = "unitPrice"
+	columnCurrency         = "currency"
+	columnCategory         = "category"
+	columnUnitOfMeasure    = "unitOfMeasure"
+	columnOnHand           = "onHand"
+	columnReserved         = "reserved"
+	columnReorderThreshold = "reorderThreshold"
+)
+
+var csvColumns = []string{
+	columnProduceCode,
+	columnName,
+	columnUnitPrice,
+	columnCurrency,
+	columnCategory,
+	columnUnitOfMeasure,
+	columnOnHand,
+	columnReserved,
+	columnReorderThreshold,
+}
+
+// requiredCSVColumns must be in the header of every CSV import
+var requiredCSVColumns = []string{columnProduceCode, columnName, columnUnitPrice}
+
+// ExportProduce is an API handlerFunc for streaming the catalog sorted by
+// produce code as CSV or newline delimited JSON, chosen by the Accept header.
+// The filter query parameters of a listing narrow what is exported.
+func (s *Server) ExportProduce(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := exportMediaType(r)
+	if !ok {
+		writeProblem(w, http.StatusNotAcceptable, models.ProblemNotAcceptable, "the catalog can only be exported as "+mediaTypeCSV+" or "+mediaTypeNDJSON)
+		return
+	}
+
+	filter, invalid := parseProduceFilter(r.URL.Query())
+	if len(invalid) > 0 {
+		writeInvalidRequest(w, invalid)
+		return
+	}
+
+	produce, err := s.produceManager.ListProduce(queryParameters{filter: filter})
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	produce = sortProduce(produce, queryParameters{sortBy: QUERY_PARAM_PRODUCE_CODE})
+
+	extension := "csv"
+	if mediaType == mediaTypeNDJSON {
+		extension = "ndjson"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"produce.%s\"", extension))
+	w.WriteHeader(http.StatusOK)
+
+	if mediaType == mediaTypeNDJSON {
+		err = writeProduceNDJSON(w, produce)
+	} else {
+		err = writeProduceCSV(w, produce)
+	}
+	if err != nil {
+		// the status has already been sent so the client only sees a short export
+		requestLogger(r).WithError(err).Error("failed to export produce")
+	}
+}
+
+// exportMediaType returns the media type of the export the client accepts,
+// which is CSV unless it only accepts newline delimited JSON. False is
+// returned when the client accepts neither.
+func exportMediaType(r *http.Request) (string, bool) {
+	accepts := r.Header["Accept"]
+	if len(accepts) == 0 {
+		return mediaTypeCSV, true
+	}
+
+	for _, accept := range accepts {
+		for _, mediaType := range strings.Split(accept, ",") {
+			switch strings.ToLower(strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0])) {
+			case mediaTypeCSV, "text/*", "*/*", "":
+				return mediaTypeCSV, true
+			case mediaTypeNDJSON, "application/ndjson":
+				return mediaTypeNDJSON, true
+			}
+		}
+	}
+	return "", false
+}
+
+// writeProduceCSV writes a header and then one row per produce
+func writeProduceCSV(w io.Writer, produce []models.Produce) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+
+	for _, p := range produce {
+		err := writer.Write([]string{
+			p.ProduceCode,
+			p.Name,
+			p.UnitPrice.String(),
+			p.UnitPrice.Currency(),
+			p.Category,
+			string(p.UnitOfMeasure),
+			p.OnHand.String(),
+			p.Reserved.String(),
+			p.ReorderThreshold.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeProduceNDJSON writes the version 2 representation of each produce on
+// its own line so prices keep their exact amount and currency
+func writeProduceNDJSON(w io.Writer, produce []models.Produce) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for _, p := range produce {
+		if err := encoder.Encode(p.V2()); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+// ImportProduce is an API handlerFunc for creating produce from a CSV or
+// newline delimited JSON body, chosen by the Content-Type header. The body is
+// read one row at a time and every row that cannot be imported is reported by
+// its row number while the other rows are still imported. The on_duplicate
+// query parameter says whether a produce code already in the catalog is
+// skipped, overwritten or fails its row, which is the default.
+func (s *Server) ImportProduce(w http.ResponseWriter, r *http.Request) {
+	onDuplicate := strings.ToLower(r.URL.Query().Get(ON_DUPLICATE))
+	switch onDuplicate {
+	case "":
+		onDuplicate = duplicateFail
+	case duplicateSkip, duplicateOverwrite, duplicateFail:
+	default:
+		writeInvalidField(w, ON_DUPLICATE, models.ReasonInvalidValue, ON_DUPLICATE+" must be one of skip, overwrite or fail")
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var rows produceRowReader
+	switch {
+	case err == nil && mediaType == mediaTypeCSV:
+		rows, err = newCSVProduceReader(r.Body)
+		if err != nil {
+			writeMalformedBody(w, err)
+			return
+		}
+	case err == nil && (mediaType == mediaTypeNDJSON || mediaType == "application/ndjson"):
+		rows = newNDJSONProduceReader(r.Body)
+	default:
+		writeProblem(w, http.StatusUnsupportedMediaType, models.ProblemUnsupportedMediaType, "the catalog can only be imported from "+mediaTypeCSV+" or "+mediaTypeNDJSON)
+		return
+	}
+
+	response := models.ImportProduceResponse{Invalid: []models.ImportRowError{}}
+	imported := map[models.ProduceCode]bool{}
+	actor := actorFromRequest(r)
+	for {
+		row, produce, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if rowErr, ok := err.(rowError); ok {
+			response.Invalid = append(response.Invalid, models.NewImportRowError(row, produce.ProduceCode, rowErr.reason, rowErr.err))
+			continue
+		}
+		if err != nil {
+			// the rows before the one that could not be read stay imported
+			writeMalformedBody(w, fmt.Errorf("failed to read the import: %w", err))
+			return
+		}
+
+		s.importRow(&response, imported, row, produce, onDuplicate, actor)
+	}
+
+	status := http.StatusOK
+	switch {
+	case len(response.Invalid) > 0 && response.Created+response.Updated+response.Skipped > 0:
+		status = http.StatusMultiStatus
+	case len(response.Invalid) > 0:
+		status = http.StatusBadRequest
+	}
+
+	writeJSON(w, status, response)
+}
+
+// importRow creates the produce of a row, or skips or overwrites it as
+// onDuplicate says when its produce code is already in the catalog, and counts
+// the outcome in the response. A produce code that appeared earlier in the
+// import is a duplicate whatever onDuplicate says.
+func (s *Server) importRow(response *models.ImportProduceResponse, imported map[models.ProduceCode]bool, row int, produce models.Produce, onDuplicate, actor string) {
+	fail := func(reason string, err error) {
+		response.Invalid = append(response.Invalid, models.NewImportRowError(row, produce.ProduceCode, reason, err))
+	}
+
+	if produceCode, err := models.ParseProduceCode(produce.ProduceCode); err == nil {
+		if imported[produceCode] {
+			fail(models.ReasonDuplicateCode, fmt.Errorf("produce code %s appears more than once in the import", produceCode))
+			return
+		}
+		imported[produceCode] = true
+	}
+
+	if reason, err := s.checkNewProduce(produce); err != nil {
+		fail(reason, err)
+		return
+	}
+
+	_, err := s.produceManager.CreateProduce(produce, actor)
+	switch {
+	case err == nil:
+		response.Created++
+	case err != ErrProduceAlreadyExists:
+		fail(createFailureReason(err), err)
+	case onDuplicate == duplicateSkip:
+		response.Skipped++
+	case onDuplicate == duplicateOverwrite:
+		// the produce is replaced as by a PUT so its stock is kept
+		if _, err := s.produceManager.UpdateProduce(produce, actor); err != nil {
+			fail(createFailureReason(err), err)
+			return
+		}
+		response.Updated++
+	default:
+		fail(models.ReasonDuplicateCode, err)
+	}
+}
+
+// produceRowReader reads the produce of an import one row at a time
+type produceRowReader interface {
+	// next returns the number and produce of the next row, or io.EOF after the
+	// last row. A row that cannot be read into a produce is a rowError and
+	// reading can go on with the next row, while any other error ends the import.
+	next() (int, models.Produce, error)
+}
+
+// rowError is a row of an import that cannot be read into a produce
+type rowError struct {
+	reason string
+	err    error
+}
+
+func (e rowError) Error() string {
+	return e.err.Error()
+}
+
+// csvProduceReader reads produce from a CSV with a header naming its columns
+type csvProduceReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+// newCSVProduceReader reads the header of a CSV import. A header without the
+// required columns or with a column that is not part of a produce is an error.
+func newCSVProduceReader(r io.Reader) (*csvProduceReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the CSV has no header")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		// a spreadsheet may start the file with a byte order mark
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		for _, column := range csvColumns {
+			if strings.EqualFold(name, column) {
+				columns[i] = column
+			}
+		}
+
+		switch {
+		case columns[i] == "":
+			return nil, fmt.Errorf("unknown column %q, columns must be among %s", name, strings.Join(csvColumns, ", "))
+		case seen[columns[i]]:
+			return nil, fmt.Errorf("column %q appears more than once", name)
+		}
+		seen[columns[i]] = true
+	}
+
+	for _, column := range requiredCSVColumns {
+		if !seen[column] {
+			return nil, fmt.Errorf("the CSV header must have a %s column", column)
+		}
+	}
+
+	return &csvProduceReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvProduceReader) next() (int, models.Produce, error) {
+	record, err := c.reader.Read()
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		return parseErr.StartLine, models.Produce{}, rowError{reason: models.ReasonMalformedRow, err: parseErr.Err}
+	}
+	if err != nil {
+		return 0, models.Produce{}, err
+	}
+	row, _ := c.reader.FieldPos(0)
+
+	values := map[string]string{}
+	for i, column := range c.columns {
+		values[column] = strings.TrimSpace(record[i])
+	}
+
+	produce := models.Produce{
+		ProduceCode:   values[columnProduceCode],
+		Name:          values[columnName],
+		Category:      values[columnCategory],
+		UnitOfMeasure: models.UnitOfMeasure(values[columnUnitOfMeasure]),
+	}
+
+	currency := values[columnCurrency]
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	if price := values[columnUnitPrice]; price != "" {
+		produce.UnitPrice, err = models.ParseMoney(price, currency)
+		if err != nil {
+			return row, produce, rowError{reason: models.ReasonInvalidPrice, err: err}
+		}
+	}
+
+	// the reserved column is exported for reference but stock is only reserved by carts
+	for _, quantity := range []struct {
+		column string
+		value  *models.Quantity
+	}{
+		{columnOnHand, &produce.OnHand},
+		{columnReorderThreshold, &produce.ReorderThreshold},
+	} {
+		value := values[quantity.column]
+		if value == "" {
+			continue
+		}
+
+		*quantity.value, err = models.ParseQuantity(value)
+		if err != nil {
+			return row, produce, rowError{reason: models.ReasonInvalidStock, err: fmt.Errorf("invalid %s %q", quantity.column, value)}
+		}
+	}
+
+	return row, produce, nil
+}
+
+// ndjsonProduceReader reads produce written as one JSON object per line in
+// either representation. Blank lines are skipped.
+type ndjsonProduceReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONProduceReader(r io.Reader) *ndjsonProduceReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxImportLineLength)
+	return &ndjsonProduceReader{scanner: scanner}
+}
+
+func (n *ndjsonProduceReader) next() (int, models.Produce, error) {
+	for n.scanner.Scan() {
+		n.line++
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var produce models.Produce
+		if err := json.Unmarshal(line, &produce); err != nil {
+			return n.line, produce, rowError{reason: models.ReasonMalformedRow, err: err}
+		}
+		return n.line, produce, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		return 0, models.Produce{}, err
+	}
+	return 0, models.Produce{}, io.EOF
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func TestExportProduce(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			name:        "csv by default",
+			path:        "/api/v1/produce/export?code_prefix=a12t",
+			status:      http.StatusOK,
+			contentType: mediaTypeCSV,
+			body:        "produceCode,name,unitPrice,currency,category,unitOfMeasure,onHand,reserved,reorderThreshold\nA12T-4GH7-QPL9-3N4M,Lettuce,3.46,USD,,,0,0,0\n",
+		},
+		{
+			name:        "csv sorted by produce code",
+			path:        "/api/v1/produce/export?min_price=3",
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: mediaTypeCSV,
+			body:        "produceCode,name,unitPrice,currency,category,unitOfMeasure,onHand,reserved,reorderThreshold\nA12T-4GH7-QPL9-3N4M,Lettuce,3.46,USD,,,0,0,0\nTQ4C-VV6T-75ZX-1RMR,Gala Apple,3.59,USD,,,0,0,0\n",
+		},
+		{
+			name:        "ndjson",
+			path:        "/api/v1/produce/export?code_prefix=a12t",
+			accept:      "application/x-ndjson",
+			status:      http.StatusOK,
+			contentType: mediaTypeNDJSON,
+			body:        `{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":{"amount":"3.46","currency":"USD"}}` + "\n",
+		},
+		{
+			name:        "unacceptable",
+			path:        "/api/v1/produce/export",
+			accept:      "application/xml",
+			status:      http.StatusNotAcceptable,
+			contentType: mediaTypeProblem,
+		},
+		{
+			name:        "invalid filter",
+			path:        "/api/v1/produce/export?min_price=cheap",
+			status:      http.StatusBadRequest,
+			contentType: mediaTypeProblem,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := ""
+			if tt.accept != "" {
+				header = "Accept"
+			}
+
+			rr := serveRequest(NewServer(), http.MethodGet, tt.path, header, tt.accept, "")
+			if rr.Code != tt.status {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.status)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("handler returned wrong content type: got %v want %v", got, tt.contentType)
+			}
+			if tt.body != "" && rr.Body.String() != tt.body {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestImportProduce(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		status      int
+		want        models.ImportProduceResponse
+	}{
+		{
+			name:        "csv",
+			contentType: "text/csv; charset=utf-8",
+			body: "\ufeffProduceCode,Name,UnitPrice,Category,onHand\n" +
+				"beet-4gh7-qpl9-3n4m,Beet,1.25,vegetable,10\n" +
+				"LEEK-4GH7-QPL9-3N4M,Leek,\"2.50\",,\n",
+			status: http.StatusOK,
+			want:   models.ImportProduceResponse{Created: 2, Invalid: []models.ImportRowError{}},
+		},
+		{
+			name:        "csv row errors",
+			contentType: "text/csv",
+			body: "produceCode,name,unitPrice\n" +
+				"BEET-4GH7-QPL9-3N4M,Beet,1.25\n" +
+				"bad,Kale,1.00\n" +
+				"KALE-4GH7-QPL9-3N4M,Kale,free\n" +
+				"KALE-4GH7-QPL9-3N4M,Kale\n" +
+				"beet-4gh7-qpl9-3n4m,Beet,1.25\n" +
+				"A12T-4GH7-QPL9-3N4M,Lettuce,3.46\n",
+			status: http.StatusMultiStatus,
+			want: models.ImportProduceResponse{Created: 1, Invalid: []models.ImportRowError{
+				{Row: 3, ProduceCode: "bad", Reason: models.ReasonInvalidCodeFormat},
+				{Row: 4, ProduceCode: "KALE-4GH7-QPL9-3N4M", Reason: models.ReasonInvalidPrice},
+				{Row: 5, Reason: models.ReasonMalformedRow},
+				{Row: 6, ProduceCode: "beet-4gh7-qpl9-3n4m", Reason: models.ReasonDuplicateCode},
+				{Row: 7, ProduceCode: "A12T-4GH7-QPL9-3N4M", Reason: models.ReasonDuplicateCode},
+			}},
+		},
+		{
+			name:        "skip duplicates",
+			query:       "?on_duplicate=skip",
+			contentType: "text/csv",
+			body:        "produceCode,name,unitPrice\nA12T-4GH7-QPL9-3N4M,Romaine,4.00\nBEET-4GH7-QPL9-3N4M,Beet,1.25\n",
+			status:      http.StatusOK,
+			want:        models.ImportProduceResponse{Created: 1, Skipped: 1, Invalid: []models.ImportRowError{}},
+		},
+		{
+			name:        "overwrite duplicates",
+			query:       "?on_duplicate=overwrite",
+			contentType: "application/x-ndjson",
+			body: `{"produceCode":"A12T-4GH7-QPL9-3N4M","name":"Romaine","unitPrice":{"amount":"4.00","currency":"USD"}}` + "\n\n" +
+				`{"produceCode":"BEET-4GH7-QPL9-3N4M","name":"Beet","unitPrice":1.25}` + "\n" +
+				`{"produceCode":` + "\n",
+			status: http.StatusMultiStatus,
+			want: models.ImportProduceResponse{Created: 1, Updated: 1, Invalid: []models.ImportRowError{
+				{Row: 4, Reason: models.ReasonMalformedRow},
+			}},
+		},
+		{
+			name:        "nothing imported",
+			contentType: "application/x-ndjson",
+			body:        `{"produceCode":"A12T-4GH7-QPL9-3N4M","name":"Romaine","unitPrice":4}`,
+			status:      http.StatusBadRequest,
+			want: models.ImportProduceResponse{Invalid: []models.ImportRowError{
+				{Row: 1, ProduceCode: "A12T-4GH7-QPL9-3N4M", Reason: models.ReasonDuplicateCode},
+			}},
+		},
+		{
+			name:        "unknown column",
+			contentType: "text/csv",
+			body:        "produceCode,name,unitPrice,color\n",
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "missing column",
+			contentType: "text/csv",
+			body:        "produceCode,name\n",
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "unsupported media type",
+			contentType: "application/json",
+			body:        "[]",
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "invalid on_duplicate",
+			query:       "?on_duplicate=merge",
+			contentType: "text/csv",
+			body:        "produceCode,name,unitPrice\n",
+			status:      http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveRequest(NewServer(), http.MethodPost, "/api/v1/produce/import"+tt.query, "Content-Type", tt.contentType, tt.body)
+			if rr.Code != tt.status {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.want.Invalid == nil {
+				return
+			}
+
+			got := models.ImportProduceResponse{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode import response %s: %v", rr.Body.String(), err)
+			}
+			// the detail is meant for people so only the machine readable parts are compared
+			for i := range got.Invalid {
+				got.Invalid[i].Detail = ""
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("handler returned unexpected body: got %+v want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportExportedProduce(t *testing.T) {
+	for name, newManager := range historyTestBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			manager, closeManager := newManager()
+			defer closeManager()
+			s := NewServer(WithProduceManager(manager))
+
+			for _, mediaType := range []string{mediaTypeCSV, mediaTypeNDJSON} {
+				exported := serveRequest(s, http.MethodGet, "/api/v1/produce/export", "Accept", mediaType, "")
+				if exported.Code != http.StatusOK {
+					t.Fatalf("export returned wrong status code: got %v want %v", exported.Code, http.StatusOK)
+				}
+
+				body := strings.Replace(exported.Body.String(), "Lettuce", "Romaine", 1)
+				rr := serveRequest(s, http.MethodPost, "/api/v1/produce/import?on_duplicate=overwrite", "Content-Type", mediaType, body)
+				if rr.Code != http.StatusOK {
+					t.Fatalf("import returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+				}
+
+				want := models.ImportProduceResponse{Updated: len(initializeData()), Invalid: []models.ImportRowError{}}
+				got := models.ImportProduceResponse{}
+				if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || !reflect.DeepEqual(got, want) {
+					t.Errorf("unexpected import of %s export got %s want %+v", mediaType, rr.Body.String(), want)
+				}
+
+				if p, err := manager.GetProduce("A12T-4GH7-QPL9-3N4M"); err != nil || p.Name != "Romaine" {
+					t.Errorf("produce was not overwritten by the import got %+v, %v", p, err)
+				}
+			}
+		})
+	}
+}
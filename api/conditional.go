@@ -0,0 +1,106 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// produceETag returns the entity tag of a produce, which changes with its version
+func produceETag(produce models.Produce) string {
+	return `"` + strconv.FormatInt(produce.Version, 10) + `"`
+}
+
+// contentETag returns an entity tag derived from the content of a response,
+// used for responses such as a produce listing that have no version of their own
+func contentETag(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// setProduceValidators sets the ETag and Last-Modified headers of a produce response
+func setProduceValidators(w http.ResponseWriter, produce models.Produce) {
+	w.Header().Set("ETag", produceETag(produce))
+	if !produce.UpdatedAt.IsZero() {
+		w.Header().Set("Last-Modified", produce.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists an
+// entity tag or is *. Weak comparison ignores a W/ prefix while strong
+// comparison, which If-Match uses, never matches a weak entity tag.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether a read can be answered with 304 Not Modified.
+// If-None-Match takes precedence over If-Modified-Since, which is only
+// evaluated when the response has a last modified time.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag, true)
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ifModifiedSince)
+		// Last-Modified only has a precision of seconds
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
+
+// checkIfMatch evaluates the If-Match header of a write to a produce. It
+// returns the version the write must be made on the condition of, which is 0
+// without an If-Match header. When the condition already fails the problem is
+// written and false is returned.
+func (s *Server) checkIfMatch(w http.ResponseWriter, r *http.Request, produceCode models.ProduceCode) (int64, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return 0, true
+	}
+
+	current, err := s.produceManager.GetProduce(produceCode)
+	switch {
+	case err == ErrProduceNotFound:
+		writePreconditionFailed(w)
+		return 0, false
+	case err != nil:
+		writeProduceManagerError(w, err)
+		return 0, false
+	case !etagMatches(ifMatch, produceETag(current), false):
+		writePreconditionFailed(w)
+		return 0, false
+	}
+
+	return current.Version, true
+}
+
+// writePreconditionFailed writes the problem of a write whose If-Match header did not match the produce
+func writePreconditionFailed(w http.ResponseWriter) {
+	writeProblem(w, http.StatusPreconditionFailed, models.ProblemPreconditionFailed, ErrProduceVersionMismatch.Error())
+}
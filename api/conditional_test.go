@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConditionalProduceRequests(t *testing.T) {
+	const path = "/api/v1/produce/A12T-4GH7-QPL9-3N4M"
+
+	for name, newManager := range historyTestBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			manager, closeManager := newManager()
+			defer closeManager()
+			s := NewServer(WithProduceManager(manager))
+
+			rr := serveRequest(s, http.MethodGet, path, "", "", "")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+			if etag := rr.Header().Get("ETag"); etag != `"1"` {
+				t.Errorf("handler returned wrong ETag: got %v want %v", etag, `"1"`)
+			}
+			lastModified := rr.Header().Get("Last-Modified")
+			if _, err := http.ParseTime(lastModified); err != nil {
+				t.Errorf("handler returned invalid Last-Modified %q: %v", lastModified, err)
+			}
+
+			rr = serveRequest(s, http.MethodGet, path, "If-None-Match", `W/"1"`, "")
+			if rr.Code != http.StatusNotModified {
+				t.Errorf("handler returned wrong status code for matching If-None-Match: got %v want %v", rr.Code, http.StatusNotModified)
+			}
+			if rr.Body.Len() != 0 {
+				t.Errorf("handler returned a body with 304: %s", rr.Body.String())
+			}
+
+			rr = serveRequest(s, http.MethodGet, path, "If-Modified-Since", lastModified, "")
+			if rr.Code != http.StatusNotModified {
+				t.Errorf("handler returned wrong status code for If-Modified-Since: got %v want %v", rr.Code, http.StatusNotModified)
+			}
+
+			before := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+			rr = serveRequest(s, http.MethodGet, path, "If-Modified-Since", before, "")
+			if rr.Code != http.StatusOK {
+				t.Errorf("handler returned wrong status code for earlier If-Modified-Since: got %v want %v", rr.Code, http.StatusOK)
+			}
+
+			rr = serveRequest(s, http.MethodPut, path, "If-Match", `"1"`, `{"name":"Romaine","unitPrice":2.5}`)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code for matching If-Match: got %v want %v", rr.Code, http.StatusOK)
+			}
+			if etag := rr.Header().Get("ETag"); etag != `"2"` {
+				t.Errorf("handler returned wrong ETag after update: got %v want %v", etag, `"2"`)
+			}
+
+			rr = serveRequest(s, http.MethodPut, path, "If-Match", `"1"`, `{"name":"Iceberg","unitPrice":2.5}`)
+			if rr.Code != http.StatusPreconditionFailed {
+				t.Errorf("handler returned wrong status code for stale PUT: got %v want %v", rr.Code, http.StatusPreconditionFailed)
+			}
+
+			rr = serveRequest(s, http.MethodPatch, path, "If-Match", `"1"`, `{"name":"Iceberg"}`)
+			if rr.Code != http.StatusPreconditionFailed {
+				t.Errorf("handler returned wrong status code for stale PATCH: got %v want %v", rr.Code, http.StatusPreconditionFailed)
+			}
+
+			rr = serveRequest(s, http.MethodDelete, path, "If-Match", `"1"`, "")
+			if rr.Code != http.StatusPreconditionFailed {
+				t.Errorf("handler returned wrong status code for stale DELETE: got %v want %v", rr.Code, http.StatusPreconditionFailed)
+			}
+
+			produce, err := manager.GetProduce("A12T-4GH7-QPL9-3N4M")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if produce.Name != "Romaine" {
+				t.Errorf("stale write changed the produce: got name %v want %v", produce.Name, "Romaine")
+			}
+
+			rr = serveRequest(s, http.MethodDelete, path, "If-Match", `"2"`, "")
+			if rr.Code != http.StatusNoContent {
+				t.Errorf("handler returned wrong status code for matching DELETE: got %v want %v", rr.Code, http.StatusNoContent)
+			}
+
+			rr = serveRequest(s, http.MethodPut, path, "If-Match", "*", `{"name":"Romaine","unitPrice":2.5}`)
+			if rr.Code != http.StatusPreconditionFailed {
+				t.Errorf("handler returned wrong status code for If-Match on deleted produce: got %v want %v", rr.Code, http.StatusPreconditionFailed)
+			}
+		})
+	}
+}
+
+func TestConditionalListProduce(t *testing.T) {
+	s := NewServer()
+
+	rr := serveRequest(s, http.MethodGet, "/api/v1/produce", "", "", "")
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("handler returned no ETag for the produce list")
+	}
+
+	rr = serveRequest(s, http.MethodGet, "/api/v1/produce", "If-None-Match", etag, "")
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("handler returned wrong status code for matching If-None-Match: got %v want %v", rr.Code, http.StatusNotModified)
+	}
+
+	rr = serveRequest(s, http.MethodGet, "/api/v1/produce?limit=1", "If-None-Match", etag, "")
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code for a different page: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = serveRequest(s, http.MethodPost, "/api/v1/produce", "", "", `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	rr = serveRequest(s, http.MethodGet, "/api/v1/produce", "If-None-Match", etag, "")
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code after a change: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr.Header().Get("ETag") == etag {
+		t.Errorf("handler returned the same ETag after a change: %v", etag)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{header: `"3"`, want: true},
+		{header: `"2"`, want: false},
+		{header: `"2", "3"`, want: true},
+		{header: "*", want: true},
+		{header: `W/"3"`, want: false},
+		{header: `W/"3"`, weak: true, want: true},
+		{header: `W/"2", W/"3"`, weak: true, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"3"`, tt.weak); got != tt.want {
+			t.Errorf("etagMatches(%q, weak %v) = %v want %v", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
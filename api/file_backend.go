@@ -0,0 +1,688 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+const (
+	snapshotFileName           = "snapshot.json"
+	promotionsSnapshotFileName = "promotions.json"
+	historySnapshotFileName    = "history.json"
+	logFileName                = "produce.log"
+
+	// defaultSnapshotInterval is how many log entries are written before the log is compacted into a snapshot
+	defaultSnapshotInterval = 1000
+
+	logOpPut             = "put"
+	logOpBatch           = "batch"
+	logOpDelete          = "delete"
+	logOpPutPromotion    = "putPromotion"
+	logOpDeletePromotion = "deletePromotion"
+)
+
+// logEntry is a single line of the append only log. Produce is written in the
+// version 2 representation so the currency of the unit price is kept. Changes
+// to the catalog carry the actor and time that are recorded in the produce
+// history, while stock changes do not. A batch entry holds the put entries of
+// produce created together so they are replayed all together or not at all.
+type logEntry struct {
+	Op          string            `json:"op"`
+	ProduceCode string            `json:"produceCode,omitempty"`
+	Produce     *models.ProduceV2 `json:"produce,omitempty"`
+	Version     int64             `json:"version,omitempty"`
+	UpdatedAt   *time.Time        `json:"updatedAt,omitempty"`
+	Actor       string            `json:"actor,omitempty"`
+	ChangedAt   *time.Time        `json:"changedAt,omitempty"`
+	PromotionID string            `json:"promotionId,omitempty"`
+	Promotion   *models.Promotion `json:"promotion,omitempty"`
+	Batch       []logEntry        `json:"batch,omitempty"`
+}
+
+func putEntry(produce models.Produce) logEntry {
+	v2 := produce.V2()
+	return logEntry{Op: logOpPut, ProduceCode: produce.ProduceCode, Produce: &v2, Version: produce.Version, UpdatedAt: &produce.UpdatedAt}
+}
+
+// snapshotProduce is a produce in the snapshot. The version is kept alongside
+// the representation because it is not part of it.
+type snapshotProduce struct {
+	models.ProduceV2
+	Version   int64     `json:"version,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// V1 converts the snapshot of a produce back to the produce
+func (s snapshotProduce) V1() models.Produce {
+	produce := s.ProduceV2.V1()
+	produce.Version = s.Version
+	produce.UpdatedAt = s.UpdatedAt
+	return produce
+}
+
+// historyEntry is a single produce revision in the history snapshot
+type historyEntry struct {
+	Produce   models.ProduceV2 `json:"produce"`
+	Deleted   bool             `json:"deleted,omitempty"`
+	Actor     string           `json:"actor"`
+	ChangedAt time.Time        `json:"changedAt"`
+}
+
+func putPromotionEntry(promotion models.Promotion) logEntry {
+	return logEntry{Op: logOpPutPromotion, PromotionID: promotion.ID, Promotion: &promotion}
+}
+
+// logFile is the file the log is appended to, which is an *os.File unless a
+// test needs its writes to fail
+type logFile interface {
+	io.WriteCloser
+	Sync() error
+	Truncate(size int64) error
+	Seek(offset int64, whence int) (int64, error)
+	Stat() (os.FileInfo, error)
+}
+
+// FileBackend is a ProduceManager and PromotionManager that persists produce
+// and promotions to a data directory. Every change is appended to a log before
+// it is acknowledged and the log is periodically compacted into a snapshot. On
+// startup the snapshot is loaded and the log is replayed on top of it.
+type FileBackend struct {
+	*backend
+
+	dir        string
+	log        logFile
+	logEntries int
+	// logErr is set when a failed write could not be removed from the log, after which nothing more is appended
+	logErr           error
+	snapshotInterval int
+	// defaultInventory is whether a new data directory is seeded with the default inventory
+	defaultInventory bool
+	// writeMutex serializes writes so the log order always matches the order changes were applied in memory
+	writeMutex sync.Mutex
+}
+
+// WithoutDefaultInventory leaves a new data directory empty instead of seeding
+// it with the default inventory, e.g. to seed it with Server.SeedProduce
+func WithoutDefaultInventory() func(*FileBackend) {
+	return func(f *FileBackend) {
+		f.defaultInventory = false
+	}
+}
+
+// NewFileBackend opens the data directory, creating it if needed, and recovers
+// any produce persisted by a previous run. An empty data directory is seeded
+// with the default inventory.
+func NewFileBackend(dir string, opts ...func(*FileBackend)) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create data directory %s", dir)
+	}
+
+	f := &FileBackend{
+		backend:          newBackend(map[string]models.Produce{}),
+		dir:              dir,
+		snapshotInterval: defaultSnapshotInterval,
+		defaultInventory: true,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	seed, err := f.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.replayLog(); err != nil {
+		return nil, err
+	}
+	f.backfillHistory(time.Now().UTC())
+	f.backfillVersions(time.Now().UTC())
+
+	f.log, err = os.OpenFile(f.path(logFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open produce log")
+	}
+
+	if seed && f.defaultInventory {
+		f.data = initializeData()
+		f.backfillHistory(time.Now().UTC())
+		f.backfillVersions(time.Now().UTC())
+		if err := f.compact(); err != nil {
+			f.log.Close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// CreateProduce stores a new produce and appends it to the log
+func (f *FileBackend) CreateProduce(produce models.Produce, actor string) (models.Produce, error) {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	newProduce, err := f.backend.CreateProduce(produce, actor)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	if err := f.appendLog(f.revisionEntry(putEntry(newProduce))); err != nil {
+		f.backend.revert(newProduce.ProduceCode, nil)
+		return models.Produce{}, err
+	}
+
+	return newProduce, nil
+}
+
+// CreateAllProduce stores every new produce of a batch, or none of them, and
+// appends them to the log as a single entry
+func (f *FileBackend) CreateAllProduce(produce []models.Produce, actor string) ([]models.Produce, error) {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	newProduce, err := f.backend.CreateAllProduce(produce, actor)
+	if err != nil || len(newProduce) == 0 {
+		return newProduce, err
+	}
+
+	entry := logEntry{Op: logOpBatch}
+	for _, p := range newProduce {
+		entry.Batch = append(entry.Batch, f.revisionEntry(putEntry(p)))
+	}
+
+	if err := f.appendLog(entry); err != nil {
+		for _, p := range newProduce {
+			f.backend.revert(p.ProduceCode, nil)
+		}
+		return nil, err
+	}
+
+	return newProduce, nil
+}
+
+// UpdateProduce replaces an existing produce and appends the new value to the log
+func (f *FileBackend) UpdateProduce(produce models.Produce, actor string) (models.Produce, error) {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	produceCode, err := models.ParseProduceCode(produce.ProduceCode)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	old, err := f.backend.GetProduce(produceCode)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	updatedProduce, err := f.backend.UpdateProduce(produce, actor)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	if err := f.appendLog(f.revisionEntry(putEntry(updatedProduce))); err != nil {
+		f.backend.revert(updatedProduce.ProduceCode, &old)
+		return models.Produce{}, err
+	}
+
+	return updatedProduce, nil
+}
+
+// ChangeStock atomically applies a stock change and appends the new stock to the log
+func (f *FileBackend) ChangeStock(produceCode models.ProduceCode, change models.StockChange) (models.Produce, error) {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	old, err := f.backend.GetProduce(produceCode)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	updatedProduce, err := f.backend.ChangeStock(produceCode, change)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	if err := f.appendLog(putEntry(updatedProduce)); err != nil {
+		f.mutex.Lock()
+		f.data[string(produceCode)] = old
+		f.mutex.Unlock()
+		return models.Produce{}, err
+	}
+
+	return updatedProduce, nil
+}
+
+// DeleteProduce removes a produce and appends the removal to the log
+func (f *FileBackend) DeleteProduce(produceCode models.ProduceCode, version int64, actor string) error {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	f.mutex.RLock()
+	old, exists := f.data[string(produceCode)]
+	f.mutex.RUnlock()
+	if !exists {
+		return ErrProduceNotFound
+	}
+
+	if err := f.backend.DeleteProduce(produceCode, version, actor); err != nil {
+		return err
+	}
+
+	if err := f.appendLog(f.revisionEntry(logEntry{Op: logOpDelete, ProduceCode: string(produceCode)})); err != nil {
+		f.backend.revert(string(produceCode), &old)
+		return err
+	}
+
+	return nil
+}
+
+// revisionEntry adds the actor and time of the last catalog change to a produce to its log entry
+func (f *FileBackend) revisionEntry(entry logEntry) logEntry {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	revisions := f.history[entry.ProduceCode]
+	revision := revisions[len(revisions)-1]
+	entry.Actor = revision.Actor
+	entry.ChangedAt = &revision.ChangedAt
+	return entry
+}
+
+// CreatePromotion stores a new promotion and appends it to the log
+func (f *FileBackend) CreatePromotion(promotion models.Promotion) (models.Promotion, error) {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	newPromotion, err := f.backend.CreatePromotion(promotion)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+
+	if err := f.appendLog(putPromotionEntry(newPromotion)); err != nil {
+		f.backend.DeletePromotion(newPromotion.ID)
+		return models.Promotion{}, err
+	}
+
+	return newPromotion, nil
+}
+
+// UpdatePromotion replaces an existing promotion and appends the new value to the log
+func (f *FileBackend) UpdatePromotion(promotion models.Promotion) (models.Promotion, error) {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	old, err := f.backend.GetPromotion(promotion.ID)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+
+	updatedPromotion, err := f.backend.UpdatePromotion(promotion)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+
+	if err := f.appendLog(putPromotionEntry(updatedPromotion)); err != nil {
+		f.backend.UpdatePromotion(old)
+		return models.Promotion{}, err
+	}
+
+	return updatedPromotion, nil
+}
+
+// DeletePromotion removes a promotion and appends the removal to the log
+func (f *FileBackend) DeletePromotion(id string) error {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	old, err := f.backend.GetPromotion(id)
+	if err != nil {
+		return err
+	}
+
+	if err := f.backend.DeletePromotion(id); err != nil {
+		return err
+	}
+
+	if err := f.appendLog(logEntry{Op: logOpDeletePromotion, PromotionID: id}); err != nil {
+		f.backend.CreatePromotion(old)
+		return err
+	}
+
+	return nil
+}
+
+// compact writes every produce and promotion to the snapshot files and
+// truncates the log. Callers must hold writeMutex once the backend is in use.
+func (f *FileBackend) compact() error {
+	promotions, err := f.backend.ListPromotions()
+	if err != nil {
+		return err
+	}
+
+	history := []historyEntry{}
+	for _, revision := range f.historySnapshot() {
+		history = append(history, historyEntry{
+			Produce:   revision.Produce.V2(),
+			Deleted:   revision.Deleted,
+			Actor:     revision.Actor,
+			ChangedAt: revision.ChangedAt,
+		})
+	}
+
+	snapshots := []struct {
+		name string
+		v    interface{}
+	}{
+		{promotionsSnapshotFileName, promotions},
+		{historySnapshotFileName, history},
+		{snapshotFileName, snapshotProduceList(f.snapshot())},
+	}
+	for _, snapshot := range snapshots {
+		b, err := json.Marshal(snapshot.v)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal snapshot")
+		}
+
+		tmp := f.path(snapshot.name + ".tmp")
+		if err := writeFileSync(tmp, b); err != nil {
+			return errors.Wrap(err, "failed to write snapshot")
+		}
+
+		// rename is atomic so a crash leaves either the old or the new snapshot in place.
+		// A crash before the log is truncated only means the log is replayed on top of a
+		// snapshot that already contains it, which is harmless.
+		if err := os.Rename(tmp, f.path(snapshot.name)); err != nil {
+			return errors.Wrap(err, "failed to replace snapshot")
+		}
+	}
+
+	if err := f.log.Truncate(0); err != nil {
+		return errors.Wrap(err, "failed to truncate produce log")
+	}
+	f.logEntries = 0
+
+	return nil
+}
+
+// Close snapshots the current state and closes the log
+func (f *FileBackend) Close() error {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	if err := f.compact(); err != nil {
+		return err
+	}
+	return f.log.Close()
+}
+
+// Ping checks the data directory can still be written to. The produce is
+// loaded into memory before NewFileBackend returns.
+func (f *FileBackend) Ping(ctx context.Context) error {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	if f.logErr != nil {
+		return f.logErr
+	}
+	if _, err := f.log.Stat(); err != nil {
+		return errors.Wrap(err, "produce log is not open")
+	}
+	if _, err := os.Stat(f.dir); err != nil {
+		return errors.Wrapf(err, "failed to read data directory %s", f.dir)
+	}
+	return nil
+}
+
+func (f *FileBackend) path(name string) string {
+	return filepath.Join(f.dir, name)
+}
+
+// loadSnapshot reads the snapshot into memory. It reports whether the data
+// directory is brand new and needs to be seeded.
+func (f *FileBackend) loadSnapshot() (bool, error) {
+	b, err := ioutil.ReadFile(f.path(snapshotFileName))
+	if os.IsNotExist(err) {
+		_, err := os.Stat(f.path(logFileName))
+		return os.IsNotExist(err), nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to read snapshot")
+	}
+
+	produce := []snapshotProduce{}
+	if err := json.Unmarshal(b, &produce); err != nil {
+		return false, errors.Wrap(err, "failed to parse snapshot")
+	}
+
+	for _, val := range produce {
+		f.data[val.ProduceCode] = val.V1()
+	}
+
+	// data directories written before promotions or history existed have no
+	// snapshot of them. Produce without history is backfilled once the log is replayed.
+	promotions := []models.Promotion{}
+	if err := readOptionalSnapshot(f.path(promotionsSnapshotFileName), &promotions); err != nil {
+		return false, errors.Wrap(err, "failed to read promotions snapshot")
+	}
+
+	for _, val := range promotions {
+		f.promotions[val.ID] = val
+	}
+
+	history := []historyEntry{}
+	if err := readOptionalSnapshot(f.path(historySnapshotFileName), &history); err != nil {
+		return false, errors.Wrap(err, "failed to read history snapshot")
+	}
+
+	for _, val := range history {
+		f.record(models.NewRevision(val.Produce.V1(), val.Deleted, val.Actor, val.ChangedAt))
+	}
+
+	return false, nil
+}
+
+// snapshotProduceList converts produce to its snapshot
+func snapshotProduceList(produce []models.Produce) []snapshotProduce {
+	snapshot := make([]snapshotProduce, len(produce))
+	for i, p := range produce {
+		snapshot[i] = snapshotProduce{ProduceV2: p.V2(), Version: p.Version, UpdatedAt: p.UpdatedAt}
+	}
+	return snapshot
+}
+
+// readOptionalSnapshot parses a snapshot file into v, leaving v untouched if the file does not exist
+func readOptionalSnapshot(name string, v interface{}) error {
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// replayLog applies every entry in the log on top of the snapshot. A partially
+// written final entry, left behind by a crash mid write, is discarded.
+func (f *FileBackend) replayLog() error {
+	file, err := os.OpenFile(f.path(logFileName), os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to open produce log")
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for line := 1; ; line++ {
+		raw, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(raw)) > 0 {
+				log.Warnf("discarding incomplete entry at line %d of the produce log", line)
+				return file.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read produce log")
+		}
+
+		entry := logEntry{}
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return errors.Wrapf(err, "corrupt produce log entry at line %d", line)
+		}
+
+		if err := f.apply(entry); err != nil {
+			return errors.Wrapf(err, "invalid produce log entry at line %d", line)
+		}
+
+		offset += int64(len(raw))
+		f.logEntries++
+	}
+}
+
+func (f *FileBackend) apply(entry logEntry) error {
+	switch entry.Op {
+	case logOpPut:
+		if entry.Produce == nil {
+			return errors.New("put entry is missing produce")
+		}
+		produce := entry.Produce.V1()
+		produce.Version = entry.Version
+		if entry.UpdatedAt != nil {
+			produce.UpdatedAt = *entry.UpdatedAt
+		}
+		f.data[entry.ProduceCode] = produce
+		f.replayRevision(entry, produce, false)
+	case logOpDelete:
+		if old, exists := f.data[entry.ProduceCode]; exists {
+			f.replayRevision(entry, old, true)
+		}
+		delete(f.data, entry.ProduceCode)
+	case logOpPutPromotion:
+		if entry.Promotion == nil {
+			return errors.New("put entry is missing promotion")
+		}
+		f.promotions[entry.PromotionID] = *entry.Promotion
+	case logOpDeletePromotion:
+		delete(f.promotions, entry.PromotionID)
+	case logOpBatch:
+		for _, batchEntry := range entry.Batch {
+			if batchEntry.Op != logOpPut {
+				return errors.Errorf("unexpected operation %q in batch", batchEntry.Op)
+			}
+			if err := f.apply(batchEntry); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("unknown operation %q", entry.Op)
+	}
+	return nil
+}
+
+// replayRevision records the revision of a catalog change read from the log.
+// Entries already in the history snapshot, because a crash came between writing
+// the snapshot and truncating the log, are not recorded twice.
+func (f *FileBackend) replayRevision(entry logEntry, produce models.Produce, deleted bool) {
+	if entry.ChangedAt == nil {
+		return
+	}
+
+	revisions := f.history[entry.ProduceCode]
+	if len(revisions) > 0 && !entry.ChangedAt.After(revisions[len(revisions)-1].ChangedAt) {
+		return
+	}
+
+	f.record(models.NewRevision(produce, deleted, entry.Actor, *entry.ChangedAt))
+}
+
+// appendLog durably writes an entry to the log, compacting the log into a
+// snapshot when it has grown past the snapshot interval. Callers must hold writeMutex.
+func (f *FileBackend) appendLog(entry logEntry) error {
+	if f.logErr != nil {
+		return f.logErr
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal produce log entry")
+	}
+
+	// recovery only discards an incomplete entry at the end of the log, so an
+	// entry that fails part way through is cut off before anything follows it
+	info, err := f.log.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to write produce log")
+	}
+	offset := info.Size()
+
+	if _, err := f.log.Write(append(b, '\n')); err != nil {
+		return f.truncateLog(offset, errors.Wrap(err, "failed to write produce log"))
+	}
+
+	if err := f.log.Sync(); err != nil {
+		return f.truncateLog(offset, errors.Wrap(err, "failed to sync produce log"))
+	}
+
+	f.logEntries++
+	if f.logEntries >= f.snapshotInterval {
+		if err := f.compact(); err != nil {
+			// the entry is already durable in the log so the write still succeeded
+			log.Errorf("failed to snapshot produce: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// truncateLog removes an entry that failed to be written from the end of the
+// log and returns the error it failed with. When the entry cannot be removed
+// nothing more is appended, since it would follow the incomplete entry and
+// the log could not be replayed.
+func (f *FileBackend) truncateLog(offset int64, err error) error {
+	if truncErr := f.log.Truncate(offset); truncErr != nil {
+		f.logErr = errors.Wrapf(truncErr, "produce log has an incomplete entry after %s", err)
+		return f.logErr
+	}
+	if _, seekErr := f.log.Seek(offset, io.SeekStart); seekErr != nil {
+		f.logErr = errors.Wrapf(seekErr, "produce log has an incomplete entry after %s", err)
+		return f.logErr
+	}
+	return err
+}
+
+func writeFileSync(name string, b []byte) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(b); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,463 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func newTestDataDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "supermarket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestFileBackendSeedsNewDataDir(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	produce, err := f.ListProduce(queryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(produce) != len(initializeData()) {
+		t.Errorf("unexpected produce count got %d want %d", len(produce), len(initializeData()))
+	}
+}
+
+func TestFileBackendWithoutDefaultInventory(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir, WithoutDefaultInventory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	produce, err := f.ListProduce(queryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(produce) != 0 {
+		t.Errorf("a new data directory has produce: %+v", produce)
+	}
+}
+
+func TestFileBackendSurvivesRestart(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := f.CreateProduce(models.Produce{Name: "fumanchu", ProduceCode: "xx1x-4gh7-qpl9-3n4m", UnitPrice: models.MustParseMoney("1.13333", models.USD)}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.DeleteProduce("A12T-4GH7-QPL9-3N4M", 0, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.UpdateProduce(models.Produce{Name: "White Peach", ProduceCode: "E5T6-9UI3-TH15-QR88", UnitPrice: models.NewMoney(349, models.USD)}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := f.ChangeStock("E5T6-9UI3-TH15-QR88", models.StockChange{Operation: models.StockReceive, Quantity: models.NewQuantity(24)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash by dropping the backend without closing it so only the log has the changes
+	f.log.Close()
+
+	f, err = NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if got := f.data[created.ProduceCode]; got != created {
+		t.Errorf("created produce was not recovered got %v want %v", got, created)
+	}
+
+	if _, exists := f.data["A12T-4GH7-QPL9-3N4M"]; exists {
+		t.Errorf("deleted produce was recovered")
+	}
+
+	if got := f.data[updated.ProduceCode]; got != updated {
+		t.Errorf("updated produce was not recovered got %v want %v", got, updated)
+	}
+
+	if _, err := f.CreateProduce(created, "test"); err != ErrProduceAlreadyExists {
+		t.Errorf("unexpected error creating duplicate produce got %v want %v", err, ErrProduceAlreadyExists)
+	}
+}
+
+func TestFileBackendDiscardsIncompleteLogEntry(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.CreateProduce(models.Produce{Name: "fumanchu", ProduceCode: "XX1X-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(113, models.USD)}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash in the middle of a write leaves a partial line at the end of the log
+	if _, err := f.log.Write([]byte(`{"op":"put","produceCode":"YY1X`)); err != nil {
+		t.Fatal(err)
+	}
+	f.log.Close()
+
+	f, err = NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exists := f.data["XX1X-4GH7-QPL9-3N4M"]; !exists {
+		t.Errorf("complete log entry was not recovered")
+	}
+
+	if _, err := f.CreateProduce(models.Produce{Name: "oomanchu", ProduceCode: "2222-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(113, models.USD)}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	f.log.Close()
+
+	f, err = NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("log written after recovery could not be replayed: %s", err)
+	}
+	defer f.Close()
+
+	if _, exists := f.data["2222-4GH7-QPL9-3N4M"]; !exists {
+		t.Errorf("produce created after recovery was not recovered")
+	}
+}
+
+// failingLog writes half of what it is given to the log and then fails, like
+// a disk that fills up part way through a write
+type failingLog struct {
+	logFile
+	failWrite bool
+	failSync  bool
+	failTrunc bool
+}
+
+func (l *failingLog) Write(b []byte) (int, error) {
+	if !l.failWrite {
+		return l.logFile.Write(b)
+	}
+	n, _ := l.logFile.Write(b[:len(b)/2])
+	return n, errors.New("no space left on device")
+}
+
+func (l *failingLog) Sync() error {
+	if l.failSync {
+		return errors.New("input/output error")
+	}
+	return l.logFile.Sync()
+}
+
+func (l *failingLog) Truncate(size int64) error {
+	if l.failTrunc {
+		return errors.New("input/output error")
+	}
+	return l.logFile.Truncate(size)
+}
+
+func TestFileBackendRemovesFailedLogEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		log  failingLog
+	}{
+		{name: "failed write", log: failingLog{failWrite: true}},
+		{name: "failed sync", log: failingLog{failSync: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTestDataDir(t)
+			defer os.RemoveAll(dir)
+
+			f, err := NewFileBackend(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failing := tt.log
+			failing.logFile = f.log
+			f.log = &failing
+			if _, err := f.CreateProduce(models.Produce{Name: "fumanchu", ProduceCode: "XX1X-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(113, models.USD)}, "test"); err == nil {
+				t.Fatal("expected an error creating produce when the log cannot be written")
+			}
+
+			// once the disk recovers the next entry must not follow the failed one
+			f.log = failing.logFile
+			if _, err := f.CreateProduce(models.Produce{Name: "oomanchu", ProduceCode: "2222-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(113, models.USD)}, "test"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.CreateProduce(models.Produce{Name: "yoomanchu", ProduceCode: "3333-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(113, models.USD)}, "test"); err != nil {
+				t.Fatal(err)
+			}
+			f.log.Close()
+
+			f, err = NewFileBackend(dir)
+			if err != nil {
+				t.Fatalf("log written after a failed write could not be replayed: %s", err)
+			}
+			defer f.Close()
+
+			if _, exists := f.data["XX1X-4GH7-QPL9-3N4M"]; exists {
+				t.Errorf("produce that failed to be written was recovered")
+			}
+			for _, code := range []string{"2222-4GH7-QPL9-3N4M", "3333-4GH7-QPL9-3N4M"} {
+				if _, exists := f.data[code]; !exists {
+					t.Errorf("produce %s created after the failed write was not recovered", code)
+				}
+			}
+		})
+	}
+}
+
+func TestFileBackendStopsWritingAfterFailedTruncate(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	failing := &failingLog{logFile: f.log, failWrite: true, failTrunc: true}
+	f.log = failing
+	if _, err := f.CreateProduce(models.Produce{Name: "fumanchu", ProduceCode: "XX1X-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(113, models.USD)}, "test"); err == nil {
+		t.Fatal("expected an error creating produce when the log cannot be written")
+	}
+
+	f.log = failing.logFile
+	if _, err := f.CreateProduce(models.Produce{Name: "oomanchu", ProduceCode: "2222-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(113, models.USD)}, "test"); err == nil {
+		t.Error("produce was appended after an incomplete entry")
+	}
+	if err := f.Ping(context.Background()); err == nil {
+		t.Error("ping succeeded with an incomplete entry in the log")
+	}
+}
+
+func TestFileBackendCompactsLog(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.snapshotInterval = 2
+
+	var created []models.Produce
+	for _, code := range []string{"AAAA-AAAA-AAAA-AAAA", "BBBB-BBBB-BBBB-BBBB"} {
+		p, err := f.CreateProduce(models.Produce{Name: code, ProduceCode: code, UnitPrice: models.NewMoney(100, models.USD)}, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, p)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("log was not truncated after snapshot got size %d", info.Size())
+	}
+	f.log.Close()
+
+	f, err = NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if len(f.data) != len(initializeData())+2 {
+		t.Errorf("unexpected produce count after snapshot got %d want %d", len(f.data), len(initializeData())+2)
+	}
+
+	// the snapshot keeps the version and updated time behind each ETag
+	for _, p := range created {
+		got := f.data[p.ProduceCode]
+		if got.Version != p.Version || !got.UpdatedAt.Equal(p.UpdatedAt) {
+			t.Errorf("produce version was not recovered from snapshot got %d at %v want %d at %v", got.Version, got.UpdatedAt, p.Version, p.UpdatedAt)
+		}
+	}
+}
+
+func TestFileBackendRecoversPromotions(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.snapshotInterval = 3
+
+	startsAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	kept := models.Promotion{ID: "kept", Name: "20% off", Kind: models.PercentOff, Category: "fruit", PercentOff: 2000, StartsAt: startsAt}
+	deleted := models.Promotion{ID: "deleted", Name: "10% off", Kind: models.PercentOff, Category: "fruit", PercentOff: 1000, StartsAt: startsAt}
+
+	// the third change is compacted into the snapshot and the fourth is only in the log
+	for _, p := range []models.Promotion{kept, deleted} {
+		if _, err := f.CreatePromotion(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.DeletePromotion(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	kept.Priority = 3
+	if _, err := f.UpdatePromotion(kept); err != nil {
+		t.Fatal(err)
+	}
+	f.log.Close()
+
+	f, err = NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := f.ListPromotions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []models.Promotion{kept}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected promotions after restart got %+v want %+v", got, want)
+	}
+}
+
+func TestFileBackendRecoversBatch(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []models.Produce{
+		{Name: "Beet", ProduceCode: "BEET-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(100, models.USD)},
+		{Name: "Leek", ProduceCode: "LEEK-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(200, models.USD)},
+	}
+	if _, err := f.CreateAllProduce(batch, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a batch with a produce code already in use stores nothing
+	failing := []models.Produce{
+		{Name: "Kale", ProduceCode: "KALE-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(100, models.USD)},
+		{Name: "Beet", ProduceCode: "BEET-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(100, models.USD)},
+	}
+	_, err = f.CreateAllProduce(failing, "test")
+	if want := (BatchError{1: ErrProduceAlreadyExists}); !reflect.DeepEqual(err, want) {
+		t.Errorf("unexpected error of a failing batch got %v want %v", err, want)
+	}
+	f.Close()
+
+	f, err = NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, p := range batch {
+		got, err := f.GetProduce(models.ProduceCode(p.ProduceCode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != p.Name {
+			t.Errorf("unexpected produce after restart got %+v want %+v", got, p)
+		}
+	}
+	if _, err := f.GetProduce("KALE-4GH7-QPL9-3N4M"); err != ErrProduceNotFound {
+		t.Errorf("produce of a failed batch was stored: %v", err)
+	}
+}
+
+func TestFileBackendRecoversHistory(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := models.ProduceCode("E5T6-9UI3-TH15-QR88")
+	if _, err := f.UpdateProduce(models.Produce{Name: "Peach", ProduceCode: code.String(), UnitPrice: models.NewMoney(349, models.USD)}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ChangeStock(code, models.StockChange{Operation: models.StockReceive, Quantity: models.NewQuantity(5)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.DeleteProduce(code, 0, "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := f.PriceHistory(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != 2 {
+		t.Fatalf("unexpected price history got %+v", want)
+	}
+
+	// simulate a crash after the snapshot is written but before the log is
+	// truncated so the log is replayed on top of a snapshot that already holds it
+	logged, err := ioutil.ReadFile(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, logFileName), logged, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.log.Close()
+
+	f, err = NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := f.PriceHistory(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("price history was not recovered got %+v want %+v", got, want)
+	}
+}
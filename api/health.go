@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// Version, GitCommit and BuildTime describe the build of the binary. They are
+// set when it is built with
+// -ldflags "-X github.com/xmattstrongx/supermarket/api.Version=0.0.1"
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildTime = "unknown"
+)
+
+// readinessTimeout bounds how long the backend is given to answer a readiness check
+const readinessTimeout = 2 * time.Second
+
+// Pinger is implemented by a ProduceManager whose storage can become
+// unreachable while the daemon runs. A ProduceManager that is not a Pinger is
+// always ready.
+type Pinger interface {
+	// Ping returns an error when the storage cannot be reached
+	Ping(context.Context) error
+}
+
+// Build returns the build of the binary
+func Build() models.BuildInfo {
+	return models.BuildInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// Healthz answers whether the daemon is running, so it is restarted when it stops answering
+func (s *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, models.Health{Status: models.StatusOK})
+}
+
+// Readyz answers whether the daemon can handle requests, which is when the
+// produce has been loaded and its storage can be reached. A daemon that is not
+// ready answers with a 503 and the checks that failed.
+func (s *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	check := models.ReadinessCheck{Name: "produce", Status: models.StatusOK}
+	if pinger, ok := s.produceManager.(Pinger); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := pinger.Ping(ctx); err != nil {
+			check.Status = models.StatusFailed
+			check.Detail = err.Error()
+		}
+	}
+
+	readiness := models.Readiness{Status: models.StatusReady, Checks: []models.ReadinessCheck{check}}
+	status := http.StatusOK
+	if check.Status != models.StatusOK {
+		readiness.Status = models.StatusNotReady
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, readiness)
+}
+
+// GetVersion answers with the build of the daemon
+func (s *Server) GetVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Build())
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func TestHealthz(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewServer().Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	health := models.Health{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != models.StatusOK {
+		t.Errorf("wrong status: got %q want %q", health.Status, models.StatusOK)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	dir := newTestDataDir(t)
+	defer os.RemoveAll(dir)
+
+	fileBackend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedFileBackend, err := NewFileBackend(newTestDataDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedFileBackend.Close()
+	os.RemoveAll(closedFileBackend.dir)
+
+	sqlBackend := newTestSQLBackend(t)
+	closedSQLBackend := newTestSQLBackend(t)
+	closedSQLBackend.Close()
+
+	tests := []struct {
+		name           string
+		produceManager ProduceManager
+		want           int
+	}{
+		{name: "memory", want: http.StatusOK},
+		{name: "file", produceManager: fileBackend, want: http.StatusOK},
+		{name: "closed file", produceManager: closedFileBackend, want: http.StatusServiceUnavailable},
+		{name: "sql", produceManager: sqlBackend, want: http.StatusOK},
+		{name: "closed sql", produceManager: closedSQLBackend, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			if tt.produceManager != nil {
+				s = NewServer(WithProduceManager(tt.produceManager))
+			}
+
+			rr := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rr.Code != tt.want {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.want, rr.Body)
+			}
+
+			readiness := models.Readiness{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &readiness); err != nil {
+				t.Fatal(err)
+			}
+			wantStatus := models.StatusReady
+			if tt.want != http.StatusOK {
+				wantStatus = models.StatusNotReady
+			}
+			if readiness.Status != wantStatus {
+				t.Errorf("wrong status: got %q want %q", readiness.Status, wantStatus)
+			}
+			if len(readiness.Checks) != 1 || readiness.Checks[0].Name != "produce" {
+				t.Errorf("wrong checks: %+v", readiness.Checks)
+			}
+		})
+	}
+
+	fileBackend.Close()
+	sqlBackend.Close()
+}
+
+func TestGetVersion(t *testing.T) {
+	defer func(version, gitCommit string) {
+		Version, GitCommit = version, gitCommit
+	}(Version, GitCommit)
+	Version, GitCommit = "1.2.3", "abc1234"
+
+	rr := httptest.NewRecorder()
+	NewServer().Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	build := models.BuildInfo{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &build); err != nil {
+		t.Fatal(err)
+	}
+	if build != Build() || build.Version != "1.2.3" || build.GitCommit != "abc1234" {
+		t.Errorf("wrong build: got %+v want %+v", build, Build())
+	}
+}
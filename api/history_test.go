@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// historyTestBackends returns a new instance of every ProduceManager so the
+// history is checked against each of them. The SQL backend keeps the time of a
+// change to the millisecond so steps are spaced further apart than that.
+func historyTestBackends(t *testing.T) map[string]func() (ProduceManager, func()) {
+	return map[string]func() (ProduceManager, func()){
+		"memory": func() (ProduceManager, func()) {
+			return newBackend(initializeData()), func() {}
+		},
+		"file": func() (ProduceManager, func()) {
+			dir := newTestDataDir(t)
+			f, err := NewFileBackend(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f, func() {
+				f.Close()
+				os.RemoveAll(dir)
+			}
+		},
+		"sql": func() (ProduceManager, func()) {
+			s := newTestSQLBackend(t)
+			return s, func() { s.Close() }
+		},
+	}
+}
+
+func TestPriceHistoryAndAsOf(t *testing.T) {
+	for name, newManager := range historyTestBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			manager, closeManager := newManager()
+			defer closeManager()
+			s := NewServer(WithProduceManager(manager))
+
+			pause := func() time.Time {
+				time.Sleep(5 * time.Millisecond)
+				at := time.Now().UTC()
+				time.Sleep(5 * time.Millisecond)
+				return at
+			}
+
+			beforeCreate := pause()
+			steps := []struct {
+				method string
+				path   string
+				actor  string
+				body   string
+				want   int
+			}{
+				{http.MethodPost, "/api/v1/produce", "alice", `[{"name":"fumanchu","produceCode":"XX1X-4GH7-QPL9-3N4M","unitPrice":1.13}]`, http.StatusCreated},
+				{http.MethodPatch, "/api/v1/produce/XX1X-4GH7-QPL9-3N4M", "bob", `{"unitPrice":1.50}`, http.StatusOK},
+				{http.MethodPatch, "/api/v1/produce/XX1X-4GH7-QPL9-3N4M", "", `{"name":"oomanchu","unitPrice":1.75}`, http.StatusOK},
+				{http.MethodDelete, "/api/v1/produce/XX1X-4GH7-QPL9-3N4M", "carol", "", http.StatusNoContent},
+			}
+			var after []time.Time
+			for _, step := range steps {
+				if rr := serveRequest(s, step.method, step.path, actorHeader, step.actor, step.body); rr.Code != step.want {
+					t.Fatalf("%s %s returned wrong status code: got %v want %v: %s", step.method, step.path, rr.Code, step.want, rr.Body)
+				}
+				after = append(after, pause())
+			}
+
+			rr := serveRequest(s, http.MethodGet, "/api/v1/produce/xx1x-4gh7-qpl9-3n4m/prices", "", "", "")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+			history := []models.PriceChange{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+				t.Fatal(err)
+			}
+			// deleting the produce does not change its price
+			if len(history) != 3 {
+				t.Fatalf("unexpected price history got %+v", history)
+			}
+			for i, want := range []struct {
+				price int64
+				actor string
+			}{{113, "alice"}, {150, "bob"}, {175, anonymousActor}} {
+				if history[i].UnitPrice.Cmp(models.NewMoney(want.price, models.USD)) != 0 || history[i].Actor != want.actor {
+					t.Errorf("unexpected price change %d got %+v want %v by %v", i, history[i], want.price, want.actor)
+				}
+			}
+
+			asOfTests := []struct {
+				name      string
+				asOf      time.Time
+				wantName  string
+				wantPrice int64
+			}{
+				{name: "before it was created", asOf: beforeCreate},
+				{name: "after it was created", asOf: after[0], wantName: "fumanchu", wantPrice: 113},
+				{name: "after its price changed", asOf: after[1], wantName: "fumanchu", wantPrice: 150},
+				{name: "after it was renamed", asOf: after[2], wantName: "oomanchu", wantPrice: 175},
+				{name: "after it was deleted", asOf: after[3]},
+			}
+			for _, tt := range asOfTests {
+				rr := serveRequest(s, http.MethodGet, "/api/v1/produce?as_of="+url.QueryEscape(tt.asOf.Format(time.RFC3339Nano)), "", "", "")
+				if rr.Code != http.StatusOK {
+					t.Fatalf("%s: handler returned wrong status code: got %v want %v", tt.name, rr.Code, http.StatusOK)
+				}
+				produce := []models.Produce{}
+				if err := json.Unmarshal(rr.Body.Bytes(), &produce); err != nil {
+					t.Fatal(err)
+				}
+
+				// the seeded produce is in the catalog throughout
+				if len(produce) < len(initializeData()) {
+					t.Errorf("%s: seeded produce missing from catalog got %d produce", tt.name, len(produce))
+				}
+
+				var found *models.Produce
+				for i := range produce {
+					if produce[i].ProduceCode == "XX1X-4GH7-QPL9-3N4M" {
+						found = &produce[i]
+					}
+				}
+				switch {
+				case tt.wantName == "" && found != nil:
+					t.Errorf("%s: produce should not be in the catalog got %+v", tt.name, *found)
+				case tt.wantName != "" && found == nil:
+					t.Errorf("%s: produce missing from the catalog", tt.name)
+				case found != nil && (found.Name != tt.wantName || found.UnitPrice.Cmp(models.NewMoney(tt.wantPrice, models.USD)) != 0):
+					t.Errorf("%s: unexpected produce got %+v want %v at %v", tt.name, *found, tt.wantName, tt.wantPrice)
+				}
+			}
+		})
+	}
+}
+
+func TestPriceHistoryErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "unknown produce", path: "/api/v1/produce/XX1X-4GH7-QPL9-3N4M/prices", wantStatus: http.StatusNotFound},
+		{name: "invalid produce code", path: "/api/v1/produce/invalid/prices", wantStatus: http.StatusBadRequest},
+		{name: "invalid as_of", path: "/api/v1/produce?as_of=yesterday", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveRequest(NewServer(), http.MethodGet, tt.path, "", "", "")
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
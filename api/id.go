@@ -0,0 +1,17 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// newID returns a random 128 bit id for a cart or promotion
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate id")
+	}
+	return hex.EncodeToString(b), nil
+}
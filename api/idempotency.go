@@ -0,0 +1,357 @@
+package api
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+const (
+	// idempotencyKeyHeader names a POST or PATCH request so a retry of it is answered with the first response
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader is set on a response replayed for a retried request
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength is the most characters an idempotency key may have
+	maxIdempotencyKeyLength = 255
+
+	// DefaultIdempotencyWindow is how long the response to a request with an idempotency key is kept by default
+	DefaultIdempotencyWindow = 24 * time.Hour
+	// DefaultIdempotencyCacheEntries is how many idempotency keys are kept by default
+	DefaultIdempotencyCacheEntries = 10000
+	// DefaultIdempotencyCacheBytes is how many bytes of response bodies are kept for idempotency keys by default
+	DefaultIdempotencyCacheBytes = 64 << 20
+
+	// maxBufferedBodyBytes is the most of a request body with an idempotency key kept in memory while it is hashed
+	maxBufferedBodyBytes = 1 << 20
+)
+
+// errIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+var errIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// errIdempotencyKeyInFlight is returned when an idempotency key is sent again before the first request finished
+var errIdempotencyKeyInFlight = errors.New("a request with this idempotency key is still being handled")
+
+// errIdempotencyCacheFull is returned when every entry of the cache belongs to a request still being handled
+var errIdempotencyCacheFull = errors.New("too many requests with an idempotency key are being handled, retry later")
+
+// idempotentResponse is the response to the first request sent with an idempotency key
+type idempotentResponse struct {
+	key string
+	// fingerprint identifies the request so a key sent with a different request is refused
+	fingerprint [sha256.Size]byte
+	// done is false while the first request is still being handled
+	done      bool
+	status    int
+	header    http.Header
+	body      []byte
+	expiresAt time.Time
+	// index is the position of a finished response in the expiry heap
+	index int
+}
+
+// expiryHeap orders finished responses by when they expire, soonest first
+type expiryHeap []*idempotentResponse
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	response := x.(*idempotentResponse)
+	response.index = len(*h)
+	*h = append(*h, response)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	response := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return response
+}
+
+// idempotencyCache keeps the response to every request with an idempotency
+// key for a window of time. It holds at most maxEntries keys and maxBytes of
+// response bodies, making room by dropping the responses that expire soonest.
+type idempotencyCache struct {
+	window     time.Duration
+	maxEntries int
+	maxBytes   int64
+	now        func() time.Time
+	responses  map[string]*idempotentResponse
+	expiry     expiryHeap
+	bytes      int64
+	mutex      sync.Mutex
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		window:     window,
+		maxEntries: DefaultIdempotencyCacheEntries,
+		maxBytes:   DefaultIdempotencyCacheBytes,
+		now:        time.Now,
+		responses:  map[string]*idempotentResponse{},
+	}
+}
+
+// remove drops a finished response from the cache
+func (c *idempotencyCache) remove(response *idempotentResponse) {
+	heap.Remove(&c.expiry, response.index)
+	delete(c.responses, response.key)
+	c.bytes -= int64(len(response.body))
+}
+
+// evict drops the finished response that expires soonest, or returns false when there is none
+func (c *idempotencyCache) evict() bool {
+	if len(c.expiry) == 0 {
+		return false
+	}
+	c.remove(c.expiry[0])
+	return true
+}
+
+// begin returns the stored response of a key, or reserves the key for a new
+// request when there is none. Responses older than the window are dropped.
+func (c *idempotencyCache) begin(key string, fingerprint [sha256.Size]byte) (*idempotentResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	for len(c.expiry) > 0 && now.After(c.expiry[0].expiresAt) {
+		c.evict()
+	}
+
+	response, exists := c.responses[key]
+	switch {
+	case !exists:
+		if len(c.responses) >= c.maxEntries && !c.evict() {
+			return nil, errIdempotencyCacheFull
+		}
+		c.responses[key] = &idempotentResponse{key: key, fingerprint: fingerprint, index: -1}
+		return nil, nil
+	case response.fingerprint != fingerprint:
+		return nil, errIdempotencyKeyReused
+	case !response.done:
+		return nil, errIdempotencyKeyInFlight
+	}
+
+	return response, nil
+}
+
+// finish stores the response to the request reserving a key. Server errors
+// are not stored so a retry of the request is handled again, and neither is a
+// body larger than the whole cache.
+func (c *idempotencyCache) finish(key string, status int, header http.Header, body []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	response, exists := c.responses[key]
+	if !exists || response.done {
+		return
+	}
+
+	if status >= http.StatusInternalServerError || int64(len(body)) > c.maxBytes {
+		delete(c.responses, key)
+		return
+	}
+
+	for c.bytes+int64(len(body)) > c.maxBytes && c.evict() {
+	}
+
+	response.done = true
+	response.status = status
+	response.header = header
+	response.body = body
+	response.expiresAt = c.now().Add(c.window)
+	c.bytes += int64(len(body))
+	heap.Push(&c.expiry, response)
+}
+
+// release frees a key reserved by a request that did not finish
+func (c *idempotencyCache) release(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if response, exists := c.responses[key]; exists && !response.done {
+		delete(c.responses, key)
+	}
+}
+
+// idempotencyScope returns the key a request's idempotency key is kept under.
+// Keys sent with different API keys are kept apart so one client can neither
+// replay nor block the response to another.
+func idempotencyScope(r *http.Request, key string) string {
+	if apiKey, ok := authenticatedKey(r); ok {
+		return apiKey.ID + " " + key
+	}
+	return " " + key
+}
+
+// spooledBody is a request body that has been read to its end so it can be
+// hashed, and is read again by the handler. A body larger than
+// maxBufferedBodyBytes is kept in a temporary file rather than in memory.
+type spooledBody struct {
+	io.Reader
+	file *os.File
+}
+
+// Close removes the temporary file of a large body
+func (b *spooledBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// spoolBody reads a body to its end, writing it to w as it is read
+func spoolBody(body io.Reader, w io.Writer) (*spooledBody, error) {
+	var buffer bytes.Buffer
+	if _, err := io.CopyN(io.MultiWriter(&buffer, w), body, maxBufferedBodyBytes+1); err == io.EOF {
+		return &spooledBody{Reader: &buffer}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile("", "supermarket-body")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to spool request body")
+	}
+	spooled := &spooledBody{Reader: file, file: file}
+	if _, err := file.Write(buffer.Bytes()); err != nil {
+		spooled.Close()
+		return nil, errors.Wrap(err, "failed to spool request body")
+	}
+	if _, err := io.Copy(io.MultiWriter(file, w), body); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return nil, errors.Wrap(err, "failed to spool request body")
+	}
+	return spooled, nil
+}
+
+// requestFingerprint hashes the method and target of a request and reads its
+// body to its end into the hash. The body is returned to be read again.
+func requestFingerprint(r *http.Request) ([sha256.Size]byte, *spooledBody, error) {
+	var fingerprint [sha256.Size]byte
+
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	body, err := spoolBody(r.Body, h)
+	if err != nil {
+		return fingerprint, nil, err
+	}
+
+	copy(fingerprint[:], h.Sum(nil))
+	return fingerprint, body, nil
+}
+
+// recordingResponseWriter writes a response through while keeping a copy of it
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// idempotent is middleware that makes POST and PATCH requests sent with an
+// Idempotency-Key header safe to retry. The first response to a key is kept
+// for the idempotency window and replayed verbatim to a retry with the same
+// method, target and body. A key sent with a different request is refused.
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			writeInvalidField(w, idempotencyKeyHeader, models.ReasonInvalidValue, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		fingerprint, body, err := requestFingerprint(r)
+		if err != nil {
+			writeMalformedBody(w, err)
+			return
+		}
+		defer body.Close()
+		r.Body = body
+
+		key = idempotencyScope(r, key)
+		stored, err := s.idempotency.begin(key, fingerprint)
+		switch err {
+		case nil:
+		case errIdempotencyKeyReused:
+			writeProblem(w, http.StatusUnprocessableEntity, models.ProblemIdempotencyKeyReused, err.Error())
+			return
+		case errIdempotencyCacheFull:
+			w.Header().Set("Retry-After", "1")
+			writeProblem(w, http.StatusServiceUnavailable, models.ProblemUnavailable, err.Error())
+			return
+		default:
+			writeProblem(w, http.StatusConflict, models.ProblemConflict, err.Error())
+			return
+		}
+
+		if stored != nil {
+			for name, values := range stored.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set(idempotentReplayedHeader, "true")
+			w.WriteHeader(stored.status)
+			w.Write(stored.body)
+			return
+		}
+
+		finished := false
+		defer func() {
+			if !finished {
+				s.idempotency.release(key)
+			}
+		}()
+
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		finished = true
+
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// a retry is a request of its own with its own id
+		header := w.Header().Clone()
+		header.Del(requestIDHeader)
+		s.idempotency.finish(key, status, header, rw.body.Bytes())
+	})
+}
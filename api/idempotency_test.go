@@ -0,0 +1,242 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func TestIdempotentCreateProduce(t *testing.T) {
+	s := NewServer()
+	body := `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`
+
+	first := serveRequest(s, http.MethodPost, "/api/v1/produce", idempotencyKeyHeader, "create-beet", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", first.Code, http.StatusCreated)
+	}
+
+	retry := serveRequest(s, http.MethodPost, "/api/v1/produce", idempotencyKeyHeader, "create-beet", body)
+	if retry.Code != http.StatusCreated {
+		t.Errorf("handler returned wrong status code for a retry: got %v want %v", retry.Code, http.StatusCreated)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("handler did not replay the first response: got %s want %s", retry.Body.String(), first.Body.String())
+	}
+	if retry.Header().Get("Content-Type") != first.Header().Get("Content-Type") || retry.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("handler returned unexpected headers for a retry: %v", retry.Header())
+	}
+
+	// without the key the request is handled again and the produce already exists
+	again := serveRequest(s, http.MethodPost, "/api/v1/produce", "", "", body)
+	if again.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code without a key: got %v want %v", again.Code, http.StatusBadRequest)
+	}
+}
+
+func TestIdempotencyKeyReused(t *testing.T) {
+	s := NewServer()
+
+	rr := serveRequest(s, http.MethodPost, "/api/v1/produce", idempotencyKeyHeader, "key", `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "different body", method: http.MethodPost, path: "/api/v1/produce", body: `[{"name":"Leek","produceCode":"LEEK-4GH7-QPL9-3N4M","unitPrice":1}]`},
+		{name: "different target", method: http.MethodPost, path: "/api/v1/produce?atomic=true", body: `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`},
+	} {
+		rr := serveRequest(s, tt.method, tt.path, idempotencyKeyHeader, "key", tt.body)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.name, rr.Code, http.StatusUnprocessableEntity)
+		}
+
+		problem := models.Problem{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil || problem.Type != models.ProblemIdempotencyKeyReused {
+			t.Errorf("%s: handler returned unexpected problem %s", tt.name, rr.Body.String())
+		}
+	}
+}
+
+func TestIdempotencyWindow(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	s := NewServer(WithIdempotencyWindow(time.Hour))
+	s.idempotency.now = func() time.Time { return now }
+
+	body := `{"quantity":5}`
+	path := "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/receive"
+	onHand := func(rr *httptest.ResponseRecorder) string {
+		produce := models.Produce{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &produce); err != nil {
+			t.Fatal(err)
+		}
+		return produce.OnHand.String()
+	}
+
+	if rr := serveRequest(s, http.MethodPost, path, idempotencyKeyHeader, "receive", body); onHand(rr) != "5" {
+		t.Fatalf("unexpected stock on hand %s", rr.Body.String())
+	}
+
+	now = now.Add(time.Hour)
+	if rr := serveRequest(s, http.MethodPost, path, idempotencyKeyHeader, "receive", body); onHand(rr) != "5" {
+		t.Errorf("retry within the window was applied again: %s", rr.Body.String())
+	}
+
+	now = now.Add(time.Second)
+	if rr := serveRequest(s, http.MethodPost, path, idempotencyKeyHeader, "receive", body); onHand(rr) != "10" {
+		t.Errorf("retry after the window was not handled again: %s", rr.Body.String())
+	}
+}
+
+func TestIdempotencyKeyIgnoredForOtherMethods(t *testing.T) {
+	s := NewServer()
+	body := `{"name":"Lettuce","unitPrice":1}`
+
+	for i := 0; i < 2; i++ {
+		rr := serveRequest(s, http.MethodPut, "/api/v1/produce/A12T-4GH7-QPL9-3N4M", idempotencyKeyHeader, "key", body)
+		if rr.Code != http.StatusOK || rr.Header().Get(idempotentReplayedHeader) != "" {
+			t.Errorf("handler returned unexpected response %v %v", rr.Code, rr.Header())
+		}
+	}
+}
+
+func TestIdempotencyKeyTooLong(t *testing.T) {
+	rr := serveRequest(NewServer(), http.MethodPost, "/api/v1/carts", idempotencyKeyHeader, strings.Repeat("k", maxIdempotencyKeyLength+1), "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestIdempotencyCache(t *testing.T) {
+	c := newIdempotencyCache(time.Hour)
+	fingerprint := sha256.Sum256([]byte("request"))
+
+	if stored, err := c.begin("key", fingerprint); stored != nil || err != nil {
+		t.Fatalf("begin() of a new key = %v, %v", stored, err)
+	}
+	if _, err := c.begin("key", fingerprint); err != errIdempotencyKeyInFlight {
+		t.Errorf("begin() of a key in flight error = %v, want %v", err, errIdempotencyKeyInFlight)
+	}
+
+	// a server error is not kept so the request can be retried
+	c.finish("key", http.StatusInternalServerError, http.Header{}, nil)
+	if stored, err := c.begin("key", fingerprint); stored != nil || err != nil {
+		t.Fatalf("begin() after a server error = %v, %v", stored, err)
+	}
+
+	c.finish("key", http.StatusCreated, http.Header{}, []byte("created"))
+	stored, err := c.begin("key", fingerprint)
+	if err != nil || stored == nil || stored.status != http.StatusCreated || string(stored.body) != "created" {
+		t.Errorf("begin() of a finished key = %+v, %v", stored, err)
+	}
+
+	c.release("key")
+	if stored, _ := c.begin("key", fingerprint); stored == nil {
+		t.Errorf("release() dropped a finished response")
+	}
+}
+
+func TestIdempotencyCacheLimits(t *testing.T) {
+	c := newIdempotencyCache(time.Hour)
+	c.maxEntries = 2
+	c.maxBytes = 10
+	start := time.Now()
+	c.now = func() time.Time { return start }
+	fingerprint := sha256.Sum256([]byte("request"))
+
+	for _, key := range []string{"first", "second"} {
+		if _, err := c.begin(key, fingerprint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// every entry is still in flight so there is nothing to drop
+	if _, err := c.begin("third", fingerprint); err != errIdempotencyCacheFull {
+		t.Fatalf("begin() of a full cache error = %v, want %v", err, errIdempotencyCacheFull)
+	}
+
+	c.finish("first", http.StatusCreated, http.Header{}, []byte("first"))
+	c.now = func() time.Time { return start.Add(time.Minute) }
+	c.finish("second", http.StatusCreated, http.Header{}, []byte("second"))
+
+	// the bodies do not fit together so the one expiring soonest is dropped
+	if stored, err := c.begin("first", fingerprint); stored != nil || err != nil {
+		t.Fatalf("begin() of a dropped key = %v, %v", stored, err)
+	}
+	if stored, err := c.begin("second", fingerprint); stored == nil || err != nil {
+		t.Fatalf("begin() of a kept key = %v, %v", stored, err)
+	}
+
+	// a new key makes room by dropping the finished response
+	if _, err := c.begin("third", fingerprint); err != nil {
+		t.Fatalf("begin() dropping a finished response error = %v", err)
+	}
+	if len(c.responses) != 2 || c.bytes != 0 || len(c.expiry) != 0 {
+		t.Errorf("wrong cache after dropping: %d responses, %d bytes, %d expiring", len(c.responses), c.bytes, len(c.expiry))
+	}
+
+	// a body larger than the whole cache is not kept
+	c.finish("third", http.StatusCreated, http.Header{}, []byte("more than ten bytes"))
+	if _, exists := c.responses["third"]; exists {
+		t.Error("finish() kept a body larger than the cache")
+	}
+}
+
+func TestIdempotencyKeyScopedByAPIKey(t *testing.T) {
+	keyFile := newTestKeyFile(t)
+	_, first, err := keyFile.CreateAPIKey("first", models.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := keyFile.CreateAPIKey("second", models.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewServer(WithKeyStore(keyFile)).Handler()
+
+	create := func(apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/produce", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set(idempotencyKeyHeader, "create")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := create(first, `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`); rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	// the same key sent with another API key is a different request
+	rr := create(second, `[{"name":"Kale","produceCode":"KALE-4GH7-QPL9-3N4M","unitPrice":1}]`)
+	if rr.Code != http.StatusCreated || rr.Header().Get(idempotentReplayedHeader) != "" {
+		t.Errorf("handler did not handle the request of another API key: %v %v: %s", rr.Code, rr.Header(), rr.Body)
+	}
+}
+
+func TestIdempotentLargeBody(t *testing.T) {
+	s := NewServer()
+	// a body larger than what is kept in memory while it is hashed
+	body := `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}` + strings.Repeat(" ", maxBufferedBodyBytes) + "]"
+
+	first := serveRequest(s, http.MethodPost, "/api/v1/produce", idempotencyKeyHeader, "large", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %.200s", first.Code, http.StatusCreated, first.Body)
+	}
+	retry := serveRequest(s, http.MethodPost, "/api/v1/produce", idempotencyKeyHeader, "large", body)
+	if retry.Code != http.StatusCreated || retry.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("handler did not replay the first response: %v %v", retry.Code, retry.Header())
+	}
+	changed := serveRequest(s, http.MethodPost, "/api/v1/produce", idempotencyKeyHeader, "large", body[:len(body)-1]+" ]")
+	if changed.Code != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code for a changed body: got %v want %v", changed.Code, http.StatusUnprocessableEntity)
+	}
+}
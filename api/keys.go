@@ -0,0 +1,243 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// apiKeyPrefix starts every API key so keys are easy to recognise, e.g. by secret scanners
+const apiKeyPrefix = "sm_"
+
+// ErrAPIKeyNotFound is returned by a KeyStore when no API key has the requested id
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// KeyStore looks up the API keys requests are authenticated with
+type KeyStore interface {
+	GetAPIKey(id string) (models.APIKey, error)
+}
+
+// newAPIKey generates an API key with a role. The key that is sent with
+// requests is returned along with it since only its hash is kept.
+func newAPIKey(name string, role models.Role) (models.APIKey, string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return models.APIKey{}, "", errors.Wrap(err, "failed to generate API key")
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return models.APIKey{}, "", errors.Wrap(err, "failed to generate API key")
+	}
+
+	apiKey := models.APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Role:      role,
+		Hash:      hashSecret(hex.EncodeToString(secret)),
+		CreatedAt: time.Now().UTC(),
+	}
+	return apiKey, apiKeyPrefix + apiKey.ID + "_" + hex.EncodeToString(secret), nil
+}
+
+// hashSecret hashes the secret part of an API key. The secret is random so a
+// salted, slow hash would not make it any harder to guess.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// parseAPIKey splits an API key into its id and secret
+func parseAPIKey(key string) (string, string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// verifyAPIKey reports whether a secret is the secret of an API key
+func verifyAPIKey(apiKey models.APIKey, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashSecret(secret))) == 1
+}
+
+// keyFileContents is how the API keys are written to a key file
+type keyFileContents struct {
+	Keys []models.APIKey `json:"keys"`
+}
+
+// KeyFile is a KeyStore of API keys kept in a JSON file. The file is read
+// again whenever it changes, so keys created or revoked by another process,
+// such as the admin keys commands, are used without restarting the daemon. A
+// file that does not exist has no keys.
+type KeyFile struct {
+	path    string
+	mutex   sync.Mutex
+	keys    []models.APIKey
+	modTime time.Time
+	size    int64
+}
+
+// OpenKeyFile reads the API keys of a key file
+func OpenKeyFile(path string) (*KeyFile, error) {
+	k := &KeyFile{path: path}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// reload reads the key file again when it has changed since it was last read.
+// The mutex must be held unless the key file is being opened.
+func (k *KeyFile) reload() error {
+	info, err := os.Stat(k.path)
+	if os.IsNotExist(err) {
+		k.keys, k.modTime, k.size = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read API keys")
+	}
+	if k.keys != nil && info.ModTime().Equal(k.modTime) && info.Size() == k.size {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(k.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read API keys")
+	}
+	contents := keyFileContents{}
+	if err := json.Unmarshal(b, &contents); err != nil {
+		return errors.Wrapf(err, "failed to read API keys from %s", k.path)
+	}
+
+	k.keys = contents.Keys
+	if k.keys == nil {
+		k.keys = []models.APIKey{}
+	}
+	k.modTime, k.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// write replaces the key file with the keys. The file is only readable by its
+// owner, and is replaced by a rename so it is never read half written.
+func (k *KeyFile) write(keys []models.APIKey) error {
+	b, err := json.MarshalIndent(keyFileContents{Keys: keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(k.path), filepath.Base(k.path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to write API keys")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write API keys")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write API keys")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to write API keys")
+	}
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return errors.Wrap(err, "failed to write API keys")
+	}
+
+	// the keys are read back so the file is known to be up to date
+	k.keys = nil
+	return k.reload()
+}
+
+// GetAPIKey returns the API key with an id, including a revoked one
+func (k *KeyFile) GetAPIKey(id string) (models.APIKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if err := k.reload(); err != nil {
+		return models.APIKey{}, err
+	}
+	for _, apiKey := range k.keys {
+		if apiKey.ID == id {
+			return apiKey, nil
+		}
+	}
+	return models.APIKey{}, ErrAPIKeyNotFound
+}
+
+// ListAPIKeys returns every API key, including revoked ones, in the order they were created
+func (k *KeyFile) ListAPIKeys() ([]models.APIKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return append([]models.APIKey{}, k.keys...), nil
+}
+
+// CreateAPIKey adds a new API key with a role. The key that is sent with
+// requests is returned along with it and cannot be recovered later.
+func (k *KeyFile) CreateAPIKey(name string, role models.Role) (models.APIKey, string, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if err := k.reload(); err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	apiKey, key, err := newAPIKey(name, role)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	if err := k.write(append(append([]models.APIKey{}, k.keys...), apiKey)); err != nil {
+		return models.APIKey{}, "", err
+	}
+	return apiKey, key, nil
+}
+
+// RevokeAPIKey stops an API key from being used. The key is kept so it is
+// known who it belonged to. Revoking a revoked key leaves it as it was.
+func (k *KeyFile) RevokeAPIKey(id string) (models.APIKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if err := k.reload(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	keys := append([]models.APIKey{}, k.keys...)
+	for i, apiKey := range keys {
+		if apiKey.ID != id {
+			continue
+		}
+		if apiKey.Revoked() {
+			return apiKey, nil
+		}
+
+		now := time.Now().UTC()
+		keys[i].RevokedAt = &now
+		if err := k.write(keys); err != nil {
+			return models.APIKey{}, err
+		}
+		return keys[i], nil
+	}
+	return models.APIKey{}, ErrAPIKeyNotFound
+}
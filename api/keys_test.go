@@ -0,0 +1,164 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func newTestKeyFile(t *testing.T) *KeyFile {
+	dir := newTestDataDir(t)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	k, err := OpenKeyFile(filepath.Join(dir, "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKeyFile(t *testing.T) {
+	k := newTestKeyFile(t)
+
+	keys, err := k.ListAPIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("a key file that does not exist has keys: %+v", keys)
+	}
+
+	created, key, err := k.CreateAPIKey("ci", models.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, secret, ok := parseAPIKey(key)
+	if !ok || id != created.ID {
+		t.Fatalf("key %q does not have the id %q", key, created.ID)
+	}
+
+	b, err := ioutil.ReadFile(k.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), secret) {
+		t.Error("the key file has the secret of a key")
+	}
+	info, err := os.Stat(k.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("wrong key file permissions: got %v want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	// a key created by another process is read without reopening the file
+	other, err := OpenKeyFile(k.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := other.CreateAPIKey("admin", models.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := k.GetAPIKey(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "admin" || got.Role != models.RoleAdmin {
+		t.Errorf("wrong key: %+v", got)
+	}
+
+	got, err = k.GetAPIKey(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifyAPIKey(got, secret) || verifyAPIKey(got, secret+"0") {
+		t.Error("the key was not verified by its secret")
+	}
+
+	revoked, err := other.RevokeAPIKey(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked.Revoked() {
+		t.Fatalf("key was not revoked: %+v", revoked)
+	}
+	// revoking twice keeps the time the key was first revoked
+	again, err := other.RevokeAPIKey(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Errorf("revoked again at %v, first at %v", again.RevokedAt, revoked.RevokedAt)
+	}
+
+	got, err = k.GetAPIKey(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Revoked() {
+		t.Error("key revoked by another process is still valid")
+	}
+
+	keys, err = k.ListAPIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != created.ID || keys[1].ID != second.ID {
+		t.Errorf("wrong keys: %+v", keys)
+	}
+
+	if _, err := k.GetAPIKey("missing"); err != ErrAPIKeyNotFound {
+		t.Errorf("wrong error: got %v want %v", err, ErrAPIKeyNotFound)
+	}
+	if _, err := k.RevokeAPIKey("missing"); err != ErrAPIKeyNotFound {
+		t.Errorf("wrong error: got %v want %v", err, ErrAPIKeyNotFound)
+	}
+}
+
+func TestKeyFileInvalid(t *testing.T) {
+	k := newTestKeyFile(t)
+	if err := ioutil.WriteFile(k.path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the modification time may not change within the resolution of the file system
+	if err := os.Chtimes(k.path, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenKeyFile(k.path); err == nil {
+		t.Error("expected an error opening an invalid key file")
+	}
+	if _, err := k.GetAPIKey("any"); err == nil || err == ErrAPIKeyNotFound {
+		t.Errorf("expected an error reading an invalid key file, got %v", err)
+	}
+}
+
+func Test_parseAPIKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		id     string
+		secret string
+		ok     bool
+	}{
+		{key: "sm_0123abcd_s3cret", id: "0123abcd", secret: "s3cret", ok: true},
+		{key: "sm_0123abcd_s3cret_more", id: "0123abcd", secret: "s3cret_more", ok: true},
+		{key: "0123abcd_s3cret"},
+		{key: "sm_0123abcd"},
+		{key: "sm__s3cret"},
+		{key: "sm_0123abcd_"},
+		{key: ""},
+	}
+	for _, tt := range tests {
+		id, secret, ok := parseAPIKey(tt.key)
+		if id != tt.id || secret != tt.secret || ok != tt.ok {
+			t.Errorf("parseAPIKey(%q) = %q, %q, %v want %q, %q, %v", tt.key, id, secret, ok, tt.id, tt.secret, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds a request id sent by a client so it cannot bloat the logs
+	maxRequestIDLength = 128
+)
+
+// contextKey is the type of the keys of values the API adds to the context of a request
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	apiKeyContextKey
+)
+
+// requestLog holds the logger of a request. Middleware that learns more about
+// a request, such as who sent it, replaces the logger so the fields are also
+// in the access log entry.
+type requestLog struct {
+	logger *log.Entry
+}
+
+// requestLogger returns the logger of a request, which logs every entry with
+// the id of the request so it can be found alongside the access log
+func requestLogger(r *http.Request) *log.Entry {
+	if rl, ok := r.Context().Value(loggerContextKey).(*requestLog); ok {
+		return rl.logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// addLogFields adds fields to every entry logged for a request from now on,
+// including its access log entry
+func addLogFields(r *http.Request, fields log.Fields) {
+	if rl, ok := r.Context().Value(loggerContextKey).(*requestLog); ok {
+		rl.logger = rl.logger.WithFields(fields)
+	}
+}
+
+// validRequestID reports whether a request id sent by a client can be kept,
+// which is when it is short and only has printable characters without spaces
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// clientIP returns the address a request was sent from without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// logRequests is middleware that gives every request an id and writes an
+// access log entry once it has been handled. The id sent by the client in
+// X-Request-ID is kept when it is valid, and a new one is generated otherwise.
+// The id is sent back in X-Request-ID and in the problem details of an error.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			var err error
+			if requestID, err = newID(); err != nil {
+				writeInternalError(w, err)
+				return
+			}
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		rl := &requestLog{logger: log.WithField("requestId", requestID)}
+		r = r.WithContext(context.WithValue(r.Context(), loggerContextKey, rl))
+
+		rw := &statusResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		entry := rl.logger.WithFields(log.Fields{
+			"method":     r.Method,
+			"route":      routeTemplate(r),
+			"status":     rw.status,
+			"durationMs": float64(time.Since(start)) / float64(time.Millisecond),
+			"bytes":      rw.bytes,
+			"clientIp":   clientIP(r),
+		})
+		if rw.status >= http.StatusInternalServerError {
+			entry.Error("handled request")
+			return
+		}
+		entry.Info("handled request")
+	})
+}
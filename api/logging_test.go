@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func TestLogRequests(t *testing.T) {
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		requestID string
+		wantID    string
+		route     string
+		status    int
+	}{
+		{name: "generated id", method: http.MethodGet, path: "/api/v1/produce", route: "/api/v1/produce", status: http.StatusOK},
+		{name: "propagated id", method: http.MethodGet, path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M", requestID: "lb-1234", wantID: "lb-1234", route: "/api/v1/produce/{productCode}", status: http.StatusOK},
+		{name: "invalid id", method: http.MethodGet, path: "/api/v1/produce", requestID: "has spaces", route: "/api/v1/produce", status: http.StatusOK},
+		{name: "too long id", method: http.MethodGet, path: "/api/v1/produce", requestID: strings.Repeat("a", maxRequestIDLength+1), route: "/api/v1/produce", status: http.StatusOK},
+		{name: "problem", method: http.MethodGet, path: "/api/v1/produce/ZZZZ-4GH7-QPL9-3N4M", requestID: "lb-5678", wantID: "lb-5678", route: "/api/v1/produce/{productCode}", status: http.StatusNotFound},
+		{name: "unmatched", method: http.MethodGet, path: "/no/such/path", requestID: "lb-9012", wantID: "lb-9012", route: unmatchedRoute, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook.Reset()
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = "192.0.2.1:54321"
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			NewServer().Handler().ServeHTTP(rr, req)
+
+			requestID := rr.Header().Get(requestIDHeader)
+			switch {
+			case tt.wantID != "" && requestID != tt.wantID:
+				t.Errorf("wrong request id: got %q want %q", requestID, tt.wantID)
+			case tt.wantID == "" && (requestID == "" || requestID == tt.requestID):
+				t.Errorf("request id was not generated: got %q", requestID)
+			}
+
+			if rr.Code >= 400 && rr.Header().Get("Content-Type") == mediaTypeProblem {
+				problem := models.Problem{}
+				if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+					t.Fatal(err)
+				}
+				if problem.RequestID != requestID {
+					t.Errorf("wrong request id in problem: got %q want %q", problem.RequestID, requestID)
+				}
+			}
+
+			entry := hook.LastEntry()
+			if entry == nil || entry.Message != "handled request" {
+				t.Fatalf("request was not logged: %+v", hook.AllEntries())
+			}
+			want := log.Fields{
+				"requestId": requestID,
+				"method":    tt.method,
+				"route":     tt.route,
+				"status":    tt.status,
+				"bytes":     int64(rr.Body.Len()),
+				"clientIp":  "192.0.2.1",
+			}
+			for field, value := range want {
+				if entry.Data[field] != value {
+					t.Errorf("wrong %s: got %v want %v", field, entry.Data[field], value)
+				}
+			}
+			if _, ok := entry.Data["durationMs"].(float64); !ok {
+				t.Errorf("duration was not logged: %+v", entry.Data)
+			}
+		})
+	}
+}
+
+func TestIdempotentReplayHasItsOwnRequestID(t *testing.T) {
+	s := NewServer()
+	body := `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`
+
+	first := serveRequest(s, http.MethodPost, "/api/v1/produce", idempotencyKeyHeader, "create-beet", body)
+	retry := serveRequest(s, http.MethodPost, "/api/v1/produce", idempotencyKeyHeader, "create-beet", body)
+	if retry.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Fatal("retry was not replayed")
+	}
+	if first.Header().Get(requestIDHeader) == retry.Header().Get(requestIDHeader) {
+		t.Errorf("replay was sent with the request id of the first request: %q", retry.Header().Get(requestIDHeader))
+	}
+}
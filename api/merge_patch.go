@@ -0,0 +1,26 @@
+package api
+
+// mergePatch applies a JSON Merge Patch as defined by RFC 7396 to a decoded
+// JSON document. Objects in the patch are merged recursively, null members are
+// removed from the target and any other value replaces the target outright.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+
+	return targetObject
+}
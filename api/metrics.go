@@ -0,0 +1,116 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xmattstrongx/supermarket/metrics"
+)
+
+// unmatchedRoute is the route of a request that matched no route, so the
+// paths of such requests do not each add a series
+const unmatchedRoute = "unmatched"
+
+// serverMetrics are the metrics of a Server written on /metrics
+type serverMetrics struct {
+	registry        *metrics.Registry
+	requests        *metrics.Counter
+	requestDuration *metrics.Histogram
+	createBatchSize *metrics.Histogram
+	produceCreates  *metrics.Counter
+}
+
+func newServerMetrics(s *Server) *serverMetrics {
+	registry := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: registry,
+		requests: registry.NewCounter("supermarket_http_requests_total",
+			"Requests handled by route, method and status code.", "method", "route", "status"),
+		requestDuration: registry.NewHistogram("supermarket_http_request_duration_seconds",
+			"Time taken to handle requests by route, method and status code.", metrics.DefaultBuckets, "method", "route", "status"),
+		createBatchSize: registry.NewHistogram("supermarket_produce_create_batch_size",
+			"Produce sent in each bulk create.", metrics.ExponentialBuckets(1, 2, 11)),
+		produceCreates: registry.NewCounter("supermarket_produce_creates_total",
+			"Produce a bulk create tried to create by whether it was created.", "result"),
+	}
+	// the produce manager is read when the metrics are written since options
+	// set it after the metrics are made
+	registry.NewGaugeFunc("supermarket_produce_items", "Produce in the catalog.", func() float64 {
+		produce, err := s.produceManager.ListProduce(queryParameters{})
+		if err != nil {
+			log.Errorf("failed to count produce: %s", err)
+			return math.NaN()
+		}
+		return float64(len(produce))
+	})
+	return m
+}
+
+// observeCreate records the size of a bulk create and how much of it was created
+func (m *serverMetrics) observeCreate(requested, created, failed int) {
+	m.createBatchSize.Observe(float64(requested))
+	m.produceCreates.Add(float64(created), "success")
+	m.produceCreates.Add(float64(failed), "failure")
+}
+
+// GetMetrics is an API handlerFunc for scraping the metrics of the daemon in the Prometheus text format
+func (s *Server) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	s.metrics.registry.ServeHTTP(w, r)
+}
+
+// statusResponseWriter keeps the status code and size of the response it writes
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rw *statusResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *statusResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// instrument is middleware that counts every request and how long it took by
+// the template of its route, its method and the status code of its response
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &statusResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		labels := []string{r.Method, routeTemplate(r), strconv.Itoa(rw.status)}
+		s.metrics.requests.Inc(labels...)
+		s.metrics.requestDuration.Observe(time.Since(start).Seconds(), labels...)
+	})
+}
+
+// routeTemplate returns the path template of the route a request matched
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return unmatchedRoute
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return template
+}
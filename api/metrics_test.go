@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/metrics"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// deterministicMetrics drops the samples of request durations that depend on
+// how long the requests took, keeping their counts
+func deterministicMetrics(body string) []byte {
+	var b bytes.Buffer
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "supermarket_http_request_duration_seconds_bucket") ||
+			strings.HasPrefix(line, "supermarket_http_request_duration_seconds_sum") {
+			continue
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.Bytes()
+}
+
+func TestGetMetrics(t *testing.T) {
+	s := NewServer()
+	handler := s.Handler()
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodGet, path: "/api/v1/produce"},
+		{method: http.MethodGet, path: "/api/v1/produce"},
+		{method: http.MethodGet, path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M"},
+		{method: http.MethodGet, path: "/api/v1/produce/ZZZZ-4GH7-QPL9-3N4M"},
+		{method: http.MethodPost, path: "/api/v1/produce", body: `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1},{"name":"Kale","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":1}]`},
+		{method: http.MethodPost, path: "/api/v1/produce", body: `[{"name":"Kiwi","produceCode":"KIWI-4GH7-QPL9-3N4M","unitPrice":1}]`},
+		{method: http.MethodPatch, path: "/api/v1/produce"},
+		{method: http.MethodGet, path: "/no/such/path"},
+	}
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("wrong content type: got %q want %q", got, metrics.ContentType)
+	}
+
+	got := deterministicMetrics(rr.Body.String())
+	golden := filepath.Join("testdata", "metrics.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("metrics do not match %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
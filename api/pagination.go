@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// totalCountHeader holds the number of produce matching a list request across every page
+const totalCountHeader = "X-Total-Count"
+
+// pageCursor marks the produce a page of the list starts after, or ends before
+// when paging backwards. Pages are found by comparing produce with the sort
+// keys of that produce rather than by position, so a cursor keeps working
+// while produce is created or deleted.
+type pageCursor struct {
+	SortBy      string `json:"s"`
+	Descending  bool   `json:"d,omitempty"`
+	Before      bool   `json:"b,omitempty"`
+	Name        string `json:"n,omitempty"`
+	UnitPrice   string `json:"p,omitempty"`
+	Currency    string `json:"c,omitempty"`
+	ProduceCode string `json:"k"`
+}
+
+// newPageCursor returns a cursor for the page after, or before, a produce in a listing sorted by the query parameters
+func newPageCursor(produce models.Produce, queryParams queryParameters, before bool) *pageCursor {
+	cursor := &pageCursor{
+		SortBy:      queryParams.sortBy,
+		Descending:  queryParams.descending,
+		Before:      before,
+		ProduceCode: produce.ProduceCode,
+	}
+
+	switch queryParams.sortBy {
+	case QUERY_PARAM_NAME:
+		cursor.Name = produce.Name
+	case QUERY_PARAM_UNIT_PRICE:
+		cursor.UnitPrice = produce.UnitPrice.String()
+		cursor.Currency = produce.UnitPrice.Currency()
+	}
+
+	return cursor
+}
+
+// decodePageCursor reads a cursor from the opaque token sent by a client
+func decodePageCursor(token string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := &pageCursor{}
+	if err := json.Unmarshal(b, cursor); err != nil {
+		return nil, err
+	}
+
+	switch cursor.SortBy {
+	case QUERY_PARAM_NAME, QUERY_PARAM_PRODUCE_CODE:
+	case QUERY_PARAM_UNIT_PRICE:
+		if _, err := models.ParseMoney(cursor.UnitPrice, cursor.Currency); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown sort %q", cursor.SortBy)
+	}
+
+	if cursor.ProduceCode == "" {
+		return nil, fmt.Errorf("missing produce code")
+	}
+
+	return cursor, nil
+}
+
+// encode returns the opaque token of the cursor
+func (c *pageCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// produce returns a produce holding the sort keys of the cursor
+func (c *pageCursor) produce() models.Produce {
+	produce := models.Produce{Name: c.Name, ProduceCode: c.ProduceCode}
+	if c.SortBy == QUERY_PARAM_UNIT_PRICE {
+		produce.UnitPrice = models.MustParseMoney(c.UnitPrice, c.Currency)
+	}
+	return produce
+}
+
+// compareProduce orders two produce by the sort key of the query parameters.
+// Produce with the same sort key are ordered by their unique produce code so
+// the order is always the same.
+func compareProduce(a, b models.Produce, queryParams queryParameters) int {
+	var c int
+	switch queryParams.sortBy {
+	case QUERY_PARAM_NAME:
+		c = strings.Compare(a.Name, b.Name)
+	case QUERY_PARAM_UNIT_PRICE:
+		c = a.UnitPrice.Cmp(b.UnitPrice)
+	}
+
+	if c == 0 {
+		c = strings.Compare(a.ProduceCode, b.ProduceCode)
+	}
+
+	if queryParams.descending {
+		return -c
+	}
+	return c
+}
+
+// producePage is one page of a produce listing
+type producePage struct {
+	produce []models.Produce
+	// total is the number of produce listed across every page
+	total int
+	// next and prev are nil when there is no page after or before this one
+	next *pageCursor
+	prev *pageCursor
+	// first is set when this is not the first page
+	first bool
+}
+
+// pageProduce sorts produce by the query parameters and returns the page
+// starting at the offset or cursor and holding at most the limit of produce
+func pageProduce(produce []models.Produce, queryParams queryParameters) producePage {
+	sortedProduce := sortProduce(produce, queryParams)
+	total := len(sortedProduce)
+
+	start, end := 0, total
+	if queryParams.cursor != nil && queryParams.cursor.Before {
+		boundary := queryParams.cursor.produce()
+		end = 0
+		for end < total && compareProduce(sortedProduce[end], boundary, queryParams) < 0 {
+			end++
+		}
+		if queryParams.limit > 0 && end > queryParams.limit {
+			start = end - queryParams.limit
+		}
+	} else {
+		switch {
+		case queryParams.cursor != nil:
+			boundary := queryParams.cursor.produce()
+			for start < total && compareProduce(sortedProduce[start], boundary, queryParams) <= 0 {
+				start++
+			}
+		case queryParams.offset < total:
+			start = queryParams.offset
+		default:
+			start = total
+		}
+		if queryParams.limit > 0 && start+queryParams.limit < end {
+			end = start + queryParams.limit
+		}
+	}
+
+	page := producePage{
+		produce: append([]models.Produce{}, sortedProduce[start:end]...),
+		total:   total,
+		first:   start > 0,
+	}
+	if start < end && start > 0 {
+		page.prev = newPageCursor(sortedProduce[start], queryParams, true)
+	}
+	if start < end && end < total {
+		page.next = newPageCursor(sortedProduce[end-1], queryParams, false)
+	}
+
+	return page
+}
+
+// writePageHeaders sets the total count and the RFC 5988 Link header of a
+// page. Links keep every query parameter of the request but the offset and
+// cursor, so the filters and sort carry over to the next and previous pages.
+func writePageHeaders(w http.ResponseWriter, r *http.Request, page producePage) {
+	w.Header().Set(totalCountHeader, strconv.Itoa(page.total))
+
+	link := func(cursor *pageCursor, rel string) string {
+		query := r.URL.Query()
+		query.Del(OFFSET)
+		query.Del(CURSOR)
+		if cursor != nil {
+			query.Set(CURSOR, cursor.encode())
+		}
+
+		u := *r.URL
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+	}
+
+	var links []string
+	if page.next != nil {
+		links = append(links, link(page.next, "next"))
+	}
+	if page.prev != nil {
+		links = append(links, link(page.prev, "prev"))
+	}
+	if page.first {
+		links = append(links, link(nil, "first"))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
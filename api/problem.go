@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// problemTitles is the short summary of every type of problem, which does not change between occurrences
+var problemTitles = map[string]string{
+	models.ProblemMalformedBody:        "Malformed request body",
+	models.ProblemInvalidRequest:       "Invalid request",
+	models.ProblemNotFound:             "Resource not found",
+	models.ProblemConflict:             "Conflict with the current state of the resource",
+	models.ProblemInsufficientStock:    "Insufficient stock",
+	models.ProblemPreconditionFailed:   "Precondition failed",
+	models.ProblemNotAcceptable:        "Not acceptable",
+	models.ProblemUnsupportedMediaType: "Unsupported media type",
+	models.ProblemIdempotencyKeyReused: "Idempotency key reused",
+	models.ProblemRequestTooLarge:      "Request body too large",
+	models.ProblemMethodNotAllowed:     "Method not allowed",
+	models.ProblemUnauthorized:         "Unauthorized",
+	models.ProblemForbidden:            "Forbidden",
+	models.ProblemUnavailable:          "Service unavailable",
+	models.ProblemInternal:             "Internal server error",
+}
+
+// writeProblem writes an RFC 7807 problem details response. The detail
+// explains this occurrence of the problem and field errors name each invalid
+// field of the request.
+func writeProblem(w http.ResponseWriter, status int, problemType, detail string, fieldErrors ...models.FieldError) {
+	b, err := json.Marshal(models.Problem{
+		Type:   problemType,
+		Title:  problemTitles[problemType],
+		Status: status,
+		Detail: detail,
+		Errors: fieldErrors,
+		// set by logRequests before the request is handled
+		RequestID: w.Header().Get(requestIDHeader),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// writeMalformedBody writes the problem of a request body that could not be decoded
+func writeMalformedBody(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(w, http.StatusRequestEntityTooLarge, models.ProblemRequestTooLarge, fmt.Sprintf("the request body must be at most %d bytes", tooLarge.Limit))
+		return
+	}
+	writeProblem(w, http.StatusBadRequest, models.ProblemMalformedBody, err.Error())
+}
+
+// writeInvalidRequest writes the problem of a request with invalid values.
+// Every field named by models.FieldErrors is listed in the problem.
+func writeInvalidRequest(w http.ResponseWriter, err error) {
+	var fieldErrors models.FieldErrors
+	if errors.As(err, &fieldErrors) {
+		writeProblem(w, http.StatusBadRequest, models.ProblemInvalidRequest, err.Error(), fieldErrors...)
+		return
+	}
+	writeProblem(w, http.StatusBadRequest, models.ProblemInvalidRequest, err.Error())
+}
+
+// writeInvalidField writes the problem of a request with one invalid field
+func writeInvalidField(w http.ResponseWriter, field, reason, detail string) {
+	writeInvalidRequest(w, models.FieldErrors{{Field: field, Reason: reason, Detail: detail}})
+}
+
+// writeInternalError writes the problem of a request that failed on the server
+func writeInternalError(w http.ResponseWriter, err error) {
+	writeProblem(w, http.StatusInternalServerError, models.ProblemInternal, err.Error())
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/models"
+	"github.com/xmattstrongx/supermarket/validator"
+)
+
+func TestProblemResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantType   string
+		wantFields []string
+	}{
+		{name: "malformed produce", method: http.MethodPost, path: "/api/v1/produce", body: `[{`, wantStatus: http.StatusBadRequest, wantType: models.ProblemMalformedBody},
+		{name: "invalid produce code in path", method: http.MethodGet, path: "/api/v1/produce/invalid", wantStatus: http.StatusBadRequest, wantType: models.ProblemInvalidRequest, wantFields: []string{"produceCode"}},
+		{name: "unknown produce", method: http.MethodGet, path: "/api/v1/produce/XX1X-4GH7-QPL9-3N4M", wantStatus: http.StatusNotFound, wantType: models.ProblemNotFound},
+		{name: "invalid query parameters", method: http.MethodGet, path: "/api/v1/produce?limit=0&min_price=x", wantStatus: http.StatusBadRequest, wantType: models.ProblemInvalidRequest, wantFields: []string{"limit", "min_price"}},
+		{name: "invalid replaced produce", method: http.MethodPut, path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M", body: `{"name":" ","unitPrice":-1}`, wantStatus: http.StatusBadRequest, wantType: models.ProblemInvalidRequest, wantFields: []string{"name", "unitPrice"}},
+		{name: "changed produce code", method: http.MethodPut, path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M", body: `{"name":"Lettuce","produceCode":"E5T6-9UI3-TH15-QR88","unitPrice":1}`, wantStatus: http.StatusBadRequest, wantType: models.ProblemInvalidRequest, wantFields: []string{"produceCode"}},
+		{name: "insufficient stock", method: http.MethodPost, path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/reserve", body: `{"quantity":1}`, wantStatus: http.StatusConflict, wantType: models.ProblemInsufficientStock},
+		{name: "unknown cart", method: http.MethodGet, path: "/api/v1/carts/missing", wantStatus: http.StatusNotFound, wantType: models.ProblemNotFound},
+		{name: "invalid cart quantity", method: http.MethodPost, path: "/api/v1/pricing/quote", body: `{"items":[{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":0}]}`, wantStatus: http.StatusBadRequest, wantType: models.ProblemInvalidRequest, wantFields: []string{"quantity"}},
+		{name: "unknown promotion", method: http.MethodDelete, path: "/api/v1/promotions/missing", wantStatus: http.StatusNotFound, wantType: models.ProblemNotFound},
+		{name: "unknown path", method: http.MethodGet, path: "/api/v1/vegetables", wantStatus: http.StatusNotFound, wantType: models.ProblemNotFound},
+		{name: "wrong method", method: http.MethodPatch, path: "/api/v1/promotions/missing", wantStatus: http.StatusMethodNotAllowed, wantType: models.ProblemMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveRequest(NewServer(), tt.method, tt.path, "", "", tt.body)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != mediaTypeProblem {
+				t.Errorf("handler returned wrong content type: got %v want %v", contentType, mediaTypeProblem)
+			}
+
+			problem := models.Problem{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("handler returned a body that is not a problem %q: %s", rr.Body.String(), err)
+			}
+			if problem.Type != tt.wantType || problem.Status != tt.wantStatus || problem.Title == "" || problem.Detail == "" {
+				t.Errorf("handler returned unexpected problem %+v", problem)
+			}
+
+			var fields []string
+			for _, fieldError := range problem.Errors {
+				if fieldError.Reason == "" || fieldError.Detail == "" {
+					t.Errorf("handler returned field error without a reason or detail %+v", fieldError)
+				}
+				fields = append(fields, fieldError.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("handler returned wrong field errors: got %v want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestCreateProduceFailureReasons(t *testing.T) {
+	s := NewServer(WithRoundingPolicy(models.RejectExcessPrecision))
+
+	body := `[
+		{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":1},
+		{"name":"Kiwi","produceCode":"KIWI","unitPrice":1},
+		{"name":"Leek","produceCode":"LEEK-4GH7-QPL9-3N4M","unitPrice":1.001},
+		{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1,"onHand":-1}
+	]`
+	rr := serveRequest(s, http.MethodPost, "/api/v1/produce", "", "", body)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	response := models.CreateProduceResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := map[string]string{}
+	for _, failed := range response.Invalid {
+		reasons[failed.Name] = failed.Reason
+	}
+	want := map[string]string{
+		"Lettuce": models.ReasonDuplicateCode,
+		"Kiwi":    models.ReasonInvalidCodeFormat,
+		"Leek":    models.ReasonInvalidPrice,
+		"Beet":    models.ReasonInvalidStock,
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("handler returned wrong failure reasons: got %v want %v", reasons, want)
+	}
+}
+
+func TestCreateProduceValidationRules(t *testing.T) {
+	rules := validator.DefaultRules()
+	rules.MaxNameLength = 5
+	rules.UnitPrices[models.USD] = validator.PriceRange{Min: models.NewMoney(0, models.USD), Max: models.NewMoney(1000, models.USD)}
+	s := NewServer(WithValidationRules(rules))
+
+	body := `[
+		{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1},
+		{"name":"Spinach","produceCode":"SPIN-4GH7-QPL9-3N4M","unitPrice":1},
+		{"name":"Leek","produceCode":"LEEK-4GH7-QPL9-3N4M","unitPrice":10.01}
+	]`
+	rr := serveRequest(s, http.MethodPost, "/api/v1/produce", "", "", body)
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMultiStatus)
+	}
+
+	response := models.CreateProduceResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := map[string]string{}
+	for _, failed := range response.Invalid {
+		reasons[failed.Name] = failed.Reason
+	}
+	want := map[string]string{
+		"Spinach": models.ReasonInvalidName,
+		"Leek":    models.ReasonInvalidPrice,
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("handler returned wrong failure reasons: got %v want %v", reasons, want)
+	}
+}
+
+func TestMethodNotAllowedListsAllowedMethods(t *testing.T) {
+	rr := serveRequest(NewServer(), http.MethodPost, "/api/v1/produce/A12T-4GH7-QPL9-3N4M", "", "", "")
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+	want := "GET, PUT, PATCH, DELETE"
+	if allow := rr.Header().Get("Allow"); allow != want {
+		t.Errorf("handler returned wrong Allow header: got %q want %q", allow, want)
+	}
+}
@@ -2,13 +2,16 @@ package api
 
 import (
 	"encoding/json"
-	"math"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/xmattstrongx/supermarket/models"
@@ -19,152 +22,338 @@ const (
 	ORDER     = "order"
 	LIMIT     = "limit"
 	OFFSET    = "offset"
+	AS_OF     = "as_of"
+	CURSOR    = "cursor"
+	ATOMIC    = "atomic"
+	DRY_RUN   = "dry_run"
+	CONFIRM   = "confirm"
+
+	IGNORE_MISSING = "ignore_missing"
+	ON_DUPLICATE   = "on_duplicate"
+
+	NAME_CONTAINS = "name_contains"
+	NAME_PREFIX   = "name_prefix"
+	PRODUCE_CODE  = "produce_code"
+	CODE_PREFIX   = "code_prefix"
+	MIN_PRICE     = "min_price"
+	MAX_PRICE     = "max_price"
 
 	QUERY_PARAM_NAME         = "name"
 	QUERY_PARAM_PRODUCE_CODE = "producecode"
 	QUERY_PARAM_UNIT_PRICE   = "unitprice"
+	QUERY_PARAM_ASC          = "asc"
+	QUERY_PARAM_ASCENDING    = "ascending"
 	QUERY_PARAM_DESC         = "desc"
 	QUERY_PARAM_DESCENDING   = "descending"
 )
 
+// actorHeader names who is making a change to the catalog so it can be recorded in the produce history
+const actorHeader = "X-Actor"
+
+// anonymousActor is recorded for changes made without an actor header
+const anonymousActor = "anonymous"
+
 type queryParameters struct {
-	sortBy string
-	order  string
-	limit  string
-	offset string
+	// sortBy is the lower case field produce is listed by. Produce with the
+	// same value is listed by produce code.
+	sortBy     string
+	descending bool
+	// limit is the most produce listed on a page, or every produce when 0
+	limit  int
+	offset int
+	// cursor continues a listing from a page returned before in place of an offset
+	cursor *pageCursor
+	// asOf lists the catalog as it was at a moment in time instead of as it is now
+	asOf   *time.Time
+	filter produceFilter
+}
+
+// produceFilter narrows the produce listed. Every filter that is set must
+// match and an empty filter matches all produce.
+type produceFilter struct {
+	nameContains string
+	namePrefix   string
+	produceCode  models.ProduceCode
+	codePrefix   string
+	// price bounds are inclusive and only match produce priced in the same currency
+	minPrice *models.Money
+	maxPrice *models.Money
+}
+
+// matches reports whether a produce passes every filter. Names and produce
+// codes are matched case insensitively.
+func (f produceFilter) matches(produce models.Produce) bool {
+	name := strings.ToLower(produce.Name)
+	if f.nameContains != "" && !strings.Contains(name, strings.ToLower(f.nameContains)) {
+		return false
+	}
+	if f.namePrefix != "" && !strings.HasPrefix(name, strings.ToLower(f.namePrefix)) {
+		return false
+	}
+
+	code := strings.ToUpper(produce.ProduceCode)
+	if f.produceCode != "" && models.ProduceCode(code) != f.produceCode {
+		return false
+	}
+	if f.codePrefix != "" && !strings.HasPrefix(code, f.codePrefix) {
+		return false
+	}
+
+	if f.minPrice != nil && (produce.UnitPrice.Currency() != f.minPrice.Currency() || produce.UnitPrice.Cmp(*f.minPrice) < 0) {
+		return false
+	}
+	if f.maxPrice != nil && (produce.UnitPrice.Currency() != f.maxPrice.Currency() || produce.UnitPrice.Cmp(*f.maxPrice) > 0) {
+		return false
+	}
+
+	return true
+}
+
+// filterProduce returns the produce that passes the filter in its original order
+func filterProduce(produce []models.Produce, filter produceFilter) []models.Produce {
+	var filtered []models.Produce
+	for _, val := range produce {
+		if filter.matches(val) {
+			filtered = append(filtered, val)
+		}
+	}
+	return filtered
 }
 
 // ListProduce is an API handlerFunc for listing all produce inventory in the DB
 func (s *Server) ListProduce(w http.ResponseWriter, r *http.Request) {
+	queryParams, err := parseQueryParams(r)
+	if err != nil {
+		writeInvalidRequest(w, err)
+		return
+	}
+
 	var produce []models.Produce
-	var err error
 	wg := sync.WaitGroup{}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		produce, err = s.listProduce(getQueryParams(r))
+		produce, err = s.produceManager.ListProduce(queryParams)
 	}()
 	wg.Wait()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 
-	b, err := json.Marshal(produce)
+	page := pageProduce(produce, queryParams)
+
+	contentType, b, err := marshalVersioned(r, page.produce, func() interface{} {
+		return models.ProduceListV2(page.produce)
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	writePageHeaders(w, r, page)
+
+	// a listing has no version of its own so its entity tag covers everything sent
+	etag := contentETag(b, []byte(w.Header().Get(totalCountHeader)), []byte(w.Header().Get("Link")))
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(http.StatusOK)
 	w.Write(b)
-	return
 }
 
-func getQueryParams(r *http.Request) queryParameters {
+// parseQueryParams reads the query parameters of a list request. Every
+// parameter with an invalid value is named in the returned error.
+func parseQueryParams(r *http.Request) (queryParameters, error) {
 	query := r.URL.Query()
-	return queryParameters{
-		sortBy: query.Get(SORTED_BY),
-		order:  query.Get(ORDER),
-		limit:  query.Get(LIMIT),
-		offset: query.Get(OFFSET),
+	queryParams := queryParameters{
+		sortBy: QUERY_PARAM_PRODUCE_CODE,
+	}
+
+	var invalid models.FieldErrors
+	reject := func(field, detail string) {
+		invalid = append(invalid, models.FieldError{Field: field, Reason: models.ReasonInvalidValue, Detail: detail})
 	}
-}
 
-func (s *Server) listProduce(queryParams queryParameters) ([]models.Produce, error) {
-	// s.mutex.RLock()
-	// defer s.mutex.RUnlock()
+	sortBy := strings.ToLower(query.Get(SORTED_BY))
+	switch sortBy {
+	case "":
+	case QUERY_PARAM_NAME, QUERY_PARAM_PRODUCE_CODE, QUERY_PARAM_UNIT_PRICE:
+		queryParams.sortBy = sortBy
+	default:
+		reject(SORTED_BY, SORTED_BY+" must be one of name, producecode or unitprice")
+	}
 
-	var produce []models.Produce
-	for _, val := range s.data {
-		produce = append(produce, val)
+	order := strings.ToLower(query.Get(ORDER))
+	switch order {
+	case "", QUERY_PARAM_ASC, QUERY_PARAM_ASCENDING:
+	case QUERY_PARAM_DESC, QUERY_PARAM_DESCENDING:
+		queryParams.descending = true
+	default:
+		reject(ORDER, ORDER+" must be one of asc, ascending, desc or descending")
 	}
 
-	if queryParams.sortBy != "" {
-		produce = sortProduce(produce, queryParams)
+	if limit := query.Get(LIMIT); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			reject(LIMIT, LIMIT+" must be a whole number of at least 1")
+		}
+		queryParams.limit = n
 	}
 
-	return produce, nil
+	if offset := query.Get(OFFSET); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			reject(OFFSET, OFFSET+" must be a whole number of at least 0")
+		}
+		queryParams.offset = n
+	}
+
+	if token := query.Get(CURSOR); token != "" {
+		cursor, err := decodePageCursor(token)
+		switch {
+		case err != nil:
+			reject(CURSOR, CURSOR+" must be a cursor from the Link header of a previous page")
+		case query.Get(OFFSET) != "":
+			reject(CURSOR, CURSOR+" and "+OFFSET+" cannot be used together")
+		case (sortBy != "" && sortBy != cursor.SortBy) || (order != "" && queryParams.descending != cursor.Descending):
+			reject(SORTED_BY, SORTED_BY+" and "+ORDER+" must match the "+CURSOR)
+		default:
+			queryParams.cursor = cursor
+			queryParams.sortBy = cursor.SortBy
+			queryParams.descending = cursor.Descending
+		}
+	}
+
+	if asOf := query.Get(AS_OF); asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			reject(AS_OF, AS_OF+" must be an RFC 3339 timestamp")
+		} else {
+			t = t.UTC()
+			queryParams.asOf = &t
+		}
+	}
+
+	filter, invalidFilter := parseProduceFilter(query)
+	invalid = append(invalid, invalidFilter...)
+	queryParams.filter = filter
+
+	if len(invalid) > 0 {
+		return queryParameters{}, invalid
+	}
+
+	return queryParams, nil
 }
 
-// sortProduce will attempt to sort the produce slice passed in based on the query parameters
-// provided by the request.
-func sortProduce(produce []models.Produce, queryParams queryParameters) []models.Produce {
-	sortedProduce := make([]models.Produce, len(produce))
+// parseProduceFilter reads the filter query parameters of a request. Every
+// filter with an invalid value is named in the returned field errors.
+func parseProduceFilter(query url.Values) (produceFilter, models.FieldErrors) {
+	filter := produceFilter{
+		nameContains: query.Get(NAME_CONTAINS),
+		namePrefix:   query.Get(NAME_PREFIX),
+	}
 
-	for i, val := range produce {
-		sortedProduce[i] = val
+	var invalid models.FieldErrors
+	reject := func(field, detail string) {
+		invalid = append(invalid, models.FieldError{Field: field, Reason: models.ReasonInvalidValue, Detail: detail})
 	}
 
-	order := queryParams.order
+	if code := query.Get(PRODUCE_CODE); code != "" {
+		produceCode, err := models.ParseProduceCode(code)
+		if err != nil {
+			reject(PRODUCE_CODE, PRODUCE_CODE+" must be a produce code such as A12T-4GH7-QPL9-3N4M")
+		} else {
+			filter.produceCode = produceCode
+		}
+	}
 
-	switch strings.ToLower(queryParams.sortBy) {
-	case QUERY_PARAM_NAME:
-		{
-			if order == QUERY_PARAM_DESC || order == QUERY_PARAM_DESCENDING {
-				sort.Slice(sortedProduce, func(i, j int) bool { return sortedProduce[i].Name > sortedProduce[j].Name })
-			} else {
-				sort.Slice(sortedProduce, func(i, j int) bool { return sortedProduce[i].Name < sortedProduce[j].Name })
-			}
+	if prefix := query.Get(CODE_PREFIX); prefix != "" {
+		if !validProduceCodePrefix.MatchString(prefix) {
+			reject(CODE_PREFIX, CODE_PREFIX+" must be the start of a produce code such as A12T-4G")
+		} else {
+			filter.codePrefix = strings.ToUpper(prefix)
 		}
-	case QUERY_PARAM_PRODUCE_CODE:
-		{
-			if order == QUERY_PARAM_DESC || order == QUERY_PARAM_DESCENDING {
-				sort.Slice(sortedProduce, func(i, j int) bool { return sortedProduce[i].ProduceCode > sortedProduce[j].ProduceCode })
-			} else {
-				sort.Slice(sortedProduce, func(i, j int) bool { return sortedProduce[i].ProduceCode < sortedProduce[j].ProduceCode })
-			}
+	}
+
+	for _, bound := range []struct {
+		name  string
+		price **models.Money
+	}{
+		{MIN_PRICE, &filter.minPrice},
+		{MAX_PRICE, &filter.maxPrice},
+	} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
 		}
-	case QUERY_PARAM_UNIT_PRICE:
-		{
-			if order == QUERY_PARAM_DESC || order == QUERY_PARAM_DESCENDING {
-				sort.Slice(sortedProduce, func(i, j int) bool { return sortedProduce[i].UnitPrice > sortedProduce[j].UnitPrice })
-			} else {
-				sort.Slice(sortedProduce, func(i, j int) bool { return sortedProduce[i].UnitPrice < sortedProduce[j].UnitPrice })
-			}
+
+		price, err := models.ParseMoney(value, models.DefaultCurrency)
+		if err != nil || price.Sign() < 0 {
+			reject(bound.name, bound.name+" must be a decimal amount of at least 0")
+			continue
 		}
+		*bound.price = &price
 	}
 
-	// first split the produce by the offset
-	offset, err := strconv.ParseInt(queryParams.offset, 10, 0)
-	if err != nil || offset >= int64(len(sortedProduce)) || offset < 0 {
-		offset = 0
+	if min, max := filter.minPrice, filter.maxPrice; min != nil && max != nil && min.Cmp(*max) > 0 {
+		reject(MIN_PRICE, MIN_PRICE+" must not be greater than "+MAX_PRICE)
 	}
 
-	sortedProduce = sortedProduce[offset:]
+	return filter, invalid
+}
 
-	// next split the produce so that only the limit requested is returned
-	limit, err := strconv.ParseInt(queryParams.limit, 10, 0)
-	if err != nil || limit > int64(len(sortedProduce)) || limit < 0 {
-		limit = int64(len(sortedProduce))
-	}
+// sortProduce returns a copy of the produce sorted by the query parameters
+func sortProduce(produce []models.Produce, queryParams queryParameters) []models.Produce {
+	sortedProduce := make([]models.Produce, len(produce))
+	copy(sortedProduce, produce)
 
-	return sortedProduce[:limit]
+	sort.Slice(sortedProduce, func(i, j int) bool {
+		return compareProduce(sortedProduce[i], sortedProduce[j], queryParams) < 0
+	})
+
+	return sortedProduce
 }
 
 // CreateProduce is an API handlerFunc for adding new produce(s) to the DB
 func (s *Server) CreateProduce(w http.ResponseWriter, r *http.Request) {
+	atomic, ok := parseBoolQueryParam(w, r, ATOMIC)
+	if !ok {
+		return
+	}
+
 	newProduceRequest := &[]models.Produce{}
 	err := json.NewDecoder(r.Body).Decode(newProduceRequest) //decode the request body into struct and failed if any error occur
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeMalformedBody(w, err)
 		return
 	}
 
 	validProduce, invalidProduce := s.filterNewProduceRequest(*newProduceRequest)
-	createdProduce, failedProduce := s.createAllProduce(validProduce)
 
-	failedProduce = append(failedProduce, invalidProduce...)
+	var createdProduce []models.Produce
+	var failedProduce []models.FailedProduce
+	if atomic {
+		createdProduce, failedProduce, err = s.createProduceAtomically(validProduce, invalidProduce, actorFromRequest(r))
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	} else {
+		createdProduce, failedProduce = s.createAllProduce(validProduce, actorFromRequest(r))
+		failedProduce = append(failedProduce, invalidProduce...)
+	}
 
-	js, err := json.Marshal(&models.CreateProduceResponse{
+	s.metrics.observeCreate(len(*newProduceRequest), len(createdProduce), len(failedProduce))
+
+	createProduceResponse := models.CreateProduceResponse{
 		Created: createdProduce,
 		Invalid: failedProduce,
-	})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
 	}
 
 	status := http.StatusCreated
@@ -175,23 +364,44 @@ func (s *Server) CreateProduce(w http.ResponseWriter, r *http.Request) {
 		status = http.StatusBadRequest
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write(js)
-	return
+	writeVersioned(w, r, status, createProduceResponse, func() interface{} {
+		return createProduceResponse.V2()
+	})
 }
 
-func (s *Server) filterNewProduceRequest(newProduce []models.Produce) ([]models.Produce, []models.Produce) {
+// parseBoolQueryParam reads an optional true or false query parameter, which
+// is false when absent. An invalid value is written as a problem and false is returned.
+func parseBoolQueryParam(w http.ResponseWriter, r *http.Request, name string) (bool, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, true
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		writeInvalidField(w, name, models.ReasonInvalidValue, name+" must be true or false")
+		return false, false
+	}
+	return b, true
+}
+
+// filterNewProduceRequest splits new produce into the produce that can be
+// created and the produce that is invalid along with the reason why. Produce
+// with a produce code used earlier in the request is a duplicate.
+func (s *Server) filterNewProduceRequest(newProduce []models.Produce) ([]models.Produce, []models.FailedProduce) {
 	validProduce := []models.Produce{}
-	failedProduce := []models.Produce{}
+	failedProduce := []models.FailedProduce{}
+	requested := map[string]bool{}
 	for _, val := range newProduce {
-		if _, exists := s.data[strings.ToUpper(val.ProduceCode)]; exists {
-			failedProduce = append(failedProduce, val)
+		produceCode := strings.ToUpper(val.ProduceCode)
+		if requested[produceCode] {
+			failedProduce = append(failedProduce, models.NewFailedProduce(val, models.ReasonDuplicateCode, fmt.Errorf("produce code %s appears more than once in the request", produceCode)))
 			continue
 		}
+		requested[produceCode] = true
 
-		if !isValidProduceCode(val.ProduceCode) {
-			failedProduce = append(failedProduce, val)
+		if reason, err := s.checkNewProduce(val); err != nil {
+			failedProduce = append(failedProduce, models.NewFailedProduce(val, reason, err))
 			continue
 		}
 
@@ -200,21 +410,40 @@ func (s *Server) filterNewProduceRequest(newProduce []models.Produce) ([]models.
 	return validProduce, failedProduce
 }
 
-func isValidProduceCode(produceCode string) bool {
-	validProduceCode := regexp.MustCompile(`[a-zA-Z0-9]{4}\-[a-zA-Z0-9]{4}\-[a-zA-Z0-9]{4}\-[a-zA-Z0-9]{4}`)
-	return validProduceCode.MatchString(produceCode)
+// checkNewProduce returns why a new produce cannot be created along with the
+// machine readable reason, or nil when it can be
+func (s *Server) checkNewProduce(produce models.Produce) (string, error) {
+	if err := s.validator.Validate(produce); err != nil {
+		return invalidProduceReason(err), err
+	}
+
+	if err := s.checkUnitPrice(produce); err != nil {
+		return models.ReasonInvalidPrice, err
+	}
+
+	return "", nil
+}
+
+// checkUnitPrice reports whether the unit price can be stored under the server's rounding policy
+func (s *Server) checkUnitPrice(produce models.Produce) error {
+	_, err := produce.UnitPrice.Round(s.roundingPolicy)
+	return err
 }
 
+// validProduceCodePrefix matches the start of a produce code, such as A12T or A12T-4G
+var validProduceCodePrefix = regexp.MustCompile(`^([a-zA-Z0-9]{4}-){0,3}[a-zA-Z0-9]{0,4}$`)
+
 // createAllProduce will attempt to add every produce passed in by newProduce
 // It will return a slice of all created produce and failed produce for error reporting.
-func (s *Server) createAllProduce(newProduce []models.Produce) ([]models.Produce, []models.Produce) {
+func (s *Server) createAllProduce(newProduce []models.Produce, actor string) ([]models.Produce, []models.FailedProduce) {
 	type createResponse struct {
 		successful *models.Produce
-		failed     *models.Produce
+		failed     *models.FailedProduce
 	}
 
 	createdProduce := []models.Produce{}
-	failedProduce := []models.Produce{}
+	failedProduce := []models.FailedProduce{}
+	mutex := sync.Mutex{}
 	ch := make(chan createResponse)
 	wgSelect := sync.WaitGroup{}
 	wgSelect.Add(1)
@@ -229,14 +458,14 @@ func (s *Server) createAllProduce(newProduce []models.Produce) ([]models.Produce
 					break
 				}
 				if x.successful != nil {
-					s.mutex.Lock()
+					mutex.Lock()
 					createdProduce = append(createdProduce, *x.successful)
-					s.mutex.Unlock()
+					mutex.Unlock()
 				}
 				if x.failed != nil {
-					s.mutex.Lock()
-					failedProduce = append(failedProduce, *x.successful)
-					s.mutex.Unlock()
+					mutex.Lock()
+					failedProduce = append(failedProduce, *x.failed)
+					mutex.Unlock()
 				}
 			}
 		}
@@ -248,10 +477,11 @@ func (s *Server) createAllProduce(newProduce []models.Produce) ([]models.Produce
 		go func(val models.Produce, ch chan createResponse) {
 			defer wg.Done()
 
-			p, err := s.createProduce(val)
+			p, err := s.produceManager.CreateProduce(val, actor)
 			if err != nil {
+				failed := models.NewFailedProduce(val, createFailureReason(err), err)
 				ch <- createResponse{
-					failed: &val,
+					failed: &failed,
 				}
 				return
 			}
@@ -269,29 +499,337 @@ func (s *Server) createAllProduce(newProduce []models.Produce) ([]models.Produce
 	return createdProduce, failedProduce
 }
 
-// createProduce cannot return an error in this implementation
-// however this method is part of an interface so a future implementation that uses
-// a real database would need the option to return an error
-func (s *Server) createProduce(produce models.Produce) (models.Produce, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	newProduce := models.Produce{
-		Name:        produce.Name,
-		ProduceCode: strings.ToUpper(produce.ProduceCode),
-		UnitPrice:   math.Round(produce.UnitPrice*100) / 100,
+// createProduceAtomically creates every valid produce together, or none of
+// it when any new produce is invalid or cannot be created. The reason of every
+// produce that failed is returned, and an error only when the backend failed.
+func (s *Server) createProduceAtomically(validProduce []models.Produce, invalidProduce []models.FailedProduce, actor string) ([]models.Produce, []models.FailedProduce, error) {
+	if len(invalidProduce) > 0 {
+		// nothing is created but produce codes already in use are still reported
+		failedProduce := invalidProduce
+		for _, val := range validProduce {
+			produceCode, err := models.ParseProduceCode(val.ProduceCode)
+			if err != nil {
+				failedProduce = append(failedProduce, models.NewFailedProduce(val, models.ReasonInvalidCodeFormat, err))
+				continue
+			}
+			if _, err := s.produceManager.GetProduce(produceCode); err == nil {
+				failedProduce = append(failedProduce, models.NewFailedProduce(val, models.ReasonDuplicateCode, ErrProduceAlreadyExists))
+			}
+		}
+		return []models.Produce{}, failedProduce, nil
 	}
 
-	s.data[newProduce.ProduceCode] = newProduce
+	if len(validProduce) == 0 {
+		return []models.Produce{}, []models.FailedProduce{}, nil
+	}
 
-	return newProduce, nil
+	createdProduce, err := s.produceManager.CreateAllProduce(validProduce, actor)
+	if batchErr, ok := err.(BatchError); ok {
+		failedProduce := []models.FailedProduce{}
+		for i, val := range validProduce {
+			if err, failed := batchErr[i]; failed {
+				failedProduce = append(failedProduce, models.NewFailedProduce(val, createFailureReason(err), err))
+			}
+		}
+		return []models.Produce{}, failedProduce, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return createdProduce, []models.FailedProduce{}, nil
 }
 
-// DeleteProduce is an API handlerFunc for adding removing produce from the DB
-func (s *Server) DeleteProduce(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	err := s.deleteProduce(vars["productCode"])
+// invalidProduceReason returns the machine readable reason a produce failed
+// validation, which is the reason of its first invalid field
+func invalidProduceReason(err error) string {
+	var fieldErrors models.FieldErrors
+	if errors.As(err, &fieldErrors) && len(fieldErrors) > 0 {
+		return fieldErrors[0].Reason
+	}
+	return models.ReasonInvalidValue
+}
+
+// createFailureReason returns the machine readable reason a backend could not create a produce
+func createFailureReason(err error) string {
+	if _, ok := err.(models.InvalidProduceCodeError); ok {
+		return models.ReasonInvalidCodeFormat
+	}
+
+	switch err {
+	case ErrProduceAlreadyExists:
+		return models.ReasonDuplicateCode
+	case models.ErrExcessPrecision, models.ErrAmountOutOfRange:
+		return models.ReasonInvalidPrice
+	default:
+		return models.ReasonInternal
+	}
+}
+
+// SeedProduce creates every produce of a seed whose produce code is not in
+// the catalog yet, and returns how much was created. Produce already in the
+// catalog is left as it is, so seeding again on every start changes nothing.
+// The seed replaces the default inventory of a Server keeping its produce in
+// memory. Nothing is created when any produce of the seed is invalid.
+func (s *Server) SeedProduce(produce []models.Produce) (int, error) {
+	if s.defaultInventory {
+		backend := newBackend(map[string]models.Produce{})
+		s.produceManager = backend
+		s.promotionManager = backend
+		s.defaultInventory = false
+	}
+
+	existing, err := s.produceManager.ListProduce(queryParameters{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list produce: %s", err)
+	}
+	inCatalog := map[string]bool{}
+	for _, val := range existing {
+		inCatalog[val.ProduceCode] = true
+	}
+	newProduce := []models.Produce{}
+	for _, val := range produce {
+		if !inCatalog[strings.ToUpper(val.ProduceCode)] {
+			newProduce = append(newProduce, val)
+		}
+	}
+
+	validProduce, invalidProduce := s.filterNewProduceRequest(newProduce)
+	createdProduce, failedProduce, err := s.createProduceAtomically(validProduce, invalidProduce, systemActor)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create produce: %s", err)
+	}
+	if len(failedProduce) > 0 {
+		failed := failedProduce[0]
+		return 0, fmt.Errorf("produce %q can not be created: %s", failed.ProduceCode, failed.Detail)
+	}
+	return len(createdProduce), nil
+}
+
+// GetProduce is an API handlerFunc for fetching a single produce from the DB
+func (s *Server) GetProduce(w http.ResponseWriter, r *http.Request) {
+	produceCode, ok := produceCodeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	produce, err := s.produceManager.GetProduce(produceCode)
+	if err != nil {
+		writeProduceManagerError(w, err)
+		return
+	}
+
+	setProduceValidators(w, produce)
+	if notModified(r, produceETag(produce), produce.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeProduce(w, r, produce)
+}
+
+// UpdateProduce is an API handlerFunc for replacing an existing produce in the DB
+func (s *Server) UpdateProduce(w http.ResponseWriter, r *http.Request) {
+	produceCode, ok := produceCodeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	produce := models.Produce{}
+	if err := json.NewDecoder(r.Body).Decode(&produce); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+
+	version, ok := s.checkIfMatch(w, r, produceCode)
+	if !ok {
+		return
+	}
+	produce.Version = version
+
+	s.replaceProduce(w, r, produceCode, produce)
+}
+
+// PatchProduce is an API handlerFunc for partially updating an existing produce
+// in the DB. The request body is a JSON Merge Patch (RFC 7396) of the produce.
+func (s *Server) PatchProduce(w http.ResponseWriter, r *http.Request) {
+	produceCode, ok := produceCodeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var patch interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+
+	current, err := s.produceManager.GetProduce(produceCode)
+	if err != nil {
+		writeProduceManagerError(w, err)
+		return
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, produceETag(current), false) {
+		writePreconditionFailed(w)
+		return
+	}
+
+	// round trip the current produce through its JSON representation so the
+	// patch is applied to exactly what a client would see
+	b, err := json.Marshal(current)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(b, &document); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	patched := mergePatch(document, patch)
+	for _, field := range []string{"name", "produceCode", "unitPrice"} {
+		if patchedObject, ok := patched.(map[string]interface{}); !ok || patchedObject[field] == nil {
+			writeInvalidField(w, field, models.ReasonRequired, "patch cannot remove required field "+field)
+			return
+		}
+	}
+
+	b, err = json.Marshal(patched)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	produce := models.Produce{}
+	if err := json.Unmarshal(b, &produce); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+
+	// the patch was applied to the current produce so it is only stored if
+	// nothing else changed the produce in the meantime
+	produce.Version = current.Version
+
+	s.replaceProduce(w, r, produceCode, produce)
+}
+
+// replaceProduce stores the new value of the produce identified by the path.
+// The produce code in the body is optional but must match the path when present.
+func (s *Server) replaceProduce(w http.ResponseWriter, r *http.Request, produceCode models.ProduceCode, produce models.Produce) {
+	if produce.ProduceCode != "" && !strings.EqualFold(produce.ProduceCode, produceCode.String()) {
+		writeInvalidField(w, "produceCode", models.ReasonImmutable, "produceCode cannot be changed")
+		return
+	}
+	produce.ProduceCode = produceCode.String()
+
+	if err := s.validator.Validate(produce); err != nil {
+		writeInvalidRequest(w, err)
+		return
+	}
+
+	if err := s.checkUnitPrice(produce); err != nil {
+		writeInvalidField(w, "unitPrice", models.ReasonInvalidPrice, err.Error())
+		return
+	}
+
+	updatedProduce, err := s.produceManager.UpdateProduce(produce, actorFromRequest(r))
+	if err != nil {
+		writeProduceManagerError(w, err)
+		return
+	}
+
+	writeProduce(w, r, updatedProduce)
+}
+
+// GetPriceHistory is an API handlerFunc for listing every unit price a
+// produce has had, oldest first, with who set it and when
+func (s *Server) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	produceCode, ok := produceCodeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := s.produceManager.PriceHistory(produceCode)
+	if err != nil {
+		writeProduceManagerError(w, err)
+		return
+	}
+
+	writeVersioned(w, r, http.StatusOK, history, func() interface{} {
+		return models.PriceHistoryV2(history)
+	})
+}
+
+// actorFromRequest returns who is making a change to the catalog. A request
+// authenticated with an API key is made by the key, whatever X-Actor says, so
+// nobody can record a change under the name of someone else.
+func actorFromRequest(r *http.Request) string {
+	if apiKey, ok := authenticatedKey(r); ok {
+		return fmt.Sprintf("%s (API key %s)", apiKey.Name, apiKey.ID)
+	}
+	if actor := strings.TrimSpace(r.Header.Get(actorHeader)); actor != "" {
+		return actor
+	}
+	return anonymousActor
+}
+
+// produceCodeFromPath returns the canonical produce code from the request
+// path. If the produce code is invalid a 400 is written and false is returned.
+func produceCodeFromPath(w http.ResponseWriter, r *http.Request) (models.ProduceCode, bool) {
+	produceCode, err := models.ParseProduceCode(mux.Vars(r)["productCode"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInvalidField(w, "produceCode", models.ReasonInvalidCodeFormat, err.Error())
+		return "", false
+	}
+	return produceCode, true
+}
+
+func writeProduceManagerError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrProduceNotFound:
+		writeProblem(w, http.StatusNotFound, models.ProblemNotFound, err.Error())
+	case ErrProduceAlreadyExists:
+		writeProblem(w, http.StatusConflict, models.ProblemConflict, err.Error())
+	case ErrProduceVersionMismatch:
+		writePreconditionFailed(w)
+	default:
+		writeInternalError(w, err)
+	}
+}
+
+// writeProduce writes a produce along with its ETag and Last-Modified headers
+func writeProduce(w http.ResponseWriter, r *http.Request, produce models.Produce) {
+	setProduceValidators(w, produce)
+	writeVersioned(w, r, http.StatusOK, produce, func() interface{} {
+		return produce.V2()
+	})
+}
+
+// DeleteProduce is an API handlerFunc for removing a produce from the DB. A
+// produce that does not exist is a 404 unless ignore_missing is true, which
+// makes the delete idempotent.
+func (s *Server) DeleteProduce(w http.ResponseWriter, r *http.Request) {
+	produceCode, ok := produceCodeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	ignoreMissing, ok := parseBoolQueryParam(w, r, IGNORE_MISSING)
+	if !ok {
+		return
+	}
+
+	version, ok := s.checkIfMatch(w, r, produceCode)
+	if !ok {
+		return
+	}
+
+	err := s.produceManager.DeleteProduce(produceCode, version, actorFromRequest(r))
+	if err != nil && !(err == ErrProduceNotFound && ignoreMissing) {
+		writeProduceManagerError(w, err)
 		return
 	}
 
@@ -299,13 +837,3 @@ func (s *Server) DeleteProduce(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 	return
 }
-
-// deleteProduce cannot return an error in this implementation
-// however this method is part of an interface so a future implementation that uses
-// a real database would need the option to return an error
-func (s *Server) deleteProduce(produceCode string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	delete(s.data, produceCode)
-	return nil
-}
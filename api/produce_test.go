@@ -3,9 +3,13 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/xmattstrongx/supermarket/models"
@@ -48,11 +52,18 @@ func Test_isValidProduceCode(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "invalid product code surrounded by other characters",
+			args: args{
+				produceCode: "xxAAAA-BBBB-CCCC-DDDDxx",
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := isValidProduceCode(tt.args.produceCode); got != tt.want {
-				t.Errorf("isValidProduceCode() = %v, want %v", got, tt.want)
+			if _, err := models.ParseProduceCode(tt.args.produceCode); (err == nil) != tt.want {
+				t.Errorf("ParseProduceCode() error = %v, want valid %v", err, tt.want)
 			}
 		})
 	}
@@ -71,7 +82,7 @@ func Test_sortProduce(t *testing.T) {
 			name: "sort by name",
 			args: args{
 				queryParameters{
-					sortBy: "name",
+					sortBy: QUERY_PARAM_NAME,
 				},
 			},
 			want: produceSortedByNameAsc(),
@@ -80,8 +91,8 @@ func Test_sortProduce(t *testing.T) {
 			name: "sort by name descending",
 			args: args{
 				queryParameters{
-					sortBy: "name",
-					order:  "desc",
+					sortBy:     QUERY_PARAM_NAME,
+					descending: true,
 				},
 			},
 			want: produceSortedByNameDesc(),
@@ -90,7 +101,7 @@ func Test_sortProduce(t *testing.T) {
 			name: "sort by price",
 			args: args{
 				queryParameters{
-					sortBy: "unitPrice",
+					sortBy: QUERY_PARAM_UNIT_PRICE,
 				},
 			},
 			want: produceSortedByPriceAsc(),
@@ -99,8 +110,8 @@ func Test_sortProduce(t *testing.T) {
 			name: "sort by price descending",
 			args: args{
 				queryParameters{
-					sortBy: "unitPrice",
-					order:  "desc",
+					sortBy:     QUERY_PARAM_UNIT_PRICE,
+					descending: true,
 				},
 			},
 			want: produceSortedByPriceDesc(),
@@ -109,7 +120,7 @@ func Test_sortProduce(t *testing.T) {
 			name: "sort by produceCode",
 			args: args{
 				queryParameters{
-					sortBy: "produceCode",
+					sortBy: QUERY_PARAM_PRODUCE_CODE,
 				},
 			},
 			want: produceSortedByProduceCodeAsc(),
@@ -118,97 +129,113 @@ func Test_sortProduce(t *testing.T) {
 			name: "sort by produceCode descending",
 			args: args{
 				queryParameters{
-					sortBy: "produceCode",
-					order:  "desc",
+					sortBy:     QUERY_PARAM_PRODUCE_CODE,
+					descending: true,
 				},
 			},
 			want: produceSortedByProduceCodeDesc(),
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortProduce(generateTestProduceData(), tt.args.queryParams); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortProduce() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sortProduceTies(t *testing.T) {
+	produce := []models.Produce{
+		{Name: "Peach", ProduceCode: "ZZZZ-9UI3-TH15-QR88", UnitPrice: models.NewMoney(299, models.USD)},
+		{Name: "Peach", ProduceCode: "AAAA-9UI3-TH15-QR88", UnitPrice: models.NewMoney(299, models.USD)},
+		{Name: "Peach", ProduceCode: "MMMM-9UI3-TH15-QR88", UnitPrice: models.NewMoney(299, models.USD)},
+	}
+	for _, sortBy := range []string{QUERY_PARAM_NAME, QUERY_PARAM_UNIT_PRICE} {
+		got := sortProduce(produce, queryParameters{sortBy: sortBy})
+		for i, want := range []string{"AAAA-9UI3-TH15-QR88", "MMMM-9UI3-TH15-QR88", "ZZZZ-9UI3-TH15-QR88"} {
+			if got[i].ProduceCode != want {
+				t.Errorf("sortProduce() by %s listed %s at %d, want %s", sortBy, got[i].ProduceCode, i, want)
+			}
+		}
+	}
+}
+
+func Test_pageProduce(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryParams queryParameters
+		want        []models.Produce
+		wantNext    bool
+		wantPrev    bool
+	}{
 		{
-			name: "sort by name limit 2 offset 1",
-			args: args{
-				queryParameters{
-					sortBy: "name",
-					offset: "1",
-					limit:  "2",
-				},
-			},
-			want: produceSortedByNameLimit2Offset1(),
+			name:        "sort by name limit 2 offset 1",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_NAME, offset: 1, limit: 2},
+			want:        produceSortedByNameLimit2Offset1(),
+			wantPrev:    true,
 		},
 		{
-			name: "sort by price desc limit 2 offset 0",
-			args: args{
-				queryParameters{
-					sortBy: "unitPrice",
-					order:  "desc",
-					offset: "0",
-					limit:  "2",
-				},
-			},
-			want: produceSortedByPriceLimit2Offset0Desc(),
+			name:        "sort by price desc limit 2 offset 0",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_UNIT_PRICE, descending: true, limit: 2},
+			want:        produceSortedByPriceLimit2Offset0Desc(),
+			wantNext:    true,
 		},
 		{
-			name: "sort by produceCode desc offset 1",
-			args: args{
-				queryParameters{
-					sortBy: "produceCode",
-					order:  "desc",
-					offset: "1",
-				},
-			},
-			want: produceSortedByProductCodeOffset1Desc(),
+			name:        "sort by produceCode desc offset 1",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_PRODUCE_CODE, descending: true, offset: 1},
+			want:        produceSortedByProductCodeOffset1Desc(),
+			wantPrev:    true,
 		},
 		{
-			name: "limit greater than length",
-			args: args{
-				queryParameters{
-					limit: string(len(generateTestProduceData()) + 1),
-				},
-			},
-			want: generateTestProduceData(),
+			name:        "limit greater than length",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_PRODUCE_CODE, limit: len(generateTestProduceData()) + 1},
+			want:        produceSortedByProduceCodeAsc(),
 		},
 		{
-			name: "offset greater than length",
-			args: args{
-				queryParameters{
-					offset: string(len(generateTestProduceData())),
-				},
-			},
-			want: generateTestProduceData(),
+			name:        "offset greater than length",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_PRODUCE_CODE, offset: len(generateTestProduceData())},
+			want:        []models.Produce{},
 		},
 		{
-			name: "offset greater than length limit 2",
-			args: args{
-				queryParameters{
-					offset: string(len(generateTestProduceData())),
-					limit:  "2",
-				},
-			},
-			want: produceOffsetOverLengthLimit2(),
+			name:        "offset greater than length limit 2",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_PRODUCE_CODE, offset: len(generateTestProduceData()), limit: 2},
+			want:        []models.Produce{},
 		},
 		{
-			name: "offset is negative",
-			args: args{
-				queryParameters{
-					offset: "-1",
-				},
-			},
-			want: generateTestProduceData(),
+			name:        "cursor after a produce",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_NAME, limit: 1, cursor: &pageCursor{SortBy: QUERY_PARAM_NAME, Name: "Green Pepper", ProduceCode: "YRT6-72AS-K736-L4AR"}},
+			want:        produceSortedByNameAsc()[1:2],
+			wantNext:    true,
+			wantPrev:    true,
 		},
 		{
-			name: "limit is negative",
-			args: args{
-				queryParameters{
-					limit: "-1",
-				},
-			},
-			want: generateTestProduceData(),
+			name:        "cursor before a produce",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_NAME, limit: 1, cursor: &pageCursor{SortBy: QUERY_PARAM_NAME, Before: true, Name: "Lettuce", ProduceCode: "A12T-4GH7-QPL9-3N4M"}},
+			want:        produceSortedByNameAsc()[:1],
+			wantNext:    true,
+		},
+		{
+			name:        "cursor after a deleted produce",
+			queryParams: queryParameters{sortBy: QUERY_PARAM_UNIT_PRICE, limit: 2, cursor: &pageCursor{SortBy: QUERY_PARAM_UNIT_PRICE, UnitPrice: "1.00", Currency: models.USD, ProduceCode: "XX1X-4GH7-QPL9-3N4M"}},
+			want:        produceSortedByPriceAsc()[1:],
+			wantPrev:    true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := sortProduce(generateTestProduceData(), tt.args.queryParams); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("sortProduce() = %v, want %v", got, tt.want)
+			page := pageProduce(generateTestProduceData(), tt.queryParams)
+			if !reflect.DeepEqual(page.produce, tt.want) {
+				t.Errorf("pageProduce() = %v, want %v", page.produce, tt.want)
+			}
+			if page.total != len(generateTestProduceData()) {
+				t.Errorf("pageProduce() total = %d, want %d", page.total, len(generateTestProduceData()))
+			}
+			if (page.next != nil) != tt.wantNext {
+				t.Errorf("pageProduce() next = %v, want next page %v", page.next, tt.wantNext)
+			}
+			if (page.prev != nil) != tt.wantPrev {
+				t.Errorf("pageProduce() prev = %v, want previous page %v", page.prev, tt.wantPrev)
 			}
 		})
 	}
@@ -252,7 +279,7 @@ func TestListProduce(t *testing.T) {
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 	); !ok {
 		t.Errorf("response array does not contain expected field")
@@ -263,7 +290,7 @@ func TestListProduce(t *testing.T) {
 		models.Produce{
 			Name:        "Green Pepper",
 			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
+			UnitPrice:   models.NewMoney(79, models.USD),
 		},
 	); !ok {
 		t.Errorf("response array does not contain expected field")
@@ -274,7 +301,7 @@ func TestListProduce(t *testing.T) {
 		models.Produce{
 			Name:        "Gala Apple",
 			ProduceCode: "TQ4C-VV6T-75ZX-1RMR",
-			UnitPrice:   3.59,
+			UnitPrice:   models.NewMoney(359, models.USD),
 		},
 	); !ok {
 		t.Errorf("response array does not contain expected field")
@@ -285,7 +312,7 @@ func TestListProduce(t *testing.T) {
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 	); !ok {
 		t.Errorf("response array does not contain expected field")
@@ -404,7 +431,7 @@ func TestCreateProduceBadRequest(t *testing.T) {
 	}
 
 	// Check the response body is what we expect.
-	expected := `{"created":[],"createFailed":[{"name":"fumanchu","produceCode":"invalid","unitPrice":1.13333}]}`
+	expected := `{"created":[],"createFailed":[{"name":"fumanchu","produceCode":"invalid","unitPrice":1.13333,"reason":"invalid_code_format","detail":"invalid produce code \"invalid\", must be four groups of four letters or digits such as A12T-4GH7-QPL9-3N4M"}]}`
 	if rr.Body.String() != expected {
 		t.Errorf("handler returned unexpected body: got %v want %v",
 			rr.Body.String(), expected)
@@ -428,7 +455,7 @@ func TestCreateProduceValidAndInvalidRequests(t *testing.T) {
 	}
 
 	// Check the response body is what we expect.
-	expected := `{"created":[{"name":"fumanchu","produceCode":"XX1X-4GH7-QPL9-3N4M","unitPrice":1.13}],"createFailed":[{"name":"fumanchu","produceCode":"XX1X-4GH7-QPL9-","unitPrice":1}]}`
+	expected := `{"created":[{"name":"fumanchu","produceCode":"XX1X-4GH7-QPL9-3N4M","unitPrice":1.13}],"createFailed":[{"name":"fumanchu","produceCode":"XX1X-4GH7-QPL9-","unitPrice":1,"reason":"invalid_code_format","detail":"invalid produce code \"XX1X-4GH7-QPL9-\", must be four groups of four letters or digits such as A12T-4GH7-QPL9-3N4M"}]}`
 	if rr.Body.String() != expected {
 		t.Errorf("handler returned unexpected body: got %v want %v",
 			rr.Body.String(), expected)
@@ -436,25 +463,623 @@ func TestCreateProduceValidAndInvalidRequests(t *testing.T) {
 }
 
 func TestDeleteProduce(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "existing produce", path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M", wantStatus: http.StatusNoContent},
+		{name: "lower case produce code", path: "/api/v1/produce/a12t-4gh7-qpl9-3n4m", wantStatus: http.StatusNoContent},
+		{name: "missing produce", path: "/api/v1/produce/ZZZZ-4GH7-QPL9-3N4M", wantStatus: http.StatusNotFound},
+		{name: "missing produce ignored", path: "/api/v1/produce/ZZZZ-4GH7-QPL9-3N4M?ignore_missing=true", wantStatus: http.StatusNoContent},
+		{name: "invalid ignore missing", path: "/api/v1/produce/A12T-4GH7-QPL9-3N4M?ignore_missing=maybe", wantStatus: http.StatusBadRequest},
+		{name: "invalid produce code", path: "/api/v1/produce/A12T-4GH7", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+
+			req, err := http.NewRequest(http.MethodDelete, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			s.router().ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusNoContent {
+				// Check the response body is what we expect.
+				if rr.Body.String() != "" {
+					t.Errorf("handler returned unexpected body: got %v want empty", rr.Body.String())
+				}
+			}
+		})
+	}
+
 	s := NewServer()
+	rr := serveRequest(s, http.MethodDelete, "/api/v1/produce/a12t-4gh7-qpl9-3n4m", "", "", "")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if _, err := s.produceManager.GetProduce("A12T-4GH7-QPL9-3N4M"); err != ErrProduceNotFound {
+		t.Errorf("unexpected error getting produce deleted by a lower case code got %v want %v", err, ErrProduceNotFound)
+	}
+
+	rr = serveRequest(s, http.MethodDelete, "/api/v1/produce/A12T-4GH7-QPL9-3N4M", "", "", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code deleting twice: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetProduce(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "existing produce",
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":3.46}`,
+		},
+		{
+			name:       "produce code is case insensitive",
+			path:       "/api/v1/produce/a12t-4gh7-qpl9-3n4m",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":3.46}`,
+		},
+		{
+			name:       "unknown produce",
+			path:       "/api/v1/produce/XX1X-4GH7-QPL9-3N4M",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid produce code",
+			path:       "/api/v1/produce/invalid",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			s.router().ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.wantStatus)
+			}
+
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUpdateProduce(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "put replaces produce and rounds the price",
+			method:     http.MethodPut,
+			path:       "/api/v1/produce/a12t-4gh7-qpl9-3n4m",
+			body:       `{"name":"Romaine","unitPrice":2.555}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Romaine","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":2.56}`,
+		},
+		{
+			name:       "put with matching produce code",
+			method:     http.MethodPut,
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M",
+			body:       `{"name":"Romaine","produceCode":"a12t-4gh7-qpl9-3n4m","unitPrice":2}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Romaine","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":2}`,
+		},
+		{
+			name:       "put cannot change the produce code",
+			method:     http.MethodPut,
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M",
+			body:       `{"name":"Romaine","produceCode":"XX1X-4GH7-QPL9-3N4M","unitPrice":2}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "put unknown produce",
+			method:     http.MethodPut,
+			path:       "/api/v1/produce/XX1X-4GH7-QPL9-3N4M",
+			body:       `{"name":"Romaine","unitPrice":2}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "put invalid produce code",
+			method:     http.MethodPut,
+			path:       "/api/v1/produce/invalid",
+			body:       `{"name":"Romaine","unitPrice":2}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "patch only changes the fields in the patch",
+			method:     http.MethodPatch,
+			path:       "/api/v1/produce/E5T6-9UI3-TH15-QR88",
+			body:       `{"unitPrice":1.499}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Peach","produceCode":"E5T6-9UI3-TH15-QR88","unitPrice":1.5}`,
+		},
+		{
+			name:       "patch cannot remove a required field",
+			method:     http.MethodPatch,
+			path:       "/api/v1/produce/E5T6-9UI3-TH15-QR88",
+			body:       `{"name":null}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "patch unknown produce",
+			method:     http.MethodPatch,
+			path:       "/api/v1/produce/XX1X-4GH7-QPL9-3N4M",
+			body:       `{"unitPrice":1}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBuffer([]byte(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			s.router().ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.wantStatus)
+			}
+
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCreateProduceRejectExcessPrecision(t *testing.T) {
+	s := NewServer(WithRoundingPolicy(models.RejectExcessPrecision))
 
-	req, err := http.NewRequest(http.MethodDelete, "/produce/A12T-4GH7-QPL9-3N4M", nil)
+	req, err := http.NewRequest(http.MethodPost, "/produce", bytes.NewBuffer([]byte(`[{"name":"fumanchu","produceCode":"XX1X-4GH7-QPL9-3N4M","unitPrice": 1.13333},{"name":"oomanchu","produceCode":"2222-4GH7-QPL9-3N4M","unitPrice": 1.10}]`)))
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(s.DeleteProduce)
+	handler := http.HandlerFunc(s.CreateProduce)
 	handler.ServeHTTP(rr, req)
-	if status := rr.Code; status != http.StatusNoContent {
+	if status := rr.Code; status != http.StatusMultiStatus {
 		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusCreated)
+			status, http.StatusMultiStatus)
+	}
+
+	// Check the response body is what we expect.
+	expected := `{"created":[{"name":"oomanchu","produceCode":"2222-4GH7-QPL9-3N4M","unitPrice":1.1}],"createFailed":[{"name":"fumanchu","produceCode":"XX1X-4GH7-QPL9-3N4M","unitPrice":1.13333,"reason":"invalid_price","detail":"price has more decimal places than its currency allows"}]}`
+	if rr.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v",
+			rr.Body.String(), expected)
+	}
+}
+
+func TestListProduceV2Representation(t *testing.T) {
+	s := NewServer()
+
+	req, err := http.NewRequest(http.MethodGet, "/produce?sort_by=unitPrice&limit=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/vnd.supermarket.v2+json")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(s.ListProduce)
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/vnd.supermarket.v2+json" {
+		t.Errorf("handler returned wrong content type: got %v want %v",
+			contentType, "application/vnd.supermarket.v2+json")
 	}
 
 	// Check the response body is what we expect.
-	expected := ``
+	expected := `[{"name":"Green Pepper","produceCode":"YRT6-72AS-K736-L4AR","unitPrice":{"amount":"0.79","currency":"USD"}},{"name":"Peach","produceCode":"E5T6-9UI3-TH15-QR88","unitPrice":{"amount":"2.99","currency":"USD"}}]`
 	if rr.Body.String() != expected {
 		t.Errorf("handler returned unexpected body: got %v want %v",
 			rr.Body.String(), expected)
 	}
 }
+
+func TestListProduceFilters(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantCodes []string
+	}{
+		{name: "no filters", query: "", wantCodes: []string{"A12T-4GH7-QPL9-3N4M", "E5T6-9UI3-TH15-QR88", "TQ4C-VV6T-75ZX-1RMR", "YRT6-72AS-K736-L4AR"}},
+		{name: "name contains ignores case", query: "name_contains=PEP", wantCodes: []string{"YRT6-72AS-K736-L4AR"}},
+		{name: "name contains matches several", query: "name_contains=e", wantCodes: []string{"A12T-4GH7-QPL9-3N4M", "E5T6-9UI3-TH15-QR88", "TQ4C-VV6T-75ZX-1RMR", "YRT6-72AS-K736-L4AR"}},
+		{name: "name prefix", query: "name_prefix=g", wantCodes: []string{"TQ4C-VV6T-75ZX-1RMR", "YRT6-72AS-K736-L4AR"}},
+		{name: "name prefix is not a substring match", query: "name_prefix=apple", wantCodes: nil},
+		{name: "produce code ignores case", query: "produce_code=e5t6-9ui3-th15-qr88", wantCodes: []string{"E5T6-9UI3-TH15-QR88"}},
+		{name: "code prefix", query: "code_prefix=a12t-4g", wantCodes: []string{"A12T-4GH7-QPL9-3N4M"}},
+		{name: "min price is inclusive", query: "min_price=3.46", wantCodes: []string{"A12T-4GH7-QPL9-3N4M", "TQ4C-VV6T-75ZX-1RMR"}},
+		{name: "max price is inclusive", query: "max_price=2.99", wantCodes: []string{"E5T6-9UI3-TH15-QR88", "YRT6-72AS-K736-L4AR"}},
+		{name: "price range", query: "min_price=1&max_price=3.5", wantCodes: []string{"A12T-4GH7-QPL9-3N4M", "E5T6-9UI3-TH15-QR88"}},
+		{name: "filters combine", query: "name_contains=a&max_price=3", wantCodes: []string{"E5T6-9UI3-TH15-QR88"}},
+		{name: "filters apply before limit", query: "name_prefix=g&sort_by=unitPrice&limit=1", wantCodes: []string{"YRT6-72AS-K736-L4AR"}},
+	}
+	for name, newManager := range historyTestBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			manager, cleanup := newManager()
+			defer cleanup()
+			s := NewServer(WithProduceManager(manager))
+
+			for _, tt := range tests {
+				rr := serveRequest(s, http.MethodGet, "/api/v1/produce?"+tt.query, "", "", "")
+				if rr.Code != http.StatusOK {
+					t.Fatalf("%s: handler returned wrong status code: got %v want %v", tt.name, rr.Code, http.StatusOK)
+				}
+
+				produce := []models.Produce{}
+				if err := json.Unmarshal(rr.Body.Bytes(), &produce); err != nil {
+					t.Fatal(err)
+				}
+				var codes []string
+				for _, val := range produce {
+					codes = append(codes, val.ProduceCode)
+				}
+				if !strings.Contains(tt.query, "sort_by") {
+					sort.Strings(codes)
+				}
+				if !reflect.DeepEqual(codes, tt.wantCodes) {
+					t.Errorf("%s: handler returned wrong produce: got %v want %v", tt.name, codes, tt.wantCodes)
+				}
+			}
+		})
+	}
+}
+
+func TestListProduceInvalidFilters(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantInvalid []string
+	}{
+		{name: "invalid produce code", query: "produce_code=A12T", wantInvalid: []string{"produce_code"}},
+		{name: "invalid code prefix", query: "code_prefix=A1-2", wantInvalid: []string{"code_prefix"}},
+		{name: "invalid min price", query: "min_price=cheap", wantInvalid: []string{"min_price"}},
+		{name: "negative max price", query: "max_price=-1", wantInvalid: []string{"max_price"}},
+		{name: "min price greater than max price", query: "min_price=3&max_price=2", wantInvalid: []string{"min_price must not be greater than max_price"}},
+		{name: "every invalid parameter is listed", query: "as_of=yesterday&code_prefix=!&min_price=x&max_price=y", wantInvalid: []string{"as_of", "code_prefix", "min_price", "max_price"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveRequest(NewServer(), http.MethodGet, "/api/v1/produce?"+tt.query, "", "", "")
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+			for _, invalid := range tt.wantInvalid {
+				if !strings.Contains(rr.Body.String(), invalid) {
+					t.Errorf("handler returned error %q that does not name %q", rr.Body.String(), invalid)
+				}
+			}
+		})
+	}
+}
+
+// pageLink returns the URL of a relation in the Link header of a response
+func pageLink(t *testing.T, rr *httptest.ResponseRecorder, rel string) string {
+	for _, link := range strings.Split(rr.Header().Get("Link"), ", ") {
+		if strings.HasSuffix(link, `; rel="`+rel+`"`) {
+			return strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="`+rel+`"`)
+		}
+	}
+	return ""
+}
+
+func TestListProducePagination(t *testing.T) {
+	s := NewServer()
+
+	names := func(rr *httptest.ResponseRecorder) []string {
+		produce := []models.Produce{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &produce); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, val := range produce {
+			names = append(names, val.Name)
+		}
+		return names
+	}
+
+	rr := serveRequest(s, http.MethodGet, "/api/v1/produce?sort_by=name&limit=2&name_contains=e", "", "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got, want := names(rr), []string{"Gala Apple", "Green Pepper"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handler returned wrong first page: got %v want %v", got, want)
+	}
+	if total := rr.Header().Get(totalCountHeader); total != "4" {
+		t.Errorf("handler returned wrong total count: got %v want %v", total, 4)
+	}
+	next := pageLink(t, rr, "next")
+	if next == "" || pageLink(t, rr, "prev") != "" {
+		t.Fatalf("handler returned wrong links for the first page: %v", rr.Header().Get("Link"))
+	}
+	if !strings.Contains(next, "name_contains=e") || !strings.Contains(next, "sort_by=name") {
+		t.Errorf("next link does not keep the filter and sort: %v", next)
+	}
+
+	// produce created before the cursor and produce deleted after it do not shift the next page
+	for _, val := range []models.Produce{
+		{Name: "Beet", ProduceCode: "BEET-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(199, models.USD)},
+		{Name: "Leek", ProduceCode: "LEEK-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(99, models.USD)},
+	} {
+		if _, err := s.produceManager.CreateProduce(val, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.produceManager.DeleteProduce("A12T-4GH7-QPL9-3N4M", 0, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = serveRequest(s, http.MethodGet, next, "", "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got, want := names(rr), []string{"Leek", "Peach"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handler returned wrong next page: got %v want %v", got, want)
+	}
+	if total := rr.Header().Get(totalCountHeader); total != "5" {
+		t.Errorf("handler returned wrong total count: got %v want %v", total, 5)
+	}
+	prev := pageLink(t, rr, "prev")
+	if prev == "" || pageLink(t, rr, "next") != "" || pageLink(t, rr, "first") == "" {
+		t.Fatalf("handler returned wrong links for the last page: %v", rr.Header().Get("Link"))
+	}
+
+	rr = serveRequest(s, http.MethodGet, prev, "", "", "")
+	if got, want := names(rr), []string{"Gala Apple", "Green Pepper"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handler returned wrong previous page: got %v want %v", got, want)
+	}
+	if pageLink(t, rr, "prev") == "" || pageLink(t, rr, "next") == "" {
+		t.Errorf("handler returned wrong links for the previous page: %v", rr.Header().Get("Link"))
+	}
+}
+
+func TestListProduceInvalidPaging(t *testing.T) {
+	cursor := (&pageCursor{SortBy: QUERY_PARAM_NAME, Name: "Lettuce", ProduceCode: "A12T-4GH7-QPL9-3N4M"}).encode()
+
+	tests := []struct {
+		name        string
+		query       string
+		wantInvalid []string
+	}{
+		{name: "invalid limit", query: "limit=ten", wantInvalid: []string{"limit"}},
+		{name: "zero limit", query: "limit=0", wantInvalid: []string{"limit"}},
+		{name: "negative offset", query: "offset=-1", wantInvalid: []string{"offset"}},
+		{name: "unknown sort", query: "sort_by=color", wantInvalid: []string{"sort_by"}},
+		{name: "unknown order", query: "order=sideways", wantInvalid: []string{"order"}},
+		{name: "invalid cursor", query: "cursor=garbage", wantInvalid: []string{"cursor"}},
+		{name: "cursor with offset", query: "offset=1&cursor=" + cursor, wantInvalid: []string{"cursor and offset"}},
+		{name: "cursor with another sort", query: "sort_by=unitprice&cursor=" + cursor, wantInvalid: []string{"must match the cursor"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveRequest(NewServer(), http.MethodGet, "/api/v1/produce?"+tt.query, "", "", "")
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+			for _, invalid := range tt.wantInvalid {
+				if !strings.Contains(rr.Body.String(), invalid) {
+					t.Errorf("handler returned error %q that does not name %q", rr.Body.String(), invalid)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateProduceDuplicatesInRequest(t *testing.T) {
+	body := `[
+		{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1},
+		{"name":"Red Beet","produceCode":"beet-4gh7-qpl9-3n4m","unitPrice":2}
+	]`
+	rr := serveRequest(NewServer(), http.MethodPost, "/api/v1/produce", "", "", body)
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMultiStatus)
+	}
+
+	response := models.CreateProduceResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Created) != 1 || response.Created[0].Name != "Beet" {
+		t.Errorf("handler created wrong produce: got %+v", response.Created)
+	}
+	if len(response.Invalid) != 1 || response.Invalid[0].Name != "Red Beet" || response.Invalid[0].Reason != models.ReasonDuplicateCode {
+		t.Errorf("handler returned wrong failed produce: got %+v", response.Invalid)
+	}
+}
+
+func TestCreateProduceAtomic(t *testing.T) {
+	for name, newManager := range historyTestBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			manager, cleanup := newManager()
+			defer cleanup()
+			s := NewServer(WithProduceManager(manager))
+
+			failing := `[
+				{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1},
+				{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":1},
+				{"name":"Red Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1},
+				{"name":"","produceCode":"LEEK-4GH7-QPL9-3N4M","unitPrice":1}
+			]`
+			rr := serveRequest(s, http.MethodPost, "/api/v1/produce?atomic=true", "", "", failing)
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+
+			response := models.CreateProduceResponse{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Created) != 0 {
+				t.Errorf("handler created produce of a failed atomic request: %+v", response.Created)
+			}
+			reasons := map[string]string{}
+			for _, failed := range response.Invalid {
+				reasons[failed.Name] = failed.Reason
+			}
+			want := map[string]string{
+				"Lettuce":  models.ReasonDuplicateCode,
+				"Red Beet": models.ReasonDuplicateCode,
+				"":         models.ReasonInvalidName,
+			}
+			if !reflect.DeepEqual(reasons, want) {
+				t.Errorf("handler returned wrong failure reasons: got %v want %v", reasons, want)
+			}
+
+			if _, err := manager.GetProduce("BEET-4GH7-QPL9-3N4M"); err != ErrProduceNotFound {
+				t.Errorf("produce of a failed atomic request was stored: %v", err)
+			}
+
+			// a produce code already in use is only found by the backend when the rest is valid
+			duplicate := `[
+				{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1},
+				{"name":"Lettuce","produceCode":"a12t-4gh7-qpl9-3n4m","unitPrice":1}
+			]`
+			rr = serveRequest(s, http.MethodPost, "/api/v1/produce?atomic=true", "", "", duplicate)
+			response = models.CreateProduceResponse{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if rr.Code != http.StatusBadRequest || len(response.Invalid) != 1 || response.Invalid[0].Reason != models.ReasonDuplicateCode {
+				t.Errorf("handler returned unexpected response %v %s", rr.Code, rr.Body.String())
+			}
+			if _, err := manager.GetProduce("BEET-4GH7-QPL9-3N4M"); err != ErrProduceNotFound {
+				t.Errorf("produce of a failed atomic request was stored: %v", err)
+			}
+
+			succeeding := `[
+				{"name":"Beet","produceCode":"beet-4gh7-qpl9-3n4m","unitPrice":1},
+				{"name":"Leek","produceCode":"LEEK-4GH7-QPL9-3N4M","unitPrice":1.005}
+			]`
+			rr = serveRequest(s, http.MethodPost, "/api/v1/produce?atomic=true", actorHeader, "loader", succeeding)
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+			}
+
+			for _, code := range []models.ProduceCode{"BEET-4GH7-QPL9-3N4M", "LEEK-4GH7-QPL9-3N4M"} {
+				if _, err := manager.GetProduce(code); err != nil {
+					t.Errorf("produce %s of an atomic request was not stored: %v", code, err)
+				}
+				history, err := manager.PriceHistory(code)
+				if err != nil || len(history) != 1 || history[0].Actor != "loader" {
+					t.Errorf("unexpected price history of %s: %+v %v", code, history, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateProduceAtomicInvalidValue(t *testing.T) {
+	rr := serveRequest(NewServer(), http.MethodPost, "/api/v1/produce?atomic=maybe", "", "", `[]`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSeedProduce(t *testing.T) {
+	seed := []models.Produce{
+		{Name: "Beet", ProduceCode: "BEET-4GH7-QPL9-3N4M", UnitPrice: models.MustParseMoney("1.25", models.USD)},
+		{Name: "Kale", ProduceCode: "KALE-4GH7-QPL9-3N4M", UnitPrice: models.MustParseMoney("2.50", models.USD)},
+	}
+
+	// the seed replaces the default inventory kept in memory
+	s := NewServer()
+	created, err := s.SeedProduce(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != len(seed) {
+		t.Errorf("wrong produce count seeded: got %d want %d", created, len(seed))
+	}
+	produce, err := s.produceManager.ListProduce(queryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	produce = sortProduce(produce, queryParameters{sortBy: QUERY_PARAM_PRODUCE_CODE})
+	if len(produce) != len(seed) || produce[0].ProduceCode != "BEET-4GH7-QPL9-3N4M" || produce[1].ProduceCode != "KALE-4GH7-QPL9-3N4M" {
+		t.Errorf("wrong produce after seeding: %+v", produce)
+	}
+
+	// produce already in the catalog is left as it is
+	changed := seed[0]
+	changed.Name = "Golden Beet"
+	leek := models.Produce{Name: "Leek", ProduceCode: "LEEK-4GH7-QPL9-3N4M", UnitPrice: models.MustParseMoney("1", models.USD)}
+	created, err = s.SeedProduce([]models.Produce{changed, seed[1], leek})
+	if err != nil || created != 1 {
+		t.Errorf("SeedProduce() of a seeded catalog = %d, %v want 1", created, err)
+	}
+	beet, err := s.produceManager.GetProduce("BEET-4GH7-QPL9-3N4M")
+	if err != nil || beet.Name != "Beet" {
+		t.Errorf("seeding changed produce in the catalog: %+v, %v", beet, err)
+	}
+
+	// nothing is created when any produce is invalid
+	s = NewServer()
+	if _, err := s.SeedProduce(append(seed, models.Produce{Name: "Leek", ProduceCode: "not-a-code"})); err == nil {
+		t.Fatal("expected an error seeding invalid produce")
+	}
+	if produce, err := s.produceManager.ListProduce(queryParameters{}); err != nil || len(produce) != 0 {
+		t.Errorf("produce seeded from an invalid seed: %+v, %v", produce, err)
+	}
+}
+
+func Test_invalidProduceReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "field errors", err: models.FieldErrors{{Field: "name", Reason: models.ReasonInvalidName}, {Field: "unitPrice", Reason: models.ReasonInvalidPrice}}, want: models.ReasonInvalidName},
+		{name: "wrapped field errors", err: fmt.Errorf("invalid: %w", models.FieldErrors{{Field: "unitPrice", Reason: models.ReasonInvalidPrice}}), want: models.ReasonInvalidPrice},
+		{name: "no field errors", err: models.FieldErrors{}, want: models.ReasonInvalidValue},
+		{name: "another error", err: errors.New("invalid"), want: models.ReasonInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := invalidProduceReason(tt.err); got != tt.want {
+				t.Errorf("invalidProduceReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
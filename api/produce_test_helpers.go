@@ -1,23 +1,41 @@
 package api
 
-import "github.com/xmattstrongx/supermarket/models"
+import (
+	"net/http/httptest"
+	"strings"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// serveRequest serves a request with an optional header through the router of
+// s. The header is left out when its name is empty.
+func serveRequest(s *Server, method, path, header, value, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+
+	rr := httptest.NewRecorder()
+	s.router().ServeHTTP(rr, req)
+	return rr
+}
 
 func generateTestProduceData() []models.Produce {
 	return []models.Produce{
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 		models.Produce{
 			Name:        "Green Pepper",
 			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
+			UnitPrice:   models.NewMoney(79, models.USD),
 		},
 	}
 }
@@ -27,17 +45,17 @@ func produceSortedByNameAsc() []models.Produce {
 		models.Produce{
 			Name:        "Green Pepper",
 			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
+			UnitPrice:   models.NewMoney(79, models.USD),
 		},
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 	}
 }
@@ -47,17 +65,17 @@ func produceSortedByNameDesc() []models.Produce {
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 		models.Produce{
 			Name:        "Green Pepper",
 			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
+			UnitPrice:   models.NewMoney(79, models.USD),
 		},
 	}
 }
@@ -67,17 +85,17 @@ func produceSortedByPriceAsc() []models.Produce {
 		models.Produce{
 			Name:        "Green Pepper",
 			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
+			UnitPrice:   models.NewMoney(79, models.USD),
 		},
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 	}
 }
@@ -87,17 +105,17 @@ func produceSortedByPriceDesc() []models.Produce {
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 		models.Produce{
 			Name:        "Green Pepper",
 			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
+			UnitPrice:   models.NewMoney(79, models.USD),
 		},
 	}
 }
@@ -107,17 +125,17 @@ func produceSortedByProduceCodeAsc() []models.Produce {
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 		models.Produce{
 			Name:        "Green Pepper",
 			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
+			UnitPrice:   models.NewMoney(79, models.USD),
 		},
 	}
 }
@@ -127,17 +145,17 @@ func produceSortedByProduceCodeDesc() []models.Produce {
 		models.Produce{
 			Name:        "Green Pepper",
 			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
+			UnitPrice:   models.NewMoney(79, models.USD),
 		},
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 	}
 }
@@ -147,12 +165,12 @@ func produceSortedByNameLimit2Offset1() []models.Produce {
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 	}
 }
@@ -162,12 +180,12 @@ func produceSortedByPriceLimit2Offset0Desc() []models.Produce {
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 	}
 }
@@ -177,27 +195,12 @@ func produceSortedByProductCodeOffset1Desc() []models.Produce {
 		models.Produce{
 			Name:        "Peach",
 			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(299, models.USD),
 		},
 		models.Produce{
 			Name:        "Lettuce",
 			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
-		},
-	}
-}
-
-func produceOffsetOverLengthLimit2() []models.Produce {
-	return []models.Produce{
-		models.Produce{
-			Name:        "Lettuce",
-			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
-		},
-		models.Produce{
-			Name:        "Peach",
-			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
+			UnitPrice:   models.NewMoney(346, models.USD),
 		},
 	}
 }
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// ListPromotions is an API handlerFunc for listing every promotion
+func (s *Server) ListPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := s.promotionManager.ListPromotions()
+	if err != nil {
+		writePromotionManagerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, promotions)
+}
+
+// GetPromotion is an API handlerFunc for fetching a single promotion
+func (s *Server) GetPromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, err := s.promotionManager.GetPromotion(mux.Vars(r)["promotionID"])
+	if err != nil {
+		writePromotionManagerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, promotion)
+}
+
+// CreatePromotion is an API handlerFunc for adding a promotion. The id of the
+// promotion is always chosen by the server.
+func (s *Server) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotion := models.Promotion{}
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	promotion.ID = id
+
+	if !s.checkPromotion(w, &promotion) {
+		return
+	}
+
+	created, err := s.promotionManager.CreatePromotion(promotion)
+	if err != nil {
+		writePromotionManagerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// UpdatePromotion is an API handlerFunc for replacing an existing promotion.
+// The id in the body is optional but must match the path when present.
+func (s *Server) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["promotionID"]
+
+	promotion := models.Promotion{}
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+
+	if promotion.ID != "" && promotion.ID != id {
+		writeInvalidField(w, "id", models.ReasonImmutable, "id cannot be changed")
+		return
+	}
+	promotion.ID = id
+
+	if !s.checkPromotion(w, &promotion) {
+		return
+	}
+
+	updated, err := s.promotionManager.UpdatePromotion(promotion)
+	if err != nil {
+		writePromotionManagerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeletePromotion is an API handlerFunc for removing a promotion
+func (s *Server) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	if err := s.promotionManager.DeletePromotion(mux.Vars(r)["promotionID"]); err != nil {
+		writePromotionManagerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Quote is an API handlerFunc for pricing a list of items with the promotions
+// that are valid, without creating a cart
+func (s *Server) Quote(w http.ResponseWriter, r *http.Request) {
+	request := models.QuoteRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+
+	at := time.Now().UTC()
+	if request.At != nil {
+		at = *request.At
+	}
+
+	// the same produce listed twice is priced as one line so promotions such as
+	// buy 2 get 1 free see the whole quantity
+	var order []string
+	quantities := map[string]models.Quantity{}
+	produce := map[string]models.Produce{}
+	for _, item := range request.Items {
+		p, ok := s.checkCartItem(w, &item)
+		if !ok {
+			return
+		}
+
+		if _, seen := quantities[item.ProduceCode]; !seen {
+			order = append(order, item.ProduceCode)
+			produce[item.ProduceCode] = p
+		}
+		quantity, ok := quantities[item.ProduceCode].Add(item.Quantity)
+		if !ok {
+			writeInvalidField(w, "items", models.ReasonInvalidValue, "the quantities of produce "+item.ProduceCode+" add up beyond the largest quantity that can be held")
+			return
+		}
+		quantities[item.ProduceCode] = quantity
+	}
+
+	lines := make([]models.LineItem, 0, len(order))
+	for _, code := range order {
+		line, err := models.NewLineItem(produce[code], quantities[code])
+		if err != nil {
+			writeInvalidField(w, "items", models.ReasonInvalidValue, err.Error())
+			return
+		}
+		lines = append(lines, line)
+	}
+
+	quote, err := s.quote(lines, at)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, quote)
+}
+
+// quote applies the promotions valid at a moment in time to priced lines
+func (s *Server) quote(lines []models.LineItem, at time.Time) (models.Quote, error) {
+	promotions, err := s.promotionManager.ListPromotions()
+	if err != nil {
+		return models.Quote{}, err
+	}
+
+	return models.NewQuote(lines, promotions, at)
+}
+
+// checkPromotion normalizes the target produce code and rounds the amount off
+// of a promotion before validating it. If the promotion is invalid a 400 is
+// written and false is returned.
+func (s *Server) checkPromotion(w http.ResponseWriter, promotion *models.Promotion) bool {
+	if promotion.ProduceCode != "" {
+		produceCode, err := models.ParseProduceCode(promotion.ProduceCode)
+		if err != nil {
+			writeInvalidField(w, "produceCode", models.ReasonInvalidCodeFormat, err.Error())
+			return false
+		}
+		promotion.ProduceCode = produceCode.String()
+	}
+
+	if promotion.Kind == models.AmountOff {
+		amountOff, err := promotion.AmountOff.Round(s.roundingPolicy)
+		if err != nil {
+			writeInvalidField(w, "amountOff", models.ReasonInvalidPrice, err.Error())
+			return false
+		}
+		promotion.AmountOff = amountOff
+	} else {
+		promotion.AmountOff = models.Money{}
+	}
+
+	if err := promotion.Validate(); err != nil {
+		writeInvalidRequest(w, err)
+		return false
+	}
+
+	return true
+}
+
+func writePromotionManagerError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrPromotionNotFound:
+		writeProblem(w, http.StatusNotFound, models.ProblemNotFound, err.Error())
+	case ErrPromotionAlreadyExists:
+		writeProblem(w, http.StatusConflict, models.ProblemConflict, err.Error())
+	default:
+		writeInternalError(w, err)
+	}
+}
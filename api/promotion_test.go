@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func newTestPromotion(t *testing.T, s *Server, body string) models.Promotion {
+	rr := serveRequest(s, http.MethodPost, "/api/v1/promotions", "", "", body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create promotion returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	promotion := models.Promotion{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &promotion); err != nil {
+		t.Fatal(err)
+	}
+	return promotion
+}
+
+func TestPromotionLifecycle(t *testing.T) {
+	s := NewServer()
+
+	created := newTestPromotion(t, s, `{"name":"20% off peaches","kind":"percentOff","produceCode":"e5t6-9ui3-th15-qr88","percentOff":20,"startsAt":"2020-01-01T00:00:00Z"}`)
+	if created.ID == "" {
+		t.Fatal("created promotion has no id")
+	}
+	if created.ProduceCode != "E5T6-9UI3-TH15-QR88" {
+		t.Errorf("unexpected produce code got %v want %v", created.ProduceCode, "E5T6-9UI3-TH15-QR88")
+	}
+
+	path := "/api/v1/promotions/" + created.ID
+	rr := serveRequest(s, http.MethodPut, path, "", "", `{"name":"25% off peaches","kind":"percentOff","produceCode":"E5T6-9UI3-TH15-QR88","percentOff":25,"startsAt":"2020-01-01T00:00:00Z"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+
+	rr = serveRequest(s, http.MethodGet, "/api/v1/promotions", "", "", "")
+	promotions := []models.Promotion{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &promotions); err != nil {
+		t.Fatal(err)
+	}
+	if len(promotions) != 1 || promotions[0].PercentOff != 2500 {
+		t.Errorf("unexpected promotions got %+v", promotions)
+	}
+
+	if rr := serveRequest(s, http.MethodDelete, path, "", "", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := serveRequest(s, http.MethodGet, path, "", "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("get after delete returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if rr := serveRequest(s, http.MethodDelete, path, "", "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("second delete returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestPromotionErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "malformed body", method: http.MethodPost, path: "/api/v1/promotions", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "invalid produce code", method: http.MethodPost, path: "/api/v1/promotions", body: `{"name":"x","kind":"percentOff","produceCode":"invalid","percentOff":20,"startsAt":"2020-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown kind", method: http.MethodPost, path: "/api/v1/promotions", body: `{"name":"x","kind":"halfPrice","category":"fruit","startsAt":"2020-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest},
+		{name: "too many decimal places", method: http.MethodPost, path: "/api/v1/promotions", body: `{"name":"x","kind":"percentOff","category":"fruit","percentOff":20.125,"startsAt":"2020-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest},
+		{name: "update unknown promotion", method: http.MethodPut, path: "/api/v1/promotions/missing", body: `{"name":"x","kind":"percentOff","category":"fruit","percentOff":20,"startsAt":"2020-01-01T00:00:00Z"}`, wantStatus: http.StatusNotFound},
+		{name: "update changes id", method: http.MethodPut, path: "/api/v1/promotions/missing", body: `{"id":"other","name":"x","kind":"percentOff","category":"fruit","percentOff":20,"startsAt":"2020-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest},
+		// the quantities would wrap around to 0.384
+		{name: "quote quantities adding up out of range", method: http.MethodPost, path: "/api/v1/pricing/quote", body: `{"items":[{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":6148914691236517},{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":6148914691236517},{"produceCode":"A12T-4GH7-QPL9-3N4M","quantity":6148914691236518}]}`, wantStatus: http.StatusBadRequest},
+		{name: "quote unknown produce", method: http.MethodPost, path: "/api/v1/pricing/quote", body: `{"items":[{"produceCode":"XX1X-4GH7-QPL9-3N4M","quantity":1}]}`, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveRequest(NewServer(), tt.method, tt.path, "", "", tt.body)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	s := NewServer()
+	newTestPromotion(t, s, `{"name":"buy 2 get 1 free","kind":"buyGetFree","produceCode":"E5T6-9UI3-TH15-QR88","buyQuantity":2,"freeQuantity":1,"priority":10,"startsAt":"2020-01-01T00:00:00Z"}`)
+	newTestPromotion(t, s, `{"name":"20% off peaches","kind":"percentOff","produceCode":"E5T6-9UI3-TH15-QR88","percentOff":20,"startsAt":"2020-01-01T00:00:00Z","endsAt":"2020-02-01T00:00:00Z"}`)
+
+	tests := []struct {
+		name      string
+		at        string
+		wantTotal int64
+	}{
+		// 3 x 2.99 = 8.97 less one free peach, then 20% off the remaining 5.98
+		{name: "both promotions valid", at: "2020-01-15T00:00:00Z", wantTotal: 478},
+		{name: "percent off has ended", at: "2020-02-01T00:00:00Z", wantTotal: 598},
+		{name: "no promotion has started", at: "2019-12-31T23:59:59Z", wantTotal: 897},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the same produce listed twice is priced as a single line
+			body := `{"items":[{"produceCode":"e5t6-9ui3-th15-qr88","quantity":2},{"produceCode":"E5T6-9UI3-TH15-QR88","quantity":1}],"at":"` + tt.at + `"}`
+			rr := serveRequest(s, http.MethodPost, "/api/v1/pricing/quote", "", "", body)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+			}
+
+			quote := models.Quote{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &quote); err != nil {
+				t.Fatal(err)
+			}
+			if len(quote.Items) != 1 {
+				t.Fatalf("unexpected number of lines got %v want %v", len(quote.Items), 1)
+			}
+			if want := models.NewMoney(tt.wantTotal, models.USD); quote.Total.Cmp(want) != 0 {
+				t.Errorf("unexpected total got %v want %v", quote.Total, want)
+			}
+		})
+	}
+}
+
+func TestCheckoutAppliesPromotions(t *testing.T) {
+	s := NewServer()
+	newTestPromotion(t, s, `{"name":"$1 off 2 apples","kind":"amountOff","produceCode":"TQ4C-VV6T-75ZX-1RMR","amountOff":{"amount":"1.00","currency":"USD"},"minQuantity":2,"startsAt":"2020-01-01T00:00:00Z"}`)
+
+	cartPath := "/api/v1/carts/" + newTestCart(t, s)
+	if rr := serveRequest(s, http.MethodPost, cartPath+"/items", "", "", `{"produceCode":"TQ4C-VV6T-75ZX-1RMR","quantity":5}`); rr.Code != http.StatusOK {
+		t.Fatalf("add returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr := serveRequest(s, http.MethodPost, cartPath+"/checkout", "", "", "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("checkout returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	receipt := models.Receipt{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &receipt); err != nil {
+		t.Fatal(err)
+	}
+	// 5 x 3.59 = 17.95 less 2 x 1.00
+	if want := models.NewMoney(1795, models.USD); receipt.Subtotal.Cmp(want) != 0 {
+		t.Errorf("unexpected subtotal got %v want %v", receipt.Subtotal, want)
+	}
+	if want := models.NewMoney(200, models.USD); receipt.Discount.Cmp(want) != 0 {
+		t.Errorf("unexpected discount got %v want %v", receipt.Discount, want)
+	}
+	if want := models.NewMoney(1595, models.USD); receipt.Total.Cmp(want) != 0 {
+		t.Errorf("unexpected total got %v want %v", receipt.Total, want)
+	}
+	if len(receipt.Promotions) != 1 {
+		t.Errorf("unexpected promotions on receipt got %+v", receipt.Promotions)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	mediaTypeJSON = "application/json"
+
+	// mediaTypeV2 is requested through the Accept header to receive the version 2
+	// representation where prices are written as an exact amount and a currency
+	mediaTypeV2 = "application/vnd.supermarket.v2+json"
+
+	// mediaTypeProblem is the RFC 7807 media type of every error response
+	mediaTypeProblem = "application/problem+json"
+)
+
+// acceptsV2 reports whether the client asked for the version 2 representation
+func acceptsV2(r *http.Request) bool {
+	for _, accept := range r.Header["Accept"] {
+		for _, mediaType := range strings.Split(accept, ",") {
+			if strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0]) == mediaTypeV2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// marshalVersioned returns the media type and body of the version 1
+// representation of a response, or of version 2 when the client asked for it
+func marshalVersioned(r *http.Request, v1 interface{}, v2 func() interface{}) (string, []byte, error) {
+	contentType, body := mediaTypeJSON, v1
+	if acceptsV2(r) {
+		contentType, body = mediaTypeV2, v2()
+	}
+
+	b, err := json.Marshal(body)
+	return contentType, b, err
+}
+
+// writeVersioned writes the version 1 representation of a response unless the
+// client asked for version 2, in which case v2 is called to build it
+func writeVersioned(w http.ResponseWriter, r *http.Request, status int, v1 interface{}, v2 func() interface{}) {
+	contentType, b, err := marshalVersioned(r, v1, v2)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -1,87 +1,379 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/xmattstrongx/supermarket/models"
+	"github.com/xmattstrongx/supermarket/validator"
 )
 
-// ProduceManager is the interface between the API and the backend storage
+// ProduceManager is the interface between the API and the backend storage.
+// Every change to the catalog is recorded in the history of the produce along
+// with the actor that made it.
 type ProduceManager interface {
 	ListProduce(queryParameters) ([]models.Produce, error)
-	CreateProduce(models.Produce) (models.Produce, error)
-	DeleteProduce(string) error
+	GetProduce(models.ProduceCode) (models.Produce, error)
+	PriceHistory(models.ProduceCode) ([]models.PriceChange, error)
+	CreateProduce(models.Produce, string) (models.Produce, error)
+	// CreateAllProduce creates every produce of a batch together, or none of
+	// them with a BatchError when any of them cannot be created
+	CreateAllProduce([]models.Produce, string) ([]models.Produce, error)
+	// UpdateProduce and DeleteProduce compare and swap: given a version other
+	// than 0 they return ErrProduceVersionMismatch unless the stored produce
+	// still has that version. UpdateProduce takes the version of the produce.
+	UpdateProduce(models.Produce, string) (models.Produce, error)
+	ChangeStock(models.ProduceCode, models.StockChange) (models.Produce, error)
+	DeleteProduce(models.ProduceCode, int64, string) error
+}
+
+// PromotionManager is the interface between the API and the storage of promotions
+type PromotionManager interface {
+	ListPromotions() ([]models.Promotion, error)
+	GetPromotion(string) (models.Promotion, error)
+	CreatePromotion(models.Promotion) (models.Promotion, error)
+	UpdatePromotion(models.Promotion) (models.Promotion, error)
+	DeletePromotion(string) error
 }
 
 // Server is the data structure for holding all types needed by the server to run and serve requests
 type Server struct {
-	produceManager ProduceManager
-	backend
-	// data    map[string]models.Produce
+	produceManager   ProduceManager
+	promotionManager PromotionManager
+	cartManager      CartManager
+	roundingPolicy   models.RoundingPolicy
+	salesTaxRate     models.TaxRate
+	lowStockHandler  func(models.Produce)
+	validator        *validator.Validator
+	idempotency      *idempotencyCache
+	httpConfig       HTTPConfig
+	listenAddress    string
+	tlsCertFile      string
+	tlsKeyFile       string
+	metrics          *serverMetrics
+	keyStore         KeyStore
+	// defaultInventory is true while the produce is kept in the in-memory
+	// store seeded with the default inventory
+	defaultInventory bool
 }
 
-type backend struct {
-	data  map[string]models.Produce
-	once  sync.Once
-	mutex sync.RWMutex
+// DefaultListenAddress is the address Serve listens on without WithListenAddress
+const DefaultListenAddress = ":8000"
+
+// HTTPConfig is how the http.Server started by Serve handles connections and
+// how much of a request it reads. A zero timeout or limit is no limit.
+type HTTPConfig struct {
+	// ReadHeaderTimeout is how long a client may take to send the headers of a request
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is how long a client may take to send a whole request, body included
+	ReadTimeout time.Duration
+	// WriteTimeout is how long a request may take from the end of its headers
+	// until its response is written
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection is kept open waiting for the next request
+	IdleTimeout time.Duration
+	// MaxHeaderBytes is the most bytes the headers of a request may have
+	MaxHeaderBytes int
+	// MaxBodyBytes is the most bytes the body of a request may have. A larger
+	// body is refused with a 413.
+	MaxBodyBytes int64
+	// ShutdownTimeout is how long requests in flight are given to finish when the server shuts down
+	ShutdownTimeout time.Duration
 }
 
-// NewServer instantiates a new Server
-func NewServer() *Server {
-	server := &Server{}
-	server.backend.once.Do(func() {
-		server.backend.data = initializeData()
-	})
+// DefaultHTTPConfig returns the HTTPConfig of a Server without WithHTTPConfig
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      32 << 20,
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// NewServer instantiates a new Server. Without any options the server keeps
+// its produce in memory seeded with the default inventory.
+func NewServer(opts ...func(*Server)) *Server {
+	backend := newBackend(initializeData())
+	server := &Server{
+		produceManager:   backend,
+		promotionManager: backend,
+		cartManager:      newCartBackend(),
+		roundingPolicy:   models.RoundHalfEven,
+		lowStockHandler:  logLowStock,
+		validator:        validator.New(validator.DefaultRules()),
+		idempotency:      newIdempotencyCache(DefaultIdempotencyWindow),
+		httpConfig:       DefaultHTTPConfig(),
+		listenAddress:    DefaultListenAddress,
+		defaultInventory: true,
+	}
+	server.metrics = newServerMetrics(server)
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
 	return server
 }
 
-// Serve starts a Server for handling API requests
-func (s *Server) Serve() {
-	router := mux.NewRouter()
+// WithProduceManager sets the backend storage used by the Server. When the
+// backend can also store promotions they are stored alongside the produce.
+func WithProduceManager(produceManager ProduceManager) func(*Server) {
+	return func(s *Server) {
+		s.produceManager = produceManager
+		s.defaultInventory = false
+		if promotionManager, ok := produceManager.(PromotionManager); ok {
+			s.promotionManager = promotionManager
+		}
+	}
+}
+
+// WithPromotionManager sets the storage used for promotions. It must come
+// after WithProduceManager to store promotions apart from the produce.
+func WithPromotionManager(promotionManager PromotionManager) func(*Server) {
+	return func(s *Server) {
+		s.promotionManager = promotionManager
+	}
+}
+
+// WithCartManager sets the storage used for carts
+func WithCartManager(cartManager CartManager) func(*Server) {
+	return func(s *Server) {
+		s.cartManager = cartManager
+	}
+}
+
+// WithSalesTaxRate sets the sales tax rate charged when a cart is checked out
+func WithSalesTaxRate(rate models.TaxRate) func(*Server) {
+	return func(s *Server) {
+		s.salesTaxRate = rate
+	}
+}
+
+// WithRoundingPolicy sets how unit prices with more decimal places than their currency allows are handled
+func WithRoundingPolicy(policy models.RoundingPolicy) func(*Server) {
+	return func(s *Server) {
+		s.roundingPolicy = policy
+	}
+}
+
+// WithValidationRules sets the rules every produce that is created or replaced must meet
+func WithValidationRules(rules validator.Rules) func(*Server) {
+	return func(s *Server) {
+		s.validator = validator.New(rules)
+	}
+}
+
+// WithIdempotencyWindow sets how long the response to a request with an
+// Idempotency-Key header is kept to be replayed to a retry of the request
+func WithIdempotencyWindow(window time.Duration) func(*Server) {
+	return func(s *Server) {
+		s.idempotency.window = window
+	}
+}
+
+// WithIdempotencyCacheLimits sets how many idempotency keys, and how many
+// bytes of response bodies, are kept at most. When the cache is full the
+// responses that expire soonest are dropped first.
+func WithIdempotencyCacheLimits(entries int, bytes int64) func(*Server) {
+	return func(s *Server) {
+		s.idempotency.maxEntries = entries
+		s.idempotency.maxBytes = bytes
+	}
+}
+
+// WithLowStockHandler sets the function called when the stock available of a
+// produce falls below its reorder threshold. By default a warning is logged.
+func WithLowStockHandler(handler func(models.Produce)) func(*Server) {
+	return func(s *Server) {
+		s.lowStockHandler = handler
+	}
+}
+
+// WithHTTPConfig sets how the http.Server started by Serve handles connections
+// and the most bytes the body of a request may have
+func WithHTTPConfig(config HTTPConfig) func(*Server) {
+	return func(s *Server) {
+		s.httpConfig = config
+	}
+}
+
+// WithListenAddress sets the TCP address Serve listens on, e.g. :8000 or 127.0.0.1:8443
+func WithListenAddress(address string) func(*Server) {
+	return func(s *Server) {
+		s.listenAddress = address
+	}
+}
+
+// WithTLS serves requests over HTTPS with the PEM encoded certificate and
+// private key in the files, instead of plain HTTP
+func WithTLS(certFile, keyFile string) func(*Server) {
+	return func(s *Server) {
+		s.tlsCertFile = certFile
+		s.tlsKeyFile = keyFile
+	}
+}
+
+// Serve listens on the listen address, :8000 by default, and handles API
+// requests until ctx is done. It then shuts down gracefully, see
+// ServeListener. An error is returned when the address cannot be listened on.
+func (s *Server) Serve(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s", s.listenAddress)
+	}
+
+	if s.tlsCertFile != "" {
+		log.Infof("Listening and serving HTTPS on %s", s.listenAddress)
+	} else {
+		log.Infof("Listening and serving on %s", s.listenAddress)
+	}
+	return s.ServeListener(ctx, listener)
+}
+
+// ServeListener handles API requests accepted by listener until ctx is done.
+// It then stops accepting requests and waits up to the shutdown timeout for
+// the requests in flight to finish. An error is returned when the server
+// fails or the requests in flight did not finish in time.
+func (s *Server) ServeListener(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: s.httpConfig.ReadHeaderTimeout,
+		ReadTimeout:       s.httpConfig.ReadTimeout,
+		WriteTimeout:      s.httpConfig.WriteTimeout,
+		IdleTimeout:       s.httpConfig.IdleTimeout,
+		MaxHeaderBytes:    s.httpConfig.MaxHeaderBytes,
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		if s.tlsCertFile != "" {
+			served <- server.ServeTLS(listener, s.tlsCertFile, s.tlsKeyFile)
+			return
+		}
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return errors.Wrap(err, "failed to serve")
+	case <-ctx.Done():
+	}
+
+	log.Infof("Shutting down, waiting up to %s for requests in flight to finish", s.httpConfig.ShutdownTimeout)
+	shutdownCtx := context.Background()
+	if s.httpConfig.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.httpConfig.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// the requests still in flight are cut off
+		server.Close()
+		return errors.Wrap(err, "requests in flight did not finish before the shutdown timeout")
+	}
 
-	port := os.Getenv("PORT") //Get port from .env file, we did not specify any port so this should return an empty string when tested locally
-	if port == "" {
-		port = "8000" //localhost
+	if err := <-served; err != http.ErrServerClosed {
+		return errors.Wrap(err, "failed to serve")
 	}
+	return nil
+}
+
+// Handler returns the handler of every API route so the API can be served by
+// an http.Server other than the one Serve starts, such as an httptest.Server
+func (s *Server) Handler() http.Handler {
+	return s.router()
+}
+
+// router registers every API route with its handler
+func (s *Server) router() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(s.logRequests)
+	router.Use(s.instrument)
+	router.Use(s.authenticate)
+	router.Use(s.limitBody)
+	router.Use(s.idempotent)
+
+	router.HandleFunc("/healthz", s.Healthz).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", s.Readyz).Methods(http.MethodGet)
+	router.HandleFunc("/version", s.GetVersion).Methods(http.MethodGet)
+	router.HandleFunc("/metrics", s.GetMetrics).Methods(http.MethodGet)
 
 	router.HandleFunc("/api/v1/produce", s.ListProduce).Methods(http.MethodGet)
 	router.HandleFunc("/api/v1/produce", s.CreateProduce).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/produce", s.DeleteMatchingProduce).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/produce:batchDelete", s.BatchDeleteProduce).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/produce/export", s.ExportProduce).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/produce/import", s.ImportProduce).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/produce/{productCode}", s.GetProduce).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/produce/{productCode}", s.UpdateProduce).Methods(http.MethodPut)
+	router.HandleFunc("/api/v1/produce/{productCode}", s.PatchProduce).Methods(http.MethodPatch)
 	router.HandleFunc("/api/v1/produce/{productCode}", s.DeleteProduce).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/produce/{productCode}/stock/{operation}", s.ChangeStock).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/produce/{productCode}/prices", s.GetPriceHistory).Methods(http.MethodGet)
 
-	log.Infof("Listening and serving on :%s", port)
-	err := http.ListenAndServe(":"+port, router) //Launch the app, visit localhost:8000/api
-	if err != nil {
-		fmt.Print(err)
-	}
-}
-
-func initializeData() map[string]models.Produce {
-	data := map[string]models.Produce{
-		"A12T-4GH7-QPL9-3N4M": models.Produce{
-			Name:        "Lettuce",
-			ProduceCode: "A12T-4GH7-QPL9-3N4M",
-			UnitPrice:   3.46,
-		},
-		"E5T6-9UI3-TH15-QR88": models.Produce{
-			Name:        "Peach",
-			ProduceCode: "E5T6-9UI3-TH15-QR88",
-			UnitPrice:   2.99,
-		},
-		"YRT6-72AS-K736-L4AR": models.Produce{
-			Name:        "Green Pepper",
-			ProduceCode: "YRT6-72AS-K736-L4AR",
-			UnitPrice:   0.79,
-		},
-		"TQ4C-VV6T-75ZX-1RMR": models.Produce{
-			Name:        "Gala Apple",
-			ProduceCode: "TQ4C-VV6T-75ZX-1RMR",
-			UnitPrice:   3.59,
-		},
-	}
-	return data
+	router.HandleFunc("/api/v1/promotions", s.ListPromotions).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/promotions", s.CreatePromotion).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/promotions/{promotionID}", s.GetPromotion).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/promotions/{promotionID}", s.UpdatePromotion).Methods(http.MethodPut)
+	router.HandleFunc("/api/v1/promotions/{promotionID}", s.DeletePromotion).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/pricing/quote", s.Quote).Methods(http.MethodPost)
+
+	router.HandleFunc("/api/v1/carts", s.CreateCart).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/carts/{cartID}", s.GetCart).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/carts/{cartID}/items", s.AddCartItem).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/carts/{cartID}/items/{productCode}", s.RemoveCartItem).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/carts/{cartID}/checkout", s.CheckoutCart).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/carts/{cartID}/receipt", s.GetReceipt).Methods(http.MethodGet)
+
+	// requests that match no route skip the middleware of the router
+	router.NotFoundHandler = s.logRequests(s.instrument(http.HandlerFunc(routeNotFound)))
+	router.MethodNotAllowedHandler = s.logRequests(s.instrument(methodNotAllowed(router)))
+
+	return router
+}
+
+// routeNotFound answers a request whose path matches no route
+func routeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, http.StatusNotFound, models.ProblemNotFound, fmt.Sprintf("no resource at %s", r.URL.Path))
+}
+
+// methodNotAllowed answers a request whose path only matches routes of other
+// methods, which are listed in the Allow header
+func methodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			candidate := r.Clone(r.Context())
+			candidate.Method = method
+			var match mux.RouteMatch
+			if router.Match(candidate, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeProblem(w, http.StatusMethodNotAllowed, models.ProblemMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s, only %s", r.Method, r.URL.Path, strings.Join(allowed, ", ")))
+	})
+}
+
+// limitBody refuses to read more of the body of a request than the most bytes
+// it may have. Handlers that read past the limit answer with a 413.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.httpConfig.MaxBodyBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, s.httpConfig.MaxBodyBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
 }
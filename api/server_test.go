@@ -0,0 +1,250 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// serve starts s on a local port and returns its address and the result of ServeListener
+func serve(t *testing.T, ctx context.Context, s *Server) (string, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ServeListener(ctx, listener)
+	}()
+	return "http://" + listener.Addr().String(), served
+}
+
+// startSlowRequest sends the headers of a create produce request and returns
+// once its handler has started reading the body, which is left to be written
+func startSlowRequest(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	host := strings.TrimPrefix(addr, "http://")
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprintf(conn, "POST /api/v1/produce HTTP/1.1\r\nHost: %s\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", host, len(slowRequestBody))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusContinue {
+		t.Fatalf("wrong status code: got %v want %v", resp.StatusCode, http.StatusContinue)
+	}
+	return conn, reader
+}
+
+const slowRequestBody = `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`
+
+func TestServeListenerDrainsRequestsInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, served := serve(t, ctx, NewServer())
+
+	conn, reader := startSlowRequest(t, addr)
+	defer conn.Close()
+	cancel()
+
+	select {
+	case err := <-served:
+		t.Fatalf("server stopped with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := io.WriteString(conn, slowRequestBody); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("request in flight was not handled: got %v want %v", resp.StatusCode, http.StatusCreated)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := http.Get(addr + "/api/v1/produce"); err == nil {
+		t.Fatal("server still accepts requests after shutdown")
+	}
+}
+
+func TestServeListenerShutdownTimeout(t *testing.T) {
+	config := DefaultHTTPConfig()
+	config.ShutdownTimeout = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, served := serve(t, ctx, NewServer(WithHTTPConfig(config)))
+
+	conn, _ := startSlowRequest(t, addr)
+	defer conn.Close()
+	cancel()
+
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Fatal("expected an error when requests in flight do not finish")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop after the shutdown timeout")
+	}
+}
+
+func TestServeListenerError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+
+	if err := NewServer().ServeListener(context.Background(), listener); err == nil {
+		t.Fatal("expected an error serving a closed listener")
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate of 127.0.0.1 and its
+// key to dir and returns the paths of the files and the certificate
+func writeTestCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "supermarket"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestServeListenerTLS(t *testing.T) {
+	certFile, keyFile, cert := writeTestCertificate(t, t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, served := serve(t, ctx, NewServer(WithTLS(certFile, keyFile)))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get(strings.Replace(addr, "http://", "https://", 1) + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("wrong response over HTTPS: %v %+v", resp.StatusCode, resp.TLS)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestServeListenAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// the address is in use so Serve fails with it in the error
+	err = NewServer(WithListenAddress(listener.Addr().String())).Serve(context.Background())
+	if err == nil || !strings.Contains(err.Error(), listener.Addr().String()) {
+		t.Fatalf("expected an error listening on %s, got %v", listener.Addr(), err)
+	}
+}
+
+func TestRequestBodyTooLarge(t *testing.T) {
+	config := DefaultHTTPConfig()
+	config.MaxBodyBytes = 64
+	s := NewServer(WithHTTPConfig(config))
+
+	body := `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1},{"name":"Kale","produceCode":"KALE-4GH7-QPL9-3N4M","unitPrice":1}]`
+	tests := []struct {
+		name   string
+		header http.Header
+		path   string
+	}{
+		{name: "create", path: "/api/v1/produce"},
+		{name: "idempotent create", path: "/api/v1/produce", header: http.Header{idempotencyKeyHeader: {"too-large"}}},
+		{name: "import", path: "/api/v1/produce/import", header: http.Header{"Content-Type": {mediaTypeNDJSON}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(strings.Repeat(body, 2)))
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+
+			rr := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rr, req)
+			if rr.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusRequestEntityTooLarge, rr.Body)
+			}
+
+			problem := models.Problem{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Type != models.ProblemRequestTooLarge {
+				t.Errorf("wrong problem type: got %q want %q", problem.Type, models.ProblemRequestTooLarge)
+			}
+		})
+	}
+}
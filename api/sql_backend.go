@@ -0,0 +1,692 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xmattstrongx/supermarket/migrations"
+	"github.com/xmattstrongx/supermarket/models"
+
+	// registers the pure go sqlite driver so the daemon builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDriver is the name of the embedded database/sql driver
+const SQLiteDriver = "sqlite"
+
+// produceColumns is the column list scanProduce expects
+const produceColumns = `name, produce_code, unit_price_minor, currency, category, on_hand, reserved, unit_of_measure, reorder_threshold, version, updated_at`
+
+// promotionColumns is the column list scanPromotion expects
+const promotionColumns = `id, name, kind, produce_code, category, buy_quantity, free_quantity, percent_off,
+	amount_off_minor, currency, min_quantity, priority, exclusive, starts_at, ends_at`
+
+// revisionColumns is the column list scanRevision expects
+const revisionColumns = `name, produce_code, unit_price_minor, currency, category, unit_of_measure, reorder_threshold, deleted, actor, changed_at`
+
+// revisionTimeFormat is how the time of a revision, and of the last change to
+// a produce, is stored. It matches strftime('%Y-%m-%dT%H:%M:%fZ') in sqlite and
+// its fixed width means revisions are ordered in time when compared as text.
+const revisionTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// maxStockChangeAttempts bounds how often a stock change is retried when it races with another write
+const maxStockChangeAttempts = 10
+
+// SQLBackend is a ProduceManager and PromotionManager that stores produce and
+// promotions in a relational database through database/sql
+type SQLBackend struct {
+	db *sql.DB
+}
+
+// OpenSQLBackend connects to the database and applies any pending schema migrations
+func OpenSQLBackend(driver, dataSourceName string) (*SQLBackend, error) {
+	db, err := OpenDB(driver, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := migrations.Up(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return NewSQLBackend(db), nil
+}
+
+// OpenDB opens and verifies a database connection for the SQL backend
+func OpenDB(driver, dataSourceName string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dataSourceName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+
+	if driver == SQLiteDriver {
+		// sqlite only allows a single writer and every connection to an in memory
+		// database gets its own copy so all access goes through one connection
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to connect to database")
+	}
+
+	return db, nil
+}
+
+// NewSQLBackend instantiates a SQLBackend using a database that has already been migrated
+func NewSQLBackend(db *sql.DB) *SQLBackend {
+	return &SQLBackend{
+		db: db,
+	}
+}
+
+// ListProduce returns all produce in the database matching the filter of the
+// query parameters in no particular order. When the query is as of a moment in time the catalog is
+// read from the latest revision of every produce made by then.
+func (s *SQLBackend) ListProduce(queryParams queryParameters) ([]models.Produce, error) {
+	var produce []models.Produce
+	var err error
+	if queryParams.asOf != nil {
+		produce, err = s.listProduceAsOf(*queryParams.asOf)
+	} else {
+		produce, err = s.listProduce()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list produce")
+	}
+
+	return filterProduce(produce, queryParams.filter), nil
+}
+
+func (s *SQLBackend) listProduce() ([]models.Produce, error) {
+	rows, err := s.db.Query(`SELECT ` + produceColumns + ` FROM produce`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var produce []models.Produce
+	for rows.Next() {
+		p, err := scanProduce(rows)
+		if err != nil {
+			return nil, err
+		}
+		produce = append(produce, p)
+	}
+	return produce, rows.Err()
+}
+
+func (s *SQLBackend) listProduceAsOf(asOf time.Time) ([]models.Produce, error) {
+	rows, err := s.db.Query(
+		`SELECT `+revisionColumns+` FROM produce_revisions WHERE deleted = 0 AND id IN (
+			SELECT MAX(id) FROM produce_revisions WHERE changed_at <= ? GROUP BY produce_code
+		)`,
+		asOf.UTC().Format(revisionTimeFormat),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var produce []models.Produce
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		produce = append(produce, revision.Produce)
+	}
+	return produce, rows.Err()
+}
+
+// PriceHistory returns every unit price a produce has had, oldest first. The
+// history of a deleted produce is kept.
+func (s *SQLBackend) PriceHistory(produceCode models.ProduceCode) ([]models.PriceChange, error) {
+	rows, err := s.db.Query(`SELECT `+revisionColumns+` FROM produce_revisions WHERE produce_code = ? ORDER BY id`, produceCode)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get price history")
+	}
+	defer rows.Close()
+
+	var revisions []models.ProduceRevision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read produce revision")
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to get price history")
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrProduceNotFound
+	}
+
+	return models.PriceHistory(revisions), nil
+}
+
+// GetProduce returns the produce with the given produce code
+func (s *SQLBackend) GetProduce(produceCode models.ProduceCode) (models.Produce, error) {
+	p, err := scanProduce(s.db.QueryRow(
+		`SELECT `+produceColumns+` FROM produce WHERE produce_code = ?`,
+		produceCode,
+	))
+	if err == sql.ErrNoRows {
+		return models.Produce{}, ErrProduceNotFound
+	}
+	if err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to get produce")
+	}
+
+	return p, nil
+}
+
+// CreateProduce inserts a new produce. The produce code is upper cased and the
+// unit price is rounded to the minor unit of its currency before it is stored.
+func (s *SQLBackend) CreateProduce(produce models.Produce, actor string) (models.Produce, error) {
+	newProduce, err := normalizeProduce(produce)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to create produce")
+	}
+	defer tx.Rollback()
+
+	newProduce, err = insertProduce(tx, newProduce, actor, time.Now().UTC())
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to create produce")
+	}
+
+	return newProduce, nil
+}
+
+// CreateAllProduce inserts every new produce of a batch in one transaction.
+// When any produce cannot be created the transaction is rolled back and the
+// reason of every produce that failed is returned in a BatchError.
+func (s *SQLBackend) CreateAllProduce(produce []models.Produce, actor string) ([]models.Produce, error) {
+	newProduce := make([]models.Produce, len(produce))
+	failed := BatchError{}
+	for i, val := range produce {
+		p, err := normalizeProduce(val)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		newProduce[i] = p
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create produce")
+	}
+	defer tx.Rollback()
+
+	changedAt := time.Now().UTC()
+	for i, p := range newProduce {
+		if _, invalid := failed[i]; invalid {
+			continue
+		}
+
+		created, err := insertProduce(tx, p, actor, changedAt)
+		if err == ErrProduceAlreadyExists {
+			failed[i] = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		newProduce[i] = created
+	}
+
+	if len(failed) > 0 {
+		return nil, failed
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to create produce")
+	}
+
+	return newProduce, nil
+}
+
+// insertProduce inserts a normalized new produce and records its first revision
+func insertProduce(tx *sql.Tx, newProduce models.Produce, actor string, changedAt time.Time) (models.Produce, error) {
+	result, err := tx.Exec(
+		`INSERT INTO produce (produce_code, name, unit_price_minor, currency, category, on_hand, reserved, unit_of_measure, reorder_threshold, version, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, 1, ?) ON CONFLICT (produce_code) DO NOTHING`,
+		newProduce.ProduceCode, newProduce.Name, newProduce.UnitPrice.MinorUnits(), newProduce.UnitPrice.Currency(),
+		newProduce.Category, int64(newProduce.OnHand), string(newProduce.UnitOfMeasure), int64(newProduce.ReorderThreshold),
+		changedAt.UTC().Format(revisionTimeFormat),
+	)
+	if err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to create produce")
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to create produce")
+	}
+
+	if inserted == 0 {
+		return models.Produce{}, ErrProduceAlreadyExists
+	}
+
+	newProduce.Reserved = 0
+	newProduce.Version = 1
+	newProduce.UpdatedAt = changedAt.UTC().Truncate(time.Millisecond)
+
+	if err := insertRevision(tx, models.NewRevision(newProduce, false, actor, changedAt)); err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to create produce")
+	}
+
+	return newProduce, nil
+}
+
+// UpdateProduce replaces an existing produce. The unit price is rounded the
+// same way as CreateProduce and the stock on hand and reserved are kept. When
+// the produce has a version the row is only updated if it still has that version.
+func (s *SQLBackend) UpdateProduce(produce models.Produce, actor string) (models.Produce, error) {
+	updatedProduce, err := normalizeProduce(produce)
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to update produce")
+	}
+	defer tx.Rollback()
+
+	changedAt := time.Now().UTC()
+	result, err := tx.Exec(
+		`UPDATE produce SET name = ?, unit_price_minor = ?, currency = ?, category = ?, unit_of_measure = ?, reorder_threshold = ?,
+		version = version + 1, updated_at = ? WHERE produce_code = ? AND (? = 0 OR version = ?)`,
+		updatedProduce.Name, updatedProduce.UnitPrice.MinorUnits(), updatedProduce.UnitPrice.Currency(), updatedProduce.Category,
+		string(updatedProduce.UnitOfMeasure), int64(updatedProduce.ReorderThreshold), changedAt.Format(revisionTimeFormat),
+		updatedProduce.ProduceCode, updatedProduce.Version, updatedProduce.Version,
+	)
+	if err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to update produce")
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to update produce")
+	}
+
+	if updated == 0 {
+		return models.Produce{}, missingProduceError(tx, updatedProduce.ProduceCode)
+	}
+
+	// read back the stock counts the update kept
+	updatedProduce, err = scanProduce(tx.QueryRow(`SELECT `+produceColumns+` FROM produce WHERE produce_code = ?`, updatedProduce.ProduceCode))
+	if err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to update produce")
+	}
+
+	if err := insertRevision(tx, models.NewRevision(updatedProduce, false, actor, changedAt)); err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to update produce")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Produce{}, errors.Wrap(err, "failed to update produce")
+	}
+
+	return updatedProduce, nil
+}
+
+// ChangeStock atomically applies a stock change to a produce. The new stock is
+// only written if the produce has not changed since it was read, so concurrent
+// changes are retried rather than lost.
+func (s *SQLBackend) ChangeStock(produceCode models.ProduceCode, change models.StockChange) (models.Produce, error) {
+	for attempt := 0; attempt < maxStockChangeAttempts; attempt++ {
+		produce, err := s.GetProduce(produceCode)
+		if err != nil {
+			return models.Produce{}, err
+		}
+
+		updatedProduce, err := produce.ApplyStockChange(change)
+		if err != nil {
+			return models.Produce{}, err
+		}
+
+		updatedProduce.Version = produce.Version + 1
+		updatedProduce.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+
+		result, err := s.db.Exec(
+			`UPDATE produce SET on_hand = ?, reserved = ?, version = ?, updated_at = ? WHERE produce_code = ? AND version = ?`,
+			int64(updatedProduce.OnHand), int64(updatedProduce.Reserved), updatedProduce.Version,
+			updatedProduce.UpdatedAt.Format(revisionTimeFormat), produceCode, produce.Version,
+		)
+		if err != nil {
+			return models.Produce{}, errors.Wrap(err, "failed to change stock")
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return models.Produce{}, errors.Wrap(err, "failed to change stock")
+		}
+
+		if updated == 1 {
+			return updatedProduce, nil
+		}
+	}
+
+	return models.Produce{}, errors.New("failed to change stock: too many concurrent changes")
+}
+
+// DeleteProduce removes a produce from the database. Deleting a produce that
+// does not exist returns ErrProduceNotFound. When a version is given the
+// produce is only deleted if it still has that version.
+func (s *SQLBackend) DeleteProduce(produceCode models.ProduceCode, version int64, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to delete produce")
+	}
+	defer tx.Rollback()
+
+	produce, err := scanProduce(tx.QueryRow(`SELECT `+produceColumns+` FROM produce WHERE produce_code = ?`, produceCode))
+	if err == sql.ErrNoRows {
+		return ErrProduceNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to delete produce")
+	}
+
+	if version != 0 && version != produce.Version {
+		return ErrProduceVersionMismatch
+	}
+
+	result, err := tx.Exec(`DELETE FROM produce WHERE produce_code = ? AND version = ?`, produceCode, produce.Version)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete produce")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to delete produce")
+	}
+
+	if deleted == 0 {
+		return ErrProduceVersionMismatch
+	}
+
+	if err := insertRevision(tx, models.NewRevision(produce, true, actor, time.Now().UTC())); err != nil {
+		return errors.Wrap(err, "failed to delete produce")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to delete produce")
+	}
+
+	return nil
+}
+
+// missingProduceError explains why a conditional write to a produce changed
+// no row: either the produce does not exist or it no longer has the version given
+func missingProduceError(tx *sql.Tx, produceCode string) error {
+	var version int64
+	err := tx.QueryRow(`SELECT version FROM produce WHERE produce_code = ?`, produceCode).Scan(&version)
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrProduceNotFound
+	case err != nil:
+		return errors.Wrap(err, "failed to update produce")
+	default:
+		return ErrProduceVersionMismatch
+	}
+}
+
+// insertRevision adds a revision to the history of its produce
+func insertRevision(tx *sql.Tx, revision models.ProduceRevision) error {
+	p := revision.Produce
+	_, err := tx.Exec(
+		`INSERT INTO produce_revisions (produce_code, name, unit_price_minor, currency, category, unit_of_measure, reorder_threshold, deleted, actor, changed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ProduceCode, p.Name, p.UnitPrice.MinorUnits(), p.UnitPrice.Currency(), p.Category, string(p.UnitOfMeasure),
+		int64(p.ReorderThreshold), revision.Deleted, revision.Actor, revision.ChangedAt.UTC().Format(revisionTimeFormat),
+	)
+	return err
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProduce(row scanner) (models.Produce, error) {
+	p := models.Produce{}
+	var unitPriceMinor, onHand, reserved, reorderThreshold int64
+	var currency, unitOfMeasure, updatedAt string
+	if err := row.Scan(&p.Name, &p.ProduceCode, &unitPriceMinor, &currency, &p.Category, &onHand, &reserved, &unitOfMeasure, &reorderThreshold,
+		&p.Version, &updatedAt); err != nil {
+		return models.Produce{}, err
+	}
+	if updatedAt != "" {
+		t, err := time.Parse(revisionTimeFormat, updatedAt)
+		if err != nil {
+			return models.Produce{}, err
+		}
+		p.UpdatedAt = t
+	}
+	p.UnitPrice = models.NewMoney(unitPriceMinor, currency)
+	p.OnHand = models.Quantity(onHand)
+	p.Reserved = models.Quantity(reserved)
+	p.UnitOfMeasure = models.UnitOfMeasure(unitOfMeasure)
+	p.ReorderThreshold = models.Quantity(reorderThreshold)
+	return p, nil
+}
+
+func scanRevision(row scanner) (models.ProduceRevision, error) {
+	r := models.ProduceRevision{}
+	var unitPriceMinor, reorderThreshold int64
+	var currency, unitOfMeasure, changedAt string
+	if err := row.Scan(&r.Produce.Name, &r.Produce.ProduceCode, &unitPriceMinor, &currency, &r.Produce.Category,
+		&unitOfMeasure, &reorderThreshold, &r.Deleted, &r.Actor, &changedAt); err != nil {
+		return models.ProduceRevision{}, err
+	}
+	r.Produce.UnitPrice = models.NewMoney(unitPriceMinor, currency)
+	r.Produce.UnitOfMeasure = models.UnitOfMeasure(unitOfMeasure)
+	r.Produce.ReorderThreshold = models.Quantity(reorderThreshold)
+
+	var err error
+	if r.ChangedAt, err = time.Parse(revisionTimeFormat, changedAt); err != nil {
+		return models.ProduceRevision{}, err
+	}
+	return r, nil
+}
+
+// Close closes the database connection
+func (s *SQLBackend) Close() error {
+	return s.db.Close()
+}
+
+// Ping checks the database can be reached and its produce can be read
+func (s *SQLBackend) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return errors.Wrap(err, "failed to connect to database")
+	}
+
+	var one int
+	err := s.db.QueryRowContext(ctx, `SELECT 1 FROM produce LIMIT 1`).Scan(&one)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "failed to read produce")
+	}
+	return nil
+}
+
+// ListPromotions returns every promotion ordered by id
+func (s *SQLBackend) ListPromotions() ([]models.Promotion, error) {
+	rows, err := s.db.Query(`SELECT ` + promotionColumns + ` FROM promotions ORDER BY id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list promotions")
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read promotion")
+		}
+		promotions = append(promotions, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list promotions")
+	}
+
+	return promotions, nil
+}
+
+// GetPromotion returns the promotion with the given id
+func (s *SQLBackend) GetPromotion(id string) (models.Promotion, error) {
+	p, err := scanPromotion(s.db.QueryRow(`SELECT `+promotionColumns+` FROM promotions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return models.Promotion{}, ErrPromotionNotFound
+	}
+	if err != nil {
+		return models.Promotion{}, errors.Wrap(err, "failed to get promotion")
+	}
+
+	return p, nil
+}
+
+// CreatePromotion stores a new promotion
+func (s *SQLBackend) CreatePromotion(promotion models.Promotion) (models.Promotion, error) {
+	result, err := s.db.Exec(
+		`INSERT INTO promotions (`+promotionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		promotionValues(promotion)...,
+	)
+	if err != nil {
+		return models.Promotion{}, errors.Wrap(err, "failed to create promotion")
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return models.Promotion{}, errors.Wrap(err, "failed to create promotion")
+	}
+
+	if inserted == 0 {
+		return models.Promotion{}, ErrPromotionAlreadyExists
+	}
+
+	return promotion, nil
+}
+
+// UpdatePromotion replaces an existing promotion
+func (s *SQLBackend) UpdatePromotion(promotion models.Promotion) (models.Promotion, error) {
+	values := promotionValues(promotion)
+	result, err := s.db.Exec(
+		`UPDATE promotions SET name = ?, kind = ?, produce_code = ?, category = ?, buy_quantity = ?, free_quantity = ?,
+		percent_off = ?, amount_off_minor = ?, currency = ?, min_quantity = ?, priority = ?, exclusive = ?, starts_at = ?, ends_at = ?
+		WHERE id = ?`,
+		append(values[1:], values[0])...,
+	)
+	if err != nil {
+		return models.Promotion{}, errors.Wrap(err, "failed to update promotion")
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return models.Promotion{}, errors.Wrap(err, "failed to update promotion")
+	}
+
+	if updated == 0 {
+		return models.Promotion{}, ErrPromotionNotFound
+	}
+
+	return promotion, nil
+}
+
+// DeletePromotion removes a promotion
+func (s *SQLBackend) DeletePromotion(id string) error {
+	result, err := s.db.Exec(`DELETE FROM promotions WHERE id = ?`, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete promotion")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to delete promotion")
+	}
+
+	if deleted == 0 {
+		return ErrPromotionNotFound
+	}
+
+	return nil
+}
+
+// promotionValues returns the values of a promotion in the order of promotionColumns
+func promotionValues(p models.Promotion) []interface{} {
+	var endsAt interface{}
+	if p.EndsAt != nil {
+		endsAt = p.EndsAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	var amountOffMinor int64
+	var currency string
+	if p.Kind == models.AmountOff {
+		amountOffMinor, currency = p.AmountOff.MinorUnits(), p.AmountOff.Currency()
+	}
+
+	exclusive := 0
+	if p.Exclusive {
+		exclusive = 1
+	}
+
+	return []interface{}{
+		p.ID, p.Name, string(p.Kind), p.ProduceCode, p.Category, int64(p.BuyQuantity), int64(p.FreeQuantity), int64(p.PercentOff),
+		amountOffMinor, currency, int64(p.MinQuantity), p.Priority, exclusive, p.StartsAt.UTC().Format(time.RFC3339Nano), endsAt,
+	}
+}
+
+func scanPromotion(row scanner) (models.Promotion, error) {
+	p := models.Promotion{}
+	var kind, currency, startsAt string
+	var buyQuantity, freeQuantity, percentOff, amountOffMinor, minQuantity int64
+	var exclusive int
+	var endsAt sql.NullString
+	err := row.Scan(&p.ID, &p.Name, &kind, &p.ProduceCode, &p.Category, &buyQuantity, &freeQuantity, &percentOff,
+		&amountOffMinor, &currency, &minQuantity, &p.Priority, &exclusive, &startsAt, &endsAt)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+
+	p.Kind = models.PromotionKind(kind)
+	p.BuyQuantity = models.Quantity(buyQuantity)
+	p.FreeQuantity = models.Quantity(freeQuantity)
+	p.PercentOff = models.Percent(percentOff)
+	p.MinQuantity = models.Quantity(minQuantity)
+	p.Exclusive = exclusive != 0
+	if currency != "" {
+		p.AmountOff = models.NewMoney(amountOffMinor, currency)
+	}
+
+	if p.StartsAt, err = time.Parse(time.RFC3339Nano, startsAt); err != nil {
+		return models.Promotion{}, err
+	}
+	if endsAt.Valid {
+		t, err := time.Parse(time.RFC3339Nano, endsAt.String)
+		if err != nil {
+			return models.Promotion{}, err
+		}
+		p.EndsAt = &t
+	}
+
+	return p, nil
+}
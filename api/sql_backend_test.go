@@ -0,0 +1,209 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func newTestSQLBackend(t *testing.T) *SQLBackend {
+	s, err := OpenSQLBackend(SQLiteDriver, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLBackendIsSeeded(t *testing.T) {
+	s := newTestSQLBackend(t)
+	defer s.Close()
+
+	produce, err := s.ListProduce(queryParameters{sortBy: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(produce) != len(initializeData()) {
+		t.Fatalf("unexpected produce count got %d want %d", len(produce), len(initializeData()))
+	}
+
+	for _, val := range produce {
+		if val.Version != 1 || val.UpdatedAt.IsZero() {
+			t.Errorf("unexpected version of seeded produce %s got %d updated at %v", val.ProduceCode, val.Version, val.UpdatedAt)
+		}
+
+		val.Version, val.UpdatedAt = 0, time.Time{}
+		if want := initializeData()[val.ProduceCode]; val != want {
+			t.Errorf("unexpected produce got %v want %v", val, want)
+		}
+	}
+}
+
+func TestSQLBackendCreateUpdateAndDelete(t *testing.T) {
+	s := newTestSQLBackend(t)
+	defer s.Close()
+
+	created, err := s.CreateProduce(models.Produce{Name: "fumanchu", ProduceCode: "xx1x-4gh7-qpl9-3n4m", UnitPrice: models.MustParseMoney("1.13333", models.USD)}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.UpdatedAt.IsZero() {
+		t.Error("expected created produce to have an updated time")
+	}
+
+	want := models.Produce{Name: "fumanchu", ProduceCode: "XX1X-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(113, models.USD), Version: 1, UpdatedAt: created.UpdatedAt}
+	if created != want {
+		t.Errorf("unexpected created produce got %v want %v", created, want)
+	}
+
+	if _, err := s.CreateProduce(created, "test"); err != ErrProduceAlreadyExists {
+		t.Errorf("unexpected error creating duplicate produce got %v want %v", err, ErrProduceAlreadyExists)
+	}
+
+	updated, err := s.UpdateProduce(models.Produce{Name: "oomanchu", ProduceCode: created.ProduceCode, UnitPrice: models.MustParseMoney("2.005", models.USD)}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetProduce(models.ProduceCode(created.ProduceCode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != updated {
+		t.Errorf("unexpected produce after update got %v want %v", got, updated)
+	}
+	if updated.Version != 2 {
+		t.Errorf("unexpected version after update got %d want %d", updated.Version, 2)
+	}
+
+	stale := updated
+	stale.Version = created.Version
+	if _, err := s.UpdateProduce(stale, "test"); err != ErrProduceVersionMismatch {
+		t.Errorf("unexpected error updating stale produce got %v want %v", err, ErrProduceVersionMismatch)
+	}
+
+	if err := s.DeleteProduce(models.ProduceCode(created.ProduceCode), created.Version, "test"); err != ErrProduceVersionMismatch {
+		t.Errorf("unexpected error deleting stale produce got %v want %v", err, ErrProduceVersionMismatch)
+	}
+
+	if err := s.DeleteProduce(models.ProduceCode(created.ProduceCode), 0, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetProduce(models.ProduceCode(created.ProduceCode)); err != ErrProduceNotFound {
+		t.Errorf("unexpected error getting deleted produce got %v want %v", err, ErrProduceNotFound)
+	}
+
+	if err := s.DeleteProduce(models.ProduceCode(created.ProduceCode), 0, "test"); err != ErrProduceNotFound {
+		t.Errorf("unexpected error deleting deleted produce got %v want %v", err, ErrProduceNotFound)
+	}
+
+	if _, err := s.UpdateProduce(created, "test"); err != ErrProduceNotFound {
+		t.Errorf("unexpected error updating deleted produce got %v want %v", err, ErrProduceNotFound)
+	}
+
+	produce, err := s.ListProduce(queryParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(produce) != len(initializeData()) {
+		t.Errorf("unexpected produce count got %d want %d", len(produce), len(initializeData()))
+	}
+}
+
+func TestSQLBackendChangeStock(t *testing.T) {
+	s := newTestSQLBackend(t)
+	defer s.Close()
+
+	created, err := s.CreateProduce(models.Produce{
+		Name:             "Bananas",
+		ProduceCode:      "BNNA-4GH7-QPL9-3N4M",
+		UnitPrice:        models.NewMoney(59, models.USD),
+		OnHand:           models.NewQuantity(20),
+		Reserved:         models.NewQuantity(5),
+		UnitOfMeasure:    models.Pound,
+		ReorderThreshold: models.NewQuantity(4),
+	}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Reserved != 0 {
+		t.Errorf("stock was reserved on create got %v", created.Reserved)
+	}
+
+	changed, err := s.ChangeStock(models.ProduceCode(created.ProduceCode), models.StockChange{Operation: models.StockReserve, Quantity: 2500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ChangeStock(models.ProduceCode(created.ProduceCode), models.StockChange{Operation: models.StockReserve, Quantity: models.NewQuantity(18)}); err != models.ErrInsufficientStock {
+		t.Errorf("unexpected error reserving more than is available got %v want %v", err, models.ErrInsufficientStock)
+	}
+
+	// replacing the produce keeps the stock counts
+	updated, err := s.UpdateProduce(models.Produce{Name: "Plantains", ProduceCode: created.ProduceCode, UnitPrice: models.NewMoney(79, models.USD), UnitOfMeasure: models.Pound}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.OnHand != changed.OnHand || updated.Reserved != changed.Reserved {
+		t.Errorf("stock was not kept on update got %v/%v want %v/%v", updated.OnHand, updated.Reserved, changed.OnHand, changed.Reserved)
+	}
+
+	if _, err := s.ChangeStock("XX1X-4GH7-QPL9-3N4M", models.StockChange{Operation: models.StockReceive, Quantity: 1}); err != ErrProduceNotFound {
+		t.Errorf("unexpected error changing stock of unknown produce got %v want %v", err, ErrProduceNotFound)
+	}
+}
+
+func TestSQLBackendPromotions(t *testing.T) {
+	s := newTestSQLBackend(t)
+	defer s.Close()
+
+	endsAt := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	promotions := []models.Promotion{
+		{ID: "b", Name: "$1 off 3 lb", Kind: models.AmountOff, Category: "fruit", AmountOff: models.NewMoney(100, models.USD), MinQuantity: models.NewQuantity(3), Priority: 5, Exclusive: true, StartsAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), EndsAt: &endsAt},
+		{ID: "a", Name: "buy 2 get 1 free", Kind: models.BuyGetFree, ProduceCode: "E5T6-9UI3-TH15-QR88", BuyQuantity: models.NewQuantity(2), FreeQuantity: models.NewQuantity(1), StartsAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, p := range promotions {
+		if _, err := s.CreatePromotion(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.CreatePromotion(promotions[0]); err != ErrPromotionAlreadyExists {
+		t.Errorf("unexpected error creating duplicate promotion got %v want %v", err, ErrPromotionAlreadyExists)
+	}
+
+	got, err := s.ListPromotions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []models.Promotion{promotions[1], promotions[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected promotions got %+v want %+v", got, want)
+	}
+
+	updated := promotions[1]
+	updated.Priority = 20
+	if _, err := s.UpdatePromotion(updated); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := s.GetPromotion(updated.ID); err != nil || !reflect.DeepEqual(p, updated) {
+		t.Errorf("unexpected updated promotion got %+v, %v want %+v", p, err, updated)
+	}
+
+	if err := s.DeletePromotion(updated.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPromotion(updated.ID); err != ErrPromotionNotFound {
+		t.Errorf("unexpected error getting deleted promotion got %v want %v", err, ErrPromotionNotFound)
+	}
+	if err := s.DeletePromotion(updated.ID); err != ErrPromotionNotFound {
+		t.Errorf("unexpected error deleting missing promotion got %v want %v", err, ErrPromotionNotFound)
+	}
+	if _, err := s.UpdatePromotion(updated); err != ErrPromotionNotFound {
+		t.Errorf("unexpected error updating missing promotion got %v want %v", err, ErrPromotionNotFound)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// ChangeStock is an API handlerFunc for receiving, adjusting, reserving and
+// releasing the stock of a produce. The operation is taken from the path and
+// the body holds the quantity, e.g. {"quantity": 12}.
+func (s *Server) ChangeStock(w http.ResponseWriter, r *http.Request) {
+	produceCode, ok := produceCodeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	change := models.StockChange{}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		writeMalformedBody(w, err)
+		return
+	}
+	change.Operation = models.StockOperation(mux.Vars(r)["operation"])
+
+	if err := change.Validate(); err != nil {
+		writeInvalidRequest(w, err)
+		return
+	}
+
+	produce, err := s.produceManager.ChangeStock(produceCode, change)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	// only signal when this change crosses the threshold so a produce that
+	// stays low does not signal on every change
+	if produce.IsLowStock() && produce.Available()-change.AvailableDelta() >= produce.ReorderThreshold {
+		s.lowStockHandler(produce)
+	}
+
+	writeProduce(w, r, produce)
+}
+
+func writeStockError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrFractionalQuantity, models.ErrQuantityOutOfRange:
+		writeInvalidField(w, "quantity", models.ReasonInvalidValue, err.Error())
+	case models.ErrInsufficientStock, models.ErrInsufficientReserved:
+		writeProblem(w, http.StatusConflict, models.ProblemInsufficientStock, err.Error())
+	default:
+		writeProduceManagerError(w, err)
+	}
+}
+
+// logLowStock is the default low stock handler
+func logLowStock(produce models.Produce) {
+	log.WithFields(log.Fields{
+		"produceCode":      produce.ProduceCode,
+		"name":             produce.Name,
+		"available":        produce.Available().String(),
+		"reorderThreshold": produce.ReorderThreshold.String(),
+		"unitOfMeasure":    produce.UnitOfMeasure.OrDefault(),
+	}).Warn("produce is low on stock")
+}
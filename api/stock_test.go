@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func TestChangeStock(t *testing.T) {
+	tests := []struct {
+		name       string
+		steps      []models.StockChange
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "receive adds to the stock on hand",
+			path:       "/api/v1/produce/a12t-4gh7-qpl9-3n4m/stock/receive",
+			body:       `{"quantity":12}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":3.46,"onHand":12}`,
+		},
+		{
+			name:       "reserve sets stock aside",
+			steps:      []models.StockChange{{Operation: models.StockReceive, Quantity: models.NewQuantity(12)}},
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/reserve",
+			body:       `{"quantity":5}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":3.46,"onHand":12,"reserved":5}`,
+		},
+		{
+			name:       "release returns reserved stock",
+			steps:      []models.StockChange{{Operation: models.StockReceive, Quantity: models.NewQuantity(12)}, {Operation: models.StockReserve, Quantity: models.NewQuantity(5)}},
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/release",
+			body:       `{"quantity":5}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":3.46,"onHand":12}`,
+		},
+		{
+			name:       "adjust can remove stock",
+			steps:      []models.StockChange{{Operation: models.StockReceive, Quantity: models.NewQuantity(12)}},
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/adjust",
+			body:       `{"quantity":-2}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"Lettuce","produceCode":"A12T-4GH7-QPL9-3N4M","unitPrice":3.46,"onHand":10}`,
+		},
+		{
+			name:       "adjust cannot take stock below zero",
+			steps:      []models.StockChange{{Operation: models.StockReceive, Quantity: models.NewQuantity(1)}},
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/adjust",
+			body:       `{"quantity":-2}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "adjust cannot remove reserved stock",
+			steps:      []models.StockChange{{Operation: models.StockReceive, Quantity: models.NewQuantity(2)}, {Operation: models.StockReserve, Quantity: models.NewQuantity(2)}},
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/adjust",
+			body:       `{"quantity":-1}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "cannot reserve more than is available",
+			steps:      []models.StockChange{{Operation: models.StockReceive, Quantity: models.NewQuantity(2)}},
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/reserve",
+			body:       `{"quantity":3}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "cannot release more than is reserved",
+			steps:      []models.StockChange{{Operation: models.StockReceive, Quantity: models.NewQuantity(2)}, {Operation: models.StockReserve, Quantity: models.NewQuantity(1)}},
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/release",
+			body:       `{"quantity":2}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "fractions of produce sold each are rejected",
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/receive",
+			body:       `{"quantity":1.5}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "receive must be positive",
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/receive",
+			body:       `{"quantity":-1}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown operation",
+			path:       "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/steal",
+			body:       `{"quantity":1}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown produce",
+			path:       "/api/v1/produce/XX1X-4GH7-QPL9-3N4M/stock/receive",
+			body:       `{"quantity":1}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+
+			for _, step := range tt.steps {
+				if _, err := s.produceManager.ChangeStock("A12T-4GH7-QPL9-3N4M", step); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req, err := http.NewRequest(http.MethodPost, tt.path, bytes.NewBuffer([]byte(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			s.router().ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.wantStatus)
+			}
+
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestChangeStockIsAtomic(t *testing.T) {
+	s := NewServer()
+	const produceCode = "A12T-4GH7-QPL9-3N4M"
+
+	if _, err := s.produceManager.ChangeStock(produceCode, models.StockChange{Operation: models.StockReceive, Quantity: models.NewQuantity(50)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// twice as many reservations as there is stock so exactly half must be refused
+	statuses := make(chan int, 100)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/produce/"+produceCode+"/stock/reserve", bytes.NewBufferString(`{"quantity":1}`))
+			rr := httptest.NewRecorder()
+			s.router().ServeHTTP(rr, req)
+			statuses <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != 50 || counts[http.StatusConflict] != 50 {
+		t.Errorf("unexpected reservation results got %v want 50 OK and 50 Conflict", counts)
+	}
+
+	produce, err := s.produceManager.GetProduce(produceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if produce.Available() != 0 {
+		t.Errorf("unexpected stock available got %v want 0", produce.Available())
+	}
+}
+
+func TestChangeStockSignalsLowStock(t *testing.T) {
+	var signalled []models.Produce
+	s := NewServer(WithLowStockHandler(func(p models.Produce) {
+		signalled = append(signalled, p)
+	}))
+
+	if _, err := s.produceManager.UpdateProduce(models.Produce{
+		Name:             "Lettuce",
+		ProduceCode:      "A12T-4GH7-QPL9-3N4M",
+		UnitPrice:        models.NewMoney(346, models.USD),
+		ReorderThreshold: models.NewQuantity(5),
+	}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []struct {
+		path string
+		body string
+	}{
+		{"receive", `{"quantity":10}`},
+		{"reserve", `{"quantity":5}`},
+		// falls below the threshold of 5
+		{"reserve", `{"quantity":1}`},
+		// still below the threshold so no new signal
+		{"adjust", `{"quantity":-1}`},
+		{"receive", `{"quantity":10}`},
+		// falls below the threshold again
+		{"reserve", `{"quantity":10}`},
+	}
+	for _, c := range changes {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/produce/A12T-4GH7-QPL9-3N4M/stock/"+c.path, bytes.NewBufferString(c.body))
+		rr := httptest.NewRecorder()
+		s.router().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s %s returned wrong status code: got %v want %v", c.path, c.body, rr.Code, http.StatusOK)
+		}
+	}
+
+	if len(signalled) != 2 {
+		t.Fatalf("unexpected low stock signals got %d want 2", len(signalled))
+	}
+	if got, want := signalled[0].Available(), models.NewQuantity(4); got != want {
+		t.Errorf("unexpected stock available when first signalled got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// cartPath returns the path of a cart, or of a resource under it
+func cartPath(cartID, suffix string) string {
+	return "/api/v1/carts/" + url.PathEscape(cartID) + suffix
+}
+
+// CreateCart starts a new empty cart
+func (c *Client) CreateCart(ctx context.Context) (models.PricedCart, error) {
+	cart := models.PricedCart{}
+	_, err := c.do(ctx, http.MethodPost, "/api/v1/carts", nil, nil, &cart)
+	return cart, err
+}
+
+// GetCart gets a cart priced at the current unit prices
+func (c *Client) GetCart(ctx context.Context, cartID string) (models.PricedCart, error) {
+	cart := models.PricedCart{}
+	_, err := c.do(ctx, http.MethodGet, cartPath(cartID, ""), nil, nil, &cart)
+	return cart, err
+}
+
+// AddCartItem adds a quantity of a produce to a cart
+func (c *Client) AddCartItem(ctx context.Context, cartID string, item models.CartItem) (models.PricedCart, error) {
+	cart := models.PricedCart{}
+	_, err := c.do(ctx, http.MethodPost, cartPath(cartID, "/items"), nil, item, &cart)
+	return cart, err
+}
+
+// RemoveCartItem removes a quantity of a produce from a cart, or all of it when quantity is nil
+func (c *Client) RemoveCartItem(ctx context.Context, cartID, produceCode string, quantity *models.Quantity) (models.PricedCart, error) {
+	query := url.Values{}
+	if quantity != nil {
+		query.Set("quantity", quantity.String())
+	}
+
+	cart := models.PricedCart{}
+	_, err := c.do(ctx, http.MethodDelete, cartPath(cartID, "/items/"+url.PathEscape(produceCode)), query, nil, &cart)
+	return cart, err
+}
+
+// CheckoutCart checks out a cart and returns its receipt
+func (c *Client) CheckoutCart(ctx context.Context, cartID string) (models.Receipt, error) {
+	receipt := models.Receipt{}
+	_, err := c.do(ctx, http.MethodPost, cartPath(cartID, "/checkout"), nil, nil, &receipt)
+	return receipt, err
+}
+
+// GetReceipt gets the receipt of a checked out cart
+func (c *Client) GetReceipt(ctx context.Context, cartID string) (models.Receipt, error) {
+	receipt := models.Receipt{}
+	_, err := c.do(ctx, http.MethodGet, cartPath(cartID, "/receipt"), nil, nil, &receipt)
+	return receipt, err
+}
@@ -0,0 +1,307 @@
+// Package client is a Go client for the supermarket API.
+//
+// Every method takes a context that bounds the request along with any retries.
+// A request the API answers with an error status returns an *Error carrying the
+// status code and the problem details of the response.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+const (
+	// DefaultTimeout is how long a request may take, including reading the response, unless WithTimeout or WithHTTPClient says otherwise
+	DefaultTimeout = 10 * time.Second
+
+	mediaTypeJSON       = "application/json"
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeProblem    = "application/problem+json"
+	// mediaTypeV2 is accepted so prices keep their exact amount and currency
+	mediaTypeV2 = "application/vnd.supermarket.v2+json"
+
+	actorHeader          = "X-Actor"
+	idempotencyKeyHeader = "Idempotency-Key"
+	requestIDHeader      = "X-Request-ID"
+)
+
+// Client sends requests to the supermarket API. A Client is safe for concurrent use.
+type Client struct {
+	httpClient *http.Client
+	endpoint   *url.URL
+	// actor is sent with every request so changes are recorded in the produce history
+	actor string
+	retry RetryPolicy
+	auth  AuthFunc
+}
+
+// Option configures a Client
+type Option func(*Client) error
+
+// AuthFunc is called with every request before it is sent, including every
+// retry, to add credentials such as an Authorization header
+type AuthFunc func(*http.Request) error
+
+// New returns a client of the API served at endpoint, e.g. http://localhost:8000
+func New(endpoint string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %s", endpoint, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q: must be an absolute URL such as http://localhost:8000", endpoint)
+	}
+
+	c := &Client{
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		endpoint:   u,
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// WithHTTPClient sends requests with an http.Client of the caller's choosing
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) error {
+		if httpClient == nil {
+			return fmt.Errorf("http client must not be nil")
+		}
+		c.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithTimeout sets how long a request may take, including reading the
+// response. Zero means no timeout, which suits streaming a large export.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		if timeout < 0 {
+			return fmt.Errorf("timeout must not be negative")
+		}
+		client := *c.httpClient
+		client.Timeout = timeout
+		c.httpClient = &client
+		return nil
+	}
+}
+
+// WithActor sets who is recorded in the produce history for changes made by the client
+func WithActor(actor string) Option {
+	return func(c *Client) error {
+		c.actor = actor
+		return nil
+	}
+}
+
+// WithRetry resends requests the policy says are worth retrying. POST and
+// PATCH requests are sent with an Idempotency-Key so a retry of a request the
+// API already handled is answered with the first response instead of being
+// applied twice.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) error {
+		c.retry = policy
+		return nil
+	}
+}
+
+// WithAuth calls auth with every request before it is sent
+func WithAuth(auth AuthFunc) Option {
+	return func(c *Client) error {
+		c.auth = auth
+		return nil
+	}
+}
+
+// WithAPIKey sends every request with an API key as a bearer token
+func WithAPIKey(key string) Option {
+	return func(c *Client) error {
+		if key == "" {
+			return fmt.Errorf("API key must not be empty")
+		}
+		c.auth = func(r *http.Request) error {
+			r.Header.Set("Authorization", "Bearer "+key)
+			return nil
+		}
+		return nil
+	}
+}
+
+// newRequest builds a request of a path under the endpoint such as
+// /api/v1/produce. A body that is not an io.Reader is sent as JSON.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	u := *c.endpoint
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+		contentType = mediaTypeJSON
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", mediaTypeV2+", "+mediaTypeJSON)
+	if c.actor != "" {
+		req.Header.Set(actorHeader, c.actor)
+	}
+
+	return req, nil
+}
+
+// send sends a request, resending it as long as the retry policy says to. A
+// request whose body cannot be read again is only sent once. Every attempt is
+// sent with the same X-Request-ID so they can be found in the logs of the API.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(requestIDHeader) == "" {
+		requestID, err := newRandomID()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(requestIDHeader, requestID)
+	}
+
+	retry := c.retry != nil && (req.Body == nil || req.GetBody != nil)
+	if retry && (req.Method == http.MethodPost || req.Method == http.MethodPatch) && req.Header.Get(idempotencyKeyHeader) == "" {
+		key, err := newRandomID()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		if c.auth != nil {
+			if err := c.auth(req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			// the request may have reached the API before it failed
+			err = fmt.Errorf("%w (request ID %s)", err, req.Header.Get(requestIDHeader))
+		}
+		if !retry || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait, ok := c.retry.Retry(attempt, resp, err)
+		if !ok {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (request ID %s)", req.Context().Err(), req.Header.Get(requestIDHeader))
+		case <-timer.C:
+		}
+	}
+}
+
+// do sends a request and decodes its JSON response into out, if given. An
+// error status is returned as an *Error, and when the body of an error is not
+// problem details it is still decoded into out since bulk requests list what
+// failed in their usual response.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doRequest(req, out)
+}
+
+// doRequest is like do for a request that has already been built
+func (c *Client) doRequest(req *http.Request, out interface{}) (*http.Response, error) {
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+
+	var statusErr error
+	if resp.StatusCode >= 400 {
+		statusErr = newError(req, resp, b)
+		if isProblem(resp) {
+			return resp, statusErr
+		}
+	}
+
+	if out != nil && len(b) > 0 {
+		if err := json.Unmarshal(b, out); err != nil && statusErr == nil {
+			return resp, fmt.Errorf("failed to decode the response: %s", err)
+		}
+	}
+
+	return resp, statusErr
+}
+
+// newRandomID returns a random id identifying a request across its retries,
+// used as its request id and its idempotency key
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// produceCodePath returns the path of a produce after checking its produce code
+func produceCodePath(produceCode string, suffix string) (string, error) {
+	code, err := models.ParseProduceCode(produceCode)
+	if err != nil {
+		return "", err
+	}
+	return "/api/v1/produce/" + code.String() + suffix, nil
+}
@@ -0,0 +1,436 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/api"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// newTestClient returns a client of a server with the default inventory
+func newTestClient(t *testing.T, opts ...Option) *Client {
+	t.Helper()
+	ts := httptest.NewServer(api.NewServer().Handler())
+	t.Cleanup(ts.Close)
+
+	c, err := New(ts.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:8000", "/api", "http://"} {
+		if _, err := New(endpoint); err == nil {
+			t.Errorf("New(%q) returned no error", endpoint)
+		}
+	}
+
+	if _, err := New("http://localhost:8000", WithTimeout(-time.Second)); err == nil {
+		t.Error("New returned no error for a negative timeout")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	shared := &http.Client{}
+	c, err := New("http://localhost:8000", WithHTTPClient(shared), WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.httpClient.Timeout != time.Minute {
+		t.Errorf("wrong timeout: got %v want %v", c.httpClient.Timeout, time.Minute)
+	}
+	if shared.Timeout != 0 {
+		t.Errorf("the timeout changed the http client given by the caller")
+	}
+}
+
+func TestPingAndVersion(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	readiness, err := c.Ping(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readiness.Status != models.StatusReady {
+		t.Errorf("wrong status: got %q want %q", readiness.Status, models.StatusReady)
+	}
+
+	build, err := c.Version(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build != api.Build() {
+		t.Errorf("wrong build: got %+v want %+v", build, api.Build())
+	}
+}
+
+func TestProduceLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, WithActor("alice"))
+
+	created, err := c.CreateProduce(ctx, []models.Produce{
+		{Name: "Kiwi", ProduceCode: "kiwi-4gh7-qpl9-3n4m", UnitPrice: models.MustParseMoney("1.25", models.USD)},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Created) != 1 || created.Created[0].ProduceCode != "KIWI-4GH7-QPL9-3N4M" {
+		t.Fatalf("unexpected create response: %+v", created)
+	}
+
+	produce, etag, err := c.GetProduce(ctx, "kiwi-4gh7-qpl9-3n4m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if produce.Name != "Kiwi" || etag == "" {
+		t.Fatalf("unexpected produce %+v with ETag %q", produce, etag)
+	}
+
+	patched, patchedETag, err := c.PatchProduce(ctx, "KIWI-4GH7-QPL9-3N4M", []byte(`{"unitPrice":1.5}`), etag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.UnitPrice.Cmp(models.MustParseMoney("1.50", models.USD)) != 0 || patchedETag == etag {
+		t.Fatalf("unexpected patched produce %+v with ETag %q", patched, patchedETag)
+	}
+
+	// the ETag from before the patch no longer matches
+	produce.Name = "Golden Kiwi"
+	_, _, err = c.ReplaceProduce(ctx, produce, etag)
+	if !IsPreconditionFailed(err) {
+		t.Fatalf("replace with a stale ETag returned %v, want a precondition failure", err)
+	}
+
+	history, err := c.PriceHistory(ctx, "KIWI-4GH7-QPL9-3N4M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].Actor != "alice" {
+		t.Errorf("unexpected price history: %+v", history)
+	}
+
+	if err := c.DeleteProduce(ctx, "KIWI-4GH7-QPL9-3N4M", DeleteOptions{IfMatch: patchedETag}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = c.GetProduce(ctx, "KIWI-4GH7-QPL9-3N4M")
+	if !IsNotFound(err) {
+		t.Fatalf("get of a deleted produce returned %v, want not found", err)
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Problem.Type != models.ProblemNotFound {
+		t.Errorf("not found error is missing its problem details: %#v", err)
+	}
+
+	if err := c.DeleteProduce(ctx, "KIWI-4GH7-QPL9-3N4M", DeleteOptions{IgnoreMissing: true}); err != nil {
+		t.Errorf("delete of a missing produce with IgnoreMissing returned %v", err)
+	}
+}
+
+func TestCreateProduceFailure(t *testing.T) {
+	c := newTestClient(t)
+
+	// a produce code already in the inventory fails the whole request
+	response, err := c.CreateProduce(context.Background(), []models.Produce{
+		{Name: "Lettuce", ProduceCode: "A12T-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(100, models.USD)},
+	}, false)
+	if StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("wrong error: got %v want a %d", err, http.StatusBadRequest)
+	}
+	if len(response.Invalid) != 1 || response.Invalid[0].Reason != models.ReasonDuplicateCode {
+		t.Errorf("failed produce was not listed: %+v", response)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var sent []string
+	handler := api.NewServer().Handler()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get(requestIDHeader))
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = c.GetProduce(context.Background(), "ZZZZ-4GH7-QPL9-3N4M")
+	if !IsNotFound(err) {
+		t.Fatalf("wrong error: got %v want a %d", err, http.StatusNotFound)
+	}
+	if len(sent) != 1 || sent[0] == "" {
+		t.Fatalf("no request id was sent: %q", sent)
+	}
+
+	apiErr := err.(*Error)
+	if RequestID(err) != sent[0] || apiErr.Problem.RequestID != sent[0] {
+		t.Errorf("wrong request id: got %q and %q want %q", RequestID(err), apiErr.Problem.RequestID, sent[0])
+	}
+	if !strings.Contains(err.Error(), sent[0]) {
+		t.Errorf("error does not name the request id: %v", err)
+	}
+
+	if _, err := c.ListPromotions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || sent[1] == sent[0] {
+		t.Errorf("requests were sent with the same request id: %q", sent)
+	}
+}
+
+func TestInvalidProduceCode(t *testing.T) {
+	c := newTestClient(t)
+
+	if _, _, err := c.GetProduce(context.Background(), "not-a-code"); err == nil || StatusCode(err) != 0 {
+		t.Errorf("an invalid produce code was sent: %v", err)
+	}
+}
+
+func TestListAllProduce(t *testing.T) {
+	c := newTestClient(t)
+
+	page, err := c.ListProduce(context.Background(), ListOptions{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Produce) != 3 || page.Total != 4 || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	produce, err := c.ListAllProduce(context.Background(), ListOptions{Limit: 3, SortBy: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, p := range produce {
+		names = append(names, p.Name)
+	}
+	if got, want := strings.Join(names, ","), "Gala Apple,Green Pepper,Lettuce,Peach"; got != want {
+		t.Errorf("wrong produce listed: got %s want %s", got, want)
+	}
+
+	_, err = c.ListProduce(context.Background(), ListOptions{Filter: Filter{MinPrice: "cheap"}})
+	if StatusCode(err) != http.StatusBadRequest {
+		t.Errorf("invalid filter returned %v, want a %d", err, http.StatusBadRequest)
+	}
+}
+
+func TestExportImportProduce(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	export := &bytes.Buffer{}
+	if err := c.ExportProduce(ctx, export, MediaTypeCSV, Filter{CodePrefix: "A12T"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(export.String(), "produceCode,name,unitPrice") || !strings.Contains(export.String(), "Lettuce") {
+		t.Fatalf("unexpected export: %s", export)
+	}
+
+	if err := c.ExportProduce(ctx, &bytes.Buffer{}, "application/xml", Filter{}); StatusCode(err) != http.StatusNotAcceptable {
+		t.Errorf("export as an unsupported media type returned %v", err)
+	}
+
+	response, err := c.ImportProduce(ctx, strings.NewReader(export.String()), MediaTypeCSV, DuplicateSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Skipped != 1 {
+		t.Errorf("unexpected import response: %+v", response)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	cart, err := c.CreateCart(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.AddCartItem(ctx, cart.ID, models.CartItem{ProduceCode: "E5T6-9UI3-TH15-QR88", Quantity: models.NewQuantity(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	quote, err := c.Quote(ctx, models.QuoteRequest{Items: []models.CartItem{{ProduceCode: "E5T6-9UI3-TH15-QR88", Quantity: models.NewQuantity(2)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := c.CheckoutCart(ctx, cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Subtotal.Cmp(quote.Subtotal) != 0 || receipt.Subtotal.Cmp(models.NewMoney(598, models.USD)) != 0 {
+		t.Errorf("unexpected receipt subtotal %s", receipt.Subtotal)
+	}
+
+	if _, err := c.AddCartItem(ctx, cart.ID, models.CartItem{ProduceCode: "E5T6-9UI3-TH15-QR88", Quantity: models.NewQuantity(1)}); !IsConflict(err) {
+		t.Errorf("adding to a checked out cart returned %v, want a conflict", err)
+	}
+
+	if _, err := c.GetReceipt(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("receipt of a missing cart returned %v, want not found", err)
+	}
+}
+
+// flakyHandler answers the first failures requests with a 503 and then hands them to next
+type flakyHandler struct {
+	mutex    sync.Mutex
+	failures int
+	keys     []string
+	next     http.Handler
+}
+
+func (f *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	f.keys = append(f.keys, r.Header.Get(idempotencyKeyHeader))
+	fail := len(f.keys) <= f.failures
+	f.mutex.Unlock()
+
+	if fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	f.next.ServeHTTP(w, r)
+}
+
+func TestRetry(t *testing.T) {
+	flaky := &flakyHandler{failures: 2, next: api.NewServer().Handler()}
+	ts := httptest.NewServer(flaky)
+	defer ts.Close()
+
+	c, err := New(ts.URL, WithRetry(ExponentialBackoff{MaxAttempts: 3, Initial: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.CreateProduce(context.Background(), []models.Produce{
+		{Name: "Kiwi", ProduceCode: "KIWI-4GH7-QPL9-3N4M", UnitPrice: models.NewMoney(125, models.USD)},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(flaky.keys) != 3 {
+		t.Fatalf("wrong number of attempts: got %d want 3", len(flaky.keys))
+	}
+	if flaky.keys[0] == "" || flaky.keys[1] != flaky.keys[0] || flaky.keys[2] != flaky.keys[0] {
+		t.Errorf("retries were not sent with the same Idempotency-Key: %q", flaky.keys)
+	}
+
+	// without a retry policy the first failure is returned
+	flaky.keys, flaky.failures = nil, 1
+	c, err = New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListPromotions(context.Background()); StatusCode(err) != http.StatusServiceUnavailable {
+		t.Errorf("request without retries returned %v, want a %d", err, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	ts := httptest.NewServer(&flakyHandler{failures: 10})
+	defer ts.Close()
+
+	c, err := New(ts.URL, WithRetry(ExponentialBackoff{MaxAttempts: 10, Initial: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.ListPromotions(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error: got %v want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff{MaxAttempts: 4, Initial: time.Second, Max: 3 * time.Second}
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable}
+
+	for _, tt := range []struct {
+		attempt int
+		resp    *http.Response
+		err     error
+		wait    time.Duration
+		retry   bool
+	}{
+		{attempt: 1, resp: unavailable, wait: time.Second, retry: true},
+		{attempt: 2, err: errors.New("connection refused"), wait: 2 * time.Second, retry: true},
+		{attempt: 3, resp: unavailable, wait: 3 * time.Second, retry: true},
+		{attempt: 4, resp: unavailable},
+		{attempt: 1, resp: &http.Response{StatusCode: http.StatusBadRequest}},
+	} {
+		wait, retry := backoff.Retry(tt.attempt, tt.resp, tt.err)
+		if wait != tt.wait || retry != tt.retry {
+			t.Errorf("attempt %d: got %v, %v want %v, %v", tt.attempt, wait, retry, tt.wait, tt.retry)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	var authorization []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, WithAuth(func(r *http.Request) error {
+		r.Header.Set("Authorization", "Bearer secret")
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ListPromotions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(authorization) != 1 || authorization[0] != "Bearer secret" {
+		t.Errorf("request was not authorized: %q", authorization)
+	}
+
+	c, err = New(ts.URL, WithAPIKey("sm_0123abcd_s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListPromotions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(authorization) != 2 || authorization[1] != "Bearer sm_0123abcd_s3cret" {
+		t.Errorf("request was not sent with the API key: %q", authorization)
+	}
+	if _, err := New(ts.URL, WithAPIKey("")); err == nil {
+		t.Error("expected an error for an empty API key")
+	}
+
+	refused := errors.New("no credentials")
+	c, err = New(ts.URL, WithAuth(func(*http.Request) error { return refused }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListPromotions(context.Background()); err != refused {
+		t.Errorf("wrong error: got %v want %v", err, refused)
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// Error is a request the API answered with an error status
+type Error struct {
+	StatusCode int
+	// Problem holds the RFC 7807 problem details of the response. It is zero
+	// when the response had none, such as a bulk request that listed what failed.
+	Problem models.Problem
+	// Body is the response as it was sent
+	Body []byte
+	// RequestID is the id the request is logged with by the API
+	RequestID string
+}
+
+func newError(req *http.Request, resp *http.Response, body []byte) *Error {
+	e := &Error{StatusCode: resp.StatusCode, Body: body}
+	if isProblem(resp) {
+		// a problem that cannot be decoded is still described by its body
+		_ = json.Unmarshal(body, &e.Problem)
+	}
+
+	// the API answers with the id it logged the request with, which is the
+	// one that was sent unless it was invalid
+	e.RequestID = resp.Header.Get(requestIDHeader)
+	if e.RequestID == "" {
+		e.RequestID = req.Header.Get(requestIDHeader)
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	detail := e.Problem.Detail
+	if detail == "" {
+		detail = e.Problem.Title
+	}
+	// a JSON body that is not problem details is the usual response of the
+	// request, which lists what failed, so only a body such as the plain text
+	// error of a proxy describes the error
+	if detail == "" && !json.Valid(e.Body) {
+		detail = strings.TrimSpace(string(e.Body))
+	}
+
+	msg := fmt.Sprintf("supermarket: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if detail != "" {
+		msg += ": " + detail
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request ID %s)", e.RequestID)
+	}
+	return msg
+}
+
+// StatusCode returns the status code of an *Error, or 0 when err is not one
+func StatusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// RequestID returns the id an *Error's request is logged with by the API, or
+// "" when err is not one
+func RequestID(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RequestID
+	}
+	return ""
+}
+
+// IsNotFound reports whether err is a request for something the API does not have
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a request the current state of a resource does not allow
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+// IsPreconditionFailed reports whether err is a conditional request for a resource that has since changed
+func IsPreconditionFailed(err error) bool {
+	return StatusCode(err) == http.StatusPreconditionFailed
+}
+
+// isProblem reports whether a response is RFC 7807 problem details
+func isProblem(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == mediaTypeProblem
+}
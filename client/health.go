@@ -0,0 +1,23 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// Ping checks the API is ready to handle requests. The readiness is returned
+// along with an error when it is not, so the checks that failed are known.
+func (c *Client) Ping(ctx context.Context) (models.Readiness, error) {
+	readiness := models.Readiness{}
+	_, err := c.do(ctx, http.MethodGet, "/readyz", nil, nil, &readiness)
+	return readiness, err
+}
+
+// Version gets the build of the API
+func (c *Client) Version(ctx context.Context) (models.BuildInfo, error) {
+	build := models.BuildInfo{}
+	_, err := c.do(ctx, http.MethodGet, "/version", nil, nil, &build)
+	return build, err
+}
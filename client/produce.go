@@ -0,0 +1,378 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+const (
+	// MediaTypeCSV is the media type of a catalog exported or imported as comma separated values
+	MediaTypeCSV = "text/csv"
+	// MediaTypeNDJSON is the media type of a catalog exported or imported as one JSON produce per line
+	MediaTypeNDJSON = "application/x-ndjson"
+)
+
+// How an import handles a row with a produce code already in the catalog
+const (
+	DuplicateSkip      = "skip"
+	DuplicateOverwrite = "overwrite"
+	DuplicateFail      = "fail"
+)
+
+// Filter narrows the produce listed, exported or deleted. Every filter that is
+// set must match.
+type Filter struct {
+	NameContains string
+	NamePrefix   string
+	ProduceCode  string
+	CodePrefix   string
+	// MinPrice and MaxPrice are inclusive decimal amounts in the default currency, e.g. 1.50
+	MinPrice string
+	MaxPrice string
+}
+
+func (f Filter) query() url.Values {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"name_contains": f.NameContains,
+		"name_prefix":   f.NamePrefix,
+		"produce_code":  f.ProduceCode,
+		"code_prefix":   f.CodePrefix,
+		"min_price":     f.MinPrice,
+		"max_price":     f.MaxPrice,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	return query
+}
+
+// ListOptions chooses the produce listed and how it is sorted and paged
+type ListOptions struct {
+	Filter Filter
+	// SortBy is name, producecode or unitprice. Produce is sorted by produce code by default.
+	SortBy string
+	// Order is asc or desc
+	Order string
+	// Limit is the most produce on a page, or every produce when 0
+	Limit int
+	// Offset skips produce before the first page. Cursor continues from the
+	// page that returned it and cannot be combined with an offset.
+	Offset int
+	Cursor string
+	// AsOf lists the catalog as it was at a moment in time when it is set
+	AsOf time.Time
+}
+
+func (o ListOptions) query() url.Values {
+	query := o.Filter.query()
+	if o.SortBy != "" {
+		query.Set("sort_by", o.SortBy)
+	}
+	if o.Order != "" {
+		query.Set("order", o.Order)
+	}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		query.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.Cursor != "" {
+		query.Set("cursor", o.Cursor)
+	}
+	if !o.AsOf.IsZero() {
+		query.Set("as_of", o.AsOf.UTC().Format(time.RFC3339Nano))
+	}
+	return query
+}
+
+// ProducePage is one page of a produce listing
+type ProducePage struct {
+	Produce []models.Produce
+	// Total is how much produce matches the listing across every page
+	Total int
+	// NextCursor continues the listing with the next page, or is empty on the last page
+	NextCursor string
+}
+
+// ListProduce lists one page of the produce in the inventory
+func (c *Client) ListProduce(ctx context.Context, opts ListOptions) (ProducePage, error) {
+	page := ProducePage{Produce: []models.Produce{}}
+	resp, err := c.do(ctx, http.MethodGet, "/api/v1/produce", opts.query(), nil, &page.Produce)
+	if err != nil {
+		return ProducePage{}, err
+	}
+
+	page.Total, _ = strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	if next := linkURL(resp.Header.Get("Link"), "next"); next != "" {
+		if u, err := url.Parse(next); err == nil {
+			page.NextCursor = u.Query().Get("cursor")
+		}
+	}
+
+	return page, nil
+}
+
+// ListAllProduce lists every page of the produce in the inventory
+func (c *Client) ListAllProduce(ctx context.Context, opts ListOptions) ([]models.Produce, error) {
+	produce := []models.Produce{}
+	for {
+		page, err := c.ListProduce(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		produce = append(produce, page.Produce...)
+
+		if page.NextCursor == "" {
+			return produce, nil
+		}
+		opts.Offset, opts.Cursor = 0, page.NextCursor
+	}
+}
+
+// linkURL returns the URL of a relation in an RFC 5988 Link header
+func linkURL(header, rel string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(strings.TrimSpace(link), ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == fmt.Sprintf(`rel="%s"`, rel) {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// GetProduce gets a produce along with its ETag, which can be given to a later
+// update or delete so it only succeeds if nothing changed in between
+func (c *Client) GetProduce(ctx context.Context, produceCode string) (models.Produce, string, error) {
+	path, err := produceCodePath(produceCode, "")
+	if err != nil {
+		return models.Produce{}, "", err
+	}
+
+	produce := models.Produce{}
+	resp, err := c.do(ctx, http.MethodGet, path, nil, nil, &produce)
+	if err != nil {
+		return models.Produce{}, "", err
+	}
+	return produce, resp.Header.Get("ETag"), nil
+}
+
+// CreateProduce creates a batch of produce. When atomic is true either every
+// produce is created or none of it. Produce that could not be created is
+// listed in the response, which is also returned along with an *Error when
+// none of the produce was created.
+func (c *Client) CreateProduce(ctx context.Context, produce []models.Produce, atomic bool) (models.CreateProduceResponse, error) {
+	query := url.Values{}
+	if atomic {
+		query.Set("atomic", "true")
+	}
+
+	response := models.CreateProduceResponse{}
+	_, err := c.do(ctx, http.MethodPost, "/api/v1/produce", query, models.ProduceListV2(produce), &response)
+	return response, err
+}
+
+// ReplaceProduce replaces a produce with a PUT. Its stock is kept. When
+// ifMatch is set the produce is only replaced if its ETag still matches. The
+// produce as replaced is returned with its new ETag.
+func (c *Client) ReplaceProduce(ctx context.Context, produce models.Produce, ifMatch string) (models.Produce, string, error) {
+	path, err := produceCodePath(produce.ProduceCode, "")
+	if err != nil {
+		return models.Produce{}, "", err
+	}
+
+	return c.writeProduce(ctx, http.MethodPut, path, produce.V2(), mediaTypeJSON, ifMatch)
+}
+
+// PatchProduce changes only the fields of a produce in patch, a JSON Merge
+// Patch (RFC 7396) such as {"unitPrice": 2.99}. patch may be a []byte of JSON
+// or any value that marshals to it.
+func (c *Client) PatchProduce(ctx context.Context, produceCode string, patch interface{}, ifMatch string) (models.Produce, string, error) {
+	path, err := produceCodePath(produceCode, "")
+	if err != nil {
+		return models.Produce{}, "", err
+	}
+
+	return c.writeProduce(ctx, http.MethodPatch, path, patch, mediaTypeMergePatch, ifMatch)
+}
+
+// writeProduce sends a produce or a patch of it and returns the produce as written with its ETag
+func (c *Client) writeProduce(ctx context.Context, method, path string, body interface{}, contentType, ifMatch string) (models.Produce, string, error) {
+	if b, ok := body.([]byte); ok {
+		body = bytes.NewReader(b)
+	}
+
+	req, err := c.newRequest(ctx, method, path, nil, body)
+	if err != nil {
+		return models.Produce{}, "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	produce := models.Produce{}
+	resp, err := c.doRequest(req, &produce)
+	if err != nil {
+		return models.Produce{}, "", err
+	}
+	return produce, resp.Header.Get("ETag"), nil
+}
+
+// DeleteOptions make a delete of a single produce conditional or safe to repeat
+type DeleteOptions struct {
+	// IfMatch only deletes the produce if its ETag still matches
+	IfMatch string
+	// IgnoreMissing succeeds when the produce does not exist
+	IgnoreMissing bool
+}
+
+// DeleteProduce deletes a produce
+func (c *Client) DeleteProduce(ctx context.Context, produceCode string, opts DeleteOptions) error {
+	path, err := produceCodePath(produceCode, "")
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if opts.IgnoreMissing {
+		query.Set("ignore_missing", "true")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete, path, query, nil)
+	if err != nil {
+		return err
+	}
+	if opts.IfMatch != "" {
+		req.Header.Set("If-Match", opts.IfMatch)
+	}
+
+	_, err = c.doRequest(req, nil)
+	return err
+}
+
+// BatchDeleteProduce deletes every listed produce in a single request. In a
+// dry run the produce that would be deleted is listed instead. Produce that
+// could not be deleted is listed in the response, which is also returned along
+// with an *Error when none of the produce was deleted.
+func (c *Client) BatchDeleteProduce(ctx context.Context, produceCodes []string, dryRun bool) (models.DeleteProduceResponse, error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	response := models.DeleteProduceResponse{}
+	body := map[string][]string{"produceCodes": produceCodes}
+	_, err := c.do(ctx, http.MethodPost, "/api/v1/produce:batchDelete", query, body, &response)
+	return response, err
+}
+
+// DeleteMatchingProduce deletes every produce matching a filter. It must first
+// be sent as a dry run, which lists the produce that would be deleted along
+// with a confirm token, and then with that token to delete exactly that produce.
+func (c *Client) DeleteMatchingProduce(ctx context.Context, filter Filter, dryRun bool, confirm string) (models.DeleteProduceResponse, error) {
+	query := filter.query()
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	if confirm != "" {
+		query.Set("confirm", confirm)
+	}
+
+	response := models.DeleteProduceResponse{}
+	_, err := c.do(ctx, http.MethodDelete, "/api/v1/produce", query, nil, &response)
+	return response, err
+}
+
+// ChangeStock receives, adjusts, reserves or releases stock of a produce and
+// returns the produce with its new stock
+func (c *Client) ChangeStock(ctx context.Context, produceCode string, operation models.StockOperation, quantity models.Quantity) (models.Produce, error) {
+	path, err := produceCodePath(produceCode, "/stock/"+url.PathEscape(string(operation)))
+	if err != nil {
+		return models.Produce{}, err
+	}
+
+	produce := models.Produce{}
+	body := map[string]models.Quantity{"quantity": quantity}
+	_, err = c.do(ctx, http.MethodPost, path, nil, body, &produce)
+	return produce, err
+}
+
+// PriceHistory lists every unit price a produce has had, oldest first
+func (c *Client) PriceHistory(ctx context.Context, produceCode string) ([]models.PriceChange, error) {
+	path, err := produceCodePath(produceCode, "/prices")
+	if err != nil {
+		return nil, err
+	}
+
+	history := []models.PriceChange{}
+	_, err = c.do(ctx, http.MethodGet, path, nil, nil, &history)
+	return history, err
+}
+
+// ExportProduce streams the catalog sorted by produce code to w as
+// MediaTypeCSV or MediaTypeNDJSON. The export is copied as it arrives so it is
+// never held in memory.
+func (c *Client) ExportProduce(ctx context.Context, w io.Writer, mediaType string, filter Filter) error {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/v1/produce/export", filter.query(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", mediaType)
+
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return newError(req, resp, b)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ImportProduce streams a catalog of MediaTypeCSV or MediaTypeNDJSON from r.
+// onDuplicate is DuplicateSkip, DuplicateOverwrite or DuplicateFail, which is
+// the default when it is empty. Rows that could not be imported are listed in
+// the response, which is also returned along with an *Error when no row was
+// imported. A body that cannot be read again, such as a file, is never retried.
+func (c *Client) ImportProduce(ctx context.Context, r io.Reader, mediaType, onDuplicate string) (models.ImportProduceResponse, error) {
+	query := url.Values{}
+	if onDuplicate != "" {
+		query.Set("on_duplicate", onDuplicate)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/api/v1/produce/import", query, r)
+	if err != nil {
+		return models.ImportProduceResponse{}, err
+	}
+	req.Header.Set("Content-Type", mediaType)
+
+	response := models.ImportProduceResponse{}
+	_, err = c.doRequest(req, &response)
+	return response, err
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// promotionPath returns the path of a promotion
+func promotionPath(promotionID string) string {
+	return "/api/v1/promotions/" + url.PathEscape(promotionID)
+}
+
+// ListPromotions lists every promotion
+func (c *Client) ListPromotions(ctx context.Context) ([]models.Promotion, error) {
+	promotions := []models.Promotion{}
+	_, err := c.do(ctx, http.MethodGet, "/api/v1/promotions", nil, nil, &promotions)
+	return promotions, err
+}
+
+// GetPromotion gets a promotion
+func (c *Client) GetPromotion(ctx context.Context, promotionID string) (models.Promotion, error) {
+	promotion := models.Promotion{}
+	_, err := c.do(ctx, http.MethodGet, promotionPath(promotionID), nil, nil, &promotion)
+	return promotion, err
+}
+
+// CreatePromotion adds a promotion. Its id is chosen by the API.
+func (c *Client) CreatePromotion(ctx context.Context, promotion models.Promotion) (models.Promotion, error) {
+	created := models.Promotion{}
+	_, err := c.do(ctx, http.MethodPost, "/api/v1/promotions", nil, promotion, &created)
+	return created, err
+}
+
+// UpdatePromotion replaces the promotion with the id of promotion
+func (c *Client) UpdatePromotion(ctx context.Context, promotion models.Promotion) (models.Promotion, error) {
+	updated := models.Promotion{}
+	_, err := c.do(ctx, http.MethodPut, promotionPath(promotion.ID), nil, promotion, &updated)
+	return updated, err
+}
+
+// DeletePromotion removes a promotion
+func (c *Client) DeletePromotion(ctx context.Context, promotionID string) error {
+	_, err := c.do(ctx, http.MethodDelete, promotionPath(promotionID), nil, nil, nil)
+	return err
+}
+
+// Quote prices a list of items with the promotions that are valid, without creating a cart
+func (c *Client) Quote(ctx context.Context, request models.QuoteRequest) (models.Quote, error) {
+	quote := models.Quote{}
+	_, err := c.do(ctx, http.MethodPost, "/api/v1/pricing/quote", nil, request, &quote)
+	return quote, err
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+// RetryPolicy decides whether a request that failed is sent again
+type RetryPolicy interface {
+	// Retry is called after a request was sent for the attempt-th time, counting
+	// from 1, with its response or the error that kept it from being answered.
+	// It returns how long to wait before sending the request again and whether
+	// to send it at all.
+	Retry(attempt int, resp *http.Response, err error) (time.Duration, bool)
+}
+
+// RetryPolicyFunc lets an ordinary function be used as a RetryPolicy
+type RetryPolicyFunc func(attempt int, resp *http.Response, err error) (time.Duration, bool)
+
+// Retry calls f
+func (f RetryPolicyFunc) Retry(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	return f(attempt, resp, err)
+}
+
+// ExponentialBackoff retries requests that failed to reach the API or were
+// answered with a temporary error, doubling the wait after every retry
+type ExponentialBackoff struct {
+	// MaxAttempts is the most times a request is sent, including the first
+	MaxAttempts int
+	// Initial is how long to wait before the first retry
+	Initial time.Duration
+	// Max caps the wait between retries when it is set
+	Max time.Duration
+}
+
+// DefaultRetryPolicy sends a request up to three times, waiting half a second
+// before the first retry and a second before the second
+func DefaultRetryPolicy() ExponentialBackoff {
+	return ExponentialBackoff{MaxAttempts: 3, Initial: 500 * time.Millisecond}
+}
+
+// Retry implements RetryPolicy
+func (b ExponentialBackoff) Retry(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= b.MaxAttempts || (err == nil && !IsTemporaryStatus(resp.StatusCode)) {
+		return 0, false
+	}
+
+	wait := b.Initial << uint(attempt-1)
+	if b.Max > 0 && (wait > b.Max || wait < b.Initial) {
+		wait = b.Max
+	}
+	return wait, true
+}
+
+// IsTemporaryStatus reports whether a response status is worth retrying the request for
+func IsTemporaryStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xmattstrongx/supermarket/api"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+var (
+	adminCmd = &cobra.Command{
+		Use:   "admin",
+		Short: "administer the supermarket daemon",
+	}
+
+	adminKeysCmd = &cobra.Command{
+		Use:   "keys",
+		Short: "manage the API keys in the key file of the daemon",
+	}
+
+	adminKeysCmdFile string
+
+	adminKeysCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "create an API key and print it. The key cannot be shown again.",
+		Run:   adminKeysCreate,
+	}
+
+	adminKeysListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list every API key, including revoked keys, without their secrets",
+		Run:   adminKeysList,
+	}
+
+	adminKeysRevokeCmd = &cobra.Command{
+		Use:   "revoke [id]",
+		Short: "revoke an API key so requests sent with it are refused",
+		Args:  cobra.ExactArgs(1),
+		Run:   adminKeysRevoke,
+	}
+
+	adminKeysCreateCmdParamName string
+	adminKeysCreateCmdParamRole string
+)
+
+func init() {
+	adminKeysCmd.PersistentFlags().StringVar(&adminKeysCmdFile, "api-keys-file", "", "path of the API key file the daemon is started with")
+
+	adminKeysCreateCmd.Flags().StringVar(&adminKeysCreateCmdParamName, "name", "", "name of who or what the key is for, e.g. checkout-kiosk")
+	adminKeysCreateCmd.Flags().StringVar(&adminKeysCreateCmdParamRole, "role", string(models.RoleReader), "role of the key. Available values are reader to list and get, editor to also create and update, or admin to also delete and import.")
+	adminKeysCmd.AddCommand(adminKeysCreateCmd)
+
+	adminKeysCmd.AddCommand(adminKeysListCmd)
+
+	adminKeysCmd.AddCommand(adminKeysRevokeCmd)
+
+	adminCmd.AddCommand(adminKeysCmd)
+}
+
+func openKeyFile() *api.KeyFile {
+	if adminKeysCmdFile == "" {
+		log.Fatal("must provide an --api-keys-file")
+	}
+
+	keyFile, err := api.OpenKeyFile(adminKeysCmdFile)
+	if err != nil {
+		log.Fatalf("failed to open API key file: %s", err)
+	}
+	return keyFile
+}
+
+// withoutHash hides the hash of an API key when it is printed
+func withoutHash(apiKey models.APIKey) models.APIKey {
+	apiKey.Hash = ""
+	return apiKey
+}
+
+func adminKeysCreate(cmd *cobra.Command, args []string) {
+	if adminKeysCreateCmdParamName == "" {
+		log.Fatal("must provide a --name")
+	}
+	role, err := models.ParseRole(adminKeysCreateCmdParamRole)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	apiKey, key, err := openKeyFile().CreateAPIKey(adminKeysCreateCmdParamName, role)
+	if err != nil {
+		log.Fatalf("failed to create API key: %s", err)
+	}
+
+	printJSON(struct {
+		models.APIKey
+		Key string `json:"key"`
+	}{APIKey: withoutHash(apiKey), Key: key})
+	fmt.Fprintln(os.Stderr, "the key is not stored and cannot be shown again")
+}
+
+func adminKeysList(cmd *cobra.Command, args []string) {
+	keys, err := openKeyFile().ListAPIKeys()
+	if err != nil {
+		log.Fatalf("failed to list API keys: %s", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tROLE\tCREATED AT\tREVOKED AT")
+	for _, apiKey := range keys {
+		revokedAt := "-"
+		if apiKey.Revoked() {
+			revokedAt = apiKey.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", apiKey.ID, apiKey.Name, apiKey.Role, apiKey.CreatedAt.Format(time.RFC3339), revokedAt)
+	}
+	w.Flush()
+}
+
+func adminKeysRevoke(cmd *cobra.Command, args []string) {
+	apiKey, err := openKeyFile().RevokeAPIKey(args[0])
+	if err != nil {
+		log.Fatalf("failed to revoke API key %s: %s", args[0], err)
+	}
+
+	printJSON(withoutHash(apiKey))
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/xmattstrongx/supermarket/client"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+var (
+	cartClientCmd = &cobra.Command{
+		Use:   "cart",
+		Short: "cart client CLI to ring up produce and check out with the supermarket API",
+	}
+
+	cartClientCmdEndpoint string
+	cartClientCmdTimeout  string
+	cartClientCmdAPIKey   string
+
+	cartClientCreateCmd = &cobra.Command{
+		Use:     "create",
+		Aliases: []string{"c"},
+		Short:   "start a new empty cart",
+		Run:     cartClientCreate,
+	}
+
+	cartClientGetCmd = &cobra.Command{
+		Use:     "get [cart id]",
+		Aliases: []string{"g"},
+		Short:   "get a cart priced at the current unit prices",
+		Run:     cartClientGet,
+	}
+
+	cartClientAddCmd = &cobra.Command{
+		Use:     "add [cart id] [produce code]",
+		Aliases: []string{"a"},
+		Short:   "add a quantity of produce to a cart",
+		Run:     cartClientAdd,
+	}
+
+	cartClientRemoveCmd = &cobra.Command{
+		Use:     "remove [cart id] [produce code]",
+		Aliases: []string{"rm"},
+		Short:   "remove produce from a cart",
+		Run:     cartClientRemove,
+	}
+
+	cartClientCheckoutCmd = &cobra.Command{
+		Use:   "checkout [cart id]",
+		Short: "check out a cart and print its receipt",
+		Run:   cartClientCheckout,
+	}
+
+	cartClientReceiptCmd = &cobra.Command{
+		Use:   "receipt [cart id]",
+		Short: "print the receipt of a checked out cart",
+		Run:   cartClientReceipt,
+	}
+
+	cartClientAddCmdParamQuantity    string
+	cartClientRemoveCmdParamQuantity string
+)
+
+func init() {
+	cartClientCmd.PersistentFlags().StringVarP(&cartClientCmdEndpoint, "endpoint", "e", "http://localhost:8000", "endpoint for the cart client to use")
+	cartClientCmd.PersistentFlags().StringVarP(&cartClientCmdTimeout, "timeout", "t", "10s", "timeout for the cart client to set")
+	cartClientCmd.PersistentFlags().StringVar(&cartClientCmdAPIKey, "api-key", "", "API key to send with requests when the daemon requires one. Defaults to the SUPERMARKET_API_KEY environment variable.")
+
+	cartClientCmd.AddCommand(cartClientCreateCmd)
+
+	cartClientCmd.AddCommand(cartClientGetCmd)
+
+	cartClientAddCmd.Flags().StringVar(&cartClientAddCmdParamQuantity, "quantity", "1", "quantity of produce to add in its unit of measure")
+	cartClientCmd.AddCommand(cartClientAddCmd)
+
+	cartClientRemoveCmd.Flags().StringVar(&cartClientRemoveCmdParamQuantity, "quantity", "", "optional quantity of produce to remove. By default all of the produce is removed from the cart.")
+	cartClientCmd.AddCommand(cartClientRemoveCmd)
+
+	cartClientCmd.AddCommand(cartClientCheckoutCmd)
+
+	cartClientCmd.AddCommand(cartClientReceiptCmd)
+}
+
+func newCartClient() *client.Client {
+	return newAPIClient(cartClientCmdEndpoint, cartClientCmdTimeout, false, "", cartClientCmdAPIKey)
+}
+
+func cartClientCreate(cmd *cobra.Command, args []string) {
+	cart, err := newCartClient().CreateCart(context.Background())
+	printResult("create cart", cart, err)
+}
+
+func cartClientGet(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a cart id to get")
+	}
+
+	cart, err := newCartClient().GetCart(context.Background(), args[0])
+	printResult("get cart", cart, err)
+}
+
+func cartClientAdd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		log.Fatal("must provide a cart id and a produce code to add")
+	}
+
+	quantity, err := models.ParseQuantity(cartClientAddCmdParamQuantity)
+	if err != nil {
+		log.Fatalf("invalid quantity: %s", err)
+	}
+
+	item := models.CartItem{ProduceCode: parseProduceCodeArg(args[1]).String(), Quantity: quantity}
+	cart, err := newCartClient().AddCartItem(context.Background(), args[0], item)
+	printResult("add produce to cart", cart, err)
+}
+
+func cartClientRemove(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		log.Fatal("must provide a cart id and a produce code to remove")
+	}
+
+	var quantity *models.Quantity
+	if cartClientRemoveCmdParamQuantity != "" {
+		q, err := models.ParseQuantity(cartClientRemoveCmdParamQuantity)
+		if err != nil {
+			log.Fatalf("invalid quantity: %s", err)
+		}
+		quantity = &q
+	}
+
+	cart, err := newCartClient().RemoveCartItem(context.Background(), args[0], parseProduceCodeArg(args[1]).String(), quantity)
+	printResult("remove produce from cart", cart, err)
+}
+
+func cartClientCheckout(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a cart id to check out")
+	}
+
+	receipt, err := newCartClient().CheckoutCart(context.Background(), args[0])
+	printResult("check out cart", receipt, err)
+}
+
+func cartClientReceipt(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a cart id to get the receipt of")
+	}
+
+	receipt, err := newCartClient().GetReceipt(context.Background(), args[0])
+	printResult("get receipt", receipt, err)
+}
@@ -1,153 +1,66 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
+	"log"
+	"os"
 	"time"
 
-	"github.com/xmattstrongx/supermarket/models"
+	"github.com/xmattstrongx/supermarket/client"
 )
 
-type produceClient struct {
-	client   *http.Client
-	endpoint string
-}
-
-func newClient(opts ...func(*produceClient) error) (*produceClient, error) {
-	produceClient := &produceClient{
-		client: &http.Client{},
-	}
-
-	for _, opt := range opts {
-		if err := opt(produceClient); err != nil {
-			return nil, err
-		}
-	}
-
-	return produceClient, nil
-}
-
-func withTimeout(timeout string) func(*produceClient) error {
-	return func(p *produceClient) error {
-		t, err := time.ParseDuration("10s")
-		if err != nil {
-			return err
-		}
-		p.client.Timeout = t
-		return nil
-	}
-}
+// apiKeyEnv is read for the API key of a client when no --api-key flag is
+// passed, so the key need not show up in the shell history or process list
+const apiKeyEnv = "SUPERMARKET_API_KEY"
 
-func withEndpoint(endpoint string) func(*produceClient) error {
-	return func(p *produceClient) error {
-		p.endpoint = endpoint
-		return nil
-	}
-}
-
-func (p *produceClient) listProduce(sortBy, order, limit, offset string) ([]models.Produce, int, error) {
-	listProduceResponse := &[]models.Produce{}
-	u, err := url.Parse(fmt.Sprintf("%s/api/v1/produce", p.endpoint))
+// newAPIClient returns a client of the API at endpoint, exiting when the flags
+// it is built from are invalid. An empty actor is not sent, and requests are
+// only sent with an API key when one is passed or set in SUPERMARKET_API_KEY.
+func newAPIClient(endpoint, timeout string, retry bool, actor, apiKey string) *client.Client {
+	t, err := time.ParseDuration(timeout)
 	if err != nil {
-		return nil, 0, err
-	}
-	q := u.Query()
-
-	if sortBy != "" {
-		q.Set("sort_by", sortBy)
+		log.Fatalf("invalid timeout %q: %s", timeout, err)
 	}
 
-	if order != "" {
-		q.Set("order", order)
+	opts := []client.Option{client.WithTimeout(t), client.WithActor(actor)}
+	if retry {
+		opts = append(opts, client.WithRetry(client.DefaultRetryPolicy()))
 	}
-
-	if limit != "" {
-		q.Set("limit", limit)
+	if apiKey == "" {
+		apiKey = os.Getenv(apiKeyEnv)
 	}
-
-	if offset != "" {
-		q.Set("offset", offset)
+	if apiKey != "" {
+		opts = append(opts, client.WithAPIKey(apiKey))
 	}
 
-	u.RawQuery = q.Encode()
-	fmt.Println(u)
-
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	c, err := client.New(endpoint, opts...)
 	if err != nil {
-		return nil, 0, err
+		log.Fatalf("failed to create client: %s", err)
 	}
-
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	if err := json.Unmarshal(bodyBytes, listProduceResponse); err != nil {
-		return nil, 0, err
-	}
-
-	return *listProduceResponse, resp.StatusCode, nil
+	return c
 }
 
-func (p *produceClient) deleteProduce(produceCode string) ([]byte, int, error) {
-	url := fmt.Sprintf("%s/api/v1/produce/%s", p.endpoint, produceCode)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	fmt.Println(url)
-
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	defer resp.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+// printJSON writes a response to stdout as JSON
+func printJSON(v interface{}) {
+	b, err := json.Marshal(v)
 	if err != nil {
-		return nil, 0, err
+		log.Fatalf("failed to marshal output: %s", err)
 	}
 
-	return bodyBytes, resp.StatusCode, nil
+	fmt.Fprintln(os.Stdout, string(b))
 }
 
-func (p *produceClient) createProduce(newProduce []byte) (*models.CreateProduceResponse, int, error) {
-	url := fmt.Sprintf("%s/api/v1/produce", p.endpoint)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(newProduce))
-	if err != nil {
-		return nil, 0, err
+// printResult writes the response of a request that succeeded, or exits with
+// the error of one that failed. A bulk request that failed still lists what
+// failed in its response, so the response is written before exiting unless
+// the error came with problem details instead.
+func printResult(action string, v interface{}, err error) {
+	apiErr, ok := err.(*client.Error)
+	if err == nil || (ok && apiErr.Problem.Type == "") {
+		printJSON(v)
 	}
-
-	fmt.Println(url)
-
-	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, 0, err
+		log.Fatalf("failed to %s: %s", action, err)
 	}
-
-	defer resp.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	createProduceResponse := &models.CreateProduceResponse{}
-	if err := json.Unmarshal(bodyBytes, createProduceResponse); err != nil {
-		return nil, 0, err
-	}
-
-	return createProduceResponse, resp.StatusCode, nil
 }
@@ -1,20 +1,171 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/xmattstrongx/supermarket/api"
+	"github.com/xmattstrongx/supermarket/config"
+	"github.com/xmattstrongx/supermarket/models"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
-var daemonCmd = &cobra.Command{
-	Use:   "daemon",
-	Short: "daemon runs the supermarket daemon as a docker container",
-	Run:   daemonRun,
+var (
+	daemonCmd = &cobra.Command{
+		Use:   "daemon",
+		Short: "daemon runs the supermarket daemon as a docker container",
+		Run:   daemonRun,
+	}
+
+	daemonCmdPrintConfig bool
+)
+
+func init() {
+	config.AddFlags(daemonCmd.Flags())
+	daemonCmd.Flags().BoolVar(&daemonCmdPrintConfig, "print-config", false, "print the configuration merged from the config file, environment variables and flags as YAML and exit")
+	addValidationFlags(daemonCmd)
 }
 
 func daemonRun(cmd *cobra.Command, args []string) {
 	log.SetFormatter(&log.JSONFormatter{})
-	server := api.NewServer()
-	server.Serve()
+
+	cfg, err := config.Load(cmd.Flags(), os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid configuration: %s", err)
+	}
+
+	if daemonCmdPrintConfig {
+		b, err := cfg.YAML()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(b)
+		return
+	}
+
+	level, _ := log.ParseLevel(cfg.Log.Level)
+	log.SetLevel(level)
+	if cfg.Log.Format == config.LogFormatText {
+		log.SetFormatter(&log.TextFormatter{})
+	}
+
+	roundingPolicy, _ := models.ParseRoundingPolicy(cfg.Pricing.Rounding)
+	salesTaxRate, _ := models.ParseTaxRate(cfg.Pricing.SalesTaxRate)
+
+	validationRules, err := validationRules()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := []func(*api.Server){
+		api.WithListenAddress(cfg.Listen),
+		api.WithRoundingPolicy(roundingPolicy),
+		api.WithSalesTaxRate(salesTaxRate),
+		api.WithValidationRules(validationRules),
+		api.WithIdempotencyWindow(time.Duration(cfg.Idempotency.Window)),
+		api.WithIdempotencyCacheLimits(cfg.Idempotency.CacheEntries, cfg.Idempotency.CacheBytes),
+		api.WithHTTPConfig(cfg.HTTPConfig()),
+	}
+	if cfg.TLS.CertFile != "" {
+		opts = append(opts, api.WithTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile))
+	}
+
+	if cfg.APIKeysFile != "" {
+		keyFile, err := api.OpenKeyFile(cfg.APIKeysFile)
+		if err != nil {
+			log.Fatalf("failed to open API key file: %s", err)
+		}
+		keys, err := keyFile.ListAPIKeys()
+		if err != nil {
+			log.Fatalf("failed to open API key file: %s", err)
+		}
+		if len(keys) == 0 {
+			log.Warnf("%s has no API keys so every request needing one is refused until a key is created with supermarket admin keys create", cfg.APIKeysFile)
+		}
+		opts = append(opts, api.WithKeyStore(keyFile))
+	} else {
+		log.Warn("no API key file was configured so requests are not authenticated")
+	}
+
+	// the backend is closed once the server has stopped so every change of
+	// the requests that finished during shutdown is flushed
+	var backend io.Closer
+	switch {
+	case cfg.Storage.DataDir != "":
+		var fileOpts []func(*api.FileBackend)
+		if cfg.Seed.File != "" {
+			fileOpts = append(fileOpts, api.WithoutDefaultInventory())
+		}
+		fileBackend, err := api.NewFileBackend(cfg.Storage.DataDir, fileOpts...)
+		if err != nil {
+			log.Fatalf("failed to open data directory: %s", err)
+		}
+		backend = fileBackend
+		opts = append(opts, api.WithProduceManager(fileBackend))
+	case cfg.Storage.DatabaseURL != "":
+		sqlBackend, err := api.OpenSQLBackend(cfg.Storage.DatabaseDriver, cfg.Storage.DatabaseURL)
+		if err != nil {
+			log.Fatalf("failed to open database: %s", err)
+		}
+		backend = sqlBackend
+		opts = append(opts, api.WithProduceManager(sqlBackend))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	go func() {
+		// a second signal stops the daemon without waiting for shutdown
+		<-ctx.Done()
+		stop()
+	}()
+
+	failed := false
+	server := api.NewServer(opts...)
+	if err := seedProduce(server, cfg); err != nil {
+		log.Error(err)
+		failed = true
+	} else if err := server.Serve(ctx); err != nil {
+		log.Error(err)
+		failed = true
+	}
+
+	if backend != nil {
+		if err := backend.Close(); err != nil {
+			log.Errorf("failed to close backend: %s", err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	log.Info("Stopped")
+}
+
+// seedProduce creates the produce of the seed file of the config, if there
+// is one, that is not in the catalog yet
+func seedProduce(server *api.Server, cfg config.Config) error {
+	if cfg.Seed.File == "" {
+		return nil
+	}
+
+	seed, err := cfg.SeedProduce()
+	if err != nil {
+		return err
+	}
+	created, err := server.SeedProduce(seed)
+	if err != nil {
+		return fmt.Errorf("failed to seed produce from %s: %s", cfg.Seed.File, err)
+	}
+	log.Infof("Seeded %d produce from %s", created, cfg.Seed.File)
+	return nil
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xmattstrongx/supermarket/api"
+	"github.com/xmattstrongx/supermarket/migrations"
+)
+
+var (
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "manage the schema of the produce database",
+	}
+
+	migrateCmdDatabaseDriver string
+	migrateCmdDatabaseURL    string
+
+	migrateUpCmd = &cobra.Command{
+		Use:   "up",
+		Short: "apply all pending migrations",
+		Run:   migrateUp,
+	}
+
+	migrateDownCmd = &cobra.Command{
+		Use:   "down",
+		Short: "roll back the most recently applied migrations",
+		Run:   migrateDown,
+	}
+
+	migrateStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "list every migration and whether it has been applied",
+		Run:   migrateStatus,
+	}
+
+	migrateDownCmdParamSteps int
+)
+
+func init() {
+	migrateCmd.PersistentFlags().StringVar(&migrateCmdDatabaseDriver, "database-driver", api.SQLiteDriver, "database/sql driver used to connect to the produce database")
+	migrateCmd.PersistentFlags().StringVar(&migrateCmdDatabaseURL, "database-url", "", "data source name of the produce database, e.g. file:/var/lib/supermarket/produce.db")
+
+	migrateCmd.AddCommand(migrateUpCmd)
+
+	migrateDownCmd.Flags().IntVar(&migrateDownCmdParamSteps, "steps", 1, "how many migrations to roll back")
+	migrateCmd.AddCommand(migrateDownCmd)
+
+	migrateCmd.AddCommand(migrateStatusCmd)
+}
+
+func openMigrateDB() *sql.DB {
+	if migrateCmdDatabaseURL == "" {
+		log.Fatal("must provide a --database-url")
+	}
+
+	db, err := api.OpenDB(migrateCmdDatabaseDriver, migrateCmdDatabaseURL)
+	if err != nil {
+		log.Fatalf("failed to open database: %s", err)
+	}
+	return db
+}
+
+func migrateUp(cmd *cobra.Command, args []string) {
+	db := openMigrateDB()
+	defer db.Close()
+
+	applied, err := migrations.Up(db)
+	if err != nil {
+		log.Fatalf("failed to migrate up: %s", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "applied %d migration(s)\n", applied)
+}
+
+func migrateDown(cmd *cobra.Command, args []string) {
+	db := openMigrateDB()
+	defer db.Close()
+
+	rolledBack, err := migrations.Down(db, migrateDownCmdParamSteps)
+	if err != nil {
+		log.Fatalf("failed to migrate down: %s", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "rolled back %d migration(s)\n", rolledBack)
+}
+
+func migrateStatus(cmd *cobra.Command, args []string) {
+	db := openMigrateDB()
+	defer db.Close()
+
+	statuses, err := migrations.GetStatus(db)
+	if err != nil {
+		log.Fatalf("failed to get migration status: %s", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	w.Flush()
+}
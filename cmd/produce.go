@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/xmattstrongx/supermarket/client"
+	"github.com/xmattstrongx/supermarket/models"
 )
 
 // '[{"name":"fumanchu","produceCode":"XX1X-4GH7-QPL9-3N4M","unitPrice": 1.13333}]'
@@ -20,6 +28,9 @@ var (
 
 	produceClientCmdEndpoint string
 	produceClientCmdTimeout  string
+	produceClientCmdActor    string
+	produceClientCmdAPIKey   string
+	produceClientCmdRetry    bool
 
 	produceClientListCmd = &cobra.Command{
 		Use:     "list",
@@ -29,12 +40,41 @@ var (
 	}
 
 	produceClientDeleteCmd = &cobra.Command{
-		Use:     "delete [id]",
+		Use:     "delete [id...]",
 		Aliases: []string{"d"},
-		Short:   "delete a produce item from the inventory",
+		Short:   "delete one or more produce items from the inventory",
 		Run:     produceClientDelete,
 	}
 
+	produceClientGetCmd = &cobra.Command{
+		Use:     "get [id]",
+		Aliases: []string{"g"},
+		Short:   "get a single produce item from the inventory",
+		Run:     produceClientGet,
+	}
+
+	produceClientUpdateCmd = &cobra.Command{
+		Use:     "update [id]",
+		Aliases: []string{"u"},
+		Short:   "replace or patch a produce item in the inventory",
+		Run:     produceClientUpdate,
+	}
+
+	produceClientStockCmd = &cobra.Command{
+		Use:       "stock [receive|adjust|reserve|release] [id]",
+		Aliases:   []string{"s"},
+		Short:     "receive, adjust, reserve or release stock of a produce item",
+		ValidArgs: []string{"receive", "adjust", "reserve", "release"},
+		Run:       produceClientStock,
+	}
+
+	produceClientPricesCmd = &cobra.Command{
+		Use:     "prices [id]",
+		Aliases: []string{"p"},
+		Short:   "list every unit price a produce item has had and who set it",
+		Run:     produceClientPrices,
+	}
+
 	produceClientCreateCmd = &cobra.Command{
 		Use:     "create",
 		Aliases: []string{"c"},
@@ -42,100 +82,364 @@ var (
 		Run:     produceClientCreate,
 	}
 
+	produceClientExportCmd = &cobra.Command{
+		Use:     "export",
+		Aliases: []string{"e"},
+		Short:   "export the catalog as CSV or newline delimited JSON",
+		Run:     produceClientExport,
+	}
+
+	produceClientPingCmd = &cobra.Command{
+		Use:   "ping",
+		Short: "check the daemon is ready to handle requests",
+		Run:   produceClientPing,
+	}
+
+	produceClientImportCmd = &cobra.Command{
+		Use:     "import [file]",
+		Aliases: []string{"i"},
+		Short:   "import produce from a CSV or newline delimited JSON file",
+		Run:     produceClientImport,
+	}
+
 	produceClientListCmdParamSortBy string
 	produceClientListCmdParamOrder  string
 	produceClientListCmdParamLimit  string
 	produceClientListCmdParamOffset string
+	produceClientListCmdParamAsOf   string
+	produceClientListCmdParamAll    bool
+
+	produceClientListCmdParamNameContains string
+	produceClientListCmdParamNamePrefix   string
+	produceClientListCmdParamProduceCode  string
+	produceClientListCmdParamCodePrefix   string
+	produceClientListCmdParamMinPrice     string
+	produceClientListCmdParamMaxPrice     string
 
 	produceClientCreateCmdParamRequestBody string
+	produceClientCreateCmdParamAtomic      bool
+
+	produceClientUpdateCmdParamRequestBody string
+	produceClientUpdateCmdParamPatch       bool
+	produceClientUpdateCmdParamIfMatch     string
+
+	produceClientDeleteCmdParamIfMatch  string
+	produceClientDeleteCmdParamFromFile string
+	produceClientDeleteCmdParamDryRun   bool
+
+	produceClientStockCmdParamQuantity string
+
+	produceClientExportCmdParamOutput string
+	produceClientExportCmdParamFormat string
+
+	produceClientImportCmdParamFormat      string
+	produceClientImportCmdParamOnDuplicate string
 )
 
 func init() {
 	produceClientCmd.PersistentFlags().StringVarP(&produceClientCmdEndpoint, "endpoint", "e", "http://localhost:8000", "endpoint for the produce client to use")
 	produceClientCmd.PersistentFlags().StringVarP(&produceClientCmdTimeout, "timeout", "t", "10s", "timeout for the produce client to set")
+	produceClientCmd.PersistentFlags().StringVar(&produceClientCmdActor, "actor", os.Getenv("USER"), "who is recorded in the produce history for changes to the catalog. Defaults to the current user.")
+	produceClientCmd.PersistentFlags().StringVar(&produceClientCmdAPIKey, "api-key", "", "API key to send with requests when the daemon requires one. Defaults to the SUPERMARKET_API_KEY environment variable.")
+	produceClientCmd.PersistentFlags().BoolVar(&produceClientCmdRetry, "retry", false, "optional value to resend requests that fail to reach the daemon or are answered with a temporary error. Creates, patches and stock changes are sent with an Idempotency-Key so a retry is never applied twice.")
+	addValidationFlags(produceClientCmd)
 
 	produceClientCmd.AddCommand(produceClientListCmd)
-	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamSortBy, "sort_by", "", "optional value to choose how list response is sorted. Available case insensitive values are name, producecode, unitprice.")
-	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamOrder, "order", "", "optional value to choose how the response is order. Available case insensitive values are desc or descending. If no value or an unaccepted value is passed response will default to ascending.")
-	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamLimit, "limit", "", "optional value to choose the limit of the response after any optional offset. If an invalid value is passed this parameter will be ignored.")
-	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamOffset, "offset", "", "optional value to choose many items to start offset the response values. If an invalid value is passed this parameter will be ignored.")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamSortBy, "sort_by", "", "optional value to choose how list response is sorted. Available case insensitive values are name, producecode, unitprice. Defaults to producecode.")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamOrder, "order", "", "optional value to choose how the response is order. Available case insensitive values are asc, ascending, desc or descending. Defaults to ascending.")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamLimit, "limit", "", "optional value to choose the most produce listed on each page after any optional offset. Must be at least 1.")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamOffset, "offset", "", "optional value to choose many items to start offset the response values. Must be at least 0.")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamAsOf, "as-of", "", "optional RFC 3339 timestamp to list the catalog as it was at that moment, e.g. 2020-01-02T15:04:05Z")
+	produceClientListCmd.Flags().BoolVar(&produceClientListCmdParamAll, "all", false, "optional value to follow the next page of a limited list until every page has been listed")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamNameContains, "name_contains", "", "optional value to only list produce with a name containing it, ignoring case")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamNamePrefix, "name_prefix", "", "optional value to only list produce with a name starting with it, ignoring case")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamProduceCode, "produce_code", "", "optional value to only list the produce with this produce code, ignoring case")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamCodePrefix, "code_prefix", "", "optional value to only list produce with a produce code starting with it, ignoring case, e.g. A12T-4G")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamMinPrice, "min_price", "", "optional value to only list produce with a unit price of at least this amount in USD, e.g. 1.50")
+	produceClientListCmd.Flags().StringVar(&produceClientListCmdParamMaxPrice, "max_price", "", "optional value to only list produce with a unit price of at most this amount in USD, e.g. 3.00")
 
+	produceClientDeleteCmd.Flags().StringVar(&produceClientDeleteCmdParamIfMatch, "if-match", "", "optional ETag from get so the produce is only deleted if it has not changed since")
+	produceClientDeleteCmd.Flags().StringVar(&produceClientDeleteCmdParamFromFile, "from-file", "", "optional path of a file of produce codes to delete, separated by spaces or new lines, along with any given as arguments")
+	produceClientDeleteCmd.Flags().BoolVar(&produceClientDeleteCmdParamDryRun, "dry-run", false, "optional value to list the produce that would be deleted without deleting it")
 	produceClientCmd.AddCommand(produceClientDeleteCmd)
 
+	produceClientCmd.AddCommand(produceClientGetCmd)
+
+	produceClientUpdateCmd.Flags().StringVar(&produceClientUpdateCmdParamRequestBody, "request", "", "request body of the produce to update")
+	produceClientUpdateCmd.Flags().BoolVar(&produceClientUpdateCmdParamPatch, "patch", false, "optional value to send the request body as a JSON Merge Patch so only the fields provided are changed. By default the produce is fully replaced.")
+	produceClientUpdateCmd.Flags().StringVar(&produceClientUpdateCmdParamIfMatch, "if-match", "", "optional ETag from get so the produce is only updated if it has not changed since")
+	produceClientCmd.AddCommand(produceClientUpdateCmd)
+
+	produceClientStockCmd.Flags().StringVar(&produceClientStockCmdParamQuantity, "quantity", "", "quantity of stock in the produce's unit of measure. Adjustments may be negative.")
+	produceClientCmd.AddCommand(produceClientStockCmd)
+
+	produceClientCmd.AddCommand(produceClientPricesCmd)
+
 	produceClientCreateCmd.Flags().StringVar(&produceClientCreateCmdParamRequestBody, "request", "", "request body of produce to create")
+	produceClientCreateCmd.Flags().BoolVar(&produceClientCreateCmdParamAtomic, "atomic", false, "optional value to create every produce of the request or none of it when any produce cannot be created. By default the produce that can be created is created.")
 	produceClientCmd.AddCommand(produceClientCreateCmd)
+
+	produceClientExportCmd.Flags().StringVarP(&produceClientExportCmdParamOutput, "output", "o", "", "optional path of the file to export to. Defaults to stdout.")
+	produceClientExportCmd.Flags().StringVar(&produceClientExportCmdParamFormat, "format", "", "optional value to choose the format of the export. Available values are csv and ndjson. Defaults to the extension of the output file, or csv.")
+	produceClientExportCmd.Flags().StringVar(&produceClientListCmdParamNameContains, "name_contains", "", "optional value to only export produce with a name containing it, ignoring case")
+	produceClientExportCmd.Flags().StringVar(&produceClientListCmdParamNamePrefix, "name_prefix", "", "optional value to only export produce with a name starting with it, ignoring case")
+	produceClientExportCmd.Flags().StringVar(&produceClientListCmdParamCodePrefix, "code_prefix", "", "optional value to only export produce with a produce code starting with it, ignoring case, e.g. A12T-4G")
+	produceClientExportCmd.Flags().StringVar(&produceClientListCmdParamMinPrice, "min_price", "", "optional value to only export produce with a unit price of at least this amount in USD, e.g. 1.50")
+	produceClientExportCmd.Flags().StringVar(&produceClientListCmdParamMaxPrice, "max_price", "", "optional value to only export produce with a unit price of at most this amount in USD, e.g. 3.00")
+	produceClientCmd.AddCommand(produceClientExportCmd)
+
+	produceClientImportCmd.Flags().StringVar(&produceClientImportCmdParamFormat, "format", "", "optional value to choose the format of the file. Available values are csv and ndjson. Defaults to the extension of the file, or csv.")
+	produceClientImportCmd.Flags().StringVar(&produceClientImportCmdParamOnDuplicate, "on-duplicate", "", "optional value to choose what happens to a row whose produce code is already in the catalog. Available values are skip, overwrite and fail. Defaults to fail.")
+	produceClientCmd.AddCommand(produceClientImportCmd)
+
+	produceClientCmd.AddCommand(produceClientPingCmd)
+}
+
+func newProduceClient() *client.Client {
+	return newAPIClient(produceClientCmdEndpoint, produceClientCmdTimeout, produceClientCmdRetry, produceClientCmdActor, produceClientCmdAPIKey)
+}
+
+// produceClientFilter returns the filter set by the list flags
+func produceClientFilter() client.Filter {
+	return client.Filter{
+		NameContains: produceClientListCmdParamNameContains,
+		NamePrefix:   produceClientListCmdParamNamePrefix,
+		ProduceCode:  produceClientListCmdParamProduceCode,
+		CodePrefix:   produceClientListCmdParamCodePrefix,
+		MinPrice:     produceClientListCmdParamMinPrice,
+		MaxPrice:     produceClientListCmdParamMaxPrice,
+	}
 }
 
 func produceClientList(cmd *cobra.Command, args []string) {
-	client, err := newClient(
-		withEndpoint(produceClientCmdEndpoint),
-		withTimeout(produceClientCmdTimeout),
-	)
-	if err != nil {
-		log.Fatalf("failed to create produce client: %s", err)
+	opts := client.ListOptions{
+		Filter: produceClientFilter(),
+		SortBy: produceClientListCmdParamSortBy,
+		Order:  produceClientListCmdParamOrder,
 	}
 
-	resp, statusCode, err := client.listProduce(
-		produceClientListCmdParamSortBy,
-		produceClientListCmdParamOrder,
-		produceClientListCmdParamLimit,
-		produceClientListCmdParamOffset,
-	)
-	if err != nil {
-		log.Fatalf("failed to list produce: %s", err)
+	var err error
+	if produceClientListCmdParamLimit != "" {
+		if opts.Limit, err = strconv.Atoi(produceClientListCmdParamLimit); err != nil || opts.Limit < 1 {
+			log.Fatalf("invalid limit %q: must be at least 1", produceClientListCmdParamLimit)
+		}
+	}
+	if produceClientListCmdParamOffset != "" {
+		if opts.Offset, err = strconv.Atoi(produceClientListCmdParamOffset); err != nil || opts.Offset < 0 {
+			log.Fatalf("invalid offset %q: must be at least 0", produceClientListCmdParamOffset)
+		}
+	}
+	if produceClientListCmdParamAsOf != "" {
+		if opts.AsOf, err = time.Parse(time.RFC3339, produceClientListCmdParamAsOf); err != nil {
+			log.Fatalf("invalid as-of %q: must be an RFC 3339 timestamp", produceClientListCmdParamAsOf)
+		}
 	}
 
-	printResponse(resp, statusCode)
+	c := newProduceClient()
+	if produceClientListCmdParamAll {
+		produce, err := c.ListAllProduce(context.Background(), opts)
+		printResult("list produce", produce, err)
+		return
+	}
+
+	page, err := c.ListProduce(context.Background(), opts)
+	printResult("list produce", page.Produce, err)
 }
 
 func produceClientDelete(cmd *cobra.Command, args []string) {
-	if len(args) < 1 {
+	args = append([]string{}, args...)
+	if produceClientDeleteCmdParamFromFile != "" {
+		b, err := ioutil.ReadFile(produceClientDeleteCmdParamFromFile)
+		if err != nil {
+			log.Fatalf("failed to read produce codes: %s", err)
+		}
+		args = append(args, strings.Fields(string(b))...)
+	}
+
+	produceCodes := make([]string, len(args))
+	for i, arg := range args {
+		produceCodes[i] = parseProduceCodeArg(arg).String()
+	}
+
+	if len(produceCodes) < 1 {
 		log.Fatal("must provide a produce code to delete")
 	}
 
-	client, err := newClient(
-		withEndpoint(produceClientCmdEndpoint),
-		withTimeout(produceClientCmdTimeout),
-	)
-	if err != nil {
-		log.Fatalf("failed to create produce client: %s", err)
+	c := newProduceClient()
+
+	// a single produce is deleted on its own so the delete can be conditional on its ETag
+	if len(produceCodes) == 1 && !produceClientDeleteCmdParamDryRun {
+		err := c.DeleteProduce(context.Background(), produceCodes[0], client.DeleteOptions{IfMatch: produceClientDeleteCmdParamIfMatch})
+		if err != nil {
+			log.Fatalf("failed to delete produce: %s", err)
+		}
+		return
 	}
 
-	produceCode := args[0]
+	if produceClientDeleteCmdParamIfMatch != "" {
+		log.Fatal("--if-match can only be used to delete a single produce")
+	}
 
-	resp, statusCode, err := client.deleteProduce(produceCode)
+	response, err := c.BatchDeleteProduce(context.Background(), produceCodes, produceClientDeleteCmdParamDryRun)
+	printResult("delete produce", response, err)
+}
+
+func produceClientGet(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a produce code to get")
+	}
+
+	produce, etag, err := newProduceClient().GetProduce(context.Background(), parseProduceCodeArg(args[0]).String())
+	if err == nil && etag != "" {
+		fmt.Fprintf(os.Stdout, "ETag: %s\n", etag)
+	}
+	printResult("get produce", produce, err)
+}
+
+func produceClientUpdate(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a produce code to update")
+	}
+	produceCode := parseProduceCodeArg(args[0])
+	body := []byte(produceClientUpdateCmdParamRequestBody)
+	c := newProduceClient()
+
+	var produce models.Produce
+	var etag string
+	var err error
+	if produceClientUpdateCmdParamPatch {
+		// a patch only holds some fields so it is left for the daemon to validate
+		produce, etag, err = c.PatchProduce(context.Background(), produceCode.String(), body, produceClientUpdateCmdParamIfMatch)
+	} else {
+		if err := validateReplaceRequest(produceCode.String(), body); err != nil {
+			log.Fatalf("invalid produce: %s", err)
+		}
+
+		replacement := models.Produce{}
+		if err := json.Unmarshal(body, &replacement); err != nil {
+			log.Fatalf("invalid produce: %s", err)
+		}
+		if replacement.ProduceCode != "" && !strings.EqualFold(replacement.ProduceCode, produceCode.String()) {
+			log.Fatal("the produce code of a produce cannot be changed")
+		}
+		replacement.ProduceCode = produceCode.String()
+
+		produce, etag, err = c.ReplaceProduce(context.Background(), replacement, produceClientUpdateCmdParamIfMatch)
+	}
+
+	if err == nil && etag != "" {
+		fmt.Fprintf(os.Stdout, "ETag: %s\n", etag)
+	}
+	printResult("update produce", produce, err)
+}
+
+func produceClientStock(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		log.Fatal("must provide a stock operation and a produce code")
+	}
+
+	quantity, err := models.ParseQuantity(produceClientStockCmdParamQuantity)
 	if err != nil {
-		log.Fatalf("failed to delete produce: %s", err)
+		log.Fatalf("invalid quantity: %s", err)
 	}
 
-	printResponse(resp, statusCode)
+	produce, err := newProduceClient().ChangeStock(context.Background(), parseProduceCodeArg(args[1]).String(), models.StockOperation(args[0]), quantity)
+	printResult("change stock", produce, err)
+}
+
+func produceClientPrices(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a produce code to list the prices of")
+	}
 
+	history, err := newProduceClient().PriceHistory(context.Background(), parseProduceCodeArg(args[0]).String())
+	printResult("list prices", history, err)
+}
+
+func produceClientPing(cmd *cobra.Command, args []string) {
+	readiness, err := newProduceClient().Ping(context.Background())
+	printResult("ping daemon", readiness, err)
 }
 
 func produceClientCreate(cmd *cobra.Command, args []string) {
-	client, err := newClient(
-		withEndpoint(produceClientCmdEndpoint),
-		withTimeout(produceClientCmdTimeout),
-	)
-	if err != nil {
-		log.Fatalf("failed to create produce client: %s", err)
+	body := []byte(produceClientCreateCmdParamRequestBody)
+	if err := validateCreateRequest(body); err != nil {
+		log.Fatalf("invalid produce: %s", err)
 	}
 
-	resp, statusCode, err := client.createProduce([]byte(produceClientCreateCmdParamRequestBody))
-	if err != nil {
-		log.Fatalf("failed to create produce: %s", err)
+	var newProduce []models.Produce
+	if err := json.Unmarshal(body, &newProduce); err != nil {
+		log.Fatalf("invalid produce: %s", err)
+	}
+
+	response, err := newProduceClient().CreateProduce(context.Background(), newProduce, produceClientCreateCmdParamAtomic)
+	printResult("create produce", response, err)
+}
+
+func produceClientExport(cmd *cobra.Command, args []string) {
+	mediaType := catalogMediaType(produceClientExportCmdParamFormat, produceClientExportCmdParamOutput)
+	c := newProduceClient()
+
+	out := os.Stdout
+	if produceClientExportCmdParamOutput != "" {
+		var err error
+		if out, err = os.Create(produceClientExportCmdParamOutput); err != nil {
+			log.Fatalf("failed to create export file: %s", err)
+		}
+		defer out.Close()
 	}
 
-	printResponse(resp, statusCode)
+	// the export is copied to the file as it arrives so the catalog is never held in memory
+	if err := c.ExportProduce(context.Background(), out, mediaType, produceClientFilter()); err != nil {
+		log.Fatalf("failed to export produce: %s", err)
+	}
 }
 
-func printResponse(obj interface{}, statusCode int) {
-	js, err := json.Marshal(obj)
+func produceClientImport(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a file to import")
+	}
+	mediaType := catalogMediaType(produceClientImportCmdParamFormat, args[0])
+
+	file, err := os.Open(args[0])
 	if err != nil {
-		log.Fatalf("failed to marshal output: %s", err)
-		return
+		log.Fatalf("failed to open import file: %s", err)
+	}
+	defer file.Close()
+
+	// the file is sent as it is read so the catalog is never held in memory
+	response, err := newProduceClient().ImportProduce(context.Background(), file, mediaType, produceClientImportCmdParamOnDuplicate)
+	printResult("import produce", response, err)
+}
+
+// catalogMediaType returns the media type of an exported or imported catalog
+// named by format or, when no format is given, by the extension of path
+func catalogMediaType(format, path string) string {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			format = "csv"
+		}
 	}
 
-	fmt.Fprintf(os.Stdout, fmt.Sprintf("Status Code: %d\n", statusCode))
-	fmt.Fprintf(os.Stdout, string(js))
+	switch strings.ToLower(format) {
+	case "ndjson":
+		return client.MediaTypeNDJSON
+	case "csv":
+		return client.MediaTypeCSV
+	}
+	log.Fatalf("unknown format %q, must be csv or ndjson", format)
+	return ""
+}
+
+// parseProduceCodeArg returns the canonical form of a produce code given as an
+// argument, exiting when the produce code is invalid
+func parseProduceCodeArg(arg string) models.ProduceCode {
+	produceCode, err := models.ParseProduceCode(arg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return produceCode
 }
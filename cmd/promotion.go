@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/xmattstrongx/supermarket/client"
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+var (
+	promotionClientCmd = &cobra.Command{
+		Use:     "promotion",
+		Aliases: []string{"promo"},
+		Short:   "promotion client CLI to manage promotions and quote prices with the supermarket API",
+	}
+
+	promotionClientCmdEndpoint string
+	promotionClientCmdTimeout  string
+	promotionClientCmdAPIKey   string
+
+	promotionClientListCmd = &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l"},
+		Short:   "list every promotion",
+		Run:     promotionClientList,
+	}
+
+	promotionClientGetCmd = &cobra.Command{
+		Use:     "get [promotion id]",
+		Aliases: []string{"g"},
+		Short:   "get a single promotion",
+		Run:     promotionClientGet,
+	}
+
+	promotionClientCreateCmd = &cobra.Command{
+		Use:     "create",
+		Aliases: []string{"c"},
+		Short:   "create a promotion",
+		Run:     promotionClientCreate,
+	}
+
+	promotionClientUpdateCmd = &cobra.Command{
+		Use:     "update [promotion id]",
+		Aliases: []string{"u"},
+		Short:   "replace a promotion",
+		Run:     promotionClientUpdate,
+	}
+
+	promotionClientDeleteCmd = &cobra.Command{
+		Use:     "delete [promotion id]",
+		Aliases: []string{"d"},
+		Short:   "delete a promotion",
+		Run:     promotionClientDelete,
+	}
+
+	promotionClientQuoteCmd = &cobra.Command{
+		Use:     "quote",
+		Aliases: []string{"q"},
+		Short:   "price a list of items with the promotions that are valid without creating a cart",
+		Run:     promotionClientQuote,
+	}
+
+	promotionClientCreateCmdParamRequestBody string
+	promotionClientUpdateCmdParamRequestBody string
+	promotionClientQuoteCmdParamRequestBody  string
+)
+
+func init() {
+	promotionClientCmd.PersistentFlags().StringVarP(&promotionClientCmdEndpoint, "endpoint", "e", "http://localhost:8000", "endpoint for the promotion client to use")
+	promotionClientCmd.PersistentFlags().StringVarP(&promotionClientCmdTimeout, "timeout", "t", "10s", "timeout for the promotion client to set")
+	promotionClientCmd.PersistentFlags().StringVar(&promotionClientCmdAPIKey, "api-key", "", "API key to send with requests when the daemon requires one. Defaults to the SUPERMARKET_API_KEY environment variable.")
+
+	promotionClientCmd.AddCommand(promotionClientListCmd)
+
+	promotionClientCmd.AddCommand(promotionClientGetCmd)
+
+	promotionClientCreateCmd.Flags().StringVar(&promotionClientCreateCmdParamRequestBody, "request", "", "request body of the promotion to create")
+	promotionClientCmd.AddCommand(promotionClientCreateCmd)
+
+	promotionClientUpdateCmd.Flags().StringVar(&promotionClientUpdateCmdParamRequestBody, "request", "", "request body of the promotion to replace")
+	promotionClientCmd.AddCommand(promotionClientUpdateCmd)
+
+	promotionClientCmd.AddCommand(promotionClientDeleteCmd)
+
+	promotionClientQuoteCmd.Flags().StringVar(&promotionClientQuoteCmdParamRequestBody, "request", "", `request body of the items to quote, e.g. {"items":[{"produceCode":"E5T6-9UI3-TH15-QR88","quantity":3}]}`)
+	promotionClientCmd.AddCommand(promotionClientQuoteCmd)
+}
+
+func newPromotionClient() *client.Client {
+	return newAPIClient(promotionClientCmdEndpoint, promotionClientCmdTimeout, false, "", promotionClientCmdAPIKey)
+}
+
+func promotionClientList(cmd *cobra.Command, args []string) {
+	promotions, err := newPromotionClient().ListPromotions(context.Background())
+	printResult("list promotions", promotions, err)
+}
+
+func promotionClientGet(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a promotion id to get")
+	}
+
+	promotion, err := newPromotionClient().GetPromotion(context.Background(), args[0])
+	printResult("get promotion", promotion, err)
+}
+
+func promotionClientCreate(cmd *cobra.Command, args []string) {
+	promotion := models.Promotion{}
+	if err := json.Unmarshal([]byte(promotionClientCreateCmdParamRequestBody), &promotion); err != nil {
+		log.Fatalf("request body must be a JSON promotion: %s", err)
+	}
+
+	created, err := newPromotionClient().CreatePromotion(context.Background(), promotion)
+	printResult("create promotion", created, err)
+}
+
+func promotionClientUpdate(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a promotion id to update")
+	}
+
+	promotion := models.Promotion{}
+	if err := json.Unmarshal([]byte(promotionClientUpdateCmdParamRequestBody), &promotion); err != nil {
+		log.Fatalf("request body must be a JSON promotion: %s", err)
+	}
+	if promotion.ID != "" && promotion.ID != args[0] {
+		log.Fatal("the id of the promotion cannot be changed")
+	}
+	promotion.ID = args[0]
+
+	updated, err := newPromotionClient().UpdatePromotion(context.Background(), promotion)
+	printResult("update promotion", updated, err)
+}
+
+func promotionClientDelete(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		log.Fatal("must provide a promotion id to delete")
+	}
+
+	if err := newPromotionClient().DeletePromotion(context.Background(), args[0]); err != nil {
+		log.Fatalf("failed to delete promotion: %s", err)
+	}
+}
+
+func promotionClientQuote(cmd *cobra.Command, args []string) {
+	request := models.QuoteRequest{}
+	if err := json.Unmarshal([]byte(promotionClientQuoteCmdParamRequestBody), &request); err != nil {
+		log.Fatalf("request body must be a JSON list of items to quote: %s", err)
+	}
+
+	quote, err := newPromotionClient().Quote(context.Background(), request)
+	printResult("quote items", quote, err)
+}
@@ -14,6 +14,11 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(daemonCmd)
 	rootCmd.AddCommand(produceClientCmd)
+	rootCmd.AddCommand(cartClientCmd)
+	rootCmd.AddCommand(promotionClientCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(adminCmd)
 }
 
 func Execute() {
@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xmattstrongx/supermarket/client"
+	"github.com/xmattstrongx/supermarket/models"
+	"github.com/xmattstrongx/supermarket/validator"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	produceClientDiffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "show the produce that apply would create, update or delete to match a catalog file",
+		Run:   produceClientDiff,
+	}
+
+	produceClientApplyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "create, update and optionally delete produce so the inventory matches a catalog file",
+		Run:   produceClientApply,
+	}
+
+	produceClientSyncCmdParamFilename string
+	produceClientSyncCmdParamPrune    bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{produceClientDiffCmd, produceClientApplyCmd} {
+		cmd.Flags().StringVarP(&produceClientSyncCmdParamFilename, "filename", "f", "", "path of a YAML or JSON catalog file listing the produce the inventory should have")
+		cmd.Flags().BoolVar(&produceClientSyncCmdParamPrune, "prune", false, "optional value to delete produce that is in the inventory but not in the catalog file")
+		produceClientCmd.AddCommand(cmd)
+	}
+}
+
+// produceChange is a field of a produce that differs between the catalog file and the inventory
+type produceChange struct {
+	field string
+	from  string
+	to    string
+}
+
+// produceUpdate is a produce in the inventory that differs from the catalog file
+type produceUpdate struct {
+	produce models.Produce
+	changes []produceChange
+}
+
+// syncPlan is what must change for the inventory to match a catalog file
+type syncPlan struct {
+	create []models.Produce
+	update []produceUpdate
+	delete []models.Produce
+}
+
+func (p syncPlan) empty() bool {
+	return len(p.create) == 0 && len(p.update) == 0 && len(p.delete) == 0
+}
+
+func produceClientDiff(cmd *cobra.Command, args []string) {
+	_, plan := loadSyncPlan()
+
+	printSyncPlan(os.Stdout, plan)
+}
+
+func produceClientApply(cmd *cobra.Command, args []string) {
+	c, plan := loadSyncPlan()
+
+	printSyncPlan(os.Stdout, plan)
+	if plan.empty() {
+		return
+	}
+
+	fmt.Fprintln(os.Stdout)
+	if failed := applySyncPlan(c, plan); failed > 0 {
+		log.Fatalf("%d produce could not be synced", failed)
+	}
+}
+
+// loadSyncPlan reads the catalog file, lists the inventory and plans the
+// changes between them, exiting when any of it fails
+func loadSyncPlan() (*client.Client, syncPlan) {
+	if produceClientSyncCmdParamFilename == "" {
+		log.Fatal("must provide a catalog file with --filename")
+	}
+
+	desired, err := readCatalogFile(produceClientSyncCmdParamFilename)
+	if err != nil {
+		log.Fatalf("invalid catalog file: %s", err)
+	}
+
+	c := newAPIClient(produceClientCmdEndpoint, produceClientCmdTimeout, produceClientCmdRetry, produceClientCmdActor, produceClientCmdAPIKey)
+	live, err := c.ListAllProduce(context.Background(), client.ListOptions{})
+	if err != nil {
+		log.Fatalf("failed to list produce: %s", err)
+	}
+
+	return c, planSync(desired, live, produceClientSyncCmdParamPrune)
+}
+
+// readCatalogFile reads a list of produce from a YAML or JSON file, chosen by
+// its extension, and checks every produce against the validation rules. The
+// produce codes of the catalog are returned in their canonical form.
+func readCatalogFile(path string) ([]models.Produce, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// the produce is read through its JSON representation so prices and
+		// quantities are parsed exactly as the daemon parses them
+		var document interface{}
+		if err := yaml.Unmarshal(b, &document); err != nil {
+			return nil, err
+		}
+		if b, err = json.Marshal(document); err != nil {
+			return nil, err
+		}
+	}
+
+	var catalog []models.Produce
+	if err := json.Unmarshal(b, &catalog); err != nil {
+		return nil, fmt.Errorf("the catalog must be a list of produce: %s", err)
+	}
+
+	rules, err := validationRules()
+	if err != nil {
+		return nil, err
+	}
+	v := validator.New(rules)
+
+	seen := map[models.ProduceCode]bool{}
+	for i, produce := range catalog {
+		if err := v.Validate(produce); err != nil {
+			return nil, fmt.Errorf("produce %d: %s", i, err)
+		}
+
+		produceCode, err := models.ParseProduceCode(produce.ProduceCode)
+		if err != nil {
+			return nil, fmt.Errorf("produce %d: %s", i, err)
+		}
+		if seen[produceCode] {
+			return nil, fmt.Errorf("produce %d: produce code %s appears more than once", i, produceCode)
+		}
+		seen[produceCode] = true
+		catalog[i].ProduceCode = produceCode.String()
+	}
+
+	return catalog, nil
+}
+
+// planSync compares the produce of a catalog file with the inventory. Produce
+// only in the catalog is created and produce whose fields differ is updated.
+// When prune is set produce only in the inventory is deleted. Stock on hand is
+// only set when a produce is created since it is otherwise changed by stock
+// operations.
+func planSync(desired, live []models.Produce, prune bool) syncPlan {
+	current := map[string]models.Produce{}
+	for _, produce := range live {
+		current[produce.ProduceCode] = produce
+	}
+
+	plan := syncPlan{}
+	wanted := map[string]bool{}
+	for _, produce := range desired {
+		wanted[produce.ProduceCode] = true
+
+		existing, ok := current[produce.ProduceCode]
+		if !ok {
+			plan.create = append(plan.create, produce)
+			continue
+		}
+
+		if changes := diffProduce(existing, produce); len(changes) > 0 {
+			plan.update = append(plan.update, produceUpdate{produce: produce, changes: changes})
+		}
+	}
+
+	if prune {
+		for _, produce := range live {
+			if !wanted[produce.ProduceCode] {
+				plan.delete = append(plan.delete, produce)
+			}
+		}
+	}
+
+	sort.Slice(plan.create, func(i, j int) bool { return plan.create[i].ProduceCode < plan.create[j].ProduceCode })
+	sort.Slice(plan.update, func(i, j int) bool { return plan.update[i].produce.ProduceCode < plan.update[j].produce.ProduceCode })
+	sort.Slice(plan.delete, func(i, j int) bool { return plan.delete[i].ProduceCode < plan.delete[j].ProduceCode })
+
+	return plan
+}
+
+// diffProduce lists the fields a PUT of desired would change in current
+func diffProduce(current, desired models.Produce) []produceChange {
+	changes := []produceChange{}
+	compare := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, produceChange{field: field, from: from, to: to})
+		}
+	}
+
+	// the daemon rounds prices half to even unless it rejects them outright
+	unitPrice := desired.UnitPrice
+	if unitPrice == (models.Money{}) {
+		unitPrice = models.NewMoney(0, models.DefaultCurrency)
+	}
+	if rounded, err := unitPrice.Round(models.RoundHalfEven); err == nil {
+		unitPrice = rounded
+	}
+
+	compare("name", current.Name, desired.Name)
+	if current.UnitPrice.Currency() != unitPrice.Currency() || current.UnitPrice.Cmp(unitPrice) != 0 {
+		changes = append(changes, produceChange{field: "unitPrice", from: formatPrice(current.UnitPrice), to: formatPrice(unitPrice)})
+	}
+	compare("category", current.Category, desired.Category)
+	compare("unitOfMeasure", string(current.UnitOfMeasure), string(desired.UnitOfMeasure))
+	compare("reorderThreshold", current.ReorderThreshold.String(), desired.ReorderThreshold.String())
+
+	return changes
+}
+
+// formatPrice writes a price with its currency, e.g. 3.46 USD
+func formatPrice(price models.Money) string {
+	return fmt.Sprintf("%s %s", price.String(), price.Currency())
+}
+
+// printSyncPlan writes one line per produce that would change followed by a count of each kind of change
+func printSyncPlan(w io.Writer, plan syncPlan) {
+	for _, produce := range plan.create {
+		fmt.Fprintf(w, "+ %s %s (%s)\n", produce.ProduceCode, produce.Name, formatPrice(produce.UnitPrice))
+	}
+
+	for _, update := range plan.update {
+		fmt.Fprintf(w, "~ %s %s\n", update.produce.ProduceCode, update.produce.Name)
+		for _, change := range update.changes {
+			fmt.Fprintf(w, "    %s: %q -> %q\n", change.field, change.from, change.to)
+		}
+	}
+
+	for _, produce := range plan.delete {
+		fmt.Fprintf(w, "- %s %s\n", produce.ProduceCode, produce.Name)
+	}
+
+	if plan.empty() {
+		fmt.Fprintln(w, "the inventory matches the catalog")
+		return
+	}
+	fmt.Fprintf(w, "%d to create, %d to update, %d to delete\n", len(plan.create), len(plan.update), len(plan.delete))
+}
+
+// applySyncPlan makes the changes of a plan and returns how many produce could
+// not be changed. Every change is attempted even after one fails.
+func applySyncPlan(c *client.Client, plan syncPlan) int {
+	ctx := context.Background()
+	failed := 0
+	fail := func(action, produceCode string, err interface{}) {
+		failed++
+		fmt.Fprintf(os.Stdout, "failed to %s %s: %v\n", action, produceCode, err)
+	}
+	created, updated, deleted := 0, 0, 0
+
+	if len(plan.create) > 0 {
+		response, err := c.CreateProduce(ctx, plan.create, false)
+		created = len(response.Created)
+		for _, produce := range response.Invalid {
+			fail("create", produce.ProduceCode, produce.Reason)
+		}
+		if missing := len(plan.create) - created - len(response.Invalid); err != nil && missing > 0 {
+			// a request refused as a whole lists none of its produce
+			failed += missing
+			fmt.Fprintf(os.Stdout, "failed to create %d produce: %s\n", missing, err)
+		}
+	}
+
+	for _, update := range plan.update {
+		if _, _, err := c.ReplaceProduce(ctx, update.produce, ""); err != nil {
+			fail("update", update.produce.ProduceCode, err)
+			continue
+		}
+		updated++
+	}
+
+	if len(plan.delete) > 0 {
+		produceCodes := make([]string, len(plan.delete))
+		for i, produce := range plan.delete {
+			produceCodes[i] = produce.ProduceCode
+		}
+
+		response, err := c.BatchDeleteProduce(ctx, produceCodes, false)
+		deleted = len(response.Deleted)
+		for _, produce := range response.Invalid {
+			fail("delete", produce.ProduceCode, produce.Reason)
+		}
+		if missing := len(plan.delete) - deleted - len(response.Invalid); err != nil && missing > 0 {
+			failed += missing
+			fmt.Fprintf(os.Stdout, "failed to delete %d produce: %s\n", missing, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "%d created, %d updated, %d deleted, %d failed\n", created, updated, deleted, failed)
+	return failed
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xmattstrongx/supermarket/models"
+	"github.com/xmattstrongx/supermarket/validator"
+)
+
+var (
+	validationCmdMaxNameLength int
+	validationCmdMinUnitPrice  string
+	validationCmdMaxUnitPrice  string
+	validationCmdUnitPrices    []string
+)
+
+// addValidationFlags adds the flags changing the produce validation rules to a
+// command. The daemon and the produce client share them so both run the same rules.
+func addValidationFlags(cmd *cobra.Command) {
+	defaults := validator.DefaultRules()
+	cmd.PersistentFlags().IntVar(&validationCmdMaxNameLength, "max-name-length", defaults.MaxNameLength, "most characters the name or category of a produce may have")
+	bounds := defaults.UnitPrices[models.DefaultCurrency]
+	cmd.PersistentFlags().StringVar(&validationCmdMinUnitPrice, "min-unit-price", bounds.Min.String(), fmt.Sprintf("least unit price in %s a produce may have", models.DefaultCurrency))
+	cmd.PersistentFlags().StringVar(&validationCmdMaxUnitPrice, "max-unit-price", bounds.Max.String(), fmt.Sprintf("most unit price in %s a produce may have", models.DefaultCurrency))
+	cmd.PersistentFlags().StringArrayVar(&validationCmdUnitPrices, "unit-price-range", nil, fmt.Sprintf("optional bounds of unit prices in another currency than %s as CURRENCY=MIN:MAX, e.g. EUR=0:90000. May be repeated. Unit prices in a currency without bounds are refused.", models.DefaultCurrency))
+}
+
+// parsePriceRange parses the bounds of unit prices in a currency written as CURRENCY=MIN:MAX
+func parsePriceRange(s string) (string, validator.PriceRange, error) {
+	currency, bounds, ok := strings.Cut(s, "=")
+	min, max, ok2 := strings.Cut(bounds, ":")
+	if !ok || !ok2 || currency == "" {
+		return "", validator.PriceRange{}, fmt.Errorf("invalid unit price range %q, must be CURRENCY=MIN:MAX", s)
+	}
+	currency = strings.ToUpper(currency)
+
+	minUnitPrice, err := models.ParseMoney(min, currency)
+	if err != nil {
+		return "", validator.PriceRange{}, fmt.Errorf("invalid min unit price of %s: %s", currency, err)
+	}
+	maxUnitPrice, err := models.ParseMoney(max, currency)
+	if err != nil {
+		return "", validator.PriceRange{}, fmt.Errorf("invalid max unit price of %s: %s", currency, err)
+	}
+	return currency, validator.PriceRange{Min: minUnitPrice, Max: maxUnitPrice}, nil
+}
+
+// validationRules returns the produce validation rules set by the flags
+func validationRules() (validator.Rules, error) {
+	minUnitPrice, err := models.ParseMoney(validationCmdMinUnitPrice, models.DefaultCurrency)
+	if err != nil {
+		return validator.Rules{}, fmt.Errorf("invalid min unit price: %s", err)
+	}
+
+	maxUnitPrice, err := models.ParseMoney(validationCmdMaxUnitPrice, models.DefaultCurrency)
+	if err != nil {
+		return validator.Rules{}, fmt.Errorf("invalid max unit price: %s", err)
+	}
+
+	rules := validator.Rules{
+		MaxNameLength: validationCmdMaxNameLength,
+		UnitPrices: map[string]validator.PriceRange{
+			models.DefaultCurrency: {Min: minUnitPrice, Max: maxUnitPrice},
+		},
+	}
+	for _, unitPrices := range validationCmdUnitPrices {
+		currency, bounds, err := parsePriceRange(unitPrices)
+		if err != nil {
+			return validator.Rules{}, err
+		}
+		if _, ok := rules.UnitPrices[currency]; ok {
+			return validator.Rules{}, fmt.Errorf("unit price range of %s is set more than once", currency)
+		}
+		rules.UnitPrices[currency] = bounds
+	}
+	if err := rules.Check(); err != nil {
+		return validator.Rules{}, err
+	}
+
+	return rules, nil
+}
+
+// validateCreateRequest checks every produce of a create request body against
+// the validation rules before it is sent
+func validateCreateRequest(body []byte) error {
+	rules, err := validationRules()
+	if err != nil {
+		return err
+	}
+
+	var newProduce []models.Produce
+	if err := json.Unmarshal(body, &newProduce); err != nil {
+		return fmt.Errorf("request body must be a JSON array of produce: %s", err)
+	}
+
+	v := validator.New(rules)
+	for i, produce := range newProduce {
+		if err := v.Validate(produce); err != nil {
+			return fmt.Errorf("produce %d: %s", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateReplaceRequest checks a produce replacing the produce with the
+// produce code against the validation rules before it is sent
+func validateReplaceRequest(produceCode string, body []byte) error {
+	rules, err := validationRules()
+	if err != nil {
+		return err
+	}
+
+	var produce models.Produce
+	if err := json.Unmarshal(body, &produce); err != nil {
+		return fmt.Errorf("request body must be a JSON produce: %s", err)
+	}
+	if produce.ProduceCode == "" {
+		produce.ProduceCode = produceCode
+	}
+
+	return validator.New(rules).Validate(produce)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/xmattstrongx/supermarket/api"
+)
+
+var (
+	versionCmd = &cobra.Command{
+		Use:   "version",
+		Short: "print the build of the CLI and of the daemon it talks to",
+		Run:   versionRun,
+	}
+
+	versionCmdEndpoint string
+	versionCmdTimeout  string
+	versionCmdClient   bool
+)
+
+func init() {
+	versionCmd.Flags().StringVarP(&versionCmdEndpoint, "endpoint", "e", "http://localhost:8000", "endpoint of the daemon to get the build of")
+	versionCmd.Flags().StringVarP(&versionCmdTimeout, "timeout", "t", "10s", "timeout for the request to the daemon")
+	versionCmd.Flags().BoolVar(&versionCmdClient, "client", false, "optional value to only print the build of the CLI without contacting the daemon")
+}
+
+func versionRun(cmd *cobra.Command, args []string) {
+	fmt.Print("Client: ")
+	printJSON(api.Build())
+	if versionCmdClient {
+		return
+	}
+
+	build, err := newAPIClient(versionCmdEndpoint, versionCmdTimeout, false, "", "").Version(context.Background())
+	if err != nil {
+		log.Fatalf("failed to get the version of the daemon: %s", err)
+	}
+	fmt.Print("Server: ")
+	printJSON(build)
+}
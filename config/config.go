@@ -0,0 +1,435 @@
+// Package config loads the configuration of the supermarket daemon. Every
+// setting has a default that is overridden by a YAML config file, then by a
+// SUPERMARKET_* environment variable, then by a command line flag.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/xmattstrongx/supermarket/api"
+	"github.com/xmattstrongx/supermarket/models"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix starts the name of the environment variable of every setting
+	EnvPrefix = "SUPERMARKET_"
+	// FileFlag is the flag giving the path of the config file
+	FileFlag = "config"
+	// FileEnv is the environment variable giving the path of the config file
+	// when the flag is not passed
+	FileEnv = EnvPrefix + "CONFIG"
+
+	// portEnv is the environment variable the daemon took its port from
+	// before it had a listen address. SUPERMARKET_LISTEN takes precedence.
+	portEnv = "PORT"
+)
+
+// The formats the daemon can log in
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// Duration is a time.Duration written as a string such as 30s or 1h30m in a config file
+type Duration time.Duration
+
+// MarshalYAML writes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// UnmarshalYAML reads a duration written as a string
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	duration, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", value.Line, err)
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Config is the configuration of the daemon
+type Config struct {
+	// Listen is the TCP address the daemon listens on
+	Listen      string            `yaml:"listen"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Log         LogConfig         `yaml:"log"`
+	HTTP        HTTPConfig        `yaml:"http"`
+	TLS         TLSConfig         `yaml:"tls"`
+	Seed        SeedConfig        `yaml:"seed"`
+	Pricing     PricingConfig     `yaml:"pricing"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	// APIKeysFile is the key file requests are authenticated with, or empty
+	// to not authenticate requests
+	APIKeysFile string `yaml:"apiKeysFile"`
+}
+
+// StorageConfig is where produce is kept. With neither a data directory nor
+// a database it is only kept in memory.
+type StorageConfig struct {
+	DataDir        string `yaml:"dataDir"`
+	DatabaseDriver string `yaml:"databaseDriver"`
+	DatabaseURL    string `yaml:"databaseURL"`
+}
+
+// LogConfig is what the daemon logs and how
+type LogConfig struct {
+	// Level is the least severe level logged, e.g. debug, info or warning
+	Level string `yaml:"level"`
+	// Format is json or text
+	Format string `yaml:"format"`
+}
+
+// HTTPConfig is how the HTTP server of the daemon handles connections, see api.HTTPConfig
+type HTTPConfig struct {
+	ReadHeaderTimeout Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       Duration `yaml:"readTimeout"`
+	WriteTimeout      Duration `yaml:"writeTimeout"`
+	IdleTimeout       Duration `yaml:"idleTimeout"`
+	ShutdownTimeout   Duration `yaml:"shutdownTimeout"`
+	MaxHeaderBytes    int      `yaml:"maxHeaderBytes"`
+	MaxBodyBytes      int64    `yaml:"maxBodyBytes"`
+}
+
+// TLSConfig is the certificate requests are served over HTTPS with. Without
+// one they are served over plain HTTP.
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// SeedConfig is the produce created on startup when it is not in the catalog yet
+type SeedConfig struct {
+	// File is a JSON array of produce in the format of a create request
+	File string `yaml:"file"`
+}
+
+// PricingConfig is how prices are rounded and taxed
+type PricingConfig struct {
+	Rounding     string `yaml:"rounding"`
+	SalesTaxRate string `yaml:"salesTaxRate"`
+}
+
+// IdempotencyConfig is how long and how many responses to requests with an
+// Idempotency-Key header are kept
+type IdempotencyConfig struct {
+	Window       Duration `yaml:"window"`
+	CacheEntries int      `yaml:"cacheEntries"`
+	CacheBytes   int64    `yaml:"cacheBytes"`
+}
+
+// Default returns the configuration of a daemon without a config file,
+// environment variables or flags
+func Default() Config {
+	httpConfig := api.DefaultHTTPConfig()
+	return Config{
+		Listen: api.DefaultListenAddress,
+		Storage: StorageConfig{
+			DatabaseDriver: api.SQLiteDriver,
+		},
+		Log: LogConfig{
+			Level:  log.InfoLevel.String(),
+			Format: LogFormatJSON,
+		},
+		HTTP: HTTPConfig{
+			ReadHeaderTimeout: Duration(httpConfig.ReadHeaderTimeout),
+			ReadTimeout:       Duration(httpConfig.ReadTimeout),
+			WriteTimeout:      Duration(httpConfig.WriteTimeout),
+			IdleTimeout:       Duration(httpConfig.IdleTimeout),
+			ShutdownTimeout:   Duration(httpConfig.ShutdownTimeout),
+			MaxHeaderBytes:    httpConfig.MaxHeaderBytes,
+			MaxBodyBytes:      httpConfig.MaxBodyBytes,
+		},
+		Pricing: PricingConfig{
+			Rounding:     string(models.RoundHalfEven),
+			SalesTaxRate: "0",
+		},
+		Idempotency: IdempotencyConfig{
+			Window:       Duration(api.DefaultIdempotencyWindow),
+			CacheEntries: api.DefaultIdempotencyCacheEntries,
+			CacheBytes:   api.DefaultIdempotencyCacheBytes,
+		},
+	}
+}
+
+// setting is a value of the config that can be set by a flag and an
+// environment variable named after the flag
+type setting struct {
+	flag  string
+	usage string
+	// value returns a pointer to the value in a config
+	value func(*Config) interface{}
+}
+
+var settings = []setting{
+	{"listen", "TCP address the daemon listens on, e.g. :8000 or 127.0.0.1:8443", func(c *Config) interface{} { return &c.Listen }},
+	{"data-dir", "optional directory to persist produce in. If no value is passed produce is only kept in memory and is lost when the daemon stops.", func(c *Config) interface{} { return &c.Storage.DataDir }},
+	{"database-driver", "database/sql driver used to connect to the produce database", func(c *Config) interface{} { return &c.Storage.DatabaseDriver }},
+	{"database-url", "data source name of the produce database, e.g. file:/var/lib/supermarket/produce.db. When set produce is stored in the database and pending migrations are applied on startup.", func(c *Config) interface{} { return &c.Storage.DatabaseURL }},
+	{"log-level", "least severe level logged, one of trace, debug, info, warning, error, fatal or panic", func(c *Config) interface{} { return &c.Log.Level }},
+	{"log-format", "format of the log, json or text", func(c *Config) interface{} { return &c.Log.Format }},
+	{"read-header-timeout", "how long a client may take to send the headers of a request", func(c *Config) interface{} { return &c.HTTP.ReadHeaderTimeout }},
+	{"read-timeout", "how long a client may take to send a whole request, body included", func(c *Config) interface{} { return &c.HTTP.ReadTimeout }},
+	{"write-timeout", "how long a request may take from the end of its headers until its response is written", func(c *Config) interface{} { return &c.HTTP.WriteTimeout }},
+	{"idle-timeout", "how long a keep-alive connection is kept open waiting for the next request", func(c *Config) interface{} { return &c.HTTP.IdleTimeout }},
+	{"shutdown-timeout", "how long requests in flight are given to finish after a SIGTERM or SIGINT before the daemon stops", func(c *Config) interface{} { return &c.HTTP.ShutdownTimeout }},
+	{"max-header-bytes", "the most bytes the headers of a request may have", func(c *Config) interface{} { return &c.HTTP.MaxHeaderBytes }},
+	{"max-body-bytes", "the most bytes the body of a request, including a catalog import, may have. 0 is no limit.", func(c *Config) interface{} { return &c.HTTP.MaxBodyBytes }},
+	{"tls-cert-file", "optional PEM encoded certificate to serve HTTPS with. Needs --tls-key-file.", func(c *Config) interface{} { return &c.TLS.CertFile }},
+	{"tls-key-file", "PEM encoded private key of the --tls-cert-file", func(c *Config) interface{} { return &c.TLS.KeyFile }},
+	{"seed-file", "optional JSON array of produce, in the format of a create request, created on startup unless its produce code is already in the catalog. It replaces the default inventory of produce kept in memory or in a new data directory.", func(c *Config) interface{} { return &c.Seed.File }},
+	{"price-rounding", "how unit prices with more decimal places than their currency allows are handled. Available values are half-even to round to the nearest minor unit with ties to even, or reject to refuse them.", func(c *Config) interface{} { return &c.Pricing.Rounding }},
+	{"sales-tax-rate", "sales tax rate charged when a cart is checked out as a decimal with at most six decimal places, e.g. 0.0825 for 8.25%", func(c *Config) interface{} { return &c.Pricing.SalesTaxRate }},
+	{"idempotency-window", "how long the response to a POST or PATCH request with an Idempotency-Key header is kept to be replayed to retries of the request", func(c *Config) interface{} { return &c.Idempotency.Window }},
+	{"idempotency-cache-entries", "the most idempotency keys kept at once. When there are more the responses that expire soonest are dropped.", func(c *Config) interface{} { return &c.Idempotency.CacheEntries }},
+	{"idempotency-cache-bytes", "the most bytes of response bodies kept for idempotency keys. A larger response is not kept, so a retry of its request is handled again.", func(c *Config) interface{} { return &c.Idempotency.CacheBytes }},
+	{"api-keys-file", "optional path of the API key file managed with the admin keys commands. When set every request other than health checks, the version and metrics needs an API key with a role that allows it. Keys created or revoked while the daemon runs are used without restarting it.", func(c *Config) interface{} { return &c.APIKeysFile }},
+}
+
+// envName returns the environment variable setting the same value as a flag
+func envName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// set parses a value given as a string into the value a setting points to
+func set(value interface{}, s string) error {
+	switch value := value.(type) {
+	case *string:
+		*value = s
+	case *Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*value = Duration(d)
+	case *int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*value = i
+	case *int64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		*value = i
+	default:
+		panic(fmt.Sprintf("setting of unsupported type %T", value))
+	}
+	return nil
+}
+
+// AddFlags adds the flag of every setting, along with the flag of the config
+// file, to a flag set. The default of a flag is the default of its setting.
+func AddFlags(flags *pflag.FlagSet) {
+	flags.String(FileFlag, "", fmt.Sprintf("optional YAML config file of the daemon. Its path can also be set with %s. Its settings are overridden by %s* environment variables, which are overridden by flags.", FileEnv, EnvPrefix))
+
+	defaults := Default()
+	for _, setting := range settings {
+		usage := fmt.Sprintf("%s (env %s)", setting.usage, envName(setting.flag))
+		switch value := setting.value(&defaults).(type) {
+		case *string:
+			flags.String(setting.flag, *value, usage)
+		case *Duration:
+			flags.Duration(setting.flag, time.Duration(*value), usage)
+		case *int:
+			flags.Int(setting.flag, *value, usage)
+		case *int64:
+			flags.Int64(setting.flag, *value, usage)
+		}
+	}
+}
+
+// Load returns the configuration of the daemon: the defaults, overridden by
+// the config file, then by the environment variables found by lookupEnv, then
+// by the flags passed on the command line. The config file is given by the
+// config flag or the SUPERMARKET_CONFIG environment variable. The
+// configuration is not validated.
+func Load(flags *pflag.FlagSet, lookupEnv func(string) (string, bool)) (Config, error) {
+	config := Default()
+
+	path, _ := lookupEnv(FileEnv)
+	if flag := flags.Lookup(FileFlag); flag != nil && flag.Changed {
+		path = flag.Value.String()
+	}
+	if path != "" {
+		if err := config.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if port, ok := lookupEnv(portEnv); ok && port != "" {
+		config.Listen = ":" + port
+	}
+	for _, setting := range settings {
+		name := envName(setting.flag)
+		if value, ok := lookupEnv(name); ok {
+			if err := set(setting.value(&config), value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s %q: %s", name, value, err)
+			}
+		}
+	}
+
+	for _, setting := range settings {
+		flag := flags.Lookup(setting.flag)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		if err := set(setting.value(&config), flag.Value.String()); err != nil {
+			return Config{}, fmt.Errorf("invalid --%s %q: %s", setting.flag, flag.Value, err)
+		}
+	}
+
+	return config, nil
+}
+
+// loadFile overrides the config with the settings of a YAML config file.
+// Settings missing from the file are left as they are.
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+	return nil
+}
+
+// Validate returns an error listing every invalid setting of the config
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, port, err := net.SplitHostPort(c.Listen); err != nil {
+		invalid("invalid listen address %q: %s", c.Listen, err)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		invalid("invalid listen address %q: port must be a number from 0 to 65535", c.Listen)
+	}
+
+	if c.Storage.DataDir != "" && c.Storage.DatabaseURL != "" {
+		invalid("only one of storage.dataDir or storage.databaseURL can be set")
+	}
+	if c.Storage.DatabaseURL != "" && c.Storage.DatabaseDriver == "" {
+		invalid("storage.databaseDriver must be set with storage.databaseURL")
+	}
+
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		invalid("invalid log.level: %s", err)
+	}
+	if c.Log.Format != LogFormatJSON && c.Log.Format != LogFormatText {
+		invalid("invalid log.format %q, must be %s or %s", c.Log.Format, LogFormatJSON, LogFormatText)
+	}
+
+	for name, d := range map[string]Duration{
+		"http.readHeaderTimeout": c.HTTP.ReadHeaderTimeout,
+		"http.readTimeout":       c.HTTP.ReadTimeout,
+		"http.writeTimeout":      c.HTTP.WriteTimeout,
+		"http.idleTimeout":       c.HTTP.IdleTimeout,
+		"http.shutdownTimeout":   c.HTTP.ShutdownTimeout,
+	} {
+		if d < 0 {
+			invalid("%s can not be negative", name)
+		}
+	}
+	if c.HTTP.MaxHeaderBytes < 0 {
+		invalid("http.maxHeaderBytes can not be negative")
+	}
+	if c.HTTP.MaxBodyBytes < 0 {
+		invalid("http.maxBodyBytes can not be negative")
+	}
+
+	switch {
+	case (c.TLS.CertFile == "") != (c.TLS.KeyFile == ""):
+		invalid("tls.certFile and tls.keyFile must be set together")
+	case c.TLS.CertFile != "":
+		if _, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile); err != nil {
+			invalid("invalid TLS certificate: %s", err)
+		}
+	}
+
+	if c.Seed.File != "" {
+		if _, err := c.SeedProduce(); err != nil {
+			invalid("%s", err)
+		}
+	}
+
+	if _, err := models.ParseRoundingPolicy(c.Pricing.Rounding); err != nil {
+		invalid("invalid pricing.rounding: %s", err)
+	}
+	if _, err := models.ParseTaxRate(c.Pricing.SalesTaxRate); err != nil {
+		invalid("invalid pricing.salesTaxRate: %s", err)
+	}
+
+	if c.Idempotency.Window <= 0 {
+		invalid("idempotency.window must be positive")
+	}
+	if c.Idempotency.CacheEntries < 1 {
+		invalid("idempotency.cacheEntries must be at least 1")
+	}
+	if c.Idempotency.CacheBytes < 0 {
+		invalid("idempotency.cacheBytes can not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// SeedProduce reads the produce of the seed file
+func (c Config) SeedProduce() ([]models.Produce, error) {
+	b, err := os.ReadFile(c.Seed.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file: %s", err)
+	}
+
+	var produce []models.Produce
+	if err := json.Unmarshal(b, &produce); err != nil {
+		return nil, fmt.Errorf("seed file %s must be a JSON array of produce: %s", c.Seed.File, err)
+	}
+	return produce, nil
+}
+
+// HTTPConfig returns the HTTP settings in the form the api package takes them
+func (c Config) HTTPConfig() api.HTTPConfig {
+	return api.HTTPConfig{
+		ReadHeaderTimeout: time.Duration(c.HTTP.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(c.HTTP.ReadTimeout),
+		WriteTimeout:      time.Duration(c.HTTP.WriteTimeout),
+		IdleTimeout:       time.Duration(c.HTTP.IdleTimeout),
+		MaxHeaderBytes:    c.HTTP.MaxHeaderBytes,
+		MaxBodyBytes:      c.HTTP.MaxBodyBytes,
+		ShutdownTimeout:   time.Duration(c.HTTP.ShutdownTimeout),
+	}
+}
+
+// YAML returns the config as a YAML config file
+func (c Config) YAML() ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
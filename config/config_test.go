@@ -0,0 +1,239 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// newFlags returns the flags of the daemon parsed from args
+func newFlags(t *testing.T, args ...string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("daemon", pflag.ContinueOnError)
+	AddFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags
+}
+
+// env returns a lookupEnv of the environment variables in vars
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+// writeFile writes a file to a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefault(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("the default config is invalid: %v", err)
+	}
+
+	config, err := Load(newFlags(t), env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, Default()) {
+		t.Errorf("config without a file, environment variables or flags is not the default:\n%+v\n%+v", config, Default())
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "supermarket.yaml", `
+listen: 127.0.0.1:9000
+storage:
+  dataDir: /var/lib/supermarket
+log:
+  level: debug
+  format: text
+http:
+  readTimeout: 10s
+  writeTimeout: 20s
+`)
+
+	config, err := Load(newFlags(t, "--config", path, "--write-timeout", "40s"), env(map[string]string{
+		"SUPERMARKET_LOG_LEVEL":     "warning",
+		"SUPERMARKET_READ_TIMEOUT":  "15s",
+		"SUPERMARKET_WRITE_TIMEOUT": "30s",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.Listen = "127.0.0.1:9000"
+	want.Storage.DataDir = "/var/lib/supermarket"
+	want.Log = LogConfig{Level: "warning", Format: LogFormatText}
+	want.HTTP.ReadTimeout = Duration(15 * time.Second)
+	want.HTTP.WriteTimeout = Duration(40 * time.Second)
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("wrong config:\ngot  %+v\nwant %+v", config, want)
+	}
+}
+
+func TestLoadFileFromEnv(t *testing.T) {
+	fromEnv := writeFile(t, "env.yaml", "listen: :9001\n")
+	fromFlag := writeFile(t, "flag.yaml", "listen: :9002\n")
+
+	config, err := Load(newFlags(t), env(map[string]string{FileEnv: fromEnv}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Listen != ":9001" {
+		t.Errorf("the config file of %s was not loaded: %+v", FileEnv, config)
+	}
+
+	config, err = Load(newFlags(t, "--config", fromFlag), env(map[string]string{FileEnv: fromEnv}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Listen != ":9002" {
+		t.Errorf("the config file of the flag was not preferred: %+v", config)
+	}
+}
+
+func TestLoadPort(t *testing.T) {
+	config, err := Load(newFlags(t), env(map[string]string{"PORT": "9003"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Listen != ":9003" {
+		t.Errorf("PORT was not used: got %q want %q", config.Listen, ":9003")
+	}
+
+	config, err = Load(newFlags(t), env(map[string]string{"PORT": "9003", "SUPERMARKET_LISTEN": "127.0.0.1:9004"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Listen != "127.0.0.1:9004" {
+		t.Errorf("SUPERMARKET_LISTEN was not preferred to PORT: got %q", config.Listen)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want string
+	}{
+		{name: "missing file", env: map[string]string{FileEnv: "/does/not/exist.yaml"}, want: "failed to read config file"},
+		{name: "unknown key", file: "lisen: :9000\n", want: "field lisen not found"},
+		{name: "invalid duration in file", file: "http:\n  readTimeout: soon\n", want: "line 2"},
+		{name: "invalid yaml", file: "listen: [\n", want: "invalid config file"},
+		{name: "invalid duration in env", env: map[string]string{"SUPERMARKET_IDLE_TIMEOUT": "soon"}, want: "invalid SUPERMARKET_IDLE_TIMEOUT"},
+		{name: "invalid number in env", env: map[string]string{"SUPERMARKET_MAX_BODY_BYTES": "lots"}, want: "invalid SUPERMARKET_MAX_BODY_BYTES"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{}
+			for name, value := range tt.env {
+				vars[name] = value
+			}
+			if tt.file != "" {
+				vars[FileEnv] = writeFile(t, "supermarket.yaml", tt.file)
+			}
+
+			_, err := Load(newFlags(t), env(vars))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	seed := writeFile(t, "seed.json", `[{"name":"Beet","produceCode":"BEET-4GH7-QPL9-3N4M","unitPrice":1}]`)
+	invalidSeed := writeFile(t, "invalid-seed.json", `{"name":"Beet"}`)
+
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{name: "seed file", change: func(c *Config) { c.Seed.File = seed }},
+		{name: "listen address without a port", change: func(c *Config) { c.Listen = "localhost" }, want: "invalid listen address"},
+		{name: "listen port out of range", change: func(c *Config) { c.Listen = ":70000" }, want: "port must be a number from 0 to 65535"},
+		{name: "data directory and database", change: func(c *Config) { c.Storage.DataDir = "/tmp"; c.Storage.DatabaseURL = "file::memory:" }, want: "only one of storage.dataDir or storage.databaseURL"},
+		{name: "database without a driver", change: func(c *Config) { c.Storage.DatabaseDriver = ""; c.Storage.DatabaseURL = "file::memory:" }, want: "storage.databaseDriver must be set"},
+		{name: "log level", change: func(c *Config) { c.Log.Level = "verbose" }, want: "invalid log.level"},
+		{name: "log format", change: func(c *Config) { c.Log.Format = "xml" }, want: "invalid log.format"},
+		{name: "negative timeout", change: func(c *Config) { c.HTTP.IdleTimeout = Duration(-time.Second) }, want: "http.idleTimeout can not be negative"},
+		{name: "negative body limit", change: func(c *Config) { c.HTTP.MaxBodyBytes = -1 }, want: "http.maxBodyBytes can not be negative"},
+		{name: "certificate without a key", change: func(c *Config) { c.TLS.CertFile = "cert.pem" }, want: "tls.certFile and tls.keyFile must be set together"},
+		{name: "missing certificate", change: func(c *Config) { c.TLS.CertFile = "/does/not/exist.pem"; c.TLS.KeyFile = "/does/not/exist.key" }, want: "invalid TLS certificate"},
+		{name: "missing seed file", change: func(c *Config) { c.Seed.File = "/does/not/exist.json" }, want: "failed to read seed file"},
+		{name: "invalid seed file", change: func(c *Config) { c.Seed.File = invalidSeed }, want: "must be a JSON array of produce"},
+		{name: "price rounding", change: func(c *Config) { c.Pricing.Rounding = "up" }, want: "invalid pricing.rounding"},
+		{name: "sales tax rate", change: func(c *Config) { c.Pricing.SalesTaxRate = "lots" }, want: "invalid pricing.salesTaxRate"},
+		{name: "idempotency window", change: func(c *Config) { c.Idempotency.Window = 0 }, want: "idempotency.window must be positive"},
+		{name: "idempotency cache entries", change: func(c *Config) { c.Idempotency.CacheEntries = 0 }, want: "idempotency.cacheEntries must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Default()
+			tt.change(&config)
+
+			err := config.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateListsEveryError(t *testing.T) {
+	config := Default()
+	config.Log.Level = "verbose"
+	config.Log.Format = "xml"
+
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "log.level") || !strings.Contains(err.Error(), "log.format") {
+		t.Errorf("Validate() error = %v, want both invalid settings", err)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	config := Default()
+	config.Listen = "127.0.0.1:9000"
+	config.Log.Format = LogFormatText
+	config.HTTP.ReadTimeout = Duration(90 * time.Second)
+	config.Idempotency.CacheEntries = 50
+
+	b, err := config.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "readTimeout: 1m30s") {
+		t.Errorf("durations are not written as strings:\n%s", b)
+	}
+
+	// the printed config loads back into the same config
+	loaded, err := Load(newFlags(t, "--config", writeFile(t, "supermarket.yaml", string(b))), env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("wrong config loaded from its YAML:\ngot  %+v\nwant %+v", loaded, config)
+	}
+}
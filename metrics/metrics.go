@@ -0,0 +1,398 @@
+// Package metrics records counters, gauges and histograms and writes them in
+// the Prometheus text exposition format, version 0.0.4.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets suited to request latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ExponentialBuckets returns count bucket upper bounds starting at start with
+// each bound factor times the one before
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// metric is a metric that can be written in the text exposition format
+type metric interface {
+	name() string
+	write(*bufio.Writer)
+}
+
+// Registry holds metrics and writes them in the text exposition format. The
+// metrics are written sorted by name and their series sorted by label values,
+// so the same values are always written the same way.
+type Registry struct {
+	mutex   sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns a Registry without any metrics
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+// register adds a metric. A name that is invalid or already registered is a
+// mistake of the program rather than of its input, so it panics.
+func (r *Registry) register(m metric) {
+	if !metricNamePattern.MatchString(m.name()) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", m.name()))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.metrics[m.name()]; ok {
+		panic(fmt.Sprintf("metrics: metric %q is already registered", m.name()))
+	}
+	r.metrics[m.name()] = m
+}
+
+// WriteText writes every metric in the text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name() < metrics[j].name()
+	})
+
+	buffered := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// ServeHTTP answers a scrape with every metric
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteText(w)
+}
+
+// desc is what describes every series of a metric
+type desc struct {
+	metricName string
+	help       string
+	kind       string
+	labelNames []string
+}
+
+func newDesc(name, help, kind string, labelNames []string) desc {
+	for _, labelName := range labelNames {
+		if !labelNamePattern.MatchString(labelName) || strings.HasPrefix(labelName, "__") {
+			panic(fmt.Sprintf("metrics: invalid label name %q of metric %q", labelName, name))
+		}
+	}
+	return desc{metricName: name, help: help, kind: kind, labelNames: labelNames}
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metricName, helpEscaper.Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metricName, d.kind)
+}
+
+// seriesKey identifies the series of a metric by its label values. It panics
+// when the number of label values does not match the labels of the metric.
+func (d desc) seriesKey(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("metrics: metric %q takes %d label values, got %d", d.metricName, len(d.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// writeSample writes one sample of a series. extraName and extraValue add a
+// label after the labels of the metric, such as the le of a histogram bucket.
+func (d desc) writeSample(w *bufio.Writer, suffix string, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(d.metricName)
+	w.WriteString(suffix)
+
+	names, values := d.labelNames, labelValues
+	if extraName != "" {
+		names = append(names[:len(names):len(names)], extraName)
+		values = append(values[:len(values):len(values)], extraValue)
+	}
+	if len(names) > 0 {
+		w.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", name, labelValueEscaper.Replace(values[i]))
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// formatFloat writes a sample value the way Prometheus parses it
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of the series of a metric in order
+func sortedKeys(series map[string][]string) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter is a value that only goes up, with one series for each combination of label values
+type Counter struct {
+	desc
+	mutex       sync.Mutex
+	labelValues map[string][]string
+	values      map[string]float64
+}
+
+// NewCounter registers a counter. A counter without labels is written as 0
+// until it is first incremented; one with labels only has a series for the
+// label values it has been incremented with.
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{
+		desc:        newDesc(name, help, "counter", labelNames),
+		labelValues: map[string][]string{},
+		values:      map[string]float64{},
+	}
+	if len(labelNames) == 0 {
+		c.Add(0)
+	}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series with the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the series with the label values. It panics when v is negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: counter %q cannot go down", c.metricName))
+	}
+
+	key := c.seriesKey(labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.labelValues[key]; !ok {
+		c.labelValues[key] = append([]string(nil), labelValues...)
+	}
+	c.values[key] += v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.labelValues) {
+		c.writeSample(w, "", c.labelValues[key], "", "", c.values[key])
+	}
+}
+
+// Gauge is a value that goes up and down, with one series for each combination of label values
+type Gauge struct {
+	desc
+	mutex       sync.Mutex
+	labelValues map[string][]string
+	values      map[string]float64
+}
+
+// NewGauge registers a gauge. Like a counter, a gauge without labels is written as 0 until it is set.
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{
+		desc:        newDesc(name, help, "gauge", labelNames),
+		labelValues: map[string][]string{},
+		values:      map[string]float64{},
+	}
+	if len(labelNames) == 0 {
+		g.Set(0)
+	}
+	r.register(g)
+	return g
+}
+
+// Set sets the series with the label values to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.change(labelValues, func(float64) float64 { return v })
+}
+
+// Add adds v, which may be negative, to the series with the label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.change(labelValues, func(old float64) float64 { return old + v })
+}
+
+func (g *Gauge) change(labelValues []string, f func(float64) float64) {
+	key := g.seriesKey(labelValues)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.labelValues[key]; !ok {
+		g.labelValues[key] = append([]string(nil), labelValues...)
+	}
+	g.values[key] = f(g.values[key])
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.writeHeader(w)
+	for _, key := range sortedKeys(g.labelValues) {
+		g.writeSample(w, "", g.labelValues[key], "", "", g.values[key])
+	}
+}
+
+// gaugeFunc is a gauge without labels whose value is read when it is written
+type gaugeFunc struct {
+	desc
+	value func() float64
+}
+
+// NewGaugeFunc registers a gauge without labels whose value is the result of
+// calling value each time the metrics are written
+func (r *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	r.register(&gaugeFunc{desc: newDesc(name, help, "gauge", nil), value: value})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.writeSample(w, "", nil, "", "", g.value())
+}
+
+// Histogram counts observations in buckets by their value, with one series
+// for each combination of label values
+type Histogram struct {
+	desc
+	buckets     []float64
+	mutex       sync.Mutex
+	labelValues map[string][]string
+	series      map[string]*histogramSeries
+}
+
+// histogramSeries is the count of observations of one series in each bucket,
+// not cumulative, with the last count being of observations above every bucket
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with buckets of the upper bounds given in
+// increasing order. The +Inf bucket is added. Like a counter, a histogram
+// without labels is written with zero counts until its first observation.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of histogram %q are not in increasing order", name))
+	}
+	for _, labelName := range labelNames {
+		if labelName == "le" {
+			panic(fmt.Sprintf("metrics: histogram %q cannot have an le label", name))
+		}
+	}
+
+	h := &Histogram{
+		desc:        newDesc(name, help, "histogram", labelNames),
+		buckets:     append([]float64(nil), buckets...),
+		labelValues: map[string][]string{},
+		series:      map[string]*histogramSeries{},
+	}
+	if len(labelNames) == 0 {
+		h.seriesOf(nil)
+	}
+	r.register(h)
+	return h
+}
+
+// Observe counts v in the series with the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	series := h.seriesOf(labelValues)
+	series.counts[sort.SearchFloat64s(h.buckets, v)]++
+	series.sum += v
+}
+
+// seriesOf returns the series with the label values, adding it when it is new.
+// The mutex must be held unless the histogram is being built.
+func (h *Histogram) seriesOf(labelValues []string) *histogramSeries {
+	key := h.seriesKey(labelValues)
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = series
+		h.labelValues[key] = append([]string(nil), labelValues...)
+	}
+	return series
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.labelValues) {
+		labelValues, series := h.labelValues[key], h.series[key]
+
+		var cumulative uint64
+		for i, upperBound := range h.buckets {
+			cumulative += series.counts[i]
+			h.writeSample(w, "_bucket", labelValues, "le", formatFloat(upperBound), float64(cumulative))
+		}
+		cumulative += series.counts[len(h.buckets)]
+		h.writeSample(w, "_bucket", labelValues, "le", "+Inf", float64(cumulative))
+		h.writeSample(w, "_sum", labelValues, "", "", series.sum)
+		h.writeSample(w, "_count", labelValues, "", "", float64(cumulative))
+	}
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// checkGolden compares got with the golden file of a test, or rewrites the
+// golden file when the tests are run with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output does not match %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(*Registry)
+	}{
+		{
+			name:     "empty",
+			register: func(*Registry) {},
+		},
+		{
+			name: "unused",
+			register: func(r *Registry) {
+				r.NewCounter("jobs_total", "Jobs run.")
+				r.NewCounter("requests_total", "Requests handled.", "method", "code")
+				r.NewGauge("temperature_celsius", "Current temperature.")
+				r.NewHistogram("batch_size", "Items per batch.", []float64{1, 10})
+				r.NewHistogram("duration_seconds", "Request latency.", DefaultBuckets, "route")
+			},
+		},
+		{
+			name: "counters",
+			register: func(r *Registry) {
+				c := r.NewCounter("requests_total", "Requests handled.", "method", "code")
+				c.Inc("POST", "201")
+				c.Inc("GET", "200")
+				c.Add(2.5, "GET", "200")
+				c.Inc("GET", "404")
+
+				r.NewCounter("jobs_total", "Jobs run.").Add(3)
+			},
+		},
+		{
+			name: "gauges",
+			register: func(r *Registry) {
+				g := r.NewGauge("queue_length", "Items waiting.", "queue")
+				g.Set(4, "b")
+				g.Set(7, "a")
+				g.Add(-2, "a")
+
+				r.NewGaugeFunc("items", "Items in stock.", func() float64 { return 42 })
+				r.NewGauge("ratio", "A special value.").Set(math.Inf(1))
+			},
+		},
+		{
+			name: "histograms",
+			register: func(r *Registry) {
+				h := r.NewHistogram("duration_seconds", "Request latency.", []float64{0.1, 0.5, 1}, "route")
+				for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+					h.Observe(v, "/produce")
+				}
+				h.Observe(0.7, "/carts")
+
+				r.NewHistogram("batch_size", "Items per batch.", ExponentialBuckets(1, 2, 4)).Observe(3)
+			},
+		},
+		{
+			name: "escaping",
+			register: func(r *Registry) {
+				c := r.NewCounter("escaped_total", "Help with a \\ backslash\nand a new line.", "value")
+				c.Inc("quote \" backslash \\ new line \n end")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.register(r)
+
+			var b bytes.Buffer
+			if err := r.WriteText(&b); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name, b.Bytes())
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("jobs_total", "Jobs run.").Inc()
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("wrong content type: got %q want %q", got, ContentType)
+	}
+	if got, want := rr.Body.String(), "# HELP jobs_total Jobs run.\n# TYPE jobs_total counter\njobs_total 1\n"; got != want {
+		t.Errorf("wrong body: got %q want %q", got, want)
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	tests := []struct {
+		name string
+		use  func(*Registry)
+	}{
+		{name: "invalid metric name", use: func(r *Registry) { r.NewCounter("requests-total", "") }},
+		{name: "invalid label name", use: func(r *Registry) { r.NewCounter("requests_total", "", "status code") }},
+		{name: "reserved label name", use: func(r *Registry) { r.NewCounter("requests_total", "", "__name") }},
+		{name: "duplicate metric", use: func(r *Registry) {
+			r.NewCounter("requests_total", "")
+			r.NewGauge("requests_total", "")
+		}},
+		{name: "wrong number of label values", use: func(r *Registry) {
+			r.NewCounter("requests_total", "", "method").Inc("GET", "200")
+		}},
+		{name: "negative counter", use: func(r *Registry) { r.NewCounter("requests_total", "").Add(-1) }},
+		{name: "unsorted buckets", use: func(r *Registry) { r.NewHistogram("size", "", []float64{2, 1}) }},
+		{name: "le label", use: func(r *Registry) { r.NewHistogram("size", "", DefaultBuckets, "le") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			tt.use(NewRegistry())
+		})
+	}
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	got := ExponentialBuckets(1, 2, 5)
+	want := []float64{1, 2, 4, 8, 16}
+	if len(got) != len(want) {
+		t.Fatalf("wrong buckets: got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("wrong buckets: got %v want %v", got, want)
+		}
+	}
+}
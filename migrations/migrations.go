@@ -0,0 +1,216 @@
+// Package migrations holds the versioned schema migrations for the SQL backed
+// produce storage. Migrations are embedded in the binary so the daemon can
+// bring a database up to date on startup without any files on disk.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+const createVersionTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration has been applied to a database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// All returns every embedded migration ordered by version
+func All() ([]Migration, error) {
+	entries, err := files.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		// file names look like 0001_create_produce.up.sql
+		parts := strings.SplitN(strings.TrimSuffix(entry.Name(), ".sql"), "_", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, errors.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		b, err := files.ReadFile(path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		switch {
+		case strings.HasSuffix(parts[1], ".up"):
+			m.Name = strings.TrimSuffix(parts[1], ".up")
+			m.Up = string(b)
+		case strings.HasSuffix(parts[1], ".down"):
+			m.Name = strings.TrimSuffix(parts[1], ".down")
+			m.Down = string(b)
+		default:
+			return nil, errors.Errorf("migration file %s must end in .up.sql or .down.sql", entry.Name())
+		}
+	}
+
+	migrations := []Migration{}
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, errors.Errorf("migration %d is missing its up or down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies every migration that has not been applied yet and returns how many were applied
+func Up(db *sql.DB) (int, error) {
+	statuses, err := GetStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+
+		if err := run(db, status.Migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, status.Version, status.Name, time.Now().UTC())
+			return err
+		}); err != nil {
+			return applied, errors.Wrapf(err, "failed to apply migration %s", label(status.Migration))
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+// Down rolls back the given number of the most recently applied migrations and returns how many were rolled back
+func Down(db *sql.DB, steps int) (int, error) {
+	statuses, err := GetStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	rolledBack := 0
+	for i := len(statuses) - 1; i >= 0 && rolledBack < steps; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+
+		if err := run(db, status.Migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, status.Version)
+			return err
+		}); err != nil {
+			return rolledBack, errors.Wrapf(err, "failed to roll back migration %s", label(status.Migration))
+		}
+		rolledBack++
+	}
+
+	return rolledBack, nil
+}
+
+// GetStatus returns every embedded migration along with whether it has been applied
+func GetStatus(db *sql.DB) ([]Status, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(createVersionTable); err != nil {
+		return nil, errors.Wrap(err, "failed to create schema_migrations table")
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read schema_migrations table")
+	}
+	defer rows.Close()
+
+	appliedAt := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, errors.Wrap(err, "failed to read schema_migrations table")
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read schema_migrations table")
+	}
+
+	statuses := make([]Status, len(migrations))
+	for i, m := range migrations {
+		at, applied := appliedAt[m.Version]
+		statuses[i] = Status{
+			Migration: m,
+			Applied:   applied,
+			AppliedAt: at,
+		}
+	}
+
+	return statuses, nil
+}
+
+// run executes a migration script and records it in a single transaction so a
+// failed migration never leaves the schema half changed
+func run(db *sql.DB, script string, record func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(script); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func label(m Migration) string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
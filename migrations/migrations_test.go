@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestAll(t *testing.T) {
+	migrations, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration versions must be sequential got %d want %d", m.Version, i+1)
+		}
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	all, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := Up(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(all) {
+		t.Errorf("unexpected number of migrations applied got %d want %d", applied, len(all))
+	}
+
+	// a second run has nothing left to apply
+	applied, err = Up(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 0 {
+		t.Errorf("unexpected number of migrations applied got %d want %d", applied, 0)
+	}
+
+	rolledBack, err := Down(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack != 1 {
+		t.Errorf("unexpected number of migrations rolled back got %d want %d", rolledBack, 1)
+	}
+
+	statuses, err := GetStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, status := range statuses {
+		if want := i < len(all)-1; status.Applied != want {
+			t.Errorf("migration %d applied got %v want %v", status.Version, status.Applied, want)
+		}
+	}
+
+	rolledBack, err = Down(db, len(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack != len(all)-1 {
+		t.Errorf("unexpected number of migrations rolled back got %d want %d", rolledBack, len(all)-1)
+	}
+
+	// every down migration must undo its up migration so the schema can be rebuilt
+	if _, err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+}
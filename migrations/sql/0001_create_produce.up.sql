@@ -0,0 +1,5 @@
+CREATE TABLE produce (
+	produce_code TEXT PRIMARY KEY,
+	name         TEXT NOT NULL,
+	unit_price   REAL NOT NULL
+);
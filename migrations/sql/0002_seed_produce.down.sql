@@ -0,0 +1,6 @@
+DELETE FROM produce WHERE produce_code IN (
+	'A12T-4GH7-QPL9-3N4M',
+	'E5T6-9UI3-TH15-QR88',
+	'YRT6-72AS-K736-L4AR',
+	'TQ4C-VV6T-75ZX-1RMR'
+);
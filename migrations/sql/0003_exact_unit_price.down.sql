@@ -0,0 +1,13 @@
+-- every price stored before this migration was in USD which has two decimal places
+CREATE TABLE produce_float (
+	produce_code TEXT PRIMARY KEY,
+	name         TEXT NOT NULL,
+	unit_price   REAL NOT NULL
+);
+
+INSERT INTO produce_float (produce_code, name, unit_price)
+	SELECT produce_code, name, unit_price_minor / 100.0 FROM produce;
+
+DROP TABLE produce;
+
+ALTER TABLE produce_float RENAME TO produce;
@@ -0,0 +1,15 @@
+-- unit prices are stored as an integer number of minor units of their currency
+-- so no price ever passes through a float
+CREATE TABLE produce_exact (
+	produce_code     TEXT PRIMARY KEY,
+	name             TEXT NOT NULL,
+	unit_price_minor INTEGER NOT NULL,
+	currency         TEXT NOT NULL DEFAULT 'USD'
+);
+
+INSERT INTO produce_exact (produce_code, name, unit_price_minor, currency)
+	SELECT produce_code, name, CAST(ROUND(unit_price * 100) AS INTEGER), 'USD' FROM produce;
+
+DROP TABLE produce;
+
+ALTER TABLE produce_exact RENAME TO produce;
@@ -0,0 +1,4 @@
+ALTER TABLE produce DROP COLUMN reorder_threshold;
+ALTER TABLE produce DROP COLUMN unit_of_measure;
+ALTER TABLE produce DROP COLUMN reserved;
+ALTER TABLE produce DROP COLUMN on_hand;
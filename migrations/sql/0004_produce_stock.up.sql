@@ -0,0 +1,5 @@
+-- quantities are stored as an integer number of thousandths of the unit of measure
+ALTER TABLE produce ADD COLUMN on_hand INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE produce ADD COLUMN reserved INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE produce ADD COLUMN unit_of_measure TEXT NOT NULL DEFAULT '';
+ALTER TABLE produce ADD COLUMN reorder_threshold INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE produce DROP COLUMN category;
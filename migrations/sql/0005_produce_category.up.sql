@@ -0,0 +1 @@
+ALTER TABLE produce ADD COLUMN category TEXT NOT NULL DEFAULT '';
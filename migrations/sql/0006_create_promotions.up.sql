@@ -0,0 +1,20 @@
+-- quantities are thousandths of the unit of measure, percent_off is hundredths
+-- of a percent and amount_off_minor is minor units of currency. Times are
+-- RFC 3339 strings in UTC and a NULL ends_at never ends.
+CREATE TABLE promotions (
+	id               TEXT PRIMARY KEY,
+	name             TEXT NOT NULL,
+	kind             TEXT NOT NULL,
+	produce_code     TEXT NOT NULL DEFAULT '',
+	category         TEXT NOT NULL DEFAULT '',
+	buy_quantity     INTEGER NOT NULL DEFAULT 0,
+	free_quantity    INTEGER NOT NULL DEFAULT 0,
+	percent_off      INTEGER NOT NULL DEFAULT 0,
+	amount_off_minor INTEGER NOT NULL DEFAULT 0,
+	currency         TEXT NOT NULL DEFAULT '',
+	min_quantity     INTEGER NOT NULL DEFAULT 0,
+	priority         INTEGER NOT NULL DEFAULT 0,
+	exclusive        INTEGER NOT NULL DEFAULT 0,
+	starts_at        TEXT NOT NULL,
+	ends_at          TEXT
+);
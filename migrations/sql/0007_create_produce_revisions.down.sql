@@ -0,0 +1 @@
+DROP TABLE produce_revisions;
@@ -0,0 +1,23 @@
+-- every change to the catalog is kept as a revision of the produce. Stock is
+-- not part of the catalog and is not kept. changed_at is a UTC timestamp with
+-- millisecond precision in a fixed width format so revisions compare as text.
+CREATE TABLE produce_revisions (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	produce_code      TEXT NOT NULL,
+	name              TEXT NOT NULL,
+	unit_price_minor  INTEGER NOT NULL,
+	currency          TEXT NOT NULL,
+	category          TEXT NOT NULL DEFAULT '',
+	unit_of_measure   TEXT NOT NULL DEFAULT '',
+	reorder_threshold INTEGER NOT NULL DEFAULT 0,
+	deleted           INTEGER NOT NULL DEFAULT 0,
+	actor             TEXT NOT NULL,
+	changed_at        TEXT NOT NULL
+);
+
+CREATE INDEX produce_revisions_produce_code ON produce_revisions (produce_code, id);
+
+-- produce stored before history was kept starts its history now
+INSERT INTO produce_revisions (produce_code, name, unit_price_minor, currency, category, unit_of_measure, reorder_threshold, actor, changed_at)
+SELECT produce_code, name, unit_price_minor, currency, category, unit_of_measure, reorder_threshold, 'system', strftime('%Y-%m-%dT%H:%M:%fZ', 'now')
+FROM produce;
@@ -0,0 +1,2 @@
+ALTER TABLE produce DROP COLUMN updated_at;
+ALTER TABLE produce DROP COLUMN version;
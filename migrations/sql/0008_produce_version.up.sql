@@ -0,0 +1,7 @@
+-- version counts every change to a produce, including stock changes, so
+-- writes can be made on the condition that nothing changed since a read.
+-- updated_at is the UTC time of the last change in the same format as changed_at.
+ALTER TABLE produce ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE produce ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+
+UPDATE produce SET updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Role decides which requests an API key may send. Each role may send every
+// request of the roles below it.
+type Role string
+
+const (
+	// RoleReader may list and get the catalog, carts and promotions
+	RoleReader Role = "reader"
+
+	// RoleEditor may also create and update them
+	RoleEditor Role = "editor"
+
+	// RoleAdmin may also delete and import produce and delete promotions
+	RoleAdmin Role = "admin"
+)
+
+// roleRanks orders the roles from the one that may send the fewest requests
+var roleRanks = map[Role]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// ParseRole validates the name of a role
+func ParseRole(role string) (Role, error) {
+	r := Role(strings.ToLower(role))
+	if _, ok := roleRanks[r]; !ok {
+		return "", fmt.Errorf("unknown role %q, must be %s, %s or %s", role, RoleReader, RoleEditor, RoleAdmin)
+	}
+	return r, nil
+}
+
+// Allows reports whether the role may send a request that needs the required role
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
+
+// APIKey is a key requests are authenticated with. Only a hash of the secret
+// part of the key is kept, so the key itself is only known when it is created.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      Role       `json:"role"`
+	Hash      string     `json:"hash,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Revoked reports whether the key can no longer be used
+func (k APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
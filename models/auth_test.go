@@ -0,0 +1,36 @@
+package models
+
+import "testing"
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     string
+		required Role
+		want     bool
+	}{
+		{role: "reader", required: RoleReader, want: true},
+		{role: "reader", required: RoleEditor, want: false},
+		{role: "reader", required: RoleAdmin, want: false},
+		{role: "Editor", required: RoleReader, want: true},
+		{role: "editor", required: RoleEditor, want: true},
+		{role: "editor", required: RoleAdmin, want: false},
+		{role: "admin", required: RoleReader, want: true},
+		{role: "ADMIN", required: RoleAdmin, want: true},
+	}
+	for _, tt := range tests {
+		role, err := ParseRole(tt.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := role.Allows(tt.required); got != tt.want {
+			t.Errorf("%s.Allows(%s) = %v, want %v", role, tt.required, got, tt.want)
+		}
+	}
+
+	if _, err := ParseRole("owner"); err == nil {
+		t.Error("expected an error for an unknown role")
+	}
+	if Role("owner").Allows(RoleReader) {
+		t.Error("an unknown role allows reading")
+	}
+}
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxTaxRateScale is the most decimal places a sales tax rate may have
+const maxTaxRateScale = 6
+
+// CartStatus is the stage of its life a cart is in
+type CartStatus string
+
+const (
+	// CartOpen carts can still have produce added and removed
+	CartOpen CartStatus = "open"
+
+	// CartCheckedOut carts have a receipt and can no longer change
+	CartCheckedOut CartStatus = "checkedOut"
+)
+
+// CartItem is a quantity of one produce in a cart. Cart items only hold the
+// produce code so their price always follows the catalog until checkout.
+type CartItem struct {
+	ProduceCode string   `json:"produceCode"`
+	Quantity    Quantity `json:"quantity"`
+}
+
+// Cart is a collection of produce being bought
+type Cart struct {
+	ID        string     `json:"id"`
+	Status    CartStatus `json:"status"`
+	Items     []CartItem `json:"items"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Receipt   *Receipt   `json:"receipt,omitempty"`
+}
+
+// LineItem is a cart item priced at the unit price of its produce
+type LineItem struct {
+	ProduceCode   string        `json:"produceCode"`
+	Name          string        `json:"name"`
+	Category      string        `json:"category,omitempty"`
+	Quantity      Quantity      `json:"quantity"`
+	UnitOfMeasure UnitOfMeasure `json:"unitOfMeasure"`
+	UnitPrice     Money         `json:"unitPrice"`
+	LineTotal     Money         `json:"lineTotal"`
+}
+
+// NewLineItem prices a quantity of a produce. The line total is the exact
+// product of the quantity and the unit price rounded half to even to the minor
+// unit of the currency.
+func NewLineItem(produce Produce, quantity Quantity) (LineItem, error) {
+	total, err := produce.UnitPrice.MulQuantity(quantity)
+	if err != nil {
+		return LineItem{}, err
+	}
+
+	total, err = total.Round(RoundHalfEven)
+	if err != nil {
+		return LineItem{}, err
+	}
+
+	return LineItem{
+		ProduceCode:   produce.ProduceCode,
+		Name:          produce.Name,
+		Category:      produce.Category,
+		Quantity:      quantity,
+		UnitOfMeasure: produce.UnitOfMeasure.OrDefault(),
+		UnitPrice:     produce.UnitPrice,
+		LineTotal:     total,
+	}, nil
+}
+
+// Subtotal adds up the line totals. Every line must be in the same currency
+// and an empty list of lines costs nothing in the default currency.
+func Subtotal(lines []LineItem) (Money, error) {
+	subtotal := NewMoney(0, DefaultCurrency)
+	if len(lines) > 0 {
+		subtotal = NewMoney(0, lines[0].LineTotal.Currency())
+	}
+
+	for _, line := range lines {
+		var err error
+		if subtotal, err = subtotal.Add(line.LineTotal); err != nil {
+			return Money{}, err
+		}
+	}
+
+	return subtotal, nil
+}
+
+// PricedCart is a cart with every item priced at the current unit price of its produce
+type PricedCart struct {
+	ID        string     `json:"id"`
+	Status    CartStatus `json:"status"`
+	Items     []LineItem `json:"items"`
+	Subtotal  Money      `json:"subtotal"`
+	Currency  string     `json:"currency"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// TaxRate is an exact sales tax rate between 0 and 1, e.g. 0.0825 for 8.25%
+type TaxRate struct {
+	value int64
+	scale int
+}
+
+// ParseTaxRate parses a decimal sales tax rate with at most six decimal places
+func ParseTaxRate(s string) (TaxRate, error) {
+	value, scale, err := parseDecimal(strings.TrimSpace(s))
+	if err != nil {
+		return TaxRate{}, fmt.Errorf("invalid sales tax rate %q", s)
+	}
+
+	if scale > maxTaxRateScale {
+		return TaxRate{}, fmt.Errorf("sales tax rate %q has more than %d decimal places", s, maxTaxRateScale)
+	}
+
+	if value < 0 || value > pow10(scale) {
+		return TaxRate{}, fmt.Errorf("sales tax rate %q must be between 0 and 1", s)
+	}
+
+	return TaxRate{value: value, scale: scale}, nil
+}
+
+// String formats the rate as a plain decimal, e.g. "0.0825"
+func (r TaxRate) String() string {
+	return formatDecimal(r.value, r.scale, true)
+}
+
+// MarshalJSON writes the rate as a JSON number
+func (r TaxRate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON reads the rate from a JSON number
+func (r *TaxRate) UnmarshalJSON(b []byte) error {
+	parsed, err := ParseTaxRate(string(b))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// TaxOn returns the tax due on an amount rounded half to even to the minor unit of its currency
+func (r TaxRate) TaxOn(amount Money) (Money, error) {
+	tax, err := amount.mul(r.value, r.scale)
+	if err != nil {
+		return Money{}, err
+	}
+	return tax.Round(RoundHalfEven)
+}
+
+// Receipt is the itemized record of a checked out cart. Its prices and
+// promotions are frozen at checkout and do not follow later changes to the catalog.
+type Receipt struct {
+	CartID       string              `json:"cartId"`
+	Items        []QuotedLine        `json:"items"`
+	Subtotal     Money               `json:"subtotal"`
+	Promotions   []PromotionDiscount `json:"promotions"`
+	Discount     Money               `json:"discount"`
+	TaxRate      TaxRate             `json:"taxRate"`
+	Tax          Money               `json:"tax"`
+	Total        Money               `json:"total"`
+	Currency     string              `json:"currency"`
+	CheckedOutAt time.Time           `json:"checkedOutAt"`
+}
+
+// NewReceipt charges tax on a quote for the items of a cart. Each line total
+// and discount is already rounded, so tax is charged once on the discounted
+// total of the quote and rounded half to even.
+func NewReceipt(cartID string, quote Quote, rate TaxRate, checkedOutAt time.Time) (Receipt, error) {
+	tax, err := rate.TaxOn(quote.Total)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	total, err := quote.Total.Add(tax)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	return Receipt{
+		CartID:       cartID,
+		Items:        quote.Items,
+		Subtotal:     quote.Subtotal,
+		Promotions:   quote.Promotions,
+		Discount:     quote.Discount,
+		TaxRate:      rate,
+		Tax:          tax,
+		Total:        total,
+		Currency:     total.Currency(),
+		CheckedOutAt: checkedOutAt,
+	}, nil
+}
+
+// LineItems returns the line items of the receipt before promotions
+func (r Receipt) LineItems() []LineItem {
+	lines := make([]LineItem, len(r.Items))
+	for i, item := range r.Items {
+		lines[i] = item.LineItem
+	}
+	return lines
+}
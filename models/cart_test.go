@@ -0,0 +1,100 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewLineItem(t *testing.T) {
+	tests := []struct {
+		name      string
+		unitPrice Money
+		unit      UnitOfMeasure
+		quantity  Quantity
+		want      Money
+	}{
+		{name: "whole items", unitPrice: NewMoney(346, USD), quantity: NewQuantity(3), want: NewMoney(1038, USD)},
+		{name: "weight rounds down", unitPrice: NewMoney(199, USD), unit: Pound, quantity: 1234, want: NewMoney(246, USD)},
+		{name: "weight rounds up", unitPrice: NewMoney(199, USD), unit: Pound, quantity: 1237, want: NewMoney(246, USD)},
+		{name: "tie rounds to even", unitPrice: NewMoney(101, USD), unit: Kilogram, quantity: 500, want: NewMoney(50, USD)},
+		{name: "whole currency", unitPrice: NewMoney(350, "JPY"), unit: Kilogram, quantity: 1501, want: NewMoney(525, "JPY")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			produce := Produce{ProduceCode: "A12T-4GH7-QPL9-3N4M", UnitPrice: tt.unitPrice, UnitOfMeasure: tt.unit}
+			got, err := NewLineItem(produce, tt.quantity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.LineTotal != tt.want {
+				t.Errorf("LineTotal = %v, want %v", got.LineTotal, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTaxRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "0", want: "0"},
+		{in: "0.0825", want: "0.0825"},
+		{in: "0.07250", want: "0.0725"},
+		{in: "1", want: "1"},
+		{in: "1.5", wantErr: true},
+		{in: "-0.01", wantErr: true},
+		{in: "0.0000001", wantErr: true},
+		{in: "eight", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseTaxRate(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTaxRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseTaxRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReceipt(t *testing.T) {
+	rate, err := ParseTaxRate("0.0825")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []LineItem{
+		{ProduceCode: "A12T-4GH7-QPL9-3N4M", LineTotal: NewMoney(1038, USD)},
+		{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", LineTotal: NewMoney(246, USD)},
+	}
+
+	quote, err := NewQuote(lines, nil, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := NewReceipt("cart", quote, rate, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tax is charged once on the subtotal: 12.84 * 0.0825 = 1.0593 which rounds to 1.06
+	if want := NewMoney(1284, USD); receipt.Subtotal != want {
+		t.Errorf("Subtotal = %v, want %v", receipt.Subtotal, want)
+	}
+	if want := NewMoney(106, USD); receipt.Tax != want {
+		t.Errorf("Tax = %v, want %v", receipt.Tax, want)
+	}
+	if want := NewMoney(1390, USD); receipt.Total != want {
+		t.Errorf("Total = %v, want %v", receipt.Total, want)
+	}
+
+	lines = append(lines, LineItem{LineTotal: NewMoney(100, "EUR")})
+	if _, err := NewQuote(lines, nil, time.Time{}); err != ErrCurrencyMismatch {
+		t.Errorf("unexpected error mixing currencies got %v want %v", err, ErrCurrencyMismatch)
+	}
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxScale is the most decimal places a parsed decimal may carry
+const maxScale = 18
+
+var (
+	// ErrAmountOutOfRange is returned when a decimal cannot be held exactly in an int64
+	ErrAmountOutOfRange = errors.New("amount is out of range")
+
+	errInvalidDecimal = errors.New("invalid decimal")
+
+	decimalPattern = regexp.MustCompile(`^(-)?(\d+)(?:\.(\d+))?(?:[eE]([+-]?\d+))?$`)
+)
+
+// parseDecimal parses a JSON number literal exactly into an integer value and
+// the number of decimal places it is scaled by
+func parseDecimal(s string) (int64, int, error) {
+	match := decimalPattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, 0, errInvalidDecimal
+	}
+
+	digits := strings.TrimLeft(match[2]+match[3], "0")
+	scale := len(match[3])
+	if match[4] != "" {
+		exponent, err := strconv.Atoi(match[4])
+		if err != nil {
+			return 0, 0, ErrAmountOutOfRange
+		}
+		scale -= exponent
+	}
+
+	// drop trailing zeros that only add precision so values like 1.1000000000000000000
+	// still fit, then pad negative scales out to whole units
+	for scale > 0 && strings.HasSuffix(digits, "0") {
+		digits = strings.TrimSuffix(digits, "0")
+		scale--
+	}
+	if digits == "" {
+		return 0, 0, nil
+	}
+	if scale < 0 {
+		if -scale > maxScale {
+			return 0, 0, ErrAmountOutOfRange
+		}
+		digits += strings.Repeat("0", -scale)
+		scale = 0
+	}
+	if scale > maxScale {
+		return 0, 0, ErrAmountOutOfRange
+	}
+
+	value, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, 0, ErrAmountOutOfRange
+	}
+	if match[1] == "-" {
+		value = -value
+	}
+
+	return value, scale, nil
+}
+
+func formatDecimal(amount int64, scale int, trimZeros bool) string {
+	sign := ""
+	magnitude := strconv.FormatUint(uint64(amount), 10)
+	if amount < 0 {
+		sign = "-"
+		magnitude = strconv.FormatUint(uint64(-amount), 10)
+	}
+
+	if scale == 0 {
+		return sign + magnitude
+	}
+
+	if len(magnitude) <= scale {
+		magnitude = strings.Repeat("0", scale-len(magnitude)+1) + magnitude
+	}
+
+	whole, fraction := magnitude[:len(magnitude)-scale], magnitude[len(magnitude)-scale:]
+	if trimZeros {
+		fraction = strings.TrimRight(fraction, "0")
+	}
+	if fraction == "" {
+		return sign + whole
+	}
+
+	return sign + whole + "." + fraction
+}
+
+// rescale converts an amount from one scale to a larger one, reporting false on overflow.
+// Converting to a smaller scale truncates.
+func rescale(amount int64, from, to int) (int64, bool) {
+	if to <= from {
+		return amount / pow10(from-to), true
+	}
+
+	factor := pow10(to - from)
+	if factor == 0 || amount > math.MaxInt64/factor || amount < math.MinInt64/factor {
+		return 0, false
+	}
+	return amount * factor, true
+}
+
+// mulInt64 multiplies two integers, reporting false on overflow
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	product := a * b
+	if product/b != a {
+		return 0, false
+	}
+	return product, true
+}
+
+// addInt64 adds two integers, reporting false on overflow
+func addInt64(a, b int64) (int64, bool) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+	return sum, true
+}
+
+func pow10(n int) int64 {
+	if n > maxScale {
+		return 0
+	}
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
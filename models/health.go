@@ -0,0 +1,36 @@
+package models
+
+// The status of the daemon, and of each check of whether it is ready
+const (
+	StatusOK       = "ok"
+	StatusReady    = "ready"
+	StatusNotReady = "not ready"
+	StatusFailed   = "failed"
+)
+
+// Health is the status of a daemon that is running
+type Health struct {
+	Status string `json:"status"`
+}
+
+// ReadinessCheck is whether a dependency of the daemon is available
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Readiness is whether the daemon can handle requests and the check of every
+// dependency that decided it
+type Readiness struct {
+	Status string           `json:"status"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// BuildInfo describes the build of a binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
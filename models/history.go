@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// ProduceRevision is the catalog entry of a produce after a change made by an
+// actor. Stock is not part of the catalog so a revision never holds stock counts.
+type ProduceRevision struct {
+	Produce   Produce
+	Deleted   bool
+	Actor     string
+	ChangedAt time.Time
+}
+
+// NewRevision returns the revision of a produce after it was changed, or deleted, by an actor
+func NewRevision(produce Produce, deleted bool, actor string, changedAt time.Time) ProduceRevision {
+	produce.OnHand = 0
+	produce.Reserved = 0
+
+	return ProduceRevision{
+		Produce:   produce,
+		Deleted:   deleted,
+		Actor:     actor,
+		ChangedAt: changedAt,
+	}
+}
+
+// RevisionAt returns the latest of the revisions, ordered oldest first, that was made at or before t
+func RevisionAt(revisions []ProduceRevision, t time.Time) (ProduceRevision, bool) {
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if !revisions[i].ChangedAt.After(t) {
+			return revisions[i], true
+		}
+	}
+	return ProduceRevision{}, false
+}
+
+// PriceChange is a unit price a produce was given and who gave it
+type PriceChange struct {
+	UnitPrice Money     `json:"unitPrice"`
+	Actor     string    `json:"actor"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// PriceHistory returns the unit price changes in revisions ordered oldest
+// first. The first price of a produce is a change, as is the price it is given
+// when it is recreated after being deleted. Revisions that keep the price are skipped.
+func PriceHistory(revisions []ProduceRevision) []PriceChange {
+	changes := []PriceChange{}
+
+	var current *Money
+	for _, revision := range revisions {
+		if revision.Deleted {
+			current = nil
+			continue
+		}
+
+		price := revision.Produce.UnitPrice
+		if current != nil && current.Cmp(price) == 0 {
+			continue
+		}
+		current = &price
+
+		changes = append(changes, PriceChange{
+			UnitPrice: price,
+			Actor:     revision.Actor,
+			ChangedAt: revision.ChangedAt,
+		})
+	}
+
+	return changes
+}
+
+// PriceChangeV2 is the version 2 wire representation of PriceChange
+type PriceChangeV2 struct {
+	PriceChange
+	UnitPrice MoneyV2 `json:"unitPrice"`
+}
+
+// PriceHistoryV2 converts a price history to the version 2 wire representation
+func PriceHistoryV2(changes []PriceChange) []PriceChangeV2 {
+	v2 := make([]PriceChangeV2, len(changes))
+	for i, change := range changes {
+		v2[i] = PriceChangeV2{PriceChange: change, UnitPrice: MoneyV2(change.UnitPrice)}
+	}
+	return v2
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPriceHistory(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(day int) time.Time { return start.AddDate(0, 0, day) }
+	peach := func(cents int64) Produce {
+		return Produce{Name: "Peach", ProduceCode: "E5T6-9UI3-TH15-QR88", UnitPrice: NewMoney(cents, USD)}
+	}
+	renamed := peach(349)
+	renamed.Name = "White Peach"
+
+	tests := []struct {
+		name      string
+		revisions []ProduceRevision
+		want      []PriceChange
+	}{
+		{
+			name:      "no revisions",
+			revisions: nil,
+			want:      []PriceChange{},
+		},
+		{
+			name: "first price and every change",
+			revisions: []ProduceRevision{
+				NewRevision(peach(299), false, "alice", at(0)),
+				NewRevision(peach(349), false, "bob", at(1)),
+				NewRevision(peach(329), false, "alice", at(2)),
+			},
+			want: []PriceChange{
+				{UnitPrice: NewMoney(299, USD), Actor: "alice", ChangedAt: at(0)},
+				{UnitPrice: NewMoney(349, USD), Actor: "bob", ChangedAt: at(1)},
+				{UnitPrice: NewMoney(329, USD), Actor: "alice", ChangedAt: at(2)},
+			},
+		},
+		{
+			name: "changes that keep the price are skipped",
+			revisions: []ProduceRevision{
+				NewRevision(peach(349), false, "alice", at(0)),
+				NewRevision(renamed, false, "bob", at(1)),
+			},
+			want: []PriceChange{
+				{UnitPrice: NewMoney(349, USD), Actor: "alice", ChangedAt: at(0)},
+			},
+		},
+		{
+			name: "recreating a deleted produce records its price again",
+			revisions: []ProduceRevision{
+				NewRevision(peach(299), false, "alice", at(0)),
+				NewRevision(peach(299), true, "bob", at(1)),
+				NewRevision(peach(299), false, "carol", at(2)),
+			},
+			want: []PriceChange{
+				{UnitPrice: NewMoney(299, USD), Actor: "alice", ChangedAt: at(0)},
+				{UnitPrice: NewMoney(299, USD), Actor: "carol", ChangedAt: at(2)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PriceHistory(tt.revisions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PriceHistory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevisionAt(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	revisions := []ProduceRevision{
+		NewRevision(Produce{Name: "first"}, false, "alice", start),
+		NewRevision(Produce{Name: "second"}, false, "alice", start.Add(time.Hour)),
+	}
+
+	tests := []struct {
+		name      string
+		at        time.Time
+		want      string
+		wantFound bool
+	}{
+		{name: "before the first revision", at: start.Add(-time.Nanosecond)},
+		{name: "at the first revision", at: start, want: "first", wantFound: true},
+		{name: "between revisions", at: start.Add(time.Minute), want: "first", wantFound: true},
+		{name: "after the last revision", at: start.Add(2 * time.Hour), want: "second", wantFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := RevisionAt(revisions, tt.at)
+			if found != tt.wantFound || got.Produce.Name != tt.want {
+				t.Errorf("RevisionAt() = %v, %v, want %v, %v", got.Produce.Name, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestNewRevisionClearsStock(t *testing.T) {
+	revision := NewRevision(Produce{Name: "Peach", OnHand: NewQuantity(10), Reserved: NewQuantity(2)}, false, "alice", time.Time{})
+	if revision.Produce.OnHand != 0 || revision.Produce.Reserved != 0 {
+		t.Errorf("revision kept stock got on hand %v reserved %v", revision.Produce.OnHand, revision.Produce.Reserved)
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+// ImportRowError is a row of a catalog import that could not be imported and
+// the machine readable reason why. Rows are numbered from 1 at the first line
+// of the file, so the first row of a CSV after its header is row 2.
+type ImportRowError struct {
+	Row         int    `json:"row"`
+	ProduceCode string `json:"produceCode,omitempty"`
+	Reason      string `json:"reason"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// NewImportRowError returns a row that could not be imported for a reason described by err
+func NewImportRowError(row int, produceCode, reason string, err error) ImportRowError {
+	rowError := ImportRowError{Row: row, ProduceCode: produceCode, Reason: reason}
+	if err != nil {
+		rowError.Detail = err.Error()
+	}
+	return rowError
+}
+
+// ImportProduceResponse counts the rows of a catalog import by what was done
+// with them and lists every row that could not be imported
+type ImportProduceResponse struct {
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Skipped int              `json:"skipped"`
+	Invalid []ImportRowError `json:"importFailed"`
+}
@@ -0,0 +1,352 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+const (
+	// USD is the ISO-4217 code for US dollars
+	USD = "USD"
+
+	// DefaultCurrency is the currency of prices sent without one, which is every price in the version 1 wire format
+	DefaultCurrency = USD
+)
+
+var (
+	// ErrCurrencyMismatch is returned when amounts in different currencies are combined
+	ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+
+	// ErrExcessPrecision is returned when rounding is rejected because an amount has more decimal places than its currency allows
+	ErrExcessPrecision = errors.New("price has more decimal places than its currency allows")
+
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+	// minorUnitExceptions lists the currencies whose minor unit is not a hundredth
+	minorUnitExceptions = map[string]int{
+		"BHD": 3, "CLP": 0, "IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+		"KWD": 3, "LYD": 3, "OMR": 3, "TND": 3, "UGX": 0, "VND": 0,
+	}
+)
+
+// RoundingPolicy decides what happens to an amount with more decimal places than its currency allows
+type RoundingPolicy string
+
+const (
+	// RoundHalfEven rounds to the nearest minor unit with ties going to the even neighbour (banker's rounding)
+	RoundHalfEven RoundingPolicy = "half-even"
+
+	// RejectExcessPrecision refuses amounts that cannot be represented in minor units without rounding
+	RejectExcessPrecision RoundingPolicy = "reject"
+)
+
+// ParseRoundingPolicy validates the name of a rounding policy
+func ParseRoundingPolicy(policy string) (RoundingPolicy, error) {
+	switch p := RoundingPolicy(strings.ToLower(policy)); p {
+	case RoundHalfEven, RejectExcessPrecision:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown rounding policy %q, must be %s or %s", policy, RoundHalfEven, RejectExcessPrecision)
+	}
+}
+
+// Money is an exact decimal amount of an ISO-4217 currency. The amount is held
+// as an integer number of 10^-scale units of the currency. Stored prices are
+// always rounded to the minor unit of their currency, e.g. cents for USD, but
+// parsed amounts keep every decimal place they were sent with until they are rounded.
+type Money struct {
+	amount   int64
+	scale    int
+	currency string
+}
+
+// NewMoney returns an amount of minor units, e.g. cents for USD, of a currency
+func NewMoney(minorUnits int64, currency string) Money {
+	return Money{
+		amount:   minorUnits,
+		scale:    MinorUnitDigits(currency),
+		currency: currency,
+	}
+}
+
+// ParseMoney parses a decimal string such as "3.46" without any loss of precision
+func ParseMoney(amount, currency string) (Money, error) {
+	if !currencyPattern.MatchString(currency) {
+		return Money{}, fmt.Errorf("invalid currency %q, must be an ISO-4217 code", currency)
+	}
+
+	value, scale, err := parseDecimal(amount)
+	if err == errInvalidDecimal {
+		return Money{}, fmt.Errorf("invalid price %q", amount)
+	}
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{
+		amount:   value,
+		scale:    scale,
+		currency: currency,
+	}, nil
+}
+
+// MustParseMoney is like ParseMoney but panics if the amount is invalid. It is
+// meant for constants and tests.
+func MustParseMoney(amount, currency string) Money {
+	m, err := ParseMoney(amount, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// MinorUnitDigits returns how many decimal places the minor unit of a currency has
+func MinorUnitDigits(currency string) int {
+	if digits, ok := minorUnitExceptions[currency]; ok {
+		return digits
+	}
+	return 2
+}
+
+// Currency returns the ISO-4217 code of the currency
+func (m Money) Currency() string {
+	return m.currency
+}
+
+// MinorUnits returns the amount in minor units of the currency. Amounts that
+// have not been rounded are truncated.
+func (m Money) MinorUnits() int64 {
+	amount, _ := rescale(m.amount, m.scale, MinorUnitDigits(m.currency))
+	return amount
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the amount
+func (m Money) Sign() int {
+	switch {
+	case m.amount < 0:
+		return -1
+	case m.amount > 0:
+		return 1
+	}
+	return 0
+}
+
+// Round returns the amount in minor units of its currency. Amounts with more
+// decimal places than the currency allows are handled according to the policy.
+func (m Money) Round(policy RoundingPolicy) (Money, error) {
+	digits := MinorUnitDigits(m.currency)
+	if m.scale <= digits {
+		amount, ok := rescale(m.amount, m.scale, digits)
+		if !ok {
+			return Money{}, ErrAmountOutOfRange
+		}
+		return Money{amount: amount, scale: digits, currency: m.currency}, nil
+	}
+
+	divisor := pow10(m.scale - digits)
+	quotient, remainder := m.amount/divisor, m.amount%divisor
+	if remainder == 0 {
+		return Money{amount: quotient, scale: digits, currency: m.currency}, nil
+	}
+
+	if policy == RejectExcessPrecision {
+		return Money{}, ErrExcessPrecision
+	}
+
+	// round half to even on the absolute value so negative amounts mirror positive ones
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	twice := remainder * 2
+	if twice > divisor || (twice == divisor && quotient%2 != 0) {
+		if m.amount < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+
+	return Money{amount: quotient, scale: digits, currency: m.currency}, nil
+}
+
+// Add returns the exact sum of two amounts in the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if m.currency != other.currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+
+	a, b, scale := m.amount, other.amount, m.scale
+	var ok bool
+	switch {
+	case m.scale < other.scale:
+		a, ok = rescale(a, m.scale, other.scale)
+		scale = other.scale
+	case m.scale > other.scale:
+		b, ok = rescale(b, other.scale, m.scale)
+	default:
+		ok = true
+	}
+	if !ok {
+		return Money{}, ErrAmountOutOfRange
+	}
+
+	sum, ok := addInt64(a, b)
+	if !ok {
+		return Money{}, ErrAmountOutOfRange
+	}
+
+	return Money{amount: sum, scale: scale, currency: m.currency}, nil
+}
+
+// Sub returns the exact difference of two amounts in the same currency
+func (m Money) Sub(other Money) (Money, error) {
+	if other.amount == math.MinInt64 {
+		return Money{}, ErrAmountOutOfRange
+	}
+	other.amount = -other.amount
+	return m.Add(other)
+}
+
+// MulQuantity returns the exact price of a quantity of stock at the amount per
+// unit. The result usually has to be rounded before it is stored.
+func (m Money) MulQuantity(q Quantity) (Money, error) {
+	return m.mul(int64(q), quantityScale)
+}
+
+// mul returns the exact product of the amount and the decimal value × 10^-scale
+func (m Money) mul(value int64, scale int) (Money, error) {
+	amount, ok := mulInt64(m.amount, value)
+	if !ok || m.scale+scale > maxScale {
+		return Money{}, ErrAmountOutOfRange
+	}
+	return Money{amount: amount, scale: m.scale + scale, currency: m.currency}, nil
+}
+
+// Cmp compares two amounts exactly. Amounts in different currencies are
+// ordered by currency code so sorting is always deterministic.
+func (m Money) Cmp(other Money) int {
+	if m.currency != other.currency {
+		return strings.Compare(m.currency, other.currency)
+	}
+
+	a, b := m.amount, other.amount
+	switch {
+	case m.scale < other.scale:
+		var ok bool
+		if a, ok = rescale(a, m.scale, other.scale); !ok {
+			return m.Sign()
+		}
+	case m.scale > other.scale:
+		var ok bool
+		if b, ok = rescale(b, other.scale, m.scale); !ok {
+			return -other.Sign()
+		}
+	}
+
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// String formats the amount as a plain decimal without the currency, e.g. "3.46"
+func (m Money) String() string {
+	return formatDecimal(m.amount, m.scale, false)
+}
+
+// MarshalJSON writes the version 1 representation, a bare JSON number with
+// trailing zeros removed exactly as a float64 price was written
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(formatDecimal(m.amount, m.scale, true)), nil
+}
+
+// UnmarshalJSON reads either representation. A bare number is a version 1
+// price in the default currency and an object is a version 2 price.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	trimmed := strings.TrimSpace(string(b))
+	if strings.HasPrefix(trimmed, "{") {
+		v2 := MoneyV2{}
+		if err := json.Unmarshal(b, &v2); err != nil {
+			return err
+		}
+		*m = Money(v2)
+		return nil
+	}
+
+	parsed, err := ParseMoney(trimmed, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MoneyV2 is the version 2 representation of Money which carries the currency
+// and writes the amount as a string so no client ever parses it as a float
+type MoneyV2 Money
+
+type moneyV2JSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON writes the amount as a decimal string with every minor unit digit, e.g. {"amount":"2.50","currency":"USD"}
+func (m MoneyV2) MarshalJSON() ([]byte, error) {
+	money := Money(m)
+	scale := money.scale
+	if digits := MinorUnitDigits(money.currency); scale < digits {
+		amount, ok := rescale(money.amount, scale, digits)
+		if ok {
+			money.amount, money.scale = amount, digits
+		}
+	}
+
+	amount, err := json.Marshal(formatDecimal(money.amount, money.scale, false))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(moneyV2JSON{
+		Amount:   amount,
+		Currency: money.currency,
+	})
+}
+
+// UnmarshalJSON reads an amount given as either a decimal string or a number
+func (m *MoneyV2) UnmarshalJSON(b []byte) error {
+	v := moneyV2JSON{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	amount := strings.TrimSpace(string(v.Amount))
+	if strings.HasPrefix(amount, `"`) {
+		if err := json.Unmarshal(v.Amount, &amount); err != nil {
+			return err
+		}
+	}
+
+	currency := v.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	parsed, err := ParseMoney(amount, currency)
+	if err != nil {
+		return err
+	}
+	*m = MoneyV2(parsed)
+	return nil
+}
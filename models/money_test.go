@@ -0,0 +1,163 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{name: "cents", amount: "3.46", currency: USD, want: Money{amount: 346, scale: 2, currency: USD}},
+		{name: "whole units", amount: "3", currency: USD, want: Money{amount: 3, scale: 0, currency: USD}},
+		{name: "extra precision is kept", amount: "1.13333", currency: USD, want: Money{amount: 113333, scale: 5, currency: USD}},
+		{name: "trailing zeros are dropped", amount: "1.10000", currency: USD, want: Money{amount: 11, scale: 1, currency: USD}},
+		{name: "negative", amount: "-0.05", currency: USD, want: Money{amount: -5, scale: 2, currency: USD}},
+		{name: "exponent", amount: "1.5e2", currency: USD, want: Money{amount: 150, scale: 0, currency: USD}},
+		{name: "negative exponent", amount: "15e-1", currency: USD, want: Money{amount: 15, scale: 1, currency: USD}},
+		{name: "zero", amount: "0.00", currency: USD, want: Money{currency: USD}},
+		{name: "not a number", amount: "abc", currency: USD, wantErr: true},
+		{name: "too large", amount: "99999999999999999999", currency: USD, wantErr: true},
+		{name: "invalid currency", amount: "1", currency: "usd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.amount, tt.currency)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyRound(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string
+		policy  RoundingPolicy
+		want    int64
+		wantErr error
+	}{
+		{name: "round down", amount: "1.13333", policy: RoundHalfEven, want: 113},
+		{name: "round up", amount: "1.499", policy: RoundHalfEven, want: 150},
+		{name: "tie rounds to even below", amount: "2.345", policy: RoundHalfEven, want: 234},
+		{name: "tie rounds to even above", amount: "2.355", policy: RoundHalfEven, want: 236},
+		{name: "past the tie rounds up", amount: "2.3450001", policy: RoundHalfEven, want: 235},
+		{name: "negative tie rounds to even", amount: "-2.355", policy: RoundHalfEven, want: -236},
+		{name: "whole units are scaled", amount: "4", policy: RoundHalfEven, want: 400},
+		{name: "reject allows exact cents", amount: "1.10", policy: RejectExcessPrecision, want: 110},
+		{name: "reject refuses fractions of a cent", amount: "1.999", policy: RejectExcessPrecision, wantErr: ErrExcessPrecision},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MustParseMoney(tt.amount, USD).Round(tt.policy)
+			if err != tt.wantErr {
+				t.Fatalf("Round() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if want := NewMoney(tt.want, USD); got != want {
+				t.Errorf("Round() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMoneyRoundUsesCurrencyMinorUnits(t *testing.T) {
+	got, err := MustParseMoney("105.5", "JPY").Round(RoundHalfEven)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := NewMoney(106, "JPY"); got != want {
+		t.Errorf("Round() = %v, want %v", got, want)
+	}
+}
+
+func TestMoneyCmp(t *testing.T) {
+	tests := []struct {
+		a, b Money
+		want int
+	}{
+		{MustParseMoney("0.1", USD), MustParseMoney("0.10", USD), 0},
+		{MustParseMoney("0.1", USD), MustParseMoney("0.09999", USD), 1},
+		{MustParseMoney("2.99", USD), MustParseMoney("3.46", USD), -1},
+		{MustParseMoney("-1", USD), MustParseMoney("0.01", USD), -1},
+		{MustParseMoney("5", "EUR"), MustParseMoney("1", USD), -1},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Cmp(tt.b); got != tt.want {
+			t.Errorf("%v.Cmp(%v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		wantV1 string
+		wantV2 string
+	}{
+		{name: "number", in: `3.46`, wantV1: `3.46`, wantV2: `{"amount":"3.46","currency":"USD"}`},
+		{name: "whole number", in: `1.00`, wantV1: `1`, wantV2: `{"amount":"1.00","currency":"USD"}`},
+		{name: "float artifacts are not introduced", in: `0.30`, wantV1: `0.3`, wantV2: `{"amount":"0.30","currency":"USD"}`},
+		{name: "v2 string amount", in: `{"amount":"2.50","currency":"EUR"}`, wantV1: `2.5`, wantV2: `{"amount":"2.50","currency":"EUR"}`},
+		{name: "v2 number amount without currency", in: `{"amount":0.05}`, wantV1: `0.05`, wantV2: `{"amount":"0.05","currency":"USD"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Money{}
+			if err := json.Unmarshal([]byte(tt.in), &m); err != nil {
+				t.Fatal(err)
+			}
+
+			v1, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(v1) != tt.wantV1 {
+				t.Errorf("v1 json = %s, want %s", v1, tt.wantV1)
+			}
+
+			v2, err := json.Marshal(MoneyV2(m))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(v2) != tt.wantV2 {
+				t.Errorf("v2 json = %s, want %s", v2, tt.wantV2)
+			}
+		})
+	}
+}
+
+func TestProduceV2JSON(t *testing.T) {
+	produce := Produce{Name: "Peach", ProduceCode: "E5T6-9UI3-TH15-QR88", UnitPrice: NewMoney(299, USD)}
+
+	b, err := json.Marshal(produce.V2())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"name":"Peach","produceCode":"E5T6-9UI3-TH15-QR88","unitPrice":{"amount":"2.99","currency":"USD"}}`
+	if string(b) != want {
+		t.Errorf("json = %s, want %s", b, want)
+	}
+
+	v2 := ProduceV2{}
+	if err := json.Unmarshal(b, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if got := v2.V1(); got != produce {
+		t.Errorf("V1() = %v, want %v", got, produce)
+	}
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// PromotionDiscount is the discount one promotion gave
+type PromotionDiscount struct {
+	PromotionID string `json:"promotionId"`
+	Name        string `json:"name"`
+	Discount    Money  `json:"discount"`
+}
+
+// QuotedLine is a line item with the promotions applied to it
+type QuotedLine struct {
+	LineItem
+	Promotions []PromotionDiscount `json:"promotions"`
+	Discount   Money               `json:"discount"`
+	Total      Money               `json:"total"`
+}
+
+// QuoteRequest is the body of a pricing quote. Promotions valid at At are
+// applied, or those valid now when At is not set.
+type QuoteRequest struct {
+	Items []CartItem `json:"items"`
+	At    *time.Time `json:"at,omitempty"`
+}
+
+// Quote is the price of a list of line items after promotions
+type Quote struct {
+	Items      []QuotedLine        `json:"items"`
+	Promotions []PromotionDiscount `json:"promotions"`
+	Subtotal   Money               `json:"subtotal"`
+	Discount   Money               `json:"discount"`
+	Total      Money               `json:"total"`
+	Currency   string              `json:"currency"`
+	QuotedAt   time.Time           `json:"quotedAt"`
+}
+
+// NewQuote applies the promotions valid at a moment in time to each line.
+//
+// The promotions that target a line are applied in order of priority, highest
+// first, with ties broken by id. Each discount is rounded half to even to the
+// minor unit and capped at what is left of the line total, so a line never
+// costs less than nothing. Percentages are taken off what is left after the
+// promotions before them. An exclusive promotion is skipped when another
+// promotion has already discounted the line and stops any further promotions
+// when it discounts the line itself.
+func NewQuote(lines []LineItem, promotions []Promotion, at time.Time) (Quote, error) {
+	ordered := make([]Promotion, 0, len(promotions))
+	for _, promotion := range promotions {
+		if promotion.ActiveAt(at) {
+			ordered = append(ordered, promotion)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return lessPromotion(ordered[i], ordered[j]) })
+
+	subtotal, err := Subtotal(lines)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	quote := Quote{
+		Items:      make([]QuotedLine, 0, len(lines)),
+		Promotions: []PromotionDiscount{},
+		Subtotal:   subtotal,
+		Discount:   NewMoney(0, subtotal.Currency()),
+		Currency:   subtotal.Currency(),
+		QuotedAt:   at,
+	}
+	totals := map[string]int{}
+
+	for _, line := range lines {
+		quoted, err := quoteLine(line, ordered)
+		if err != nil {
+			return Quote{}, err
+		}
+
+		if quote.Discount, err = quote.Discount.Add(quoted.Discount); err != nil {
+			return Quote{}, err
+		}
+
+		for _, applied := range quoted.Promotions {
+			i, seen := totals[applied.PromotionID]
+			if !seen {
+				totals[applied.PromotionID] = len(quote.Promotions)
+				quote.Promotions = append(quote.Promotions, applied)
+				continue
+			}
+			if quote.Promotions[i].Discount, err = quote.Promotions[i].Discount.Add(applied.Discount); err != nil {
+				return Quote{}, err
+			}
+		}
+
+		quote.Items = append(quote.Items, quoted)
+	}
+
+	// the breakdown is listed in the same order promotions are applied in
+	rank := map[string]int{}
+	for i, promotion := range ordered {
+		rank[promotion.ID] = i
+	}
+	sort.SliceStable(quote.Promotions, func(i, j int) bool {
+		return rank[quote.Promotions[i].PromotionID] < rank[quote.Promotions[j].PromotionID]
+	})
+
+	if quote.Total, err = subtotal.Sub(quote.Discount); err != nil {
+		return Quote{}, err
+	}
+
+	return quote, nil
+}
+
+func quoteLine(line LineItem, promotions []Promotion) (QuotedLine, error) {
+	currency := line.LineTotal.Currency()
+	quoted := QuotedLine{
+		LineItem:   line,
+		Promotions: []PromotionDiscount{},
+		Discount:   NewMoney(0, currency),
+		Total:      line.LineTotal,
+	}
+
+	for _, promotion := range promotions {
+		if !promotion.Targets(line) {
+			continue
+		}
+
+		if promotion.Exclusive && len(quoted.Promotions) > 0 {
+			continue
+		}
+
+		discount, err := promotion.discount(line, quoted.Total)
+		if err != nil {
+			return QuotedLine{}, err
+		}
+		if discount.Cmp(quoted.Total) > 0 {
+			discount = quoted.Total
+		}
+		if discount.Sign() <= 0 {
+			continue
+		}
+
+		if quoted.Discount, err = quoted.Discount.Add(discount); err != nil {
+			return QuotedLine{}, err
+		}
+		if quoted.Total, err = quoted.Total.Sub(discount); err != nil {
+			return QuotedLine{}, err
+		}
+		quoted.Promotions = append(quoted.Promotions, PromotionDiscount{
+			PromotionID: promotion.ID,
+			Name:        promotion.Name,
+			Discount:    discount,
+		})
+
+		if promotion.Exclusive {
+			break
+		}
+	}
+
+	return quoted, nil
+}
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNewQuote(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	yesterday, tomorrow := now.Add(-24*time.Hour), now.Add(24*time.Hour)
+
+	peach := Produce{Name: "Peach", ProduceCode: "E5T6-9UI3-TH15-QR88", UnitPrice: NewMoney(299, USD), Category: "fruit"}
+	apple := Produce{Name: "Gala Apple", ProduceCode: "TQ4C-VV6T-75ZX-1RMR", UnitPrice: NewMoney(359, USD), Category: "fruit"}
+	grapes := Produce{Name: "Grapes", ProduceCode: "GRPE-72AS-K736-L4AR", UnitPrice: NewMoney(250, USD), UnitOfMeasure: Pound}
+
+	bogo := Promotion{ID: "bogo", Name: "buy 2 get 1 free", Kind: BuyGetFree, ProduceCode: peach.ProduceCode, BuyQuantity: NewQuantity(2), FreeQuantity: NewQuantity(1), StartsAt: yesterday}
+	peachesOff := Promotion{ID: "peaches", Name: "20% off peaches", Kind: PercentOff, ProduceCode: peach.ProduceCode, PercentOff: 2000, StartsAt: yesterday}
+	fruitOff := Promotion{ID: "fruit", Name: "10% off fruit", Kind: PercentOff, Category: "Fruit", PercentOff: 1000, StartsAt: yesterday}
+	grapesOff := Promotion{ID: "grapes", Name: "$1 off 3 lb", Kind: AmountOff, ProduceCode: grapes.ProduceCode, AmountOff: NewMoney(100, USD), MinQuantity: NewQuantity(3), StartsAt: yesterday}
+
+	withPriority := func(p Promotion, priority int) Promotion {
+		p.Priority = priority
+		return p
+	}
+	exclusive := func(p Promotion) Promotion {
+		p.Exclusive = true
+		return p
+	}
+
+	type line struct {
+		produce  Produce
+		quantity Quantity
+	}
+	tests := []struct {
+		name          string
+		lines         []line
+		promotions    []Promotion
+		wantDiscounts map[string]int64
+		wantTotal     int64
+	}{
+		{
+			name:      "no promotions",
+			lines:     []line{{peach, NewQuantity(3)}},
+			wantTotal: 897,
+		},
+		{
+			name:          "buy 2 get 1 free only counts complete sets",
+			lines:         []line{{peach, NewQuantity(5)}},
+			promotions:    []Promotion{bogo},
+			wantDiscounts: map[string]int64{"bogo": 299},
+			wantTotal:     1196,
+		},
+		{
+			name:          "percent off rounds half to even",
+			lines:         []line{{peach, NewQuantity(1)}},
+			promotions:    []Promotion{withPriority(fruitOff, 1), peachesOff},
+			wantDiscounts: map[string]int64{"fruit": 30, "peaches": 54},
+			wantTotal:     215,
+		},
+		{
+			name:          "amount off applies for every complete minimum quantity",
+			lines:         []line{{grapes, 6500}},
+			promotions:    []Promotion{grapesOff},
+			wantDiscounts: map[string]int64{"grapes": 200},
+			wantTotal:     1425,
+		},
+		{
+			name:          "category promotions apply to every produce in the category",
+			lines:         []line{{peach, NewQuantity(1)}, {apple, NewQuantity(1)}, {grapes, NewQuantity(1)}},
+			promotions:    []Promotion{fruitOff},
+			wantDiscounts: map[string]int64{"fruit": 66},
+			wantTotal:     842,
+		},
+		{
+			name:          "higher priority is applied first and later percentages apply to what is left",
+			lines:         []line{{peach, NewQuantity(3)}},
+			promotions:    []Promotion{peachesOff, withPriority(bogo, 10)},
+			wantDiscounts: map[string]int64{"bogo": 299, "peaches": 120},
+			wantTotal:     478,
+		},
+		{
+			name:          "equal priority is applied in id order",
+			lines:         []line{{peach, NewQuantity(3)}},
+			promotions:    []Promotion{peachesOff, bogo},
+			wantDiscounts: map[string]int64{"bogo": 299, "peaches": 120},
+			wantTotal:     478,
+		},
+		{
+			name:          "exclusive promotion applied first stops the rest",
+			lines:         []line{{peach, NewQuantity(3)}},
+			promotions:    []Promotion{exclusive(withPriority(peachesOff, 10)), bogo, fruitOff},
+			wantDiscounts: map[string]int64{"peaches": 179},
+			wantTotal:     718,
+		},
+		{
+			name:          "exclusive promotion is skipped once another has applied",
+			lines:         []line{{peach, NewQuantity(3)}},
+			promotions:    []Promotion{withPriority(bogo, 10), exclusive(peachesOff)},
+			wantDiscounts: map[string]int64{"bogo": 299},
+			wantTotal:     598,
+		},
+		{
+			name:          "exclusive promotion that gives nothing does not block others",
+			lines:         []line{{peach, NewQuantity(2)}},
+			promotions:    []Promotion{exclusive(withPriority(bogo, 10)), peachesOff},
+			wantDiscounts: map[string]int64{"peaches": 120},
+			wantTotal:     478,
+		},
+		{
+			name:  "discounts never take a line below zero",
+			lines: []line{{grapes, NewQuantity(1)}},
+			promotions: []Promotion{
+				{ID: "big", Name: "$5 off", Kind: AmountOff, ProduceCode: grapes.ProduceCode, AmountOff: NewMoney(500, USD), MinQuantity: NewQuantity(1), StartsAt: yesterday},
+				{ID: "more", Name: "10% off", Kind: PercentOff, ProduceCode: grapes.ProduceCode, PercentOff: 1000, StartsAt: yesterday},
+			},
+			wantDiscounts: map[string]int64{"big": 250},
+			wantTotal:     0,
+		},
+		{
+			name:  "promotions outside their window are ignored",
+			lines: []line{{peach, NewQuantity(1)}},
+			promotions: []Promotion{
+				{ID: "future", Name: "future", Kind: PercentOff, ProduceCode: peach.ProduceCode, PercentOff: 5000, StartsAt: tomorrow},
+				{ID: "ended", Name: "ended", Kind: PercentOff, ProduceCode: peach.ProduceCode, PercentOff: 5000, StartsAt: yesterday.Add(-time.Hour), EndsAt: &yesterday},
+				{ID: "ends-now", Name: "ends now", Kind: PercentOff, ProduceCode: peach.ProduceCode, PercentOff: 5000, StartsAt: yesterday, EndsAt: &now},
+			},
+			wantTotal: 299,
+		},
+		{
+			name:  "amounts off in another currency are ignored",
+			lines: []line{{grapes, NewQuantity(3)}},
+			promotions: []Promotion{
+				{ID: "euro", Name: "1 EUR off", Kind: AmountOff, ProduceCode: grapes.ProduceCode, AmountOff: NewMoney(100, "EUR"), MinQuantity: NewQuantity(1), StartsAt: yesterday},
+			},
+			wantTotal: 750,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []LineItem
+			for _, l := range tt.lines {
+				line, err := NewLineItem(l.produce, l.quantity)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines = append(lines, line)
+			}
+
+			// the order promotions are stored in never changes the quote
+			for _, promotions := range [][]Promotion{tt.promotions, reversePromotions(tt.promotions)} {
+				quote, err := NewQuote(lines, promotions, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := map[string]int64{}
+				for _, p := range quote.Promotions {
+					got[p.PromotionID] = p.Discount.MinorUnits()
+				}
+				if len(got) != len(tt.wantDiscounts) {
+					t.Errorf("unexpected promotions got %v want %v", got, tt.wantDiscounts)
+				}
+				for id, want := range tt.wantDiscounts {
+					if got[id] != want {
+						t.Errorf("unexpected discount from %s got %d want %d", id, got[id], want)
+					}
+				}
+
+				if want := NewMoney(tt.wantTotal, USD); quote.Total != want {
+					t.Errorf("unexpected total got %v want %v", quote.Total, want)
+				}
+			}
+		})
+	}
+}
+
+func reversePromotions(promotions []Promotion) []Promotion {
+	reversed := make([]Promotion, len(promotions))
+	for i, p := range promotions {
+		reversed[len(promotions)-1-i] = p
+	}
+	return reversed
+}
+
+func TestPromotionValidate(t *testing.T) {
+	start := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	valid := Promotion{Name: "20% off", Kind: PercentOff, ProduceCode: "E5T6-9UI3-TH15-QR88", PercentOff: 2000, StartsAt: start}
+
+	tests := []struct {
+		name    string
+		change  func(p *Promotion)
+		wantErr bool
+	}{
+		{name: "valid", change: func(p *Promotion) {}},
+		{name: "missing name", change: func(p *Promotion) { p.Name = "" }, wantErr: true},
+		{name: "no target", change: func(p *Promotion) { p.ProduceCode = "" }, wantErr: true},
+		{name: "two targets", change: func(p *Promotion) { p.Category = "fruit" }, wantErr: true},
+		{name: "missing start", change: func(p *Promotion) { p.StartsAt = time.Time{} }, wantErr: true},
+		{name: "ends before it starts", change: func(p *Promotion) { end := start.Add(-time.Hour); p.EndsAt = &end }, wantErr: true},
+		{name: "more than 100 percent off", change: func(p *Promotion) { p.PercentOff = 10001 }, wantErr: true},
+		{name: "unknown kind", change: func(p *Promotion) { p.Kind = "halfPrice" }, wantErr: true},
+		{name: "buy get free without free quantity", change: func(p *Promotion) { p.Kind = BuyGetFree; p.BuyQuantity = NewQuantity(2) }, wantErr: true},
+		{name: "amount off without minimum", change: func(p *Promotion) { p.Kind = AmountOff; p.AmountOff = NewMoney(100, USD) }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.change(&p)
+			if err := p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPromotionJSON(t *testing.T) {
+	in := `{"id":"x","name":"$1 off 3 lb","kind":"amountOff","produceCode":"E5T6-9UI3-TH15-QR88","minQuantity":3,"priority":0,"exclusive":false,"startsAt":"2020-06-01T00:00:00Z","amountOff":{"amount":"1.00","currency":"USD"}}`
+
+	p := Promotion{}
+	if err := json.Unmarshal([]byte(in), &p); err != nil {
+		t.Fatal(err)
+	}
+	if want := NewMoney(100, USD); p.AmountOff.Cmp(want) != 0 || p.AmountOff.Currency() != USD {
+		t.Errorf("unexpected amount off got %v want %v", p.AmountOff, want)
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != in {
+		t.Errorf("json = %s, want %s", b, in)
+	}
+}
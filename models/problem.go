@@ -0,0 +1,117 @@
+package models
+
+import "strings"
+
+// ProblemTypePrefix starts the type URI of every problem returned by the API
+const ProblemTypePrefix = "urn:supermarket:problem:"
+
+// The types of problem returned by the API
+const (
+	ProblemMalformedBody     = ProblemTypePrefix + "malformed-body"
+	ProblemInvalidRequest    = ProblemTypePrefix + "invalid-request"
+	ProblemNotFound          = ProblemTypePrefix + "not-found"
+	ProblemConflict          = ProblemTypePrefix + "conflict"
+	ProblemInsufficientStock = ProblemTypePrefix + "insufficient-stock"
+	// ProblemPreconditionFailed is a conditional write to a resource that changed since it was read
+	ProblemPreconditionFailed = ProblemTypePrefix + "precondition-failed"
+	// ProblemNotAcceptable is a request for a representation the API cannot produce
+	ProblemNotAcceptable = ProblemTypePrefix + "not-acceptable"
+	// ProblemUnsupportedMediaType is a request body in a format the API does not read
+	ProblemUnsupportedMediaType = ProblemTypePrefix + "unsupported-media-type"
+	// ProblemIdempotencyKeyReused is an Idempotency-Key sent again with a different request
+	ProblemIdempotencyKeyReused = ProblemTypePrefix + "idempotency-key-reused"
+	// ProblemRequestTooLarge is a request body larger than the API reads
+	ProblemRequestTooLarge = ProblemTypePrefix + "request-too-large"
+	// ProblemMethodNotAllowed is a request with a method the resource does not support
+	ProblemMethodNotAllowed = ProblemTypePrefix + "method-not-allowed"
+	// ProblemUnauthorized is a request without a valid API key
+	ProblemUnauthorized = ProblemTypePrefix + "unauthorized"
+	// ProblemForbidden is a request the role of its API key does not allow
+	ProblemForbidden = ProblemTypePrefix + "forbidden"
+	// ProblemUnavailable is a request the API cannot handle right now but may if it is retried
+	ProblemUnavailable = ProblemTypePrefix + "unavailable"
+	ProblemInternal    = ProblemTypePrefix + "internal-error"
+)
+
+// The machine readable reasons a field or a produce in a bulk create, delete or import was rejected
+const (
+	ReasonInvalidValue      = "invalid_value"
+	ReasonRequired          = "required"
+	ReasonImmutable         = "immutable"
+	ReasonDuplicateCode     = "duplicate_code"
+	ReasonInvalidCodeFormat = "invalid_code_format"
+	ReasonInvalidName       = "invalid_name"
+	ReasonInvalidCategory   = "invalid_category"
+	ReasonInvalidPrice      = "invalid_price"
+	ReasonInvalidStock      = "invalid_stock"
+	ReasonNotFound          = "not_found"
+	ReasonChanged           = "changed"
+	ReasonMalformedRow      = "malformed_row"
+	ReasonInternal          = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details object describing why a request failed
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+	// RequestID is the id of the request the problem is of, as logged by the daemon
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// FieldError names a field of a request with an invalid value and why it is invalid
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
+
+// Error returns the detail of the problem, or its title when there is no detail
+func (p Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// FieldErrors is an error listing every field of a request with an invalid value
+type FieldErrors []FieldError
+
+// Error joins the detail of every field error
+func (e FieldErrors) Error() string {
+	details := make([]string, len(e))
+	for i, fieldError := range e {
+		details[i] = fieldError.Detail
+	}
+	return strings.Join(details, "; ")
+}
+
+// FailedProduce is a produce that could not be created or deleted and the machine readable reason why
+type FailedProduce struct {
+	Produce
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// NewFailedProduce returns a produce that could not be created or deleted for a reason described by err
+func NewFailedProduce(produce Produce, reason string, err error) FailedProduce {
+	failed := FailedProduce{Produce: produce, Reason: reason}
+	if err != nil {
+		failed.Detail = err.Error()
+	}
+	return failed
+}
+
+// FailedProduceV2 is the version 2 wire representation of FailedProduce
+type FailedProduceV2 struct {
+	ProduceV2
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// V2 converts the failed produce to its version 2 wire representation
+func (f FailedProduce) V2() FailedProduceV2 {
+	return FailedProduceV2{ProduceV2: f.Produce.V2(), Reason: f.Reason, Detail: f.Detail}
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestFailedProduceJSON(t *testing.T) {
+	failed := NewFailedProduce(Produce{Name: "Peach", ProduceCode: "E5T6-9UI3-TH15-QR88", UnitPrice: NewMoney(299, USD)}, ReasonDuplicateCode, errors.New("produce already exists"))
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{name: "version 1", v: failed, want: `{"name":"Peach","produceCode":"E5T6-9UI3-TH15-QR88","unitPrice":2.99,"reason":"duplicate_code","detail":"produce already exists"}`},
+		{name: "version 2", v: failed.V2(), want: `{"name":"Peach","produceCode":"E5T6-9UI3-TH15-QR88","unitPrice":{"amount":"2.99","currency":"USD"},"reason":"duplicate_code","detail":"produce already exists"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("json.Marshal() = %s, want %s", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldErrorsError(t *testing.T) {
+	err := FieldErrors{
+		{Field: "limit", Reason: ReasonInvalidValue, Detail: "limit must be a whole number of at least 1"},
+		{Field: "offset", Reason: ReasonInvalidValue, Detail: "offset must be a whole number of at least 0"},
+	}
+
+	want := "limit must be a whole number of at least 1; offset must be a whole number of at least 0"
+	if got := err.Error(); got != want {
+		t.Errorf("FieldErrors.Error() = %q, want %q", got, want)
+	}
+}
@@ -1,12 +1,117 @@
 package models
 
+import "time"
+
 type Produce struct {
-	Name        string  `json:"name"`
-	ProduceCode string  `json:"produceCode"`
-	UnitPrice   float64 `json:"unitPrice"`
+	Name        string `json:"name"`
+	ProduceCode string `json:"produceCode"`
+	UnitPrice   Money  `json:"unitPrice"`
+	Category    string `json:"category,omitempty"`
+
+	// stock is only written once it has been set so produce without stock keeps its original representation
+	OnHand           Quantity      `json:"onHand,omitempty"`
+	Reserved         Quantity      `json:"reserved,omitempty"`
+	UnitOfMeasure    UnitOfMeasure `json:"unitOfMeasure,omitempty"`
+	ReorderThreshold Quantity      `json:"reorderThreshold,omitempty"`
+
+	// Version counts every change to the produce, including stock changes, and
+	// UpdatedAt is when the last one was made. They are sent in the ETag and
+	// Last-Modified headers rather than in the representation.
+	Version   int64     `json:"-"`
+	UpdatedAt time.Time `json:"-"`
 }
 
 type CreateProduceResponse struct {
-	Created []Produce `json:"created"`
-	Invalid []Produce `json:"createFailed"`
+	Created []Produce       `json:"created"`
+	Invalid []FailedProduce `json:"createFailed"`
+}
+
+// DeleteProduceResponse lists the produce a bulk delete removed, or would
+// remove in a dry run, and the produce it could not remove
+type DeleteProduceResponse struct {
+	Deleted []Produce       `json:"deleted"`
+	Invalid []FailedProduce `json:"deleteFailed"`
+	DryRun  bool            `json:"dryRun,omitempty"`
+	// Confirm is returned by a dry run of a delete by filter and must be sent
+	// with the delete to remove the produce the dry run listed
+	Confirm string `json:"confirm,omitempty"`
+}
+
+// ProduceV2 is the version 2 wire representation of Produce. It only differs
+// from version 1 in writing the unit price as an amount and currency.
+type ProduceV2 struct {
+	Produce
+	UnitPrice MoneyV2 `json:"unitPrice"`
+}
+
+// CreateProduceResponseV2 is the version 2 wire representation of CreateProduceResponse
+type CreateProduceResponseV2 struct {
+	Created []ProduceV2       `json:"created"`
+	Invalid []FailedProduceV2 `json:"createFailed"`
+}
+
+// DeleteProduceResponseV2 is the version 2 wire representation of DeleteProduceResponse
+type DeleteProduceResponseV2 struct {
+	Deleted []ProduceV2       `json:"deleted"`
+	Invalid []FailedProduceV2 `json:"deleteFailed"`
+	DryRun  bool              `json:"dryRun,omitempty"`
+	Confirm string            `json:"confirm,omitempty"`
+}
+
+// V2 converts the produce to its version 2 wire representation
+func (p Produce) V2() ProduceV2 {
+	return ProduceV2{
+		Produce:   p,
+		UnitPrice: MoneyV2(p.UnitPrice),
+	}
+}
+
+// V1 converts the produce from its version 2 wire representation
+func (p ProduceV2) V1() Produce {
+	produce := p.Produce
+	produce.UnitPrice = Money(p.UnitPrice)
+	return produce
+}
+
+// ProduceListV2 converts a list of produce to the version 2 wire representation
+func ProduceListV2(produce []Produce) []ProduceV2 {
+	if produce == nil {
+		return nil
+	}
+
+	v2 := make([]ProduceV2, len(produce))
+	for i, p := range produce {
+		v2[i] = p.V2()
+	}
+	return v2
+}
+
+// V2 converts the response to its version 2 wire representation
+func (c CreateProduceResponse) V2() CreateProduceResponseV2 {
+	return CreateProduceResponseV2{
+		Created: ProduceListV2(c.Created),
+		Invalid: failedProduceListV2(c.Invalid),
+	}
+}
+
+// V2 converts the response to its version 2 wire representation
+func (d DeleteProduceResponse) V2() DeleteProduceResponseV2 {
+	return DeleteProduceResponseV2{
+		Deleted: ProduceListV2(d.Deleted),
+		Invalid: failedProduceListV2(d.Invalid),
+		DryRun:  d.DryRun,
+		Confirm: d.Confirm,
+	}
+}
+
+func failedProduceListV2(failed []FailedProduce) []FailedProduceV2 {
+	if failed == nil {
+		return nil
+	}
+
+	v2 := make([]FailedProduceV2, len(failed))
+	for i, f := range failed {
+		v2[i] = f.V2()
+	}
+	return v2
 }
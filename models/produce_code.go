@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// produceCodeFormat is four groups of four letters or digits, e.g. A12T-4GH7-QPL9-3N4M
+var produceCodeFormat = regexp.MustCompile(`^[a-zA-Z0-9]{4}(-[a-zA-Z0-9]{4}){3}$`)
+
+// ProduceCode is a produce code in its canonical upper case form. Produce is
+// stored and looked up by its canonical produce code so clients can give a
+// produce code in any case.
+type ProduceCode string
+
+// InvalidProduceCodeError is returned for a produce code that is not four
+// groups of four letters or digits separated by dashes
+type InvalidProduceCodeError struct {
+	Code string
+}
+
+func (e InvalidProduceCodeError) Error() string {
+	return fmt.Sprintf("invalid produce code %q, must be four groups of four letters or digits such as A12T-4GH7-QPL9-3N4M", e.Code)
+}
+
+// ParseProduceCode validates a produce code given in any case and returns its canonical form
+func ParseProduceCode(code string) (ProduceCode, error) {
+	if !produceCodeFormat.MatchString(code) {
+		return "", InvalidProduceCodeError{Code: code}
+	}
+	return ProduceCode(strings.ToUpper(code)), nil
+}
+
+// MustParseProduceCode is like ParseProduceCode but panics if the produce code
+// is invalid. It is meant for constants and tests.
+func MustParseProduceCode(code string) ProduceCode {
+	produceCode, err := ParseProduceCode(code)
+	if err != nil {
+		panic(err)
+	}
+	return produceCode
+}
+
+func (c ProduceCode) String() string {
+	return string(c)
+}
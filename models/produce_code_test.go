@@ -0,0 +1,34 @@
+package models
+
+import "testing"
+
+func TestParseProduceCode(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    ProduceCode
+		wantErr bool
+	}{
+		{code: "A12T-4GH7-QPL9-3N4M", want: "A12T-4GH7-QPL9-3N4M"},
+		{code: "a12t-4gh7-qpl9-3n4m", want: "A12T-4GH7-QPL9-3N4M"},
+		{code: "a12T-4Gh7-QpL9-3n4M", want: "A12T-4GH7-QPL9-3N4M"},
+		{code: "", wantErr: true},
+		{code: "A12T-4GH7-QPL9", wantErr: true},
+		{code: "A12T-4GH7-QPL9-3N4M-", wantErr: true},
+		{code: " A12T-4GH7-QPL9-3N4M", wantErr: true},
+		{code: "A12T_4GH7_QPL9_3N4M", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseProduceCode(tt.code)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseProduceCode(%q) error = %v, wantErr %v", tt.code, err, tt.wantErr)
+			continue
+		}
+		if _, ok := err.(InvalidProduceCodeError); err != nil && !ok {
+			t.Errorf("ParseProduceCode(%q) returned error of type %T", tt.code, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseProduceCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// percentScale is how many decimal places a Percent holds
+const percentScale = 2
+
+// Percent is an exact percentage held in hundredths of a percent, e.g. 2050 is 20.5%
+type Percent int64
+
+// ParsePercent parses a decimal percentage such as "20" or "12.5" with at most two decimal places
+func ParsePercent(s string) (Percent, error) {
+	value, scale, err := parseDecimal(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+
+	if scale > percentScale {
+		return 0, fmt.Errorf("percentage %q has more than %d decimal places", s, percentScale)
+	}
+
+	value, ok := rescale(value, scale, percentScale)
+	if !ok {
+		return 0, ErrAmountOutOfRange
+	}
+
+	return Percent(value), nil
+}
+
+// String formats the percentage as a plain decimal without a percent sign, e.g. "12.5"
+func (p Percent) String() string {
+	return formatDecimal(int64(p), percentScale, true)
+}
+
+// MarshalJSON writes the percentage as a JSON number
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON reads the percentage from a JSON number
+func (p *Percent) UnmarshalJSON(b []byte) error {
+	parsed, err := ParsePercent(string(b))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// PromotionKind is the rule a promotion uses to discount a line
+type PromotionKind string
+
+const (
+	// BuyGetFree gives FreeQuantity away for every BuyQuantity bought, e.g. buy 2 get 1 free
+	BuyGetFree PromotionKind = "buyGetFree"
+
+	// PercentOff takes PercentOff percent off the line, e.g. 20% off peaches
+	PercentOff PromotionKind = "percentOff"
+
+	// AmountOff takes AmountOff off the line for every MinQuantity bought, e.g. $1 off when you buy 3 lb
+	AmountOff PromotionKind = "amountOff"
+)
+
+// Promotion is a discount on a produce, or every produce in a category, while it is valid
+type Promotion struct {
+	ID   string        `json:"id"`
+	Name string        `json:"name"`
+	Kind PromotionKind `json:"kind"`
+
+	// exactly one target is set
+	ProduceCode string `json:"produceCode,omitempty"`
+	Category    string `json:"category,omitempty"`
+
+	BuyQuantity  Quantity `json:"buyQuantity,omitempty"`
+	FreeQuantity Quantity `json:"freeQuantity,omitempty"`
+	PercentOff   Percent  `json:"percentOff,omitempty"`
+	AmountOff    Money    `json:"amountOff"`
+	MinQuantity  Quantity `json:"minQuantity,omitempty"`
+
+	// Priority orders the promotions applied to a line, highest first. An
+	// exclusive promotion is never combined with any other promotion.
+	Priority  int  `json:"priority"`
+	Exclusive bool `json:"exclusive"`
+
+	// the promotion is valid from StartsAt until just before EndsAt, or forever without an EndsAt
+	StartsAt time.Time  `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+}
+
+// MarshalJSON writes the amount off in the version 2 money representation so
+// its currency is never lost. It is left out for other kinds of promotion.
+func (p Promotion) MarshalJSON() ([]byte, error) {
+	type promotion Promotion
+	var amountOff *MoneyV2
+	if p.Kind == AmountOff {
+		v2 := MoneyV2(p.AmountOff)
+		amountOff = &v2
+	}
+
+	return json.Marshal(struct {
+		promotion
+		AmountOff *MoneyV2 `json:"amountOff,omitempty"`
+	}{
+		promotion: promotion(p),
+		AmountOff: amountOff,
+	})
+}
+
+// Validate checks the promotion has a target, a valid window and the fields its kind needs
+func (p Promotion) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("promotion name is required")
+	}
+
+	if (p.ProduceCode == "") == (p.Category == "") {
+		return errors.New("promotion must target exactly one of a produceCode or a category")
+	}
+
+	if p.StartsAt.IsZero() {
+		return errors.New("promotion startsAt is required")
+	}
+	if p.EndsAt != nil && !p.EndsAt.After(p.StartsAt) {
+		return errors.New("promotion endsAt must be after startsAt")
+	}
+
+	switch p.Kind {
+	case BuyGetFree:
+		if p.BuyQuantity <= 0 || p.FreeQuantity <= 0 {
+			return errors.New("buyGetFree promotions need a buyQuantity and freeQuantity greater than zero")
+		}
+	case PercentOff:
+		if p.PercentOff <= 0 || p.PercentOff > 100*Percent(pow10(percentScale)) {
+			return errors.New("percentOff must be greater than 0 and at most 100")
+		}
+	case AmountOff:
+		if p.AmountOff.Sign() <= 0 {
+			return errors.New("amountOff promotions need an amountOff greater than zero")
+		}
+		if p.MinQuantity <= 0 {
+			return errors.New("amountOff promotions need a minQuantity greater than zero")
+		}
+	default:
+		return fmt.Errorf("unknown promotion kind %q, must be %s, %s or %s", p.Kind, BuyGetFree, PercentOff, AmountOff)
+	}
+
+	return nil
+}
+
+// ActiveAt reports whether the promotion is valid at a moment in time
+func (p Promotion) ActiveAt(t time.Time) bool {
+	if t.Before(p.StartsAt) {
+		return false
+	}
+	return p.EndsAt == nil || t.Before(*p.EndsAt)
+}
+
+// Targets reports whether the promotion applies to a line
+func (p Promotion) Targets(line LineItem) bool {
+	if p.ProduceCode != "" {
+		return strings.EqualFold(p.ProduceCode, line.ProduceCode)
+	}
+	return line.Category != "" && strings.EqualFold(p.Category, line.Category)
+}
+
+// discount returns the discount the promotion gives on a line before it is
+// capped at what is left of the line total
+func (p Promotion) discount(line LineItem, remaining Money) (Money, error) {
+	switch p.Kind {
+	case BuyGetFree:
+		sets := line.Quantity / (p.BuyQuantity + p.FreeQuantity)
+		discount, err := line.UnitPrice.MulQuantity(sets * p.FreeQuantity)
+		if err != nil {
+			return Money{}, err
+		}
+		return discount.Round(RoundHalfEven)
+	case PercentOff:
+		discount, err := remaining.mul(int64(p.PercentOff), percentScale+2)
+		if err != nil {
+			return Money{}, err
+		}
+		return discount.Round(RoundHalfEven)
+	case AmountOff:
+		if p.AmountOff.Currency() != line.UnitPrice.Currency() {
+			return NewMoney(0, line.UnitPrice.Currency()), nil
+		}
+		discount, err := p.AmountOff.mul(int64(line.Quantity/p.MinQuantity), 0)
+		if err != nil {
+			return Money{}, err
+		}
+		return discount.Round(RoundHalfEven)
+	}
+	return NewMoney(0, line.UnitPrice.Currency()), nil
+}
+
+// lessPromotion orders promotions by priority, highest first, and then by id so
+// the order promotions are applied in never depends on how they were stored
+func lessPromotion(a, b Promotion) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.ID < b.ID
+}
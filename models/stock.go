@@ -0,0 +1,243 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// quantityScale is how many decimal places a Quantity holds
+const quantityScale = 3
+
+var (
+	// ErrInsufficientStock is returned when a stock change would take the stock available below zero
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrInsufficientReserved is returned when more stock is released than is reserved
+	ErrInsufficientReserved = errors.New("cannot release more stock than is reserved")
+
+	// ErrFractionalQuantity is returned when a fraction of a produce sold each is changed
+	ErrFractionalQuantity = errors.New("quantity must be a whole number for produce sold each")
+
+	// ErrQuantityOutOfRange is returned when a stock change would take the stock beyond the largest quantity that can be held
+	ErrQuantityOutOfRange = errors.New("stock change would take the stock beyond the largest quantity that can be held")
+)
+
+// Quantity is an exact amount of stock held in thousandths of its unit of measure
+type Quantity int64
+
+// NewQuantity returns a quantity of whole units
+func NewQuantity(units int64) Quantity {
+	return Quantity(units * 1000)
+}
+
+// ParseQuantity parses a decimal string such as "2.5" with at most three decimal places
+func ParseQuantity(s string) (Quantity, error) {
+	value, scale, err := parseDecimal(s)
+	if err == errInvalidDecimal {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if scale > quantityScale {
+		return 0, fmt.Errorf("quantity %q has more than %d decimal places", s, quantityScale)
+	}
+
+	value, ok := rescale(value, scale, quantityScale)
+	if !ok {
+		return 0, ErrAmountOutOfRange
+	}
+
+	return Quantity(value), nil
+}
+
+// Add returns the sum of two quantities, or false when it overflows
+func (q Quantity) Add(other Quantity) (Quantity, bool) {
+	sum := q + other
+	if (other > 0 && sum < q) || (other < 0 && sum > q) {
+		return 0, false
+	}
+	return sum, true
+}
+
+// IsWhole reports whether the quantity is a whole number of units
+func (q Quantity) IsWhole() bool {
+	return q%1000 == 0
+}
+
+// String formats the quantity as a plain decimal, e.g. "2.5"
+func (q Quantity) String() string {
+	return formatDecimal(int64(q), quantityScale, true)
+}
+
+// MarshalJSON writes the quantity as a JSON number
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalJSON reads the quantity from a JSON number
+func (q *Quantity) UnmarshalJSON(b []byte) error {
+	parsed, err := ParseQuantity(strings.TrimSpace(string(b)))
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
+
+// UnitOfMeasure is the unit stock of a produce is counted in
+type UnitOfMeasure string
+
+const (
+	// Each counts stock in whole items. It is the unit of measure of produce that does not set one.
+	Each UnitOfMeasure = "each"
+
+	// Pound counts stock by weight in pounds
+	Pound UnitOfMeasure = "lb"
+
+	// Kilogram counts stock by weight in kilograms
+	Kilogram UnitOfMeasure = "kg"
+)
+
+// OrDefault returns the unit of measure, or Each when none is set
+func (u UnitOfMeasure) OrDefault() UnitOfMeasure {
+	if u == "" {
+		return Each
+	}
+	return u
+}
+
+// Validate reports whether the unit of measure is supported
+func (u UnitOfMeasure) Validate() error {
+	switch u.OrDefault() {
+	case Each, Pound, Kilogram:
+		return nil
+	default:
+		return fmt.Errorf("unknown unit of measure %q, must be %s, %s or %s", u, Each, Pound, Kilogram)
+	}
+}
+
+// Available returns the stock on hand that has not been reserved
+func (p Produce) Available() Quantity {
+	return p.OnHand - p.Reserved
+}
+
+// IsLowStock reports whether the stock available has fallen below the reorder threshold
+func (p Produce) IsLowStock() bool {
+	return p.ReorderThreshold > 0 && p.Available() < p.ReorderThreshold
+}
+
+// ValidateStock checks the stock fields of a produce
+func (p Produce) ValidateStock() error {
+	if err := p.UnitOfMeasure.Validate(); err != nil {
+		return err
+	}
+
+	quantities := []struct {
+		name     string
+		quantity Quantity
+	}{
+		{"onHand", p.OnHand},
+		{"reserved", p.Reserved},
+		{"reorderThreshold", p.ReorderThreshold},
+	}
+	for _, q := range quantities {
+		if q.quantity < 0 {
+			return fmt.Errorf("%s cannot be negative", q.name)
+		}
+		if p.UnitOfMeasure.OrDefault() == Each && !q.quantity.IsWhole() {
+			return fmt.Errorf("%s must be a whole number for produce sold each", q.name)
+		}
+	}
+
+	if p.Available() < 0 {
+		return ErrInsufficientStock
+	}
+
+	return nil
+}
+
+// StockOperation is a kind of change to the stock of a produce
+type StockOperation string
+
+const (
+	// StockReceive adds delivered stock to the stock on hand
+	StockReceive StockOperation = "receive"
+
+	// StockAdjust corrects the stock on hand by a signed amount, e.g. after a count or for shrinkage
+	StockAdjust StockOperation = "adjust"
+
+	// StockReserve sets stock on hand aside so it is no longer available
+	StockReserve StockOperation = "reserve"
+
+	// StockRelease returns reserved stock to the stock available
+	StockRelease StockOperation = "release"
+)
+
+// StockChange is a request to change the stock of a produce
+type StockChange struct {
+	Operation StockOperation `json:"-"`
+	Quantity  Quantity       `json:"quantity"`
+}
+
+// Validate checks the quantity is allowed for the operation
+func (c StockChange) Validate() error {
+	switch c.Operation {
+	case StockReceive, StockReserve, StockRelease:
+		if c.Quantity <= 0 {
+			return fmt.Errorf("quantity to %s must be greater than zero", c.Operation)
+		}
+	case StockAdjust:
+		if c.Quantity == 0 {
+			return errors.New("quantity to adjust cannot be zero")
+		}
+	default:
+		return fmt.Errorf("unknown stock operation %q", c.Operation)
+	}
+	return nil
+}
+
+// AvailableDelta returns how much the change moves the stock available
+func (c StockChange) AvailableDelta() Quantity {
+	if c.Operation == StockReserve {
+		return -c.Quantity
+	}
+	return c.Quantity
+}
+
+// ApplyStockChange returns the produce with the stock change applied. A change
+// that would leave the stock on hand, reserved or available below zero is refused.
+func (p Produce) ApplyStockChange(c StockChange) (Produce, error) {
+	if err := c.Validate(); err != nil {
+		return Produce{}, err
+	}
+
+	if p.UnitOfMeasure.OrDefault() == Each && !c.Quantity.IsWhole() {
+		return Produce{}, ErrFractionalQuantity
+	}
+
+	var ok bool
+	switch c.Operation {
+	case StockReceive, StockAdjust:
+		if p.OnHand, ok = p.OnHand.Add(c.Quantity); !ok {
+			return Produce{}, ErrQuantityOutOfRange
+		}
+	case StockReserve:
+		if p.Reserved, ok = p.Reserved.Add(c.Quantity); !ok {
+			return Produce{}, ErrQuantityOutOfRange
+		}
+	case StockRelease:
+		if c.Quantity > p.Reserved {
+			return Produce{}, ErrInsufficientReserved
+		}
+		p.Reserved -= c.Quantity
+	}
+
+	if p.OnHand < 0 || p.Available() < 0 {
+		return Produce{}, ErrInsufficientStock
+	}
+
+	return p, nil
+}
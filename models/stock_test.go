@@ -0,0 +1,176 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Quantity
+		wantErr bool
+	}{
+		{in: "12", want: NewQuantity(12)},
+		{in: "2.5", want: 2500},
+		{in: "0.125", want: 125},
+		{in: "-1.5", want: -1500},
+		{in: "0.0001", wantErr: true},
+		{in: "lots", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseQuantity(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuantity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseQuantity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityJSON(t *testing.T) {
+	for _, in := range []string{`12`, `2.5`, `0.125`, `-3`} {
+		q := Quantity(0)
+		if err := json.Unmarshal([]byte(in), &q); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != in {
+			t.Errorf("json = %s, want %s", b, in)
+		}
+	}
+}
+
+func TestApplyStockChange(t *testing.T) {
+	stocked := Produce{OnHand: NewQuantity(10), Reserved: NewQuantity(4)}
+	weighed := Produce{OnHand: 2500, UnitOfMeasure: Kilogram}
+
+	tests := []struct {
+		name    string
+		produce Produce
+		change  StockChange
+		want    Produce
+		wantErr bool
+	}{
+		{
+			name:    "receive",
+			produce: stocked,
+			change:  StockChange{Operation: StockReceive, Quantity: NewQuantity(5)},
+			want:    Produce{OnHand: NewQuantity(15), Reserved: NewQuantity(4)},
+		},
+		{
+			name:    "adjust down",
+			produce: stocked,
+			change:  StockChange{Operation: StockAdjust, Quantity: NewQuantity(-6)},
+			want:    Produce{OnHand: NewQuantity(4), Reserved: NewQuantity(4)},
+		},
+		{
+			name:    "adjust below reserved",
+			produce: stocked,
+			change:  StockChange{Operation: StockAdjust, Quantity: NewQuantity(-7)},
+			wantErr: true,
+		},
+		{
+			name:    "reserve everything available",
+			produce: stocked,
+			change:  StockChange{Operation: StockReserve, Quantity: NewQuantity(6)},
+			want:    Produce{OnHand: NewQuantity(10), Reserved: NewQuantity(10)},
+		},
+		{
+			name:    "reserve more than available",
+			produce: stocked,
+			change:  StockChange{Operation: StockReserve, Quantity: NewQuantity(7)},
+			wantErr: true,
+		},
+		{
+			name:    "release",
+			produce: stocked,
+			change:  StockChange{Operation: StockRelease, Quantity: NewQuantity(4)},
+			want:    Produce{OnHand: NewQuantity(10)},
+		},
+		{
+			name:    "release more than reserved",
+			produce: stocked,
+			change:  StockChange{Operation: StockRelease, Quantity: NewQuantity(5)},
+			wantErr: true,
+		},
+		{
+			name:    "fraction of produce sold each",
+			produce: stocked,
+			change:  StockChange{Operation: StockReceive, Quantity: 500},
+			wantErr: true,
+		},
+		{
+			name:    "fraction of produce sold by weight",
+			produce: weighed,
+			change:  StockChange{Operation: StockReserve, Quantity: 1250},
+			want:    Produce{OnHand: 2500, Reserved: 1250, UnitOfMeasure: Kilogram},
+		},
+		{
+			name:    "receive beyond the largest quantity",
+			produce: Produce{OnHand: NewQuantity(1)},
+			change:  StockChange{Operation: StockReceive, Quantity: math.MaxInt64 - 807},
+			wantErr: true,
+		},
+		{
+			name:    "reserve beyond the largest quantity",
+			produce: Produce{OnHand: math.MaxInt64 - 807, Reserved: NewQuantity(1)},
+			change:  StockChange{Operation: StockReserve, Quantity: math.MaxInt64 - 807},
+			wantErr: true,
+		},
+		{
+			name:    "receive up to the largest quantity",
+			produce: Produce{OnHand: NewQuantity(1)},
+			change:  StockChange{Operation: StockReceive, Quantity: math.MaxInt64 - 1807},
+			want:    Produce{OnHand: math.MaxInt64 - 807},
+		},
+		{
+			name:    "zero receive",
+			produce: stocked,
+			change:  StockChange{Operation: StockReceive},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.produce.ApplyStockChange(tt.change)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyStockChange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyStockChange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStock(t *testing.T) {
+	tests := []struct {
+		name    string
+		produce Produce
+		wantErr bool
+	}{
+		{name: "no stock", produce: Produce{}},
+		{name: "whole stock", produce: Produce{OnHand: NewQuantity(3), ReorderThreshold: NewQuantity(1)}},
+		{name: "fractional stock by weight", produce: Produce{OnHand: 1500, UnitOfMeasure: Pound}},
+		{name: "fractional stock each", produce: Produce{OnHand: 1500}, wantErr: true},
+		{name: "negative on hand", produce: Produce{OnHand: NewQuantity(-1)}, wantErr: true},
+		{name: "unknown unit of measure", produce: Produce{UnitOfMeasure: "bushel"}, wantErr: true},
+		{name: "reserved more than on hand", produce: Produce{OnHand: NewQuantity(1), Reserved: NewQuantity(2)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.produce.ValidateStock(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateStock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
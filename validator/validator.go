@@ -0,0 +1,182 @@
+// Package validator checks produce against the rules of a deployment. The
+// daemon validates every produce it creates, replaces or imports with it and
+// the CLI runs the same rules so it can refuse invalid produce before sending it.
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+// DefaultMaxNameLength is the most characters a name or category may have by default
+const DefaultMaxNameLength = 100
+
+var (
+	// name starts with a letter or digit, which may be followed by letters,
+	// digits, spaces and common punctuation such as in "Granny Smith's (organic)"
+	name = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{M}\p{N} '&.,()/+-]*$`)
+)
+
+// PriceRange is the inclusive bounds of unit prices in a currency
+type PriceRange struct {
+	Min models.Money
+	Max models.Money
+}
+
+// Rules are the limits produce must meet. They can be changed per deployment.
+type Rules struct {
+	// MaxNameLength is the most characters a name or category may have
+	MaxNameLength int
+	// UnitPrices are the bounds of unit prices by currency. A unit price in a
+	// currency without bounds is refused.
+	UnitPrices map[string]PriceRange
+}
+
+// DefaultRules returns the rules used unless a deployment changes them
+func DefaultRules() Rules {
+	return Rules{
+		MaxNameLength: DefaultMaxNameLength,
+		UnitPrices: map[string]PriceRange{
+			models.DefaultCurrency: {
+				Min: models.NewMoney(0, models.DefaultCurrency),
+				Max: models.NewMoney(10000000, models.DefaultCurrency),
+			},
+		},
+	}
+}
+
+// Currencies returns the currencies unit prices may be in, sorted
+func (r Rules) Currencies() []string {
+	currencies := make([]string, 0, len(r.UnitPrices))
+	for currency := range r.UnitPrices {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// Check reports whether the rules can be met by any produce
+func (r Rules) Check() error {
+	if r.MaxNameLength < 1 {
+		return fmt.Errorf("max name length must be at least 1 got %d", r.MaxNameLength)
+	}
+	if len(r.UnitPrices) == 0 {
+		return fmt.Errorf("unit prices must be allowed in at least one currency")
+	}
+	for _, currency := range r.Currencies() {
+		bounds := r.UnitPrices[currency]
+		if bounds.Min.Currency() != currency || bounds.Max.Currency() != currency {
+			return fmt.Errorf("min and max unit price of %s must be in %s got %s and %s", currency, currency, bounds.Min.Currency(), bounds.Max.Currency())
+		}
+		if bounds.Min.Sign() < 0 {
+			return fmt.Errorf("min unit price cannot be negative got %s %s", bounds.Min, currency)
+		}
+		if bounds.Min.Cmp(bounds.Max) > 0 {
+			return fmt.Errorf("min unit price %s is greater than max unit price %s %s", bounds.Min, bounds.Max, currency)
+		}
+	}
+	return nil
+}
+
+// Validator checks produce against a set of rules
+type Validator struct {
+	rules Rules
+}
+
+// New returns a Validator running the rules
+func New(rules Rules) *Validator {
+	return &Validator{rules: rules}
+}
+
+// Rules returns the rules the validator runs
+func (v *Validator) Rules() Rules {
+	return v.rules
+}
+
+// IsValidProduceCode reports whether a produce code is four groups of four
+// letters or digits separated by dashes, ignoring case
+func IsValidProduceCode(code string) bool {
+	_, err := models.ParseProduceCode(code)
+	return err == nil
+}
+
+// Validate checks every field of a new or replaced produce. The error lists
+// each invalid field as models.FieldErrors and is nil when the produce is
+// valid. The stock reserved is not checked because it only changes through
+// stock operations.
+func (v *Validator) Validate(produce models.Produce) error {
+	var invalid models.FieldErrors
+	reject := func(field, reason, detail string) {
+		invalid = append(invalid, models.FieldError{Field: field, Reason: reason, Detail: detail})
+	}
+
+	if _, err := models.ParseProduceCode(produce.ProduceCode); err != nil {
+		reject("produceCode", models.ReasonInvalidCodeFormat, err.Error())
+	}
+
+	if detail := v.checkName("name", produce.Name); detail != "" {
+		reject("name", models.ReasonInvalidName, detail)
+	}
+
+	if produce.Category != "" {
+		if detail := v.checkName("category", produce.Category); detail != "" {
+			reject("category", models.ReasonInvalidCategory, detail)
+		}
+	}
+
+	if detail := v.checkUnitPrice(produce.UnitPrice); detail != "" {
+		reject("unitPrice", models.ReasonInvalidPrice, detail)
+	}
+
+	produce.Reserved = 0
+	if err := produce.ValidateStock(); err != nil {
+		reject("stock", models.ReasonInvalidStock, err.Error())
+	}
+
+	if len(invalid) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// checkName describes why a name or category is invalid, or returns an empty string when it is valid
+func (v *Validator) checkName(field, value string) string {
+	switch {
+	case strings.TrimSpace(value) == "":
+		return field + " is required"
+	case !utf8.ValidString(value):
+		return field + " must be valid UTF-8"
+	case utf8.RuneCountInString(value) > v.rules.MaxNameLength:
+		return fmt.Sprintf("%s must be at most %d characters", field, v.rules.MaxNameLength)
+	case value != strings.TrimSpace(value) || !name.MatchString(value):
+		return field + " must start with a letter or digit followed by letters, digits, spaces or the punctuation ' & . , ( ) / + -"
+	}
+	return ""
+}
+
+// checkUnitPrice describes why a unit price is invalid, or returns an empty
+// string when it is valid. A unit price without a currency is in the default currency.
+func (v *Validator) checkUnitPrice(price models.Money) string {
+	if price == (models.Money{}) {
+		price = models.NewMoney(0, models.DefaultCurrency)
+	}
+
+	if price.Sign() < 0 {
+		return "unitPrice cannot be negative"
+	}
+
+	bounds, ok := v.rules.UnitPrices[price.Currency()]
+	if !ok {
+		return fmt.Sprintf("unitPrice must be in %s got %s", strings.Join(v.rules.Currencies(), ", "), price.Currency())
+	}
+
+	if price.Cmp(bounds.Min) < 0 || price.Cmp(bounds.Max) > 0 {
+		return fmt.Sprintf("unitPrice must be from %s to %s %s", bounds.Min, bounds.Max, price.Currency())
+	}
+	return ""
+}
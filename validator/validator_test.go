@@ -0,0 +1,152 @@
+package validator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xmattstrongx/supermarket/models"
+)
+
+func TestIsValidProduceCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{code: "A12T-4GH7-QPL9-3N4M", want: true},
+		{code: "a12t-4gh7-qpl9-3n4m", want: true},
+		{code: "xxAAAA-BBBB-CCCC-DDDDxx", want: false},
+		{code: "A12T-4GH7-QPL9-3N4M\n", want: false},
+		{code: "A12T-4GH7-QPL9", want: false},
+		{code: "A12T-4GH7-QPL9-ALL!", want: false},
+		{code: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := IsValidProduceCode(tt.code); got != tt.want {
+				t.Errorf("IsValidProduceCode(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := models.Produce{
+		Name:        "Granny Smith's Apple (organic)",
+		ProduceCode: "A12T-4GH7-QPL9-3N4M",
+		UnitPrice:   models.NewMoney(346, models.USD),
+	}
+
+	tests := []struct {
+		name       string
+		change     func(*models.Produce)
+		wantFields []string
+	}{
+		{name: "valid", change: func(p *models.Produce) {}},
+		{name: "accented name", change: func(p *models.Produce) { p.Name = "Jalapeño" }},
+		{name: "no unit price", change: func(p *models.Produce) { p.UnitPrice = models.Money{} }},
+		{name: "most unit price", change: func(p *models.Produce) { p.UnitPrice = models.NewMoney(10000000, models.USD) }},
+		{name: "unanchored produce code", change: func(p *models.Produce) { p.ProduceCode = "xxA12T-4GH7-QPL9-3N4Mxx" }, wantFields: []string{"produceCode"}},
+		{name: "empty name", change: func(p *models.Produce) { p.Name = "" }, wantFields: []string{"name"}},
+		{name: "blank name", change: func(p *models.Produce) { p.Name = "   " }, wantFields: []string{"name"}},
+		{name: "long name", change: func(p *models.Produce) { p.Name = strings.Repeat("a", DefaultMaxNameLength+1) }, wantFields: []string{"name"}},
+		{name: "name with surrounding space", change: func(p *models.Produce) { p.Name = " Lettuce" }, wantFields: []string{"name"}},
+		{name: "name with control character", change: func(p *models.Produce) { p.Name = "Lettuce\x00" }, wantFields: []string{"name"}},
+		{name: "name with markup", change: func(p *models.Produce) { p.Name = "<b>Lettuce</b>" }, wantFields: []string{"name"}},
+		{name: "invalid category", change: func(p *models.Produce) { p.Category = "-fruit" }, wantFields: []string{"category"}},
+		{name: "negative unit price", change: func(p *models.Produce) { p.UnitPrice = models.NewMoney(-1, models.USD) }, wantFields: []string{"unitPrice"}},
+		{name: "huge unit price", change: func(p *models.Produce) { p.UnitPrice = models.NewMoney(10000001, models.USD) }, wantFields: []string{"unitPrice"}},
+		{name: "unit price in a currency without bounds", change: func(p *models.Produce) { p.UnitPrice = models.NewMoney(100, "EUR") }, wantFields: []string{"unitPrice"}},
+		{name: "negative on hand", change: func(p *models.Produce) { p.OnHand = models.NewQuantity(-1) }, wantFields: []string{"stock"}},
+		{
+			name: "every field",
+			change: func(p *models.Produce) {
+				*p = models.Produce{ProduceCode: "invalid", Category: "?", UnitPrice: models.NewMoney(-1, models.USD)}
+			},
+			wantFields: []string{"produceCode", "name", "category", "unitPrice"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			produce := valid
+			tt.change(&produce)
+
+			err := New(DefaultRules()).Validate(produce)
+
+			var fields []string
+			if err != nil {
+				fieldErrors, ok := err.(models.FieldErrors)
+				if !ok {
+					t.Fatalf("Validate() returned %T, want models.FieldErrors", err)
+				}
+				for _, fieldError := range fieldErrors {
+					if fieldError.Reason == "" || fieldError.Detail == "" {
+						t.Errorf("Validate() returned field error without a reason or detail %+v", fieldError)
+					}
+					fields = append(fields, fieldError.Field)
+				}
+			}
+
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("Validate() invalid fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestValidateUnitPriceByCurrency(t *testing.T) {
+	rules := DefaultRules()
+	rules.UnitPrices["EUR"] = PriceRange{Min: models.NewMoney(50, "EUR"), Max: models.NewMoney(1000, "EUR")}
+	v := New(rules)
+
+	tests := []struct {
+		price   models.Money
+		wantErr bool
+	}{
+		{price: models.NewMoney(50, "EUR")},
+		{price: models.NewMoney(1000, "EUR")},
+		{price: models.NewMoney(49, "EUR"), wantErr: true},
+		{price: models.NewMoney(1001, "EUR"), wantErr: true},
+		{price: models.NewMoney(1001, models.USD)},
+		{price: models.NewMoney(100, "GBP"), wantErr: true},
+	}
+	for _, tt := range tests {
+		produce := models.Produce{Name: "Lettuce", ProduceCode: "A12T-4GH7-QPL9-3N4M", UnitPrice: tt.price}
+		if err := v.Validate(produce); (err != nil) != tt.wantErr {
+			t.Errorf("Validate() with unit price %s %s error = %v, wantErr %v", tt.price, tt.price.Currency(), err, tt.wantErr)
+		}
+	}
+}
+
+func TestRulesCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Rules)
+		wantErr bool
+	}{
+		{name: "default", change: func(r *Rules) {}},
+		{name: "no name length", change: func(r *Rules) { r.MaxNameLength = 0 }, wantErr: true},
+		{name: "another currency", change: func(r *Rules) {
+			r.UnitPrices["EUR"] = PriceRange{Min: models.NewMoney(0, "EUR"), Max: models.NewMoney(100, "EUR")}
+		}},
+		{name: "no currency", change: func(r *Rules) { r.UnitPrices = nil }, wantErr: true},
+		{name: "bounds in another currency", change: func(r *Rules) {
+			r.UnitPrices["EUR"] = PriceRange{Min: models.NewMoney(0, "EUR"), Max: models.NewMoney(100, models.USD)}
+		}, wantErr: true},
+		{name: "negative min unit price", change: func(r *Rules) {
+			r.UnitPrices[models.USD] = PriceRange{Min: models.NewMoney(-1, models.USD), Max: models.NewMoney(100, models.USD)}
+		}, wantErr: true},
+		{name: "min above max unit price", change: func(r *Rules) {
+			r.UnitPrices[models.USD] = PriceRange{Min: models.NewMoney(101, models.USD), Max: models.NewMoney(100, models.USD)}
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultRules()
+			tt.change(&rules)
+			if err := rules.Check(); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}